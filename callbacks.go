@@ -0,0 +1,57 @@
+package libvirt
+
+/*
+#include <stdint.h>
+#include "callbacks.h"
+
+// These functions are implemented in Go and exported with "//export".
+extern void freeCallback(long);
+extern void streamEventCallback(virStreamPtr, int, long);
+extern void connectCloseCallback(virConnectPtr, int, long);
+extern void domainEventLifecycleCallback(virDomainPtr, int, int, long);
+extern void storagePoolEventLifecycleCallback(virStoragePoolPtr, int, int, long);
+
+// The callback ID is passed to libvirt as the opaque pointer, because Go
+// pointers can't be kept by C code.
+
+static void freeCallbackHelper(void *opaque) {
+    freeCallback((long)(intptr_t)opaque);
+}
+
+static void streamEventCallbackHelper(virStreamPtr st, int events, void *opaque) {
+    streamEventCallback(st, events, (long)(intptr_t)opaque);
+}
+
+int streamEventAddCallbackWrapper(virStreamPtr st, int events, long callbackID) {
+    return virStreamEventAddCallback(st, events, streamEventCallbackHelper, (void *)(intptr_t)callbackID, freeCallbackHelper);
+}
+
+static void connectCloseCallbackHelper(virConnectPtr conn, int reason, void *opaque) {
+    connectCloseCallback(conn, reason, (long)(intptr_t)opaque);
+}
+
+int connectRegisterCloseCallbackWrapper(virConnectPtr conn, long callbackID) {
+    return virConnectRegisterCloseCallback(conn, connectCloseCallbackHelper, (void *)(intptr_t)callbackID, freeCallbackHelper);
+}
+
+int connectUnregisterCloseCallbackWrapper(virConnectPtr conn) {
+    return virConnectUnregisterCloseCallback(conn, connectCloseCallbackHelper);
+}
+
+static void domainEventLifecycleCallbackHelper(virConnectPtr conn, virDomainPtr dom, int event, int detail, void *opaque) {
+    domainEventLifecycleCallback(dom, event, detail, (long)(intptr_t)opaque);
+}
+
+int domainEventLifecycleRegisterWrapper(virConnectPtr conn, virDomainPtr dom, long callbackID) {
+    return virConnectDomainEventRegisterAny(conn, dom, VIR_DOMAIN_EVENT_ID_LIFECYCLE, (virConnectDomainEventGenericCallback)domainEventLifecycleCallbackHelper, (void *)(intptr_t)callbackID, freeCallbackHelper);
+}
+
+static void storagePoolEventLifecycleCallbackHelper(virConnectPtr conn, virStoragePoolPtr pool, int event, int detail, void *opaque) {
+    storagePoolEventLifecycleCallback(pool, event, detail, (long)(intptr_t)opaque);
+}
+
+int storagePoolEventLifecycleRegisterWrapper(virConnectPtr conn, virStoragePoolPtr pool, long callbackID) {
+    return virConnectStoragePoolEventRegisterAny(conn, pool, VIR_STORAGE_POOL_EVENT_ID_LIFECYCLE, (virConnectStoragePoolEventGenericCallback)storagePoolEventLifecycleCallbackHelper, (void *)(intptr_t)callbackID, freeCallbackHelper);
+}
+*/
+import "C"
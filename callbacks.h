@@ -0,0 +1,14 @@
+#ifndef LIBVIRT_GOLANG_CALLBACKS_H
+#define LIBVIRT_GOLANG_CALLBACKS_H
+
+#include <libvirt/libvirt.h>
+
+int streamEventAddCallbackWrapper(virStreamPtr st, int events, long callbackID);
+
+int connectRegisterCloseCallbackWrapper(virConnectPtr conn, long callbackID);
+int connectUnregisterCloseCallbackWrapper(virConnectPtr conn);
+
+int domainEventLifecycleRegisterWrapper(virConnectPtr conn, virDomainPtr dom, long callbackID);
+int storagePoolEventLifecycleRegisterWrapper(virConnectPtr conn, virStoragePoolPtr pool, long callbackID);
+
+#endif /* LIBVIRT_GOLANG_CALLBACKS_H */
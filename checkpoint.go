@@ -0,0 +1,252 @@
+package libvirt
+
+// #include <stdlib.h>
+// #include <libvirt/libvirt.h>
+import "C"
+import (
+	"reflect"
+	"runtime"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// CheckpointListFlag defines a filter when listing checkpoints.
+type CheckpointListFlag uint32
+
+// Possible values for CheckpointListFlag.
+const (
+	CheckpointListAll         CheckpointListFlag = 0
+	CheckpointListRoots       CheckpointListFlag = C.VIR_DOMAIN_CHECKPOINT_LIST_ROOTS
+	CheckpointListDescendants CheckpointListFlag = C.VIR_DOMAIN_CHECKPOINT_LIST_DESCENDANTS
+	CheckpointListTopological CheckpointListFlag = C.VIR_DOMAIN_CHECKPOINT_LIST_TOPOLOGICAL
+	CheckpointListLeaves      CheckpointListFlag = C.VIR_DOMAIN_CHECKPOINT_LIST_LEAVES
+	CheckpointListNoLeaves    CheckpointListFlag = C.VIR_DOMAIN_CHECKPOINT_LIST_NO_LEAVES
+)
+
+// CheckpointCreateFlag defines how a checkpoint should be created.
+type CheckpointCreateFlag uint32
+
+// Possible values for CheckpointCreateFlag.
+const (
+	CheckpointCreateDefault  CheckpointCreateFlag = 0
+	CheckpointCreateRedefine CheckpointCreateFlag = C.VIR_DOMAIN_CHECKPOINT_CREATE_REDEFINE
+	CheckpointCreateQuiesce  CheckpointCreateFlag = C.VIR_DOMAIN_CHECKPOINT_CREATE_QUIESCE
+)
+
+// CheckpointDeleteFlag defines how a checkpoint should be deleted.
+type CheckpointDeleteFlag uint32
+
+// Possible values for CheckpointDeleteFlag.
+const (
+	CheckpointDeleteDefault      CheckpointDeleteFlag = 0
+	CheckpointDeleteChildren     CheckpointDeleteFlag = C.VIR_DOMAIN_CHECKPOINT_DELETE_CHILDREN
+	CheckpointDeleteMetadataOnly CheckpointDeleteFlag = C.VIR_DOMAIN_CHECKPOINT_DELETE_METADATA_ONLY
+	CheckpointDeleteChildrenOnly CheckpointDeleteFlag = C.VIR_DOMAIN_CHECKPOINT_DELETE_CHILDREN_ONLY
+)
+
+// CheckpointXMLFlag defines how the XML content should be read from
+// a checkpoint.
+type CheckpointXMLFlag uint32
+
+// Possible values for CheckpointXMLFlag.
+const (
+	CheckpointXMLDefault  CheckpointXMLFlag = 0
+	CheckpointXMLSecure   CheckpointXMLFlag = C.VIR_DOMAIN_CHECKPOINT_XML_SECURE
+	CheckpointXMLNoDomain CheckpointXMLFlag = C.VIR_DOMAIN_CHECKPOINT_XML_NO_DOMAIN
+	CheckpointXMLSize     CheckpointXMLFlag = C.VIR_DOMAIN_CHECKPOINT_XML_SIZE
+)
+
+// Checkpoint holds a libvirt domain checkpoint. There are no exported fields.
+type Checkpoint struct {
+	log           *logger
+	virCheckpoint C.virDomainCheckpointPtr
+	handle        *handle
+}
+
+// Free frees the domain checkpoint object. The checkpoint itself is not
+// modified. The data structure is freed and should not be used thereafter.
+func (cp Checkpoint) Free() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("freeing checkpoint object")
+	cRet := C.virDomainCheckpointFree(cp.virCheckpoint)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	cp.handle.release()
+	op.done("checkpoint freed")
+
+	return nil
+}
+
+// Delete removes the checkpoint from the domain. The dirty bitmaps tracked by
+// the checkpoint are merged into its parent, if any.
+// If "flags" includes CheckpointDeleteChildren, then any descendant
+// checkpoints are also deleted; with CheckpointDeleteChildrenOnly, only the
+// descendants are deleted and the checkpoint itself is kept. If "flags"
+// includes CheckpointDeleteMetadataOnly, then only the libvirt metadata is
+// removed, and the hypervisor data is left untouched.
+func (cp Checkpoint) Delete(flags CheckpointDeleteFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("deleting checkpoint", "flags", flags)
+	cRet := C.virDomainCheckpointDelete(cp.virCheckpoint, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("checkpoint deleted")
+
+	return nil
+}
+
+// Name gets the public name for that checkpoint.
+func (cp Checkpoint) Name() (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("reading checkpoint name")
+	cName := C.virDomainCheckpointGetName(cp.virCheckpoint)
+
+	if cName == nil {
+		err := lastError()
+		op.failed(err)
+		return "", err
+	}
+
+	name := C.GoString(cName)
+	op.done("checkpoint name read", "name", name)
+
+	return name, nil
+}
+
+// Parent gets the parent checkpoint for "cp", if any.
+func (cp Checkpoint) Parent() (Checkpoint, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("reading checkpoint parent")
+	cParent := C.virDomainCheckpointGetParent(cp.virCheckpoint, 0)
+	if cParent == nil {
+		err := lastError()
+		op.failed(err)
+		return Checkpoint{}, err
+	}
+
+	parent := Checkpoint{
+		log:           cp.log.checkpoint(cParent),
+		virCheckpoint: cParent,
+		handle:        cp.handle.track(kindCheckpoint, unsafe.Pointer(cParent)),
+	}
+
+	op.done("parent obtained")
+
+	return parent, nil
+}
+
+// XML provides an XML description of the domain checkpoint.
+// If "flags" includes CheckpointXMLSecure, security sensitive information is
+// included; CheckpointXMLNoDomain omits the <domain> element, and
+// CheckpointXMLSize includes the current size of each disk's dirty bitmap.
+func (cp Checkpoint) XML(flags CheckpointXMLFlag) (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("reading checkpoint XML", "flags", flags)
+	cXML := C.virDomainCheckpointGetXMLDesc(cp.virCheckpoint, C.uint(flags))
+	if cXML == nil {
+		err := lastError()
+		op.failed(err)
+		return "", err
+	}
+	defer C.free(unsafe.Pointer(cXML))
+
+	xml := C.GoString(cXML)
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
+
+	return xml, nil
+}
+
+// Ref increments the reference count on the checkpoint. For each additional
+// call to this method, there shall be a corresponding call to
+// "<Checkpoint>.Free" to release the reference count, once the caller no
+// longer needs the reference to this object.
+func (cp Checkpoint) Ref() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	op := cp.log.begin("incrementing checkpoint's reference count")
+	cRet := C.virDomainCheckpointRef(cp.virCheckpoint)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	cp.handle.ref()
+	op.done("reference count incremented")
+
+	return nil
+}
+
+// ListChildren collects the list of domain checkpoints that are children of
+// the given checkpoint, and allocate an array to store those objects.
+// By default, this command covers only direct children; it is also possible
+// to expand things to cover all descendants, when "flags" includes
+// CheckpointListDescendants. The other filters work the same way as in
+// "<Domain>.ListCheckpoints".
+func (cp Checkpoint) ListChildren(flags CheckpointListFlag) ([]Checkpoint, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(cp.handle)
+
+	var cCheckpoints []C.virDomainCheckpointPtr
+	checkpointsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cCheckpoints))
+
+	op := cp.log.begin("reading checkpoint children", "flags", flags)
+	cRet := C.virDomainCheckpointListAllChildren(cp.virCheckpoint, (**C.virDomainCheckpointPtr)(unsafe.Pointer(&checkpointsSH.Data)), C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return nil, err
+	}
+	defer C.free(unsafe.Pointer(checkpointsSH.Data))
+
+	checkpointsSH.Cap = int(ret)
+	checkpointsSH.Len = int(ret)
+
+	checkpoints := make([]Checkpoint, ret)
+
+	for i := range checkpoints {
+		checkpoints[i] = Checkpoint{
+			log:           cp.log.checkpoint(cCheckpoints[i]),
+			virCheckpoint: cCheckpoints[i],
+			handle:        cp.handle.track(kindCheckpoint, unsafe.Pointer(cCheckpoints[i])),
+		}
+	}
+
+	op.done("checkpoints read", "count", ret)
+
+	return checkpoints, nil
+}
@@ -0,0 +1,102 @@
+package libvirt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckpointInit(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	name, err := env.cp.Name()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if name != env.cpData.Name {
+		t.Errorf("unexpected checkpoint name; got=%v, want=%v", name, env.cpData.Name)
+	}
+
+	_, err = env.cp.Parent()
+	if err == nil {
+		t.Error("an error was not returned when querying the parent checkpoint of a root checkpoint")
+	} else {
+		virtErr := err.(*Error)
+		if virtErr.Code != ErrNoDomainCheckpoint {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCheckpointXML(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	if _, err := env.cp.XML(CheckpointXMLFlag(99)); err == nil {
+		t.Error("an error was not returned when using an invalid flag")
+	}
+
+	xml, err := env.cp.XML(CheckpointXMLNoDomain)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(xml) == 0 {
+		t.Error("empty checkpoint XML")
+	}
+}
+
+func TestCheckpointRef(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	if err := env.cp.Ref(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.cp.Free(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckpointListChildren(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	var xml bytes.Buffer
+	data := newTestCheckpointData()
+
+	if err := testCheckpointTmpl.Execute(&xml, data); err != nil {
+		t.Fatal(err)
+	}
+
+	childCp, err := env.dom.CreateCheckpoint(xml.String(), CheckpointCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer childCp.Free()
+	defer childCp.Delete(CheckpointDeleteDefault)
+
+	checkpoints, err := env.cp.ListChildren(CheckpointListDescendants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cp := range checkpoints {
+		defer cp.Free()
+	}
+
+	if l := len(checkpoints); l != 1 {
+		t.Fatalf("unexpected checkpoint children count; got=%v, want=1", l)
+	}
+
+	childName, err := checkpoints[0].Name()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if childName != data.Name {
+		t.Errorf("unexpected checkpoint child name; got=%v, want=%v", childName, data.Name)
+	}
+}
@@ -5,6 +5,7 @@ package libvirt
 #include <stdlib.h>
 #include <libvirt/libvirt.h>
 #include <libvirt/virterror.h>
+#include "callbacks.h"
 
 void emptyErrorFunc(void *userData, virErrorPtr error) {
     // do nothing
@@ -15,16 +16,19 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"reflect"
+	"runtime"
+	"time"
 	"unicode/utf8"
 	"unsafe"
 )
 
 // Connection holds a libvirt connection. There are no exported fields.
 type Connection struct {
-	log        *log.Logger
+	log        *logger
 	virConnect C.virConnectPtr
+	objects    *tracker
 }
 
 // ConnectionMode is the type of connection to the libvirt hypervisor.
@@ -36,11 +40,31 @@ const (
 	ReadOnly
 )
 
+// CloseReason is the reason why a connection was closed.
+type CloseReason int32
+
+// Possible values for CloseReason.
+const (
+	CloseReasonError     CloseReason = C.VIR_CONNECT_CLOSE_REASON_ERROR
+	CloseReasonEOF       CloseReason = C.VIR_CONNECT_CLOSE_REASON_EOF
+	CloseReasonKeepAlive CloseReason = C.VIR_CONNECT_CLOSE_REASON_KEEPALIVE
+	CloseReasonClient    CloseReason = C.VIR_CONNECT_CLOSE_REASON_CLIENT
+)
+
+// CloseCallback is called when the connection is closed, either because the
+// hypervisor couldn't be reached anymore or because it was closed by the
+// client.
+type CloseCallback func(reason CloseReason)
+
 // DefaultURI is the URI chosen by libvirt to establish a default
 // connection, based on the current environment.
 // Check http://libvirt.org/uri.html for more details.
 const DefaultURI = ""
 
+// ErrKeepAliveNotSupported is returned by "<Connection>.SetKeepAlive" when
+// the other side of the connection doesn't support keepalive messages.
+var ErrKeepAliveNotSupported = errors.New("keepalive is not supported by the libvirt connection")
+
 // ErrInvalidConnectionMode is returned by "Open" when a value other than
 // "ReadOnly" or "ReadWrite" is used.
 var ErrInvalidConnectionMode = errors.New("invalid libvirt connection mode")
@@ -51,48 +75,88 @@ func init() {
 	C.virSetErrorFunc(nil, C.virErrorFunc(unsafe.Pointer(C.emptyErrorFunc)))
 }
 
-// newLogger creates a logger object to be used across a libvirt
-// connection. It prints the messages to the default error output.
-func newLogger(output io.Writer) *log.Logger {
-	return log.New(output, "libvirt-golang: ", log.LstdFlags)
+// OpenOptions holds the settings used by OpenWithOptions. The zero value
+// opens a read-write connection which doesn't log anything.
+type OpenOptions struct {
+	// Mode specifies whether the connection will be read-write or
+	// read-only.
+	Mode ConnectionMode
+	// Logger receives the structured records of the connection and of all
+	// the objects created from it. Every record includes the connection
+	// URI; the records of other objects also include their type and
+	// identity (e.g. name and UUID), and the records of each call include
+	// its flags and duration, and the libvirt error code if it failed. No
+	// record is emitted if Logger is nil.
+	Logger *slog.Logger
+	// Level is the minimum level of the records emitted, in addition to
+	// the level enabled by the handler of Logger. Each call is logged at
+	// slog.LevelDebug, opening and closing the connection is logged at
+	// slog.LevelInfo and errors are logged at slog.LevelError.
+	Level slog.Leveler
+	// AutoFree makes the objects created from the connection (e.g. the
+	// domains returned by ListDomains) be freed automatically once they
+	// become unreachable, instead of leaking if Free isn't called. Calling
+	// Free explicitly is still allowed, and recommended for the objects
+	// which are no longer needed, because the garbage collector may take a
+	// long time to run. The objects are never freed automatically in builds
+	// with the "libvirt_leakcheck" tag, where the ones not freed before the
+	// connection is closed are reported with ReportLeak.
+	AutoFree bool
 }
 
 // Open creates a new libvirt connection to the Hypervisor. The
 // connection mode specifies whether the connection will be read-write
 // or read-only. The URIs are documented at http://libvirt.org/uri.html.
+// The log records are written as text to "logOutput"; use OpenWithOptions
+// to log through a custom *slog.Logger.
 func Open(uri string, mode ConnectionMode, logOutput io.Writer) (Connection, error) {
+	return OpenWithOptions(uri, OpenOptions{
+		Mode:   mode,
+		Logger: newLogger(logOutput),
+	})
+}
+
+// OpenWithOptions creates a new libvirt connection to the Hypervisor, as
+// Open, with the settings described by "opts".
+func OpenWithOptions(uri string, opts OpenOptions) (Connection, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if opts.Mode != ReadWrite && opts.Mode != ReadOnly {
+		return Connection{}, ErrInvalidConnectionMode
+	}
+
 	cUri := C.CString(uri)
 	defer C.free(unsafe.Pointer(cUri))
 
-	logger := newLogger(logOutput)
+	logger := newConnectionLogger(opts.Logger, opts.Level, uri)
 
+	var op operation
 	if uri == DefaultURI {
-		logger.Printf("opening connection (mode = %v) to the default URI...\n", mode)
+		op = logger.begin("opening connection to the default URI", "mode", opts.Mode)
 	} else {
-		logger.Printf("opening connection (mode = %v) to %v...\n", mode, uri)
+		op = logger.begin("opening connection", "mode", opts.Mode)
 	}
 
 	var cConn C.virConnectPtr
-	switch mode {
-	case ReadWrite:
-		cConn = C.virConnectOpen(cUri)
-	case ReadOnly:
+	if opts.Mode == ReadOnly {
 		cConn = C.virConnectOpenReadOnly(cUri)
-	default:
-		return Connection{}, ErrInvalidConnectionMode
+	} else {
+		cConn = C.virConnectOpen(cUri)
 	}
 
 	if cConn == nil {
-		err := LastError()
-		logger.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Connection{}, err
 	}
 
-	logger.Println("connection established")
+	op.lifecycle("connection established")
 
 	conn := Connection{
 		log:        logger,
 		virConnect: cConn,
+		objects:    newTracker(opts.AutoFree),
 	}
 
 	return conn, nil
@@ -119,36 +183,43 @@ func OpenDefault() (Connection, error) {
 // connection, but the application should not try to further use a connection
 // after the Close that matches the initial open.
 func (conn Connection) Close() (int32, error) {
-	conn.log.Println("closing connection...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("closing connection")
 	cRet := C.virConnectClose(conn.virConnect)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	conn.log.Printf("connection closed; remaining references: %v\n", ret)
+	conn.objects.close()
+	op.lifecycle("connection closed", "references", ret)
 
 	return ret, nil
 }
 
 // Version gets the version level of the Hypervisor running.
 func (conn Connection) Version() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var cVersion C.ulong
-	conn.log.Println("reading hypervisor version...")
+	op := conn.log.begin("reading hypervisor version")
 	cRet := C.virConnectGetVersion(conn.virConnect, &cVersion)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	version := uint64(cVersion)
-	conn.log.Printf("hypervisor version: %v\n", version)
+	op.done("hypervisor version read", "version", version)
 
 	return version, nil
 }
@@ -156,19 +227,22 @@ func (conn Connection) Version() (uint64, error) {
 // LibVersion provides the version of libvirt used by the daemon running on
 // the host.
 func (conn Connection) LibVersion() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var cVersion C.ulong
-	conn.log.Println("reading libvirt version...")
+	op := conn.log.begin("reading libvirt version")
 	cRet := C.virConnectGetLibVersion(conn.virConnect, &cVersion)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	version := uint64(cVersion)
-	conn.log.Printf("libvirt version: %v\n", version)
+	op.done("libvirt version read", "version", version)
 
 	return version, nil
 }
@@ -177,47 +251,141 @@ func (conn Connection) LibVersion() (uint64, error) {
 // If an error occurs, the function will also return "false" and the error
 // message will be written to the log.
 func (conn Connection) IsAlive() (bool, error) {
-	conn.log.Println("checking whether connection is alive...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("checking whether connection is alive")
 	cRet := C.virConnectIsAlive(conn.virConnect)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	alive := (ret == 1)
 
 	if alive {
-		conn.log.Println("connection is alive")
+		op.done("connection is alive")
 	} else {
-		conn.log.Println("connection is not alive")
+		op.done("connection is not alive")
 	}
 
 	return alive, nil
 }
 
+// SetKeepAlive starts sending keepalive messages to the other side of the
+// connection every "interval" (rounded down to seconds, but never below one
+// second), and closes the connection, with CloseReasonKeepAlive, if "count"
+// messages are sent in a row without any response. A non-positive interval
+// disables keepalive messages. It's only supported by remote connections, and the messages are
+// sent by the event loop, so an event implementation must have been
+// registered (e.g. with EventRegisterDefaultImpl) and must be running.
+func (conn Connection) SetKeepAlive(interval time.Duration, count uint32) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	seconds := int32(interval / time.Second)
+	if interval <= 0 {
+		seconds = -1
+	} else if seconds == 0 {
+		// libvirt would take 0 as "disabled"
+		seconds = 1
+	}
+
+	op := conn.log.begin("setting connection keepalive", "interval", interval, "count", count)
+	cRet := C.virConnectSetKeepAlive(conn.virConnect, C.int(seconds), C.uint(count))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	if ret == 1 {
+		op.failed(ErrKeepAliveNotSupported)
+		return ErrKeepAliveNotSupported
+	}
+
+	op.done("keepalive set")
+
+	return nil
+}
+
+// RegisterCloseCallback registers a callback to be notified when the
+// connection is closed, e.g. when the remote daemon drops it or stops
+// answering keepalive messages (see SetKeepAlive). Only one callback can be
+// registered for each connection. The callback is called from the event loop,
+// so an event implementation must have been registered (e.g. with
+// EventRegisterDefaultImpl) and must be running.
+func (conn Connection) RegisterCloseCallback(callback CloseCallback) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	callbackID := registerCallback(callback)
+
+	op := conn.log.begin("registering connection close callback")
+	cRet := C.connectRegisterCloseCallbackWrapper(conn.virConnect, C.long(callbackID))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		unregisterCallback(callbackID)
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("close callback registered")
+
+	return nil
+}
+
+// UnregisterCloseCallback removes the callback previously registered with
+// RegisterCloseCallback.
+func (conn Connection) UnregisterCloseCallback() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("unregistering connection close callback")
+	cRet := C.connectUnregisterCloseCallbackWrapper(conn.virConnect)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("close callback unregistered")
+
+	return nil
+}
+
 // IsEncrypted determines if the connection to the hypervisor is encrypted.
 // If an error occurs, the function will also return "false" and the error
 // message will be written to the log.
 func (conn Connection) IsEncrypted() (bool, error) {
-	conn.log.Println("checking whether connection is encrypted...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("checking whether connection is encrypted")
 	cRet := C.virConnectIsEncrypted(conn.virConnect)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	encrypted := (ret == 1)
 
 	if encrypted {
-		conn.log.Println("connection is encrypted")
+		op.done("connection is encrypted")
 	} else {
-		conn.log.Println("connection is not encrypted")
+		op.done("connection is not encrypted")
 	}
 
 	return encrypted, nil
@@ -227,22 +395,25 @@ func (conn Connection) IsEncrypted() (bool, error) {
 // If an error occurs, the function will also return "false" and the error
 // message will be written to the log.
 func (conn Connection) IsSecure() (bool, error) {
-	conn.log.Println("checking whether connection is secure...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("checking whether connection is secure")
 	cRet := C.virConnectIsSecure(conn.virConnect)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	secure := (ret == 1)
 
 	if secure {
-		conn.log.Println("connection is secure")
+		op.done("connection is secure")
 	} else {
-		conn.log.Println("connection is not secure")
+		op.done("connection is not secure")
 	}
 
 	return secure, nil
@@ -250,17 +421,20 @@ func (conn Connection) IsSecure() (bool, error) {
 
 // Capabilities provides capabilities of the hypervisor/driver.
 func (conn Connection) Capabilities() (string, error) {
-	conn.log.Println("reading connection capabilities...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("reading connection capabilities")
 	cCap := C.virConnectGetCapabilities(conn.virConnect)
 	if cCap == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cCap))
 
 	cap := C.GoString(cCap)
-	conn.log.Printf("capabilities XML length: %v runes\n", utf8.RuneCountInString(cap))
+	op.done("capabilities XML read", "runes", utf8.RuneCountInString(cap))
 
 	return cap, nil
 }
@@ -270,17 +444,20 @@ func (conn Connection) Capabilities() (string, error) {
 // to a fully-qualified domain name via getaddrinfo). If we are connected to a
 // remote system, then this returns the hostname of the remote system.
 func (conn Connection) Hostname() (string, error) {
-	conn.log.Println("reading system hostname...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("reading system hostname")
 	cHostname := C.virConnectGetHostname(conn.virConnect)
 	if cHostname == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cHostname))
 
 	hostname := C.GoString(cHostname)
-	conn.log.Printf("system hostname: %v\n", hostname)
+	op.done("system hostname read", "hostname", hostname)
 
 	return hostname, nil
 }
@@ -290,17 +467,20 @@ func (conn Connection) Hostname() (string, error) {
 // of a domain XML. This information is generally available only for
 // hypervisors running with root privileges.
 func (conn Connection) Sysinfo() (string, error) {
-	conn.log.Println("reading system info...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("reading system info")
 	cSysinfo := C.virConnectGetSysinfo(conn.virConnect, 0)
 	if cSysinfo == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cSysinfo))
 
 	sysinfo := C.GoString(cSysinfo)
-	conn.log.Printf("system info XML length: %v runes\n", utf8.RuneCountInString(sysinfo))
+	op.done("system info XML read", "runes", utf8.RuneCountInString(sysinfo))
 	return sysinfo, nil
 }
 
@@ -310,16 +490,19 @@ func (conn Connection) Sysinfo() (string, error) {
 // acceleration is present. For more details about the hypervisor, use
 // Capabilities.
 func (conn Connection) Type() (string, error) {
-	conn.log.Println("reading hypervisor driver name...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("reading hypervisor driver name")
 	cType := C.virConnectGetType(conn.virConnect)
 	if cType == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	typ := C.GoString(cType)
-	conn.log.Printf("hypervisor driver name: %v\n", typ)
+	op.done("hypervisor driver name read", "name", typ)
 
 	return typ, nil
 }
@@ -330,17 +513,20 @@ func (conn Connection) Type() (string, error) {
 // then the driver will return a non-NULL URI which can be used to connect tos
 // the same hypervisor later.
 func (conn Connection) URI() (string, error) {
-	conn.log.Println("reading connection URI...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("reading connection URI")
 	cURI := C.virConnectGetURI(conn.virConnect)
 	if cURI == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cURI))
 
 	uri := C.GoString(cURI)
-	conn.log.Printf("connection URI: %v\n", uri)
+	op.done("connection URI read", "uri", uri)
 	return uri, nil
 }
 
@@ -349,16 +535,20 @@ func (conn Connection) URI() (string, error) {
 // the reference count, once the caller no longer needs the reference to
 // this object.
 func (conn Connection) Ref() error {
-	conn.log.Println("incrementing connection's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("incrementing connection's reference count")
 	cRet := C.virConnectRef(conn.virConnect)
 	ret := int32(cRet)
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	conn.log.Println("reference count incremented")
+	conn.objects.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
@@ -366,19 +556,22 @@ func (conn Connection) Ref() error {
 // CPUModelNames gets the list of supported CPU models for a
 // specific architecture.
 func (conn Connection) CPUModelNames(arch string) ([]string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cArch := C.CString(arch)
 	defer C.free(unsafe.Pointer(cArch))
 
 	var cModels []*C.char
 	modelsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cModels))
 
-	conn.log.Printf("querying supported CPU models for %v...\n", arch)
+	op := conn.log.begin("querying supported CPU models", "arch", arch)
 	cRet := C.virConnectGetCPUModelNames(conn.virConnect, cArch, (***C.char)(unsafe.Pointer(&modelsSH.Data)), 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(modelsSH.Data))
@@ -392,7 +585,7 @@ func (conn Connection) CPUModelNames(arch string) ([]string, error) {
 		defer C.free(unsafe.Pointer(cModels[i]))
 	}
 
-	conn.log.Printf("CPU models count: %v\n", ret)
+	op.done("CPU models read", "count", ret)
 
 	return models, nil
 }
@@ -401,20 +594,23 @@ func (conn Connection) CPUModelNames(arch string) ([]string, error) {
 // VM of a specific type. The 'type' parameter here corresponds to the 'type'
 // attribute in the <domain> element of the XML
 func (conn Connection) MaxVCPUs(typ string) (int32, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cTyp := C.CString(typ)
 	defer C.free(unsafe.Pointer(cTyp))
 
-	conn.log.Printf("querying maximum VCPUs count for %v...\n", typ)
+	op := conn.log.begin("querying maximum VCPUs count", "type", typ)
 	cRet := C.virConnectGetMaxVcpus(conn.virConnect, cTyp)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	conn.log.Printf("max VCPUs count: %v\n", ret)
+	op.done("max VCPUs read", "count", ret)
 
 	return ret, nil
 }
@@ -422,16 +618,19 @@ func (conn Connection) MaxVCPUs(typ string) (int32, error) {
 // ListDomains collects a possibly-filtered list of all domains, and return an
 // array of information for each.
 func (conn Connection) ListDomains(flags DomainListFlag) ([]Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var cDomains []C.virDomainPtr
 	domainsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cDomains))
 
-	conn.log.Printf("reading domains (flags = %v)...\n", flags)
+	op := conn.log.begin("reading domains", "flags", flags)
 	cRet := C.virConnectListAllDomains(conn.virConnect, (**C.virDomainPtr)(unsafe.Pointer(&domainsSH.Data)), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(domainsSH.Data))
@@ -442,12 +641,13 @@ func (conn Connection) ListDomains(flags DomainListFlag) ([]Domain, error) {
 	domains := make([]Domain, ret)
 	for i := range domains {
 		domains[i] = Domain{
-			log:       conn.log,
+			log:       conn.log.domain(cDomains[i]),
 			virDomain: cDomains[i],
+			handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomains[i])),
 		}
 	}
 
-	conn.log.Printf("domains count: %v\n", ret)
+	op.done("domains read", "count", ret)
 
 	return domains, nil
 }
@@ -458,22 +658,26 @@ func (conn Connection) ListDomains(flags DomainListFlag) ([]Domain, error) {
 // definition will disappear when it is destroyed, or if the host is restarted
 // (see Domain.Define() to define persistent domains).
 func (conn Connection) CreateDomain(xml string, flags DomainCreateFlag) (Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	conn.log.Printf("creating domain (flags = %v)...\n", flags)
+	op := conn.log.begin("creating domain", "flags", flags)
 	cDomain := C.virDomainCreateXML(conn.virConnect, cXML, C.uint(flags))
 	if cDomain == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Domain{}, err
 	}
 
-	conn.log.Println("domain created")
+	op.done("domain created")
 
 	dom := Domain{
-		log:       conn.log,
+		log:       conn.log.domain(cDomain),
 		virDomain: cDomain,
+		handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomain)),
 	}
 
 	return dom, nil
@@ -483,22 +687,26 @@ func (conn Connection) CreateDomain(xml string, flags DomainCreateFlag) (Domain,
 // persistent, until explicitly undefined with Domain.Undefine(). A previous
 // definition for this domain would be overridden if it already exists.
 func (conn Connection) DefineDomain(xml string) (Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	conn.log.Println("defining domain...")
+	op := conn.log.begin("defining domain")
 	cDomain := C.virDomainDefineXML(conn.virConnect, cXML)
 	if cDomain == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Domain{}, err
 	}
 
-	conn.log.Println("domain defined")
+	op.done("domain defined")
 
 	dom := Domain{
-		log:       conn.log,
+		log:       conn.log.domain(cDomain),
 		virDomain: cDomain,
+		handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomain)),
 	}
 
 	return dom, nil
@@ -508,19 +716,23 @@ func (conn Connection) DefineDomain(xml string) (Domain, error) {
 // Note that this won't work for inactive domains which have an ID of -1, in
 // that case a lookup based on the Name or UUID need to be done instead.
 func (conn Connection) LookupDomainByID(id uint32) (Domain, error) {
-	conn.log.Printf("looking up domain with ID = %v...\n", id)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("looking up domain by ID", "id", id)
 	cDomain := C.virDomainLookupByID(conn.virConnect, C.int(id))
 	if cDomain == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Domain{}, err
 	}
 
-	conn.log.Println("domain found")
+	op.done("domain found")
 
 	dom := Domain{
-		log:       conn.log,
+		log:       conn.log.domain(cDomain),
 		virDomain: cDomain,
+		handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomain)),
 	}
 
 	return dom, nil
@@ -529,22 +741,26 @@ func (conn Connection) LookupDomainByID(id uint32) (Domain, error) {
 // LookupDomainByName tries to lookup a domain on the given hypervisor based on
 // its name.
 func (conn Connection) LookupDomainByName(name string) (Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
 
-	conn.log.Printf("looking up domain with name = %v...\n", name)
+	op := conn.log.begin("looking up domain by name", "name", name)
 	cDomain := C.virDomainLookupByName(conn.virConnect, cName)
 	if cDomain == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Domain{}, err
 	}
 
-	conn.log.Println("domain found")
+	op.done("domain found")
 
 	dom := Domain{
-		log:       conn.log,
+		log:       conn.log.domain(cDomain),
 		virDomain: cDomain,
+		handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomain)),
 	}
 
 	return dom, nil
@@ -553,22 +769,26 @@ func (conn Connection) LookupDomainByName(name string) (Domain, error) {
 // LookupDomainByUUID tries to lookup a domain on the given hypervisor based on
 // its UUID.
 func (conn Connection) LookupDomainByUUID(uuid string) (Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cUUID := C.CString(uuid)
 	defer C.free(unsafe.Pointer(cUUID))
 
-	conn.log.Printf("looking up domain with UUID = %v...\n", uuid)
+	op := conn.log.begin("looking up domain by UUID", "uuid", uuid)
 	cDomain := C.virDomainLookupByUUIDString(conn.virConnect, cUUID)
 	if cDomain == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Domain{}, err
 	}
 
-	conn.log.Println("domain found")
+	op.done("domain found")
 
 	dom := Domain{
-		log:       conn.log,
+		log:       conn.log.domain(cDomain),
 		virDomain: cDomain,
+		handle:    conn.objects.track(kindDomain, unsafe.Pointer(cDomain)),
 	}
 
 	return dom, nil
@@ -576,6 +796,9 @@ func (conn Connection) LookupDomainByUUID(uuid string) (Domain, error) {
 
 // RestoreDomain restores a domain saved to disk by Save().
 func (conn Connection) RestoreDomain(from string, xml string, flags DomainSaveFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cFrom := C.CString(from)
 	defer C.free(unsafe.Pointer(cFrom))
 
@@ -587,17 +810,17 @@ func (conn Connection) RestoreDomain(from string, xml string, flags DomainSaveFl
 		cXML = nil
 	}
 
-	conn.log.Printf("restoring domain from file %v (flags = %v)...\n", from, flags)
+	op := conn.log.begin("restoring domain", "file", from, "flags", flags)
 	cRet := C.virDomainRestoreFlags(conn.virConnect, cFrom, cXML, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	conn.log.Println("domain restored")
+	op.done("domain restored")
 
 	return nil
 }
@@ -616,16 +839,19 @@ func (conn Connection) RestoreDomain(from string, xml string, flags DomainSaveFl
 // libvirt nor to any other node. Flag SecListNoPrivate selects
 // non-private secrets.
 func (conn Connection) ListSecrets(flags SecretListFlag) ([]Secret, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var cSecrets []C.virSecretPtr
 	secretsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cSecrets))
 
-	conn.log.Printf("reading secrets (flags = %v)...\n", flags)
+	op := conn.log.begin("reading secrets", "flags", flags)
 	cRet := C.virConnectListAllSecrets(conn.virConnect, (**C.virSecretPtr)(unsafe.Pointer(&secretsSH.Data)), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(secretsSH.Data))
@@ -636,12 +862,13 @@ func (conn Connection) ListSecrets(flags SecretListFlag) ([]Secret, error) {
 	secrets := make([]Secret, ret)
 	for i := range secrets {
 		secrets[i] = Secret{
-			log:       conn.log,
+			log:       conn.log.secret(cSecrets[i]),
 			virSecret: cSecrets[i],
+			handle:    conn.objects.track(kindSecret, unsafe.Pointer(cSecrets[i])),
 		}
 	}
 
-	conn.log.Printf("secrets count: %v\n", ret)
+	op.done("secrets read", "count", ret)
 
 	return secrets, nil
 }
@@ -654,23 +881,27 @@ func (conn Connection) ListSecrets(flags SecretListFlag) ([]Secret, error) {
 // "Free" should be used to free the resources after the secret object is no
 // longer needed.
 func (conn Connection) DefineSecret(xml string) (Secret, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	conn.log.Println("defining secret...")
+	op := conn.log.begin("defining secret")
 	cSec := C.virSecretDefineXML(conn.virConnect, cXML, 0)
 
 	if cSec == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Secret{}, err
 	}
 
-	conn.log.Println("secret defined")
+	op.done("secret defined")
 
 	sec := Secret{
-		log:       conn.log,
+		log:       conn.log.secret(cSec),
 		virSecret: cSec,
+		handle:    conn.objects.track(kindSecret, unsafe.Pointer(cSec)),
 	}
 
 	return sec, nil
@@ -681,19 +912,23 @@ func (conn Connection) DefineSecret(xml string) (Secret, error) {
 // "Free" should be used to free the resources after the secret object is no
 // longer needed.
 func (conn Connection) LookupSecretByUUID(uuid string) (Secret, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cUUID := C.CString(uuid)
 	defer C.free(unsafe.Pointer(cUUID))
 
 	cSecret := C.virSecretLookupByUUIDString(conn.virConnect, cUUID)
 
 	if cSecret == nil {
-		err := LastError()
+		err := lastError()
 		return Secret{}, err
 	}
 
 	secret := Secret{
-		log:       conn.log,
+		log:       conn.log.secret(cSecret),
 		virSecret: cSecret,
+		handle:    conn.objects.track(kindSecret, unsafe.Pointer(cSecret)),
 	}
 
 	return secret, nil
@@ -705,6 +940,9 @@ func (conn Connection) LookupSecretByUUID(uuid string) (Secret, error) {
 // "Free" should be used to free the resources after the secret object is no
 // longer needed.
 func (conn Connection) LookupSecretByUsage(usageType SecretUsageType, usageID string) (Secret, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cUsageType := C.int(usageType)
 	cUsageID := C.CString(usageID)
 	defer C.free(unsafe.Pointer(cUsageID))
@@ -712,13 +950,14 @@ func (conn Connection) LookupSecretByUsage(usageType SecretUsageType, usageID st
 	cSecret := C.virSecretLookupByUsage(conn.virConnect, cUsageType, cUsageID)
 
 	if cSecret == nil {
-		err := LastError()
+		err := lastError()
 		return Secret{}, err
 	}
 
 	secret := Secret{
-		log:       conn.log,
+		log:       conn.log.secret(cSecret),
 		virSecret: cSecret,
+		handle:    conn.objects.track(kindSecret, unsafe.Pointer(cSecret)),
 	}
 
 	return secret, nil
@@ -733,24 +972,27 @@ func (conn Connection) LookupSecretByUsage(usageType SecretUsageType, usageID st
 // "source" is not required for some types (e.g., those querying local storage
 // resources only)
 func (conn Connection) FindStoragePoolSources(typ string, source string) (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cType := C.CString(typ)
 	defer C.free(unsafe.Pointer(cType))
 
 	cSource := C.CString(source)
 	defer C.free(unsafe.Pointer(cSource))
 
-	conn.log.Printf("finding storage pool sources (type = %v)...\n", typ)
+	op := conn.log.begin("finding storage pool sources", "type", typ)
 	cSources := C.virConnectFindStoragePoolSources(conn.virConnect, cType, cSource, 0)
 
 	if cSources == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cSources))
 
 	sources := C.GoString(cSources)
-	conn.log.Printf("sources XML length: %v runes\n", utf8.RuneCountInString(sources))
+	op.done("sources XML read", "runes", utf8.RuneCountInString(sources))
 
 	return sources, nil
 }
@@ -774,16 +1016,19 @@ func (conn Connection) FindStoragePoolSources(typ string, source string) (string
 // PoolListDisk, PoolListISCSI, PoolListSCSI, PoolListMPath, PoolListRBD,
 // PoolListSheepdog.
 func (conn Connection) ListStoragePools(flags StoragePoolListFlag) ([]StoragePool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var cStoragePools []C.virStoragePoolPtr
 	cStoragePoolsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cStoragePools))
 
-	conn.log.Printf("reading storage pools (flags = %v)...\n", flags)
+	op := conn.log.begin("reading storage pools", "flags", flags)
 	cRet := C.virConnectListAllStoragePools(conn.virConnect, (**C.virStoragePoolPtr)(unsafe.Pointer(&cStoragePoolsSH.Data)), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(cStoragePoolsSH.Data))
@@ -794,12 +1039,13 @@ func (conn Connection) ListStoragePools(flags StoragePoolListFlag) ([]StoragePoo
 	storagePools := make([]StoragePool, ret)
 	for i, cPool := range cStoragePools {
 		storagePools[i] = StoragePool{
-			log:            conn.log,
+			log:            conn.log.storagePool(cPool),
 			virStoragePool: cPool,
+			handle:         conn.objects.track(kindStoragePool, unsafe.Pointer(cPool)),
 		}
 	}
 
-	conn.log.Printf("pools count: %v\n", ret)
+	op.done("pools read", "count", ret)
 
 	return storagePools, nil
 }
@@ -809,24 +1055,28 @@ func (conn Connection) ListStoragePools(flags StoragePoolListFlag) ([]StoragePoo
 // "Free" should be used to free the resources after the storage pool object is
 // no longer needed.
 func (conn Connection) DefineStoragePool(xml string) (StoragePool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	conn.log.Println("defining storage pool...")
+	op := conn.log.begin("defining storage pool")
 	cPool := C.virStoragePoolDefineXML(conn.virConnect, cXML, 0)
 
 	if cPool == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StoragePool{}, err
 	}
 
 	pool := StoragePool{
-		log:            conn.log,
+		log:            conn.log.storagePool(cPool),
 		virStoragePool: cPool,
+		handle:         conn.objects.track(kindStoragePool, unsafe.Pointer(cPool)),
 	}
 
-	conn.log.Println("pool defined")
+	op.done("pool defined")
 
 	return pool, nil
 }
@@ -837,24 +1087,28 @@ func (conn Connection) DefineStoragePool(xml string) (StoragePool, error) {
 // "Free" should be used to free the resources after the storage pool object is
 // no longer needed.
 func (conn Connection) CreateStoragePool(xml string) (StoragePool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	conn.log.Println("creating storage pool...")
+	op := conn.log.begin("creating storage pool")
 	cPool := C.virStoragePoolCreateXML(conn.virConnect, cXML, 0)
 
 	if cPool == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StoragePool{}, err
 	}
 
 	pool := StoragePool{
-		log:            conn.log,
+		log:            conn.log.storagePool(cPool),
 		virStoragePool: cPool,
+		handle:         conn.objects.track(kindStoragePool, unsafe.Pointer(cPool)),
 	}
 
-	conn.log.Println("pool created")
+	op.done("pool created")
 
 	return pool, nil
 }
@@ -863,23 +1117,27 @@ func (conn Connection) CreateStoragePool(xml string) (StoragePool, error) {
 // "Free" should be used to free the resources after the storage pool object is
 // no longer needed.
 func (conn Connection) LookupStoragePoolByName(name string) (StoragePool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
 
-	conn.log.Printf("looking up storage pool with name = %v\n", name)
+	op := conn.log.begin("looking up storage pool by name", "name", name)
 	cPool := C.virStoragePoolLookupByName(conn.virConnect, cName)
 
 	if cPool == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StoragePool{}, err
 	}
 
-	conn.log.Println("pool found")
+	op.done("pool found")
 
 	pool := StoragePool{
-		log:            conn.log,
+		log:            conn.log.storagePool(cPool),
 		virStoragePool: cPool,
+		handle:         conn.objects.track(kindStoragePool, unsafe.Pointer(cPool)),
 	}
 
 	return pool, nil
@@ -890,23 +1148,27 @@ func (conn Connection) LookupStoragePoolByName(name string) (StoragePool, error)
 // "Free" should be used to free the resources after the storage pool object is
 // no longer needed.
 func (conn Connection) LookupStoragePoolByUUID(uuid string) (StoragePool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cUUID := C.CString(uuid)
 	defer C.free(unsafe.Pointer(cUUID))
 
-	conn.log.Printf("looking up storage pool with UUID = %v\n", uuid)
+	op := conn.log.begin("looking up storage pool by UUID", "uuid", uuid)
 	cPool := C.virStoragePoolLookupByUUIDString(conn.virConnect, cUUID)
 
 	if cPool == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StoragePool{}, err
 	}
 
-	conn.log.Println("pool found")
+	op.done("pool found")
 
 	pool := StoragePool{
-		log:            conn.log,
+		log:            conn.log.storagePool(cPool),
 		virStoragePool: cPool,
+		handle:         conn.objects.track(kindStoragePool, unsafe.Pointer(cPool)),
 	}
 
 	return pool, nil
@@ -917,23 +1179,27 @@ func (conn Connection) LookupStoragePoolByUUID(uuid string) (StoragePool, error)
 //"Free" should be used to free the resources after the storage volume object is
 // no longer needed.
 func (conn Connection) LookupStorageVolumeByPath(path string) (StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
 
-	conn.log.Printf("looking up storage volume by path = %v...\n", path)
+	op := conn.log.begin("looking up storage volume by path", "path", path)
 	cVol := C.virStorageVolLookupByPath(conn.virConnect, cPath)
 
 	if cVol == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StorageVolume{}, err
 	}
 
-	conn.log.Println("volume found")
+	op.done("volume found")
 
 	vol := StorageVolume{
-		log:           conn.log,
+		log:           conn.log.storageVolume(cVol),
 		virStorageVol: cVol,
+		handle:        conn.objects.track(kindStorageVolume, unsafe.Pointer(cVol)),
 	}
 
 	return vol, nil
@@ -944,23 +1210,27 @@ func (conn Connection) LookupStorageVolumeByPath(path string) (StorageVolume, er
 // "Free" should be used to free the resources after the storage volume object
 // is no longer needed.
 func (conn Connection) LookupStorageVolumeByKey(key string) (StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	cKey := C.CString(key)
 	defer C.free(unsafe.Pointer(cKey))
 
-	conn.log.Printf("looking up storage volume by key = %v...\n", key)
+	op := conn.log.begin("looking up storage volume by key", "key", key)
 	cVol := C.virStorageVolLookupByKey(conn.virConnect, cKey)
 
 	if cVol == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StorageVolume{}, err
 	}
 
-	conn.log.Println("volume found")
+	op.done("volume found")
 
 	vol := StorageVolume{
-		log:           conn.log,
+		log:           conn.log.storageVolume(cVol),
 		virStorageVol: cVol,
+		handle:        conn.objects.track(kindStorageVolume, unsafe.Pointer(cVol)),
 	}
 
 	return vol, nil
@@ -974,20 +1244,24 @@ func (conn Connection) LookupStorageVolumeByKey(key string) (StorageVolume, erro
 // If a non-blocking data stream is required passed StrNonBlock for flags,
 // otherwise pass StrDefault.
 func (conn Connection) NewStream(flags StreamFlag) (Stream, error) {
-	conn.log.Printf("creating stream (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	op := conn.log.begin("creating stream", "flags", flags)
 	cStream := C.virStreamNew(conn.virConnect, C.uint(flags))
 
 	if cStream == nil {
-		err := LastError()
-		conn.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Stream{}, err
 	}
 
-	conn.log.Println("stream created")
+	op.done("stream created")
 
 	stream := Stream{
-		log:       conn.log,
+		log:       conn.log.stream(),
 		virStream: cStream,
+		handle:    conn.objects.track(kindStream, unsafe.Pointer(cStream)),
 	}
 
 	return stream, nil
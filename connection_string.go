@@ -0,0 +1,47 @@
+// Code generated by "enumgen connection.go ConnectionMode= CloseReason=CloseReason"; DO NOT EDIT.
+
+package libvirt
+
+// connectionModeNames holds the text form of the values of ConnectionMode.
+var connectionModeNames = []enumName[ConnectionMode]{
+	{ReadWrite, "read_write"},
+	{ReadOnly, "read_only"},
+}
+
+// String returns the text form of the value.
+func (v ConnectionMode) String() string {
+	return formatEnum(v, connectionModeNames, "ConnectionMode")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v ConnectionMode) MarshalText() ([]byte, error) {
+	return marshalEnum(v, connectionModeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *ConnectionMode) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, connectionModeNames, "ConnectionMode")
+}
+
+// closeReasonNames holds the text form of the values of CloseReason.
+var closeReasonNames = []enumName[CloseReason]{
+	{CloseReasonError, "error"},
+	{CloseReasonEOF, "eof"},
+	{CloseReasonKeepAlive, "keep_alive"},
+	{CloseReasonClient, "client"},
+}
+
+// String returns the text form of the value.
+func (v CloseReason) String() string {
+	return formatEnum(v, closeReasonNames, "CloseReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v CloseReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, closeReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *CloseReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, closeReasonNames, "CloseReason")
+}
@@ -2,8 +2,13 @@ package libvirt
 
 import (
 	"bytes"
+	"encoding/json"
+	"log/slog"
 	"os"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/cd1/utils-golang"
 )
@@ -28,6 +33,104 @@ func TestConnectionOpenClose(t *testing.T) {
 	}
 }
 
+func TestConnectionOpenWithOptions(t *testing.T) {
+	if _, err := OpenWithOptions(testConnectionURI, OpenOptions{Mode: ConnectionMode(99)}); err != ErrInvalidConnectionMode {
+		t.Errorf("unexpected error with an invalid connection mode; got=%v, want=%v", err, ErrInvalidConnectionMode)
+	}
+
+	var output bytes.Buffer
+	conn, err := OpenWithOptions(testConnectionURI, OpenOptions{
+		Logger: slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Level:  slog.LevelInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = conn.LookupDomainByName(utils.RandomString()); err == nil {
+		t.Error("an error was not returned when looking up a nonexistent domain")
+	}
+
+	if _, err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var levels []string
+	var failure map[string]interface{}
+	dec := json.NewDecoder(&output)
+	for dec.More() {
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+
+		if record["uri"] != testConnectionURI {
+			t.Errorf("unexpected URI in log record; got=%v, want=%v", record["uri"], testConnectionURI)
+		}
+
+		level, _ := record["level"].(string)
+		levels = append(levels, level)
+		if level == slog.LevelError.String() {
+			failure = record
+		}
+	}
+
+	if want := []string{"INFO", "ERROR", "INFO"}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("unexpected log record levels; got=%v, want=%v", levels, want)
+	}
+
+	if failure["error_code"] != ErrNoDomain.String() {
+		t.Errorf("unexpected error code in log record; got=%v, want=%v", failure["error_code"], ErrNoDomain)
+	}
+
+	if _, ok := failure["duration"]; !ok {
+		t.Error("the error log record does not include the call duration")
+	}
+}
+
+func TestConnectionObjectLogAttributes(t *testing.T) {
+	var output bytes.Buffer
+	conn, err := OpenWithOptions(testConnectionURI, OpenOptions{
+		Logger: slog.New(slog.NewJSONHandler(&output, nil)),
+		Level:  slog.LevelError,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	data, err := newTestDomainData(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var xml bytes.Buffer
+	if err = testDomainTmpl.Execute(&xml, data); err != nil {
+		t.Fatal(err)
+	}
+
+	dom, err := conn.DefineDomain(xml.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dom.Free()
+	defer dom.Undefine(DomUndefineDefault)
+
+	// the domain isn't running, so it can't be resumed
+	if err = dom.Resume(); err == nil {
+		t.Fatal("an error was not returned when resuming an inactive domain")
+	}
+
+	var record map[string]interface{}
+	if err = json.NewDecoder(&output).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record["object"] != kindDomain.String() || record["name"] != data.Name || record["uuid"] == nil {
+		t.Errorf("unexpected object attributes in log record; got=%v", record)
+	}
+}
+
 func TestConnectionOpenDefault(t *testing.T) {
 	conn, err := OpenDefault()
 	if err != nil {
@@ -242,10 +345,119 @@ func TestConnectionListDomains(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	for _, d := range domains {
-		if err := d.Free(); err != nil {
-			t.Error(err)
+	if err := FreeAll(domains); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionCloseCallback(t *testing.T) {
+	conn, err := Open(testConnectionURI, ReadWrite, testLogOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetKeepAlive(5*time.Second, 3); err != nil && err != ErrKeepAliveNotSupported {
+		t.Error(err)
+	}
+
+	if err := conn.UnregisterCloseCallback(); err == nil {
+		t.Error("unregistering a close callback which wasn't registered should fail")
+	}
+
+	callback := func(reason CloseReason) {
+		t.Errorf("unexpected close callback call; reason=%v", reason)
+	}
+
+	if err := conn.RegisterCloseCallback(callback); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.RegisterCloseCallback(callback); err == nil {
+		t.Error("registering a second close callback should fail")
+	}
+
+	if err := conn.UnregisterCloseCallback(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionAutoFree(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	conn, err := OpenWithOptions(testConnectionURI, OpenOptions{AutoFree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 10; i++ {
+		dom, err := conn.LookupDomainByName(env.domData.Name)
+		if err != nil {
+			t.Fatal(err)
 		}
+
+		if _, err := dom.Name(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the remaining domain can still be freed explicitly
+	dom, err := conn.LookupDomainByName(env.domData.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.GC()
+
+	if err := dom.Free(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionLeakCheck(t *testing.T) {
+	if !leakCheck {
+		t.Skip("leaks are only detected with the \"libvirt_leakcheck\" build tag")
+	}
+
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	var leaks []Leak
+	defer func(reportLeak func(Leak)) {
+		ReportLeak = reportLeak
+	}(ReportLeak)
+	ReportLeak = func(leak Leak) {
+		leaks = append(leaks, leak)
+	}
+
+	conn, err := Open(testConnectionURI, ReadWrite, testLogOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freed, err := conn.LookupDomainByName(env.domData.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaked, err := conn.LookupDomainByName(env.domData.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leaked.Free()
+
+	if err := freed.Free(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaks) != 1 || leaks[0].Object != "domain" {
+		t.Errorf("unexpected leaks reported after closing the connection; got=%v, want=1 domain", leaks)
 	}
 }
 
@@ -528,6 +740,44 @@ func TestConnectionDefineUndefineSecret(t *testing.T) {
 	}
 }
 
+func TestConnectionCreateSecret(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.cleanUp()
+
+	data := newTestSecretData()
+	value := []byte{0x00, 0x01, 0xfe, 0x00, 0xff}
+
+	sec, err := env.conn.CreateSecret(data.UsageType, data.UsageName, value, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sec.Free()
+	defer sec.Undefine()
+
+	usageID, err := sec.UsageID()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if usageID != data.UsageName {
+		t.Errorf("wrong secret usage ID; got=%v, want=%v", usageID, data.UsageName)
+	}
+
+	got, err := sec.ValueBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Wipe()
+
+	if !bytes.Equal(got, value) {
+		t.Errorf("wrong secret value; got=%x, want=%x", []byte(got), value)
+	}
+
+	if _, err := env.conn.CreateSecret(data.UsageType, data.UsageName, value, false, true); err == nil {
+		t.Error("an error was not returned when creating a secret with a duplicate usage")
+	}
+}
+
 func TestConnectionLookupSecret(t *testing.T) {
 	env := newTestEnvironment(t).withSecret()
 	defer env.cleanUp()
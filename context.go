@@ -0,0 +1,123 @@
+package libvirt
+
+import (
+	"context"
+	"time"
+)
+
+// abortRetryInterval is how often callContext retries to abort an operation,
+// e.g. when the context was cancelled before its job started, and
+// maxAbortAttempts is how many times it tries before giving up.
+const (
+	abortRetryInterval = 100 * time.Millisecond
+	maxAbortAttempts   = 50
+)
+
+// callContext runs "call" in a separate goroutine until it returns or the
+// context is done. In the latter case, "abort" is called (and retried, while
+// it fails and "call" hasn't returned, up to maxAbortAttempts times) to make
+// "call" return early, and ctx.Err() is returned after it does; the result of
+// "call" is only kept if it succeeded anyway. If "abort" never succeeds,
+// ctx.Err() is returned without waiting for "call", which keeps running in
+// its goroutine until it returns by itself; its result is then discarded.
+func callContext(ctx context.Context, call func() error, abort func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil {
+		return call()
+	}
+
+	// buffered, so the goroutine can always exit once "call" returns
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	// result returns the result of "call" after the context is done
+	result := func(err error) error {
+		if err == nil {
+			return nil
+		}
+
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	ticker := time.NewTicker(abortRetryInterval)
+	defer ticker.Stop()
+
+	for attempts := 0; ; attempts++ {
+		// once "call" returns, aborting again could hit someone else's
+		// operation
+		select {
+		case err := <-done:
+			return result(err)
+		default:
+		}
+
+		if attempts == maxAbortAttempts {
+			return ctx.Err()
+		}
+
+		if abort() == nil {
+			return result(<-done)
+		}
+
+		select {
+		case err := <-done:
+			return result(err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Bounds of the adaptive polling used by waitUntil: the interval starts at
+// the minimum and doubles after each check, up to the maximum.
+const (
+	minWaitPollInterval = 50 * time.Millisecond
+	maxWaitPollInterval = 2 * time.Second
+)
+
+// waitUntil calls "check" until it returns true or an error, or the context is
+// done, in which case ctx.Err() is returned. The checks are done with an
+// adaptive interval, and a message received from "wake" (e.g. by an event
+// callback) triggers the next check immediately and resets the interval. A
+// nil "wake" never triggers anything, so waitUntil relies only on polling.
+func waitUntil(ctx context.Context, wake <-chan struct{}, check func() (bool, error)) error {
+	interval := minWaitPollInterval
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		if ok, err := check(); ok || err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+			interval = minWaitPollInterval
+		case <-timer.C:
+			if interval *= 2; interval > maxWaitPollInterval {
+				interval = maxWaitPollInterval
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+	}
+}
@@ -0,0 +1,138 @@
+package libvirt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallContext(t *testing.T) {
+	errAborted := errors.New("operation aborted")
+
+	// the call finishes before the context is done
+	if err := callContext(context.Background(), func() error { return nil }, nil); err != nil {
+		t.Errorf("unexpected error from a successful call; got=%v", err)
+	}
+
+	// the context is done before the call starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := callContext(ctx, func() error {
+		called = true
+		return nil
+	}, nil)
+	if err != context.Canceled || called {
+		t.Errorf("the call should not start with a cancelled context; got=%v, called=%v", err, called)
+	}
+
+	// the call is aborted, after the abort fails the first time
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	aborted := make(chan struct{})
+	attempts := 0
+	err = callContext(ctx, func() error {
+		<-aborted
+		return errAborted
+	}, func() error {
+		if attempts++; attempts == 1 {
+			return errors.New("no job is active")
+		}
+
+		close(aborted)
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("unexpected error from an aborted call; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	if attempts != 2 {
+		t.Errorf("unexpected number of abort attempts; got=%v, want=2", attempts)
+	}
+
+	// the abort never succeeds, so the call is left running
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	attempts = 0
+	err = callContext(ctx, func() error {
+		<-release
+		return nil
+	}, func() error {
+		attempts++
+		return errors.New("no job is active")
+	})
+	if err != context.DeadlineExceeded || attempts != maxAbortAttempts {
+		t.Errorf("unexpected result after the abort attempts; got=%v (attempts = %v), want=%v (attempts = %v)", err, attempts, context.DeadlineExceeded, maxAbortAttempts)
+	}
+
+	// the abort keeps failing, but the call returns by itself
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts = 0
+	err = callContext(ctx, func() error {
+		<-ctx.Done()
+		time.Sleep(abortRetryInterval * 2)
+		return nil
+	}, func() error {
+		attempts++
+		return errors.New("no job is active")
+	})
+	if err != nil {
+		t.Errorf("unexpected error from a call which succeeded anyway; got=%v", err)
+	}
+
+	if attempts >= maxAbortAttempts {
+		t.Errorf("the abort should stop being retried once the call returns; attempts=%v", attempts)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	errCheck := errors.New("check failed")
+
+	// the condition is met after a few polls
+	checks := 0
+	err := waitUntil(context.Background(), nil, func() (bool, error) {
+		checks++
+		return checks == 3, nil
+	})
+	if err != nil || checks != 3 {
+		t.Errorf("unexpected result after polling; err=%v, checks=%v (want 3)", err, checks)
+	}
+
+	// the check fails
+	if err = waitUntil(context.Background(), nil, func() (bool, error) { return false, errCheck }); err != errCheck {
+		t.Errorf("unexpected error from a failed check; got=%v, want=%v", err, errCheck)
+	}
+
+	// a wake-up triggers the next check before the poll interval
+	wake := make(chan struct{}, 1)
+	wake <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), minWaitPollInterval/2)
+	defer cancel()
+
+	checks = 0
+	err = waitUntil(ctx, wake, func() (bool, error) {
+		checks++
+		return checks == 2, nil
+	})
+	if err != nil {
+		t.Errorf("the wake-up should have triggered another check; got=%v", err)
+	}
+
+	// the context is done before the condition is met
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err = waitUntil(ctx, nil, func() (bool, error) { return false, nil }); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error when the condition isn't met; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+}
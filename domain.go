@@ -2,11 +2,14 @@ package libvirt
 
 // #include <stdlib.h>
 // #include <libvirt/libvirt.h>
+// #include "callbacks.h"
 import "C"
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"reflect"
+	"runtime"
 	"time"
 	"unicode/utf8"
 	"unsafe"
@@ -112,6 +115,19 @@ const (
 	DomRebootParavirt     DomainRebootFlag = C.VIR_DOMAIN_REBOOT_PARAVIRT
 )
 
+// DomainShutdownFlag defines how a domain should be shut down.
+type DomainShutdownFlag uint32
+
+// Possible values for DomainShutdownFlag.
+const (
+	DomShutdownDefault      DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_DEFAULT
+	DomShutdownACPIPowerBtn DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_ACPI_POWER_BTN
+	DomShutdownGuestAgent   DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_GUEST_AGENT
+	DomShutdownInitctl      DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_INITCTL
+	DomShutdownSignal       DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_SIGNAL
+	DomShutdownParavirt     DomainShutdownFlag = C.VIR_DOMAIN_SHUTDOWN_PARAVIRT
+)
+
 // DomainState represents the state of a domain.
 type DomainState uint32
 
@@ -219,6 +235,100 @@ const (
 	DomPMSuspendedReasonUnknown DomainPMSuspendedReason = C.VIR_DOMAIN_PMSUSPENDED_UNKNOWN
 )
 
+// DomainStateReason is the reason which led a domain to its state. Its
+// dynamic type depends on the state, e.g. DomainRunningReason for
+// DomStateRunning and DomainShutoffReason for DomStateShutoff.
+type DomainStateReason interface {
+	fmt.Stringer
+	isDomainStateReason()
+}
+
+func (DomainNostateReason) isDomainStateReason()     {}
+func (DomainRunningReason) isDomainStateReason()     {}
+func (DomainBlockedReason) isDomainStateReason()     {}
+func (DomainPausedReason) isDomainStateReason()      {}
+func (DomainShutdownReason) isDomainStateReason()    {}
+func (DomainShutoffReason) isDomainStateReason()     {}
+func (DomainCrashedReason) isDomainStateReason()     {}
+func (DomainPMSuspendedReason) isDomainStateReason() {}
+
+// DomainStateInfo is the state of a domain and the reason which led to it.
+type DomainStateInfo struct {
+	State DomainState
+	// Reason has the reason type of State; it's nil if the state is unknown.
+	Reason DomainStateReason
+}
+
+// NewDomainStateInfo converts a state and its reason, as returned by
+// "<Domain>.State", to a DomainStateInfo.
+func NewDomainStateInfo(state DomainState, reason int32) DomainStateInfo {
+	info := DomainStateInfo{State: state}
+
+	switch state {
+	case DomStateNone:
+		info.Reason = DomainNostateReason(reason)
+	case DomStateRunning:
+		info.Reason = DomainRunningReason(reason)
+	case DomStateBlocked:
+		info.Reason = DomainBlockedReason(reason)
+	case DomStatePaused:
+		info.Reason = DomainPausedReason(reason)
+	case DomStateShutdown:
+		info.Reason = DomainShutdownReason(reason)
+	case DomStateShutoff:
+		info.Reason = DomainShutoffReason(reason)
+	case DomStateCrashed:
+		info.Reason = DomainCrashedReason(reason)
+	case DomStatePMSuspended:
+		info.Reason = DomainPMSuspendedReason(reason)
+	}
+
+	return info
+}
+
+// String returns the state followed by its reason, e.g. "running (booted)".
+func (info DomainStateInfo) String() string {
+	if info.Reason == nil {
+		return info.State.String()
+	}
+
+	return fmt.Sprintf("%v (%v)", info.State, info.Reason)
+}
+
+// DomainControlState is the state of the control interface to a domain.
+type DomainControlState uint32
+
+// Possible values for DomainControlState.
+const (
+	DomControlOK       DomainControlState = C.VIR_DOMAIN_CONTROL_OK
+	DomControlJob      DomainControlState = C.VIR_DOMAIN_CONTROL_JOB
+	DomControlOccupied DomainControlState = C.VIR_DOMAIN_CONTROL_OCCUPIED
+	DomControlError    DomainControlState = C.VIR_DOMAIN_CONTROL_ERROR
+)
+
+// DomainControlErrorReason describes why the control interface to a domain
+// is on "DomControlError".
+type DomainControlErrorReason uint32
+
+// Possible values for DomainControlErrorReason.
+const (
+	DomControlErrorReasonNone     DomainControlErrorReason = C.VIR_DOMAIN_CONTROL_ERROR_REASON_NONE
+	DomControlErrorReasonUnknown  DomainControlErrorReason = C.VIR_DOMAIN_CONTROL_ERROR_REASON_UNKNOWN
+	DomControlErrorReasonMonitor  DomainControlErrorReason = C.VIR_DOMAIN_CONTROL_ERROR_REASON_MONITOR
+	DomControlErrorReasonInternal DomainControlErrorReason = C.VIR_DOMAIN_CONTROL_ERROR_REASON_INTERNAL
+)
+
+// DomainControlInfo describes the control interface to a domain, i.e. whether
+// the hypervisor can talk to the domain (e.g. through the QEMU monitor).
+type DomainControlInfo struct {
+	State DomainControlState
+	// Details is only set when State is DomControlError.
+	Details DomainControlErrorReason
+	// StateTime is how long the control interface has been in State; it's
+	// 0 when State is DomControlOK.
+	StateTime time.Duration
+}
+
 // DomainDumpFlag defines how a domain coredump should be taken.
 type DomainDumpFlag uint32
 
@@ -377,26 +487,220 @@ const (
 	DomSIGRT32   DomainProcessSignal = C.VIR_DOMAIN_PROCESS_SIGNAL_RT32
 )
 
+// DomainBackupBeginFlag defines how a domain backup job should be started.
+type DomainBackupBeginFlag uint32
+
+// Possible values for DomainBackupBeginFlag.
+const (
+	DomBackupBeginDefault       DomainBackupBeginFlag = 0
+	DomBackupBeginReuseExternal DomainBackupBeginFlag = C.VIR_DOMAIN_BACKUP_BEGIN_REUSE_EXTERNAL
+)
+
+// DomainJobType describes the type of a domain job.
+type DomainJobType uint32
+
+// Possible values for DomainJobType.
+const (
+	DomJobNone      DomainJobType = C.VIR_DOMAIN_JOB_NONE
+	DomJobBounded   DomainJobType = C.VIR_DOMAIN_JOB_BOUNDED
+	DomJobUnbounded DomainJobType = C.VIR_DOMAIN_JOB_UNBOUNDED
+	DomJobCompleted DomainJobType = C.VIR_DOMAIN_JOB_COMPLETED
+	DomJobFailed    DomainJobType = C.VIR_DOMAIN_JOB_FAILED
+	DomJobCancelled DomainJobType = C.VIR_DOMAIN_JOB_CANCELLED
+)
+
+// DomainJobOperation describes the operation which started a domain job.
+type DomainJobOperation uint32
+
+// Possible values for DomainJobOperation.
+const (
+	DomJobOperationUnknown        DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_UNKNOWN
+	DomJobOperationStart          DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_START
+	DomJobOperationSave           DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_SAVE
+	DomJobOperationRestore        DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_RESTORE
+	DomJobOperationMigrationIn    DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_MIGRATION_IN
+	DomJobOperationMigrationOut   DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_MIGRATION_OUT
+	DomJobOperationSnapshot       DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_SNAPSHOT
+	DomJobOperationSnapshotRevert DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_SNAPSHOT_REVERT
+	DomJobOperationDump           DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_DUMP
+	DomJobOperationBackup         DomainJobOperation = C.VIR_DOMAIN_JOB_OPERATION_BACKUP
+)
+
+// DomainJobStatsFlag defines which domain job statistics should be read.
+type DomainJobStatsFlag uint32
+
+// Possible values for DomainJobStatsFlag.
+const (
+	DomJobStatsDefault       DomainJobStatsFlag = 0
+	DomJobStatsCompleted     DomainJobStatsFlag = C.VIR_DOMAIN_JOB_STATS_COMPLETED
+	DomJobStatsKeepCompleted DomainJobStatsFlag = C.VIR_DOMAIN_JOB_STATS_KEEP_COMPLETED
+)
+
+// DomainJobStats holds the statistics of a domain job. Fields which are not
+// reported by the hypervisor are left with their zero values.
+type DomainJobStats struct {
+	Type          DomainJobType
+	Operation     DomainJobOperation
+	TimeElapsed   time.Duration
+	TimeRemaining time.Duration
+	DataTotal     uint64
+	DataProcessed uint64
+	DataRemaining uint64
+	DiskTempUsed  uint64
+	DiskTempTotal uint64
+	Success       bool
+	ErrorMessage  string
+}
+
+// ErrJobFailed is returned by "<Domain>.WaitForJob" when the domain job
+// failed. The error message reported by libvirt, if any, is wrapped with it.
+var ErrJobFailed = errors.New("domain job failed")
+
+// ErrJobCancelled is returned by "<Domain>.WaitForJob" when the domain job
+// was cancelled.
+var ErrJobCancelled = errors.New("domain job was cancelled")
+
+// DomainBlockCommitFlag defines how a block commit job should be performed.
+type DomainBlockCommitFlag uint32
+
+// Possible values for DomainBlockCommitFlag.
+const (
+	DomBlockCommitDefault        DomainBlockCommitFlag = 0
+	DomBlockCommitShallow        DomainBlockCommitFlag = C.VIR_DOMAIN_BLOCK_COMMIT_SHALLOW
+	DomBlockCommitDelete         DomainBlockCommitFlag = C.VIR_DOMAIN_BLOCK_COMMIT_DELETE
+	DomBlockCommitActive         DomainBlockCommitFlag = C.VIR_DOMAIN_BLOCK_COMMIT_ACTIVE
+	DomBlockCommitRelative       DomainBlockCommitFlag = C.VIR_DOMAIN_BLOCK_COMMIT_RELATIVE
+	DomBlockCommitBandwidthBytes DomainBlockCommitFlag = C.VIR_DOMAIN_BLOCK_COMMIT_BANDWIDTH_BYTES
+)
+
+// DomainBlockJobType describes the type of a block job.
+type DomainBlockJobType uint32
+
+// Possible values for DomainBlockJobType.
+const (
+	DomBlockJobUnknown      DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_UNKNOWN
+	DomBlockJobPull         DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_PULL
+	DomBlockJobCopy         DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_COPY
+	DomBlockJobCommit       DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_COMMIT
+	DomBlockJobActiveCommit DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_ACTIVE_COMMIT
+	DomBlockJobBackup       DomainBlockJobType = C.VIR_DOMAIN_BLOCK_JOB_TYPE_BACKUP
+)
+
+// DomainBlockJobInfoFlag defines how the information of a block job should be
+// read.
+type DomainBlockJobInfoFlag uint32
+
+// Possible values for DomainBlockJobInfoFlag.
+const (
+	DomBlockJobInfoDefault        DomainBlockJobInfoFlag = 0
+	DomBlockJobInfoBandwidthBytes DomainBlockJobInfoFlag = C.VIR_DOMAIN_BLOCK_JOB_INFO_BANDWIDTH_BYTES
+)
+
+// DomainBlockJobAbortFlag defines how a block job should be aborted.
+type DomainBlockJobAbortFlag uint32
+
+// Possible values for DomainBlockJobAbortFlag.
+const (
+	DomBlockJobAbortDefault DomainBlockJobAbortFlag = 0
+	DomBlockJobAbortAsync   DomainBlockJobAbortFlag = C.VIR_DOMAIN_BLOCK_JOB_ABORT_ASYNC
+	DomBlockJobAbortPivot   DomainBlockJobAbortFlag = C.VIR_DOMAIN_BLOCK_JOB_ABORT_PIVOT
+)
+
+// DomainBlockJobInfo holds the progress of a block job. The progress is
+// reported in arbitrary units: the job is done, or ready to be pivoted, when
+// Cur equals End.
+type DomainBlockJobInfo struct {
+	Type DomainBlockJobType
+	// Bandwidth is in MiB/s, or in bytes/s with DomBlockJobInfoBandwidthBytes.
+	Bandwidth uint64
+	Cur       uint64
+	End       uint64
+}
+
+// Ready reports whether the job copied all the data; a copy or an active
+// commit job then keeps mirroring the writes until it's aborted or pivoted.
+func (info DomainBlockJobInfo) Ready() bool {
+	return info.End > 0 && info.Cur == info.End
+}
+
+// DomainShutdownStep is a step taken by "<Domain>.ShutdownAndWait" to stop a
+// domain.
+type DomainShutdownStep uint32
+
+// Possible values for DomainShutdownStep.
+const (
+	DomShutdownStepNone            DomainShutdownStep = iota // the domain was already shut off
+	DomShutdownStepRequest                                   // the guest shut down after a shutdown request
+	DomShutdownStepDestroyGraceful                           // the domain was destroyed with DomDestroyGraceful
+	DomShutdownStepDestroy                                   // the domain was destroyed forcefully
+)
+
+// DomainShutdownPolicy defines how "<Domain>.ShutdownAndWait" stops a domain.
+// The zero value sends a single shutdown request, lets the hypervisor choose
+// how, and waits for up to a minute without destroying the domain.
+type DomainShutdownPolicy struct {
+	// Flags selects how the shutdown requests are sent (see ShutdownFlags).
+	Flags DomainShutdownFlag
+	// Timeout is how long to wait for the domain to shut off after each
+	// shutdown request or destroy. The default is 1 minute.
+	Timeout time.Duration
+	// Retries is the number of shutdown requests sent after the first one,
+	// if the domain doesn't shut off within the timeout.
+	Retries int
+	// DestroyGraceful escalates to Destroy with DomDestroyGraceful, which
+	// sends SIGTERM to the hypervisor process, if the domain doesn't shut off
+	// after the shutdown requests.
+	DestroyGraceful bool
+	// DestroyForce escalates to a forced Destroy if the domain still doesn't
+	// shut off. The guest may lose data.
+	DestroyForce bool
+}
+
+// defaultShutdownTimeout is the default DomainShutdownPolicy.Timeout.
+const defaultShutdownTimeout = time.Minute
+
+// DomainShutdownResult describes how "<Domain>.ShutdownAndWait" stopped a
+// domain.
+type DomainShutdownResult struct {
+	// Step is the last step taken. If an error is returned, the domain
+	// didn't shut off after it.
+	Step DomainShutdownStep
+	// Requests is the number of shutdown requests sent.
+	Requests int
+	// Duration is how long the whole operation took.
+	Duration time.Duration
+}
+
+// ErrShutdownTimeout is returned by "<Domain>.ShutdownAndWait" when the
+// domain doesn't shut off after all the steps allowed by the policy.
+var ErrShutdownTimeout = errors.New("domain did not shut off in time")
+
 // Domain holds a libvirt domain. There are no exported fields.
 type Domain struct {
-	log       *log.Logger
+	log       *logger
 	virDomain C.virDomainPtr
+	handle    *handle
 }
 
 // Free frees the domain object. The running instance is kept alive. The data
 // structure is freed and should not be used thereafter.
 func (dom Domain) Free() error {
-	dom.log.Println("freeing domain object...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("freeing domain object")
 	cRet := C.virDomainFree(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain freed")
+	dom.handle.release()
+	op.done("domain freed")
 
 	return nil
 }
@@ -404,23 +708,27 @@ func (dom Domain) Free() error {
 // Autostart provides a boolean value indicating whether the domain configured
 // to be automatically started when the host machine boots.
 func (dom Domain) Autostart() (bool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cAutostart C.int
-	dom.log.Println("checking whether domain autostarts...")
+	op := dom.log.begin("checking whether domain autostarts")
 	cRet := C.virDomainGetAutostart(dom.virDomain, &cAutostart)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	autostart := (int32(cAutostart) == 1)
 
 	if autostart {
-		dom.log.Println("domain autostarts")
+		op.done("domain autostarts")
 	} else {
-		dom.log.Println("domain does not autostart")
+		op.done("domain does not autostart")
 	}
 
 	return autostart, nil
@@ -428,22 +736,26 @@ func (dom Domain) Autostart() (bool, error) {
 
 // HasCurrentSnapshot determines if the domain has a current snapshot.
 func (dom Domain) HasCurrentSnapshot() (bool, error) {
-	dom.log.Println("checking whether domain has current snapshot...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("checking whether domain has current snapshot")
 	cRet := C.virDomainHasCurrentSnapshot(dom.virDomain, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	hasCurrentSnapshot := (ret == 1)
 
 	if hasCurrentSnapshot {
-		dom.log.Println("domain has current snapshot")
+		op.done("domain has current snapshot")
 	} else {
-		dom.log.Println("domain does not have current snapshot")
+		op.done("domain does not have current snapshot")
 	}
 
 	return hasCurrentSnapshot, nil
@@ -453,22 +765,26 @@ func (dom Domain) HasCurrentSnapshot() (bool, error) {
 // by ManagedSave(). Note that any running domain should not have such an
 // image, as it should have been removed on restart.
 func (dom Domain) HasManagedSaveImage() (bool, error) {
-	dom.log.Println("checking whether domain has managed save...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("checking whether domain has managed save")
 	cRet := C.virDomainHasManagedSaveImage(dom.virDomain, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	hasManagedSave := (ret == 1)
 
 	if hasManagedSave {
-		dom.log.Println("domain has managed save")
+		op.done("domain has managed save")
 	} else {
-		dom.log.Println("domain does not have managed save")
+		op.done("domain does not have managed save")
 	}
 
 	return hasManagedSave, nil
@@ -476,22 +792,26 @@ func (dom Domain) HasManagedSaveImage() (bool, error) {
 
 // IsActive determines if the domain is currently running.
 func (dom Domain) IsActive() (bool, error) {
-	dom.log.Println("checking whether domain is active...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("checking whether domain is active")
 	cRet := C.virDomainIsActive(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	active := (ret == 1)
 
 	if active {
-		dom.log.Println("domain is active")
+		op.done("domain is active")
 	} else {
-		dom.log.Println("domain is not active")
+		op.done("domain is not active")
 	}
 
 	return active, nil
@@ -500,22 +820,26 @@ func (dom Domain) IsActive() (bool, error) {
 // IsPersistent determines if the domain has a persistent configuration which
 // means it will still exist after shutting down
 func (dom Domain) IsPersistent() (bool, error) {
-	dom.log.Println("checking whether domain is persistent...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("checking whether domain is persistent")
 	cRet := C.virDomainIsPersistent(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	persistent := (ret == 1)
 
 	if persistent {
-		dom.log.Println("domain is persistent")
+		op.done("domain is persistent")
 	} else {
-		dom.log.Println("domain is not persistent")
+		op.done("domain is not persistent")
 	}
 
 	return persistent, nil
@@ -523,22 +847,26 @@ func (dom Domain) IsPersistent() (bool, error) {
 
 // IsUpdated determines if the domain has been updated.
 func (dom Domain) IsUpdated() (bool, error) {
-	dom.log.Println("checking whether domain is updated...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("checking whether domain is updated")
 	cRet := C.virDomainIsUpdated(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	updated := (ret == 1)
 
 	if updated {
-		dom.log.Println("domain is updated")
+		op.done("domain is updated")
 	} else {
-		dom.log.Println("domain is not updated")
+		op.done("domain is not updated")
 	}
 
 	return updated, nil
@@ -546,68 +874,82 @@ func (dom Domain) IsUpdated() (bool, error) {
 
 // OSType gets the type of domain operation system.
 func (dom Domain) OSType() (string, error) {
-	dom.log.Println("reading domain OS type...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain OS type")
 	cOS := C.virDomainGetOSType(dom.virDomain)
 	if cOS == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cOS))
 
 	os := C.GoString(cOS)
-	dom.log.Printf("OS type: %v\n", os)
+	op.done("OS type read", "type", os)
 
 	return os, nil
 }
 
 // Name gets the public name for that domain.
 func (dom Domain) Name() (string, error) {
-	dom.log.Println("reading domain name...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain name")
 	cName := C.virDomainGetName(dom.virDomain)
 
 	if cName == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	name := C.GoString(cName)
-	dom.log.Printf("domain name: %v\n", name)
+	op.done("domain name read", "name", name)
 
 	return name, nil
 }
 
 // Hostname gets the hostname for that domain.
 func (dom Domain) Hostname() (string, error) {
-	dom.log.Println("reading domain hostname...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain hostname")
 	cHostname := C.virDomainGetHostname(dom.virDomain, 0)
 	if cHostname == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cHostname))
 
 	hostname := C.GoString(cHostname)
-	dom.log.Printf("domain hostname: %v\n", hostname)
+	op.done("domain hostname read", "hostname", hostname)
 
 	return hostname, nil
 }
 
 // ID gets the hypervisor ID number for the domain.
 func (dom Domain) ID() (uint32, error) {
-	dom.log.Println("reading domain ID...")
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain ID")
 	cID := C.virDomainGetID(dom.virDomain)
 	id := uint32(cID)
 
 	if id == ^uint32(0) { // Go: ^uint32(0) == C: (unsigned int) -1
 		err := errors.New("domain doesn't have an ID")
-		dom.log.Printf("an error occurred: %v\n", err)
+		op.failed(err)
 		return 0, err
 	}
 
-	dom.log.Printf("domain ID: %v\n", id)
+	op.done("domain ID read", "id", id)
 
 	return id, nil
 }
@@ -615,21 +957,25 @@ func (dom Domain) ID() (uint32, error) {
 // UUID gets the UUID for a domain as string. For more information about UUID
 // see RFC4122.
 func (dom Domain) UUID() (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cUUID := (*C.char)(C.malloc(C.size_t(C.VIR_UUID_STRING_BUFLEN)))
 	defer C.free(unsafe.Pointer(cUUID))
 
-	dom.log.Println("reading domain UUID...")
+	op := dom.log.begin("reading domain UUID")
 	cRet := C.virDomainGetUUIDString(dom.virDomain, cUUID)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	uuid := C.GoString(cUUID)
-	dom.log.Printf("UUID: %v\n", uuid)
+	op.done("UUID read", "uuid", uuid)
 
 	return uuid, nil
 }
@@ -637,37 +983,45 @@ func (dom Domain) UUID() (string, error) {
 // XML provides an XML description of the domain. The description may be reused
 // later to relaunch the domain with CreateXML().
 func (dom Domain) XML(typ DomainXMLFlag) (string, error) {
-	dom.log.Printf("reading domain XML (flags = %v)...\n", typ)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain XML", "flags", typ)
 	cXML := C.virDomainGetXMLDesc(dom.virDomain, C.uint(typ))
 	if cXML == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cXML))
 
 	xml := C.GoString(cXML)
-	dom.log.Printf("XML length: %v runes\n", utf8.RuneCountInString(xml))
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
 
 	return xml, nil
 }
 
 // Metadata retrieves the appropriate domain element given by "type".
 func (dom Domain) Metadata(typ DomainMetadataType, xmlns string, impact DomainModificationImpact) (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cXMLNS := C.CString(xmlns)
 	defer C.free(unsafe.Pointer(cXMLNS))
 
-	dom.log.Printf("reading domain metadata (type = %v, namespace = %v, impact = %v)...\n", typ, xmlns, impact)
+	op := dom.log.begin("reading domain metadata", "type", typ, "namespace", xmlns, "impact", impact)
 	cMetadata := C.virDomainGetMetadata(dom.virDomain, C.int(typ), cXMLNS, C.uint(impact))
 	if cMetadata == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cMetadata))
 
 	metadata := C.GoString(cMetadata)
-	dom.log.Printf("metadata XML length: %v runes\n", utf8.RuneCountInString(metadata))
+	op.done("metadata XML read", "runes", utf8.RuneCountInString(metadata))
 
 	return metadata, nil
 }
@@ -677,17 +1031,21 @@ func (dom Domain) Metadata(typ DomainMetadataType, xmlns string, impact DomainMo
 // This does not free the associated virDomainPtr object. This function may
 // require privileged access.
 func (dom Domain) Destroy(flags DomainDestroyFlag) error {
-	dom.log.Printf("destroying domain (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("destroying domain", "flags", flags)
 	cRet := C.virDomainDestroyFlags(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain destroyed")
+	op.done("domain destroyed")
 
 	return nil
 }
@@ -695,17 +1053,21 @@ func (dom Domain) Destroy(flags DomainDestroyFlag) error {
 // Create launches a defined domain. If the call succeeds the domain moves from
 // the defined to the running domains pools.
 func (dom Domain) Create(flags DomainCreateFlag) error {
-	dom.log.Printf("starting domain (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("starting domain", "flags", flags)
 	cRet := C.virDomainCreateWithFlags(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain started")
+	op.done("domain started")
 
 	return nil
 }
@@ -714,17 +1076,21 @@ func (dom Domain) Create(flags DomainCreateFlag) error {
 // transient domain, without stopping it. If the domain is inactive, the domain
 // configuration is removed.
 func (dom Domain) Undefine(flags DomainUndefineFlag) error {
-	dom.log.Printf("undefining domain (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("undefining domain", "flags", flags)
 	cRet := C.virDomainUndefineFlags(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain undefined")
+	op.done("domain undefined")
 
 	return nil
 }
@@ -735,17 +1101,21 @@ func (dom Domain) Undefine(flags DomainUndefineFlag) error {
 // domain 'on_reboot' XML setting resulting in a domain that shuts down instead
 // of rebooting.
 func (dom Domain) Reboot(flags DomainRebootFlag) error {
-	dom.log.Printf("rebooting domain (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("rebooting domain", "flags", flags)
 	cRet := C.virDomainReboot(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain rebooted")
+	op.done("domain rebooted")
 
 	return nil
 }
@@ -756,17 +1126,21 @@ func (dom Domain) Reboot(flags DomainRebootFlag) error {
 // Note that there is a risk of data loss caused by reset without any guest
 // OS shutdown.
 func (dom Domain) Reset() error {
-	dom.log.Println("resetting domain...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("resetting domain")
 	cRet := C.virDomainReset(dom.virDomain, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain reset")
+	op.done("domain reset")
 
 	return nil
 }
@@ -781,17 +1155,45 @@ func (dom Domain) Reset() error {
 // as soon as the shutdown request is issued rather than blocking until the
 // guest is no longer running.
 func (dom Domain) Shutdown() error {
-	dom.log.Println("shutting down domain...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("shutting down domain")
 	cRet := C.virDomainShutdown(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("domain shut down")
+
+	return nil
+}
+
+// ShutdownFlags shuts down a domain, like Shutdown, using the methods selected
+// by "flags". If more than one method is set, the hypervisor chooses which one
+// to use; the order in which they are tried is not guaranteed. Like Shutdown,
+// it returns as soon as the request is issued.
+func (dom Domain) ShutdownFlags(flags DomainShutdownFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("shutting down domain", "flags", flags)
+	cRet := C.virDomainShutdownFlags(dom.virDomain, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain shut down")
+	op.done("domain shut down")
 
 	return nil
 }
@@ -799,41 +1201,171 @@ func (dom Domain) Shutdown() error {
 // State extracts domain state. Each state can be accompanied with a reason
 // (if known) which led to the state.
 func (dom Domain) State() (DomainState, int32, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cState, cReason C.int
-	dom.log.Println("reading domain state...")
+	op := dom.log.begin("reading domain state")
 	cRet := C.virDomainGetState(dom.virDomain, &cState, &cReason, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, 0, err
 	}
 
 	state := DomainState(cState)
 	reason := int32(cReason)
-	dom.log.Printf("state: %v (reason = %v)\n", state, reason)
+	op.done("state read", "state", state, "reason", reason)
 
 	return state, reason, nil
 }
 
+// StateWithReason is like State, but returns the reason with its type.
+func (dom Domain) StateWithReason() (DomainStateInfo, error) {
+	state, reason, err := dom.State()
+	if err != nil {
+		return DomainStateInfo{}, err
+	}
+
+	return NewDomainStateInfo(state, reason), nil
+}
+
+// ControlInfo extracts details about the control interface to the domain,
+// e.g. whether a job is using it. The domain must be running.
+func (dom Domain) ControlInfo() (DomainControlInfo, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	var cInfo C.virDomainControlInfo
+
+	op := dom.log.begin("reading domain control info")
+	cRet := C.virDomainGetControlInfo(dom.virDomain, &cInfo, 0)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return DomainControlInfo{}, err
+	}
+
+	info := DomainControlInfo{
+		State:     DomainControlState(cInfo.state),
+		Details:   DomainControlErrorReason(cInfo.details),
+		StateTime: time.Duration(cInfo.stateTime) * time.Millisecond,
+	}
+	op.done("control info read", "state", info.State, "details", info.Details, "state_time", info.StateTime)
+
+	return info, nil
+}
+
+// WaitForState waits until the domain reaches one of the "desired" states, or
+// the context is done, and returns the last state read with its reason, which
+// can be converted to the reason type of that state (e.g. DomainRunningReason
+// or DomainShutoffReason). The domain state is read again whenever libvirt
+// sends a lifecycle event for it; as events are only delivered while an event
+// loop is running (see EventRegisterDefaultImpl), the state is also polled
+// with an increasing interval.
+func (dom Domain) WaitForState(ctx context.Context, desired ...DomainState) (DomainState, int32, error) {
+	wake, stop := dom.lifecycleEvents()
+	defer stop()
+
+	var state DomainState
+	var reason int32
+
+	err := waitUntil(ctx, wake, func() (bool, error) {
+		var err error
+		if state, reason, err = dom.State(); err != nil {
+			return false, err
+		}
+
+		for _, d := range desired {
+			if state == d {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+
+	return state, reason, err
+}
+
+// lifecycleEvents registers a lifecycle event callback for the domain, and
+// returns a channel which receives a message after the events and a function
+// which deregisters the callback. If the callback can't be registered, the
+// channel is nil.
+func (dom Domain) lifecycleEvents() (<-chan struct{}, func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	wake := make(chan struct{}, 1)
+	callbackID := registerCallback(lifecycleCallback(func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}))
+
+	cConn := C.virDomainGetConnect(dom.virDomain)
+
+	op := dom.log.begin("registering lifecycle event callback")
+	cCallbackID := C.domainEventLifecycleRegisterWrapper(cConn, dom.virDomain, C.long(callbackID))
+	ret := int32(cCallbackID)
+
+	if ret == -1 {
+		// not an error for the caller, which falls back to polling
+		unregisterCallback(callbackID)
+		op.done("lifecycle events not available", "error", lastError())
+		return nil, func() {}
+	}
+
+	op.done("lifecycle event callback registered", "callback_id", ret)
+
+	stop := func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer runtime.KeepAlive(dom.handle)
+
+		op := dom.log.begin("deregistering lifecycle event callback")
+		cRet := C.virConnectDomainEventDeregisterAny(cConn, cCallbackID)
+
+		if int32(cRet) == -1 {
+			op.failed(lastError())
+			return
+		}
+
+		op.done("lifecycle event callback deregistered")
+	}
+
+	return wake, stop
+}
+
 // Suspend suspends an active domain, the process is frozen without further
 // access to CPU resources and I/O but the memory used by the domain at the
 // hypervisor level will stay allocated. Use Resume() to reactivate the domain.
 // This function may require privileged access. Moreover, suspend may not be
 // supported if domain is in some special state like DomStatePMSuspended.
 func (dom Domain) Suspend() error {
-	dom.log.Println("suspending domain...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("suspending domain")
 	cRet := C.virDomainSuspend(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain suspended")
+	op.done("domain suspended")
 
 	return nil
 }
@@ -843,17 +1375,21 @@ func (dom Domain) Suspend() error {
 // privileged access. Moreover, resume may not be supported if domain is in
 // some special state like DomStatePMSuspended.
 func (dom Domain) Resume() error {
-	dom.log.Println("resuming domain...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("resuming domain")
 	cRet := C.virDomainResume(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain resumed")
+	op.done("domain resumed")
 
 	return nil
 }
@@ -874,40 +1410,62 @@ func (dom Domain) Resume() error {
 // it cannot do so for the given system; this can allow less pressure on file
 // system cache, but also risks slowing saves to NFS.
 func (dom Domain) CoreDump(file string, format DomainDumpFormat, flags DomainDumpFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cFile := C.CString(file)
 	defer C.free(unsafe.Pointer(cFile))
 
-	dom.log.Printf("dumping domain's core to file %v (format = %v, flags = %v)...", file, format, flags)
+	op := dom.log.begin("dumping domain's core", "file", file, "format", format, "flags", flags)
 	cRet := C.virDomainCoreDumpWithFormat(dom.virDomain, cFile, C.uint(format), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("core dump saved")
+	op.done("core dump saved")
 
 	return nil
 }
 
+// CoreDumpContext dumps the core of the domain, like CoreDump, but aborts the
+// dump job (see AbortJob) and returns ctx.Err() if the context is done before
+// it finishes.
+// AbortJob aborts whichever job is running on the domain, so, if the context
+// is done right when the job finishes, a job started by someone else may be
+// aborted instead; if no job can be aborted for a few seconds, ctx.Err() is
+// returned while the job keeps running in the background.
+func (dom Domain) CoreDumpContext(ctx context.Context, file string, format DomainDumpFormat, flags DomainDumpFlag) error {
+	return callContext(ctx, func() error {
+		return dom.CoreDump(file, format, flags)
+	}, dom.AbortJob)
+}
+
 // Ref increments the reference count on the domain. For each additional call
 // to this method, there shall be a corresponding call to virDomainFree to
 // release the reference count, once the caller no longer needs the reference
 // to this object.
 func (dom Domain) Ref() error {
-	dom.log.Println("incrementing domain's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("incrementing domain's reference count")
 	cRet := C.virDomainRef(dom.virDomain)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("reference count incremented")
+	dom.handle.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
@@ -915,17 +1473,21 @@ func (dom Domain) Ref() error {
 // MaxMemory retrieves the maximum amount of physical memory allocated to
 // a domain.
 func (dom Domain) MaxMemory() (uint64, error) {
-	dom.log.Println("reading domain maximum memory...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain maximum memory")
 	cRet := C.virDomainGetMaxMemory(dom.virDomain)
 	ret := uint64(cRet)
 
 	if ret == 0 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	dom.log.Printf("max memory: %v kiB\n", ret)
+	op.done("max memory read", "kib", ret)
 
 	return ret, nil
 }
@@ -934,29 +1496,37 @@ func (dom Domain) MaxMemory() (uint64, error) {
 // call may fail if the underlying virtualization hypervisor does not support
 // it. This function may require privileged access to the hypervisor.
 func (dom Domain) VCPUs(flags DomainVCPUsFlag) (int32, error) {
-	dom.log.Println("reading domain VCPUs count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain VCPUs count", "flags", flags)
 	cRet := C.virDomainGetVcpusFlags(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	dom.log.Printf("VCPUs count: %v\n", ret)
+	op.done("VCPUs read", "count", ret)
 
 	return ret, nil
 }
 
 // InfoState extracts the state of the domain.
 func (dom Domain) InfoState() (DomainState, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cInfo C.virDomainInfo
 	cRet := C.virDomainGetInfo(dom.virDomain, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		return 0, LastError()
+		return 0, lastError()
 	}
 
 	return DomainState(cInfo.state), nil
@@ -964,12 +1534,16 @@ func (dom Domain) InfoState() (DomainState, error) {
 
 // InfoMaxMemory extracts the maximum memory in KBytes allowed in the domain.
 func (dom Domain) InfoMaxMemory() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cInfo C.virDomainInfo
 	cRet := C.virDomainGetInfo(dom.virDomain, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		return 0, LastError()
+		return 0, lastError()
 	}
 
 	return uint64(cInfo.maxMem), nil
@@ -977,12 +1551,16 @@ func (dom Domain) InfoMaxMemory() (uint64, error) {
 
 // InfoMemory extracts the memory in KBytes used by the domain.
 func (dom Domain) InfoMemory() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cInfo C.virDomainInfo
 	cRet := C.virDomainGetInfo(dom.virDomain, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		return 0, LastError()
+		return 0, lastError()
 	}
 
 	return uint64(cInfo.memory), nil
@@ -990,12 +1568,16 @@ func (dom Domain) InfoMemory() (uint64, error) {
 
 // InfoVCPUs extracts the number of virtual CPUs for the domain.
 func (dom Domain) InfoVCPUs() (uint16, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cInfo C.virDomainInfo
 	cRet := C.virDomainGetInfo(dom.virDomain, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		return 0, LastError()
+		return 0, lastError()
 	}
 
 	return uint16(cInfo.nrVirtCpu), nil
@@ -1003,12 +1585,16 @@ func (dom Domain) InfoVCPUs() (uint16, error) {
 
 // InfoCPUTime extracts the CPU time used in nanoseconds.
 func (dom Domain) InfoCPUTime() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cInfo C.virDomainInfo
 	cRet := C.virDomainGetInfo(dom.virDomain, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		return 0, LastError()
+		return 0, lastError()
 	}
 
 	return uint64(cInfo.cpuTime), nil
@@ -1019,6 +1605,10 @@ func (dom Domain) InfoCPUTime() (uint64, error) {
 // ends the life of a transient domain). Use Restore() to restore a domain
 // after saving.
 func (dom Domain) Save(to string, xml string, flags DomainSaveFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cTo := C.CString(to)
 	defer C.free(unsafe.Pointer(cTo))
 
@@ -1030,21 +1620,34 @@ func (dom Domain) Save(to string, xml string, flags DomainSaveFlag) error {
 		cXML = nil
 	}
 
-	dom.log.Printf("saving domain's memory to file %v (flags = %v)...\n", to, flags)
+	op := dom.log.begin("saving domain's memory", "file", to, "flags", flags)
 	cRet := C.virDomainSaveFlags(dom.virDomain, cTo, cXML, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain saved")
+	op.done("domain saved")
 
 	return nil
 }
 
+// SaveContext saves the domain, like Save, but aborts the save job (see
+// AbortJob) and returns ctx.Err() if the context is done before it finishes.
+// The domain keeps running if the job is aborted.
+// AbortJob aborts whichever job is running on the domain, so, if the context
+// is done right when the job finishes, a job started by someone else may be
+// aborted instead; if no job can be aborted for a few seconds, ctx.Err() is
+// returned while the job keeps running in the background.
+func (dom Domain) SaveContext(ctx context.Context, to string, xml string, flags DomainSaveFlag) error {
+	return callContext(ctx, func() error {
+		return dom.Save(to, xml, flags)
+	}, dom.AbortJob)
+}
+
 // AttachDevice attaches a virtual device to a domain, using the flags
 // parameter to control how the device is attached. DomDeviceModifyCurrent
 // specifies that the device allocation is made based on current domain state.
@@ -1056,20 +1659,24 @@ func (dom Domain) Save(to string, xml string, flags DomainSaveFlag) error {
 // hypervisor driver will return failure if DomDeviceModifyLive is specified
 // but it only supports modifying the persisted device allocation.
 func (dom Domain) AttachDevice(deviceXML string, flags DomainDeviceModifyFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cXML := C.CString(deviceXML)
 	defer C.free(unsafe.Pointer(cXML))
 
-	dom.log.Printf("attaching a virtual device to domain (flags = %v)...\n", flags)
+	op := dom.log.begin("attaching a virtual device to domain", "flags", flags)
 	cRet := C.virDomainAttachDeviceFlags(dom.virDomain, cXML, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("device attached")
+	op.done("device attached")
 
 	return nil
 }
@@ -1085,20 +1692,24 @@ func (dom Domain) AttachDevice(deviceXML string, flags DomainDeviceModifyFlag) e
 // hypervisor driver will return failure if DomDeviceModifyLive is specified
 // but it only supports removing the persisted device allocation.
 func (dom Domain) DetachDevice(deviceXML string, flags DomainDeviceModifyFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cXML := C.CString(deviceXML)
 	defer C.free(unsafe.Pointer(cXML))
 
-	dom.log.Printf("detaching a virtual device from domain (flags = %v)...\n", flags)
+	op := dom.log.begin("detaching a virtual device from domain", "flags", flags)
 	cRet := C.virDomainDetachDeviceFlags(dom.virDomain, cXML, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("device detached")
+	op.done("device detached")
 
 	return nil
 }
@@ -1114,20 +1725,24 @@ func (dom Domain) DetachDevice(deviceXML string, flags DomainDeviceModifyFlag) e
 // return failure if DomDeviceModifyLive is specified but it only supports
 // modifying the persisted device allocation.
 func (dom Domain) UpdateDevice(deviceXML string, flags DomainDeviceModifyFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cXML := C.CString(deviceXML)
 	defer C.free(unsafe.Pointer(cXML))
 
-	dom.log.Printf("updating a virtual device on domain (flags = %v)...\n", flags)
+	op := dom.log.begin("updating a virtual device on domain", "flags", flags)
 	cRet := C.virDomainUpdateDeviceFlags(dom.virDomain, cXML, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("device updated")
+	op.done("device updated")
 
 	return nil
 }
@@ -1135,12 +1750,17 @@ func (dom Domain) UpdateDevice(deviceXML string, flags DomainDeviceModifyFlag) e
 // SetAutostart configures the domain to be automatically started when the host
 // machine boots.
 func (dom Domain) SetAutostart(autostart bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cAutostart C.int
+	var op operation
 	if autostart {
-		dom.log.Println("enabling domain autostart...")
+		op = dom.log.begin("enabling domain autostart")
 		cAutostart = 1
 	} else {
-		dom.log.Println("disabling domain autostart...")
+		op = dom.log.begin("disabling domain autostart")
 		cAutostart = 0
 	}
 
@@ -1148,15 +1768,15 @@ func (dom Domain) SetAutostart(autostart bool) error {
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
 	if autostart {
-		dom.log.Println("autostart enabled")
+		op.done("autostart enabled")
 	} else {
-		dom.log.Println("autostart disabled")
+		op.done("autostart disabled")
 	}
 
 	return nil
@@ -1165,17 +1785,21 @@ func (dom Domain) SetAutostart(autostart bool) error {
 // SetMemory dynamically changes the target amount of physical memory allocated
 // to a domain. This function may require privileged access to the hypervisor.
 func (dom Domain) SetMemory(memory uint64, flags DomainMemoryModifyFlag) error {
-	dom.log.Printf("changing domain memory to %v kiB (flags = %v)...\n", memory, flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("changing domain memory", "kib", memory, "flags", flags)
 	cRet := C.virDomainSetMemoryFlags(dom.virDomain, C.ulong(memory), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("memory changed")
+	op.done("memory changed")
 
 	return nil
 }
@@ -1186,6 +1810,10 @@ func (dom Domain) SetMemory(memory uint64, flags DomainMemoryModifyFlag) error {
 // short (although the length is not enforced). For these two options "key" and
 // "uri" are irrelevant and must be set to NULL.
 func (dom Domain) SetMetadata(typ DomainMetadataType, metadata string, key string, uri string, impact DomainModificationImpact) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cMetadata := C.CString(metadata)
 	defer C.free(unsafe.Pointer(cMetadata))
 
@@ -1195,17 +1823,17 @@ func (dom Domain) SetMetadata(typ DomainMetadataType, metadata string, key strin
 	cURI := C.CString(uri)
 	defer C.free(unsafe.Pointer(cURI))
 
-	dom.log.Printf("changing domain metadata key '<%v:%v>' (type = %v, impact = %v)...\n", key, uri, typ, impact)
+	op := dom.log.begin("changing domain metadata", "key", key, "namespace", uri, "type", typ, "impact", impact)
 	cRet := C.virDomainSetMetadata(dom.virDomain, C.int(typ), cMetadata, cKey, cURI, C.uint(impact))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("metadata changed")
+	op.done("metadata changed")
 
 	return nil
 }
@@ -1215,17 +1843,21 @@ func (dom Domain) SetMetadata(typ DomainMetadataType, metadata string, key strin
 // does not support it or if growing the number is arbitrary limited. This
 // function may require privileged access to the hypervisor.
 func (dom Domain) SetVCPUs(vcpus uint32, flags DomainVCPUsFlag) error {
-	dom.log.Printf("changing domain VCPUs count to %v (flags = %v)...\n", vcpus, flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("changing domain VCPUs count", "vcpus", vcpus, "flags", flags)
 	cRet := C.virDomainSetVcpusFlags(dom.virDomain, C.uint(vcpus), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("VCPUs count changed")
+	op.done("VCPUs count changed")
 
 	return nil
 }
@@ -1239,68 +1871,97 @@ func (dom Domain) SetVCPUs(vcpus uint32, flags DomainVCPUsFlag) error {
 // managed save only works on persistent domains, since the domain must still
 // exist in order to use Create() to restart it.
 func (dom Domain) ManagedSave(flags DomainSaveFlag) error {
-	dom.log.Printf("saving domain's memory to a libvirt-managed location (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("saving domain's memory to a libvirt-managed location", "flags", flags)
 	cRet := C.virDomainManagedSave(dom.virDomain, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("domain saved")
+	op.done("domain saved")
 
 	return nil
 }
 
+// ManagedSaveContext saves the domain, like ManagedSave, but aborts the save
+// job (see AbortJob) and returns ctx.Err() if the context is done before it
+// finishes. The domain keeps running if the job is aborted.
+// AbortJob aborts whichever job is running on the domain, so, if the context
+// is done right when the job finishes, a job started by someone else may be
+// aborted instead; if no job can be aborted for a few seconds, ctx.Err() is
+// returned while the job keeps running in the background.
+func (dom Domain) ManagedSaveContext(ctx context.Context, flags DomainSaveFlag) error {
+	return callContext(ctx, func() error {
+		return dom.ManagedSave(flags)
+	}, dom.AbortJob)
+}
+
 // ManagedSaveRemove removes any managed save image for this domain.
 func (dom Domain) ManagedSaveRemove() error {
-	dom.log.Println("removing libvirt-managed domain save image...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("removing libvirt-managed domain save image")
 	cRet := C.virDomainManagedSaveRemove(dom.virDomain, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("save image removed")
+	op.done("save image removed")
 
 	return nil
 }
 
 // SendKey send key(s) to the guest.
 func (dom Domain) SendKey(codeSet DomainKeycodeSet, hold time.Duration, keycodes []uint32) error {
-	dom.log.Printf("sending keys %v (keycode set = %v) to domain during %v...\n", keycodes, codeSet, time.Duration(hold))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("sending keys to domain", "keycodes", keycodes, "keycode_set", codeSet, "hold", time.Duration(hold))
 	cRet := C.virDomainSendKey(dom.virDomain, C.uint(codeSet), C.uint(hold*time.Millisecond), (*C.uint)(unsafe.Pointer(&keycodes[0])), C.int(len(keycodes)), 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("keys sent")
+	op.done("keys sent")
 
 	return nil
 }
 
 // SendProcessSignal sends a signal to the designated process in the guest.
 func (dom Domain) SendProcessSignal(pid int64, signal DomainProcessSignal) error {
-	dom.log.Printf("sending signal %v to domain's process %v...\n", signal, pid)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("sending signal to domain's process", "signal", signal, "pid", pid)
 	cRet := C.virDomainSendProcessSignal(dom.virDomain, C.longlong(pid), C.uint(signal), 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	dom.log.Println("signal sent")
+	op.done("signal sent")
 
 	return nil
 }
@@ -1308,16 +1969,20 @@ func (dom Domain) SendProcessSignal(pid int64, signal DomainProcessSignal) error
 // ListSnapshots collects the list of domain snapshots for the given domain, and
 // allocate an array to store those objects.
 func (dom Domain) ListSnapshots(flags SnapshotListFlag) ([]Snapshot, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	var cSnaps []C.virDomainSnapshotPtr
 	snapsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cSnaps))
 
-	dom.log.Printf("reading domain snapshots (flags = %v)...\n", flags)
+	op := dom.log.begin("reading domain snapshots", "flags", flags)
 	cRet := C.virDomainListAllSnapshots(dom.virDomain, (**C.virDomainSnapshotPtr)(unsafe.Pointer(&snapsSH.Data)), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(snapsSH.Data))
@@ -1329,58 +1994,672 @@ func (dom Domain) ListSnapshots(flags SnapshotListFlag) ([]Snapshot, error) {
 
 	for i := range snaps {
 		snaps[i] = Snapshot{
-			log:         dom.log,
+			log:         dom.log.snapshot(cSnaps[i]),
 			virSnapshot: cSnaps[i],
+			handle:      dom.handle.track(kindSnapshot, unsafe.Pointer(cSnaps[i])),
 		}
 	}
 
-	dom.log.Printf("snapshots count: %v\n", len(snaps))
+	op.done("snapshots read", "count", len(snaps))
 
 	return snaps, nil
 }
 
 // CreateSnapshot creates a new snapshot of a domain based on a snapshot XML.
 func (dom Domain) CreateSnapshot(xml string, flags SnapshotCreateFlag) (Snapshot, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	dom.log.Printf("creating domain snapshot (flags = %v)...\n", flags)
+	op := dom.log.begin("creating domain snapshot", "flags", flags)
 	cSnapshot := C.virDomainSnapshotCreateXML(dom.virDomain, cXML, C.uint(flags))
 	if cSnapshot == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
+		return Snapshot{}, err
+	}
+
+	snap := Snapshot{
+		log:         dom.log.snapshot(cSnapshot),
+		virSnapshot: cSnapshot,
+		handle:      dom.handle.track(kindSnapshot, unsafe.Pointer(cSnapshot)),
+	}
+
+	op.done("snapshot created")
+
+	return snap, nil
+}
+
+// CreateSnapshotDef creates a new snapshot of a domain based on a snapshot
+// definition. See "<Domain>.CreateSnapshot".
+func (dom Domain) CreateSnapshotDef(def SnapshotDef, flags SnapshotCreateFlag) (Snapshot, error) {
+	xml, err := def.Marshal()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return dom.CreateSnapshot(xml, flags)
+}
+
+// CurrentSnapshot gets the current snapshot of a domain, if any.
+// See also "<Domain>.HasCurrentSnapshot".
+func (dom Domain) CurrentSnapshot(flags SnapshotCurrentFlag) (Snapshot, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading current snapshot", "flags", flags)
+	cSnapshot := C.virDomainSnapshotCurrent(dom.virDomain, C.uint(flags))
+	if cSnapshot == nil {
+		err := lastError()
+		op.failed(err)
 		return Snapshot{}, err
 	}
 
 	snap := Snapshot{
-		log:         dom.log,
+		log:         dom.log.snapshot(cSnapshot),
 		virSnapshot: cSnapshot,
+		handle:      dom.handle.track(kindSnapshot, unsafe.Pointer(cSnapshot)),
 	}
 
-	dom.log.Println("snapshot created")
+	op.done("current snapshot obtained")
 
 	return snap, nil
 }
 
 // LookupSnapshotByName tries to lookup a domain snapshot based on its name.
 func (dom Domain) LookupSnapshotByName(name string) (Snapshot, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
 
-	dom.log.Printf("looking up snapshot with name = %v...\n", name)
+	op := dom.log.begin("looking up snapshot by name", "name", name)
 	cSnap := C.virDomainSnapshotLookupByName(dom.virDomain, cName, 0)
 	if cSnap == nil {
-		err := LastError()
-		dom.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Snapshot{}, err
 	}
 
 	snap := Snapshot{
-		log:         dom.log,
+		log:         dom.log.snapshot(cSnap),
 		virSnapshot: cSnap,
+		handle:      dom.handle.track(kindSnapshot, unsafe.Pointer(cSnap)),
 	}
 
-	dom.log.Println("snapshot found")
+	op.done("snapshot found")
 
 	return snap, nil
 }
+
+// ListCheckpoints collects the list of domain checkpoints for the given
+// domain, and allocate an array to store those objects.
+// By default, all checkpoints are listed. If "flags" includes
+// CheckpointListRoots, only the checkpoints without a parent are listed; if it
+// includes CheckpointListLeaves or CheckpointListNoLeaves, the checkpoints are
+// filtered by whether they have children. CheckpointListTopological
+// guarantees that parents are listed before their children.
+func (dom Domain) ListCheckpoints(flags CheckpointListFlag) ([]Checkpoint, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	var cCheckpoints []C.virDomainCheckpointPtr
+	checkpointsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cCheckpoints))
+
+	op := dom.log.begin("reading domain checkpoints", "flags", flags)
+	cRet := C.virDomainListAllCheckpoints(dom.virDomain, (**C.virDomainCheckpointPtr)(unsafe.Pointer(&checkpointsSH.Data)), C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return nil, err
+	}
+	defer C.free(unsafe.Pointer(checkpointsSH.Data))
+
+	checkpointsSH.Cap = int(ret)
+	checkpointsSH.Len = int(ret)
+
+	checkpoints := make([]Checkpoint, ret)
+
+	for i := range checkpoints {
+		checkpoints[i] = Checkpoint{
+			log:           dom.log.checkpoint(cCheckpoints[i]),
+			virCheckpoint: cCheckpoints[i],
+			handle:        dom.handle.track(kindCheckpoint, unsafe.Pointer(cCheckpoints[i])),
+		}
+	}
+
+	op.done("checkpoints read", "count", len(checkpoints))
+
+	return checkpoints, nil
+}
+
+// CreateCheckpoint creates a new checkpoint of a domain based on a checkpoint
+// XML. A checkpoint tracks which blocks of the domain disks changed since its
+// creation (using dirty bitmaps), which is the foundation for incremental
+// backups.
+// If "flags" includes CheckpointCreateRedefine, the XML describes a
+// checkpoint previously listed by "<Checkpoint>.XML" and only its metadata is
+// recreated. CheckpointCreateQuiesce requires the guest agent to freeze the
+// guest filesystems while the checkpoint is created.
+func (dom Domain) CreateCheckpoint(xml string, flags CheckpointCreateFlag) (Checkpoint, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cXML := C.CString(xml)
+	defer C.free(unsafe.Pointer(cXML))
+
+	op := dom.log.begin("creating domain checkpoint", "flags", flags)
+	cCheckpoint := C.virDomainCheckpointCreateXML(dom.virDomain, cXML, C.uint(flags))
+	if cCheckpoint == nil {
+		err := lastError()
+		op.failed(err)
+		return Checkpoint{}, err
+	}
+
+	cp := Checkpoint{
+		log:           dom.log.checkpoint(cCheckpoint),
+		virCheckpoint: cCheckpoint,
+		handle:        dom.handle.track(kindCheckpoint, unsafe.Pointer(cCheckpoint)),
+	}
+
+	op.done("checkpoint created")
+
+	return cp, nil
+}
+
+// LookupCheckpointByName tries to lookup a domain checkpoint based on
+// its name.
+func (dom Domain) LookupCheckpointByName(name string) (Checkpoint, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	op := dom.log.begin("looking up checkpoint by name", "name", name)
+	cCheckpoint := C.virDomainCheckpointLookupByName(dom.virDomain, cName, 0)
+	if cCheckpoint == nil {
+		err := lastError()
+		op.failed(err)
+		return Checkpoint{}, err
+	}
+
+	cp := Checkpoint{
+		log:           dom.log.checkpoint(cCheckpoint),
+		virCheckpoint: cCheckpoint,
+		handle:        dom.handle.track(kindCheckpoint, unsafe.Pointer(cCheckpoint)),
+	}
+
+	op.done("checkpoint found")
+
+	return cp, nil
+}
+
+// BackupBegin starts a point-in-time backup job of the domain disks, described
+// by "backupXML". In push mode, libvirt copies the data to the targets listed
+// in the XML; in pull mode, the data is exported through an NBD server and the
+// client is responsible for reading it. Only one backup job can run at a time.
+// If "checkpointXML" is not empty, a checkpoint is created atomically with the
+// start of the backup, so a later incremental backup can be based on it.
+// If "flags" includes DomBackupBeginReuseExternal, the push mode targets are
+// expected to exist already instead of being created by libvirt.
+// The progress of the job can be read with JobStats, and WaitForJob can be used
+// to wait until it completes.
+func (dom Domain) BackupBegin(backupXML string, checkpointXML string, flags DomainBackupBeginFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cBackupXML := C.CString(backupXML)
+	defer C.free(unsafe.Pointer(cBackupXML))
+
+	var cCheckpointXML *C.char
+	if checkpointXML != "" {
+		cCheckpointXML = C.CString(checkpointXML)
+		defer C.free(unsafe.Pointer(cCheckpointXML))
+	}
+
+	op := dom.log.begin("starting domain backup", "flags", flags)
+	cRet := C.virDomainBackupBegin(dom.virDomain, cBackupXML, cCheckpointXML, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("backup started")
+
+	return nil
+}
+
+// BackupXML provides an XML description of the backup job currently running
+// on the domain, including the details filled in by libvirt (e.g. the NBD
+// server used in pull mode).
+func (dom Domain) BackupXML() (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("reading domain backup XML")
+	cXML := C.virDomainBackupGetXMLDesc(dom.virDomain, 0)
+	if cXML == nil {
+		err := lastError()
+		op.failed(err)
+		return "", err
+	}
+	defer C.free(unsafe.Pointer(cXML))
+
+	xml := C.GoString(cXML)
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
+
+	return xml, nil
+}
+
+// JobStats extracts the statistics of the job currently running on the
+// domain (e.g. a backup). If "flags" includes DomJobStatsCompleted, the
+// statistics of the most recently completed job are returned instead; they're
+// removed after being read, unless "flags" also includes
+// DomJobStatsKeepCompleted.
+func (dom Domain) JobStats(flags DomainJobStatsFlag) (DomainJobStats, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	var cType C.int
+	var params typedParams
+
+	op := dom.log.begin("reading domain job stats", "flags", flags)
+	cRet := C.virDomainGetJobStats(dom.virDomain, &cType, &params.params, &params.nparams, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return DomainJobStats{}, err
+	}
+	defer params.free()
+
+	stats := DomainJobStats{
+		Type: DomainJobType(cType),
+	}
+
+	if operation, ok := params.getInt(C.VIR_DOMAIN_JOB_OPERATION); ok {
+		stats.Operation = DomainJobOperation(operation)
+	}
+
+	if elapsed, ok := params.getUint64(C.VIR_DOMAIN_JOB_TIME_ELAPSED); ok {
+		stats.TimeElapsed = time.Duration(elapsed) * time.Millisecond
+	}
+
+	if remaining, ok := params.getUint64(C.VIR_DOMAIN_JOB_TIME_REMAINING); ok {
+		stats.TimeRemaining = time.Duration(remaining) * time.Millisecond
+	}
+
+	stats.DataTotal, _ = params.getUint64(C.VIR_DOMAIN_JOB_DATA_TOTAL)
+	stats.DataProcessed, _ = params.getUint64(C.VIR_DOMAIN_JOB_DATA_PROCESSED)
+	stats.DataRemaining, _ = params.getUint64(C.VIR_DOMAIN_JOB_DATA_REMAINING)
+	stats.DiskTempUsed, _ = params.getUint64(C.VIR_DOMAIN_JOB_DISK_TEMP_USED)
+	stats.DiskTempTotal, _ = params.getUint64(C.VIR_DOMAIN_JOB_DISK_TEMP_TOTAL)
+	stats.Success, _ = params.getBool(C.VIR_DOMAIN_JOB_SUCCESS)
+	stats.ErrorMessage, _ = params.getString(C.VIR_DOMAIN_JOB_ERRMSG)
+
+	op.done("job stats read", "type", stats.Type, "processed", stats.DataProcessed, "total", stats.DataTotal)
+
+	return stats, nil
+}
+
+// AbortJob requests that the current background job be aborted at the soonest
+// opportunity. In case the job is a migration in a post-copy mode, this
+// function will report an error.
+func (dom Domain) AbortJob() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	op := dom.log.begin("aborting domain job")
+	cRet := C.virDomainAbortJob(dom.virDomain)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("job aborted")
+
+	return nil
+}
+
+// BlockCommit commits the changes in the image "top" of the backing chain of
+// "disk" down into the image "base", merging the images in between. "disk" is
+// the target (e.g. "vda") or the source path of the disk. If "base" is empty,
+// the bottom-most image is used (or the backing image of "top", with
+// DomBlockCommitShallow); if "top" is empty, the active image is used, which
+// requires DomBlockCommitActive. A "bandwidth" of 0 means unlimited; otherwise
+// it's in MiB/s, or in bytes/s with DomBlockCommitBandwidthBytes.
+// The commit runs as a block job: see "<Domain>.BlockJobInfo" and
+// "<Domain>.BlockJobAbort". An active commit never ends by itself; once it's
+// ready, it must be pivoted to make "base" the active image.
+func (dom Domain) BlockCommit(disk string, base string, top string, bandwidth uint64, flags DomainBlockCommitFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cDisk := C.CString(disk)
+	defer C.free(unsafe.Pointer(cDisk))
+
+	var cBase, cTop *C.char
+	if base != "" {
+		cBase = C.CString(base)
+		defer C.free(unsafe.Pointer(cBase))
+	}
+	if top != "" {
+		cTop = C.CString(top)
+		defer C.free(unsafe.Pointer(cTop))
+	}
+
+	op := dom.log.begin("starting block commit", "disk", disk, "flags", flags)
+	cRet := C.virDomainBlockCommit(dom.virDomain, cDisk, cBase, cTop, C.ulong(bandwidth), C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("block commit started")
+
+	return nil
+}
+
+// BlockJobInfo reads the progress of the block job running on "disk". The
+// returned boolean is false, with an empty DomainBlockJobInfo, if there's no
+// block job on the disk.
+func (dom Domain) BlockJobInfo(disk string, flags DomainBlockJobInfoFlag) (DomainBlockJobInfo, bool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cDisk := C.CString(disk)
+	defer C.free(unsafe.Pointer(cDisk))
+
+	var cInfo C.virDomainBlockJobInfo
+	op := dom.log.begin("reading block job info", "disk", disk, "flags", flags)
+	cRet := C.virDomainGetBlockJobInfo(dom.virDomain, cDisk, &cInfo, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return DomainBlockJobInfo{}, false, err
+	}
+
+	if ret == 0 {
+		op.done("no block job running")
+		return DomainBlockJobInfo{}, false, nil
+	}
+
+	info := DomainBlockJobInfo{
+		Type:      DomainBlockJobType(cInfo._type),
+		Bandwidth: uint64(cInfo.bandwidth),
+		Cur:       uint64(cInfo.cur),
+		End:       uint64(cInfo.end),
+	}
+
+	op.done("block job info read", "type", info.Type, "cur", info.Cur, "end", info.End)
+
+	return info, true, nil
+}
+
+// BlockJobAbort cancels the block job running on "disk". With
+// DomBlockJobAbortPivot, a copy or an active commit job which is ready is
+// completed instead, making the new image the active one. The call waits until
+// the job is gone, unless DomBlockJobAbortAsync is used.
+func (dom Domain) BlockJobAbort(disk string, flags DomainBlockJobAbortFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(dom.handle)
+
+	cDisk := C.CString(disk)
+	defer C.free(unsafe.Pointer(cDisk))
+
+	op := dom.log.begin("aborting block job", "disk", disk, "flags", flags)
+	cRet := C.virDomainBlockJobAbort(dom.virDomain, cDisk, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("block job aborted")
+
+	return nil
+}
+
+// WaitForJob waits until the job currently running on the domain (e.g. a
+// backup started by BackupBegin) finishes, reading its statistics every
+// "interval" (or every second, if it's not positive). If "progress" is not
+// nil, it's called with the statistics read while the job is running.
+// When the job finishes, the statistics of the completed job are returned. If
+// the job failed or was cancelled, an error matching ErrJobFailed or
+// ErrJobCancelled, respectively, is returned along with them. If
+// the context is cancelled before the job finishes, ctx.Err() is returned and
+// the job keeps running; use AbortJob to stop it.
+func (dom Domain) WaitForJob(ctx context.Context, interval time.Duration, progress func(DomainJobStats)) (DomainJobStats, error) {
+	return WaitForJob(ctx, NewDomainAPI(dom), interval, progress)
+}
+
+// defaultJobPollInterval is used by WaitForJob when the interval isn't
+// positive.
+const defaultJobPollInterval = time.Second
+
+// jobTarget is the subset of DomainAPI used by waitForJob.
+type jobTarget interface {
+	JobStats(flags DomainJobStatsFlag) (DomainJobStats, error)
+}
+
+// WaitForJob waits until the job running on the domain "dom" finishes, as
+// "<Domain>.WaitForJob".
+func WaitForJob(ctx context.Context, dom DomainAPI, interval time.Duration, progress func(DomainJobStats)) (DomainJobStats, error) {
+	return waitForJob(ctx, dom, interval, progress)
+}
+
+// waitForJob implements WaitForJob.
+func waitForJob(ctx context.Context, dom jobTarget, interval time.Duration, progress func(DomainJobStats)) (DomainJobStats, error) {
+	if interval <= 0 {
+		interval = defaultJobPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := dom.JobStats(DomJobStatsDefault)
+		if err != nil {
+			return DomainJobStats{}, err
+		}
+
+		if stats.Type == DomJobNone {
+			break
+		}
+
+		if progress != nil {
+			progress(stats)
+		}
+
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	stats, err := dom.JobStats(DomJobStatsCompleted)
+	if err != nil {
+		return DomainJobStats{}, err
+	}
+
+	switch stats.Type {
+	case DomJobFailed:
+		if stats.ErrorMessage != "" {
+			return stats, fmt.Errorf("%w: %v", ErrJobFailed, stats.ErrorMessage)
+		}
+
+		return stats, ErrJobFailed
+	case DomJobCancelled:
+		return stats, ErrJobCancelled
+	}
+
+	return stats, nil
+}
+
+// shutdownTarget is the subset of DomainAPI used by shutdownAndWait.
+type shutdownTarget interface {
+	ShutdownFlags(flags DomainShutdownFlag) error
+	Destroy(flags DomainDestroyFlag) error
+	State() (DomainState, int32, error)
+	WaitForState(ctx context.Context, desired ...DomainState) (DomainState, int32, error)
+}
+
+// ShutdownAndWait shuts down the domain and waits until it's shut off,
+// following "policy": the shutdown request is sent again if the domain
+// doesn't shut off in time and, once all the retries fail, the domain can be
+// destroyed gracefully and then forcefully. The returned result tells which
+// step stopped the domain. ErrShutdownTimeout is returned if no step
+// succeeded, and ctx.Err() if the context is done before the domain shuts off.
+// Transient domains, which disappear when they shut off, are handled as well.
+func (dom Domain) ShutdownAndWait(ctx context.Context, policy DomainShutdownPolicy) (DomainShutdownResult, error) {
+	return ShutdownAndWait(ctx, NewDomainAPI(dom), policy)
+}
+
+// ShutdownAndWait shuts down the domain "dom" and waits until it's shut off,
+// as "<Domain>.ShutdownAndWait".
+func ShutdownAndWait(ctx context.Context, dom DomainAPI, policy DomainShutdownPolicy) (DomainShutdownResult, error) {
+	return shutdownAndWait(ctx, dom, policy)
+}
+
+// shutdownAndWait implements ShutdownAndWait.
+func shutdownAndWait(ctx context.Context, dom shutdownTarget, policy DomainShutdownPolicy) (DomainShutdownResult, error) {
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultShutdownTimeout
+	}
+
+	start := time.Now()
+	var result DomainShutdownResult
+
+	finish := func(err error) (DomainShutdownResult, error) {
+		result.Duration = time.Since(start)
+		return result, err
+	}
+
+	// isShutoff reads the domain state; a domain which doesn't exist anymore
+	// was transient and is shut off.
+	isShutoff := func() (bool, error) {
+		state, _, err := dom.State()
+		if IsNotFound(err) {
+			return true, nil
+		}
+
+		return state == DomStateShutoff, err
+	}
+
+	// waitShutoff waits until the domain is shut off or the timeout expires.
+	waitShutoff := func() (bool, error) {
+		waitCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+
+		_, _, err := dom.WaitForState(waitCtx, DomStateShutoff)
+		switch {
+		case err == nil || IsNotFound(err):
+			return true, nil
+		case ctx.Err() != nil:
+			return false, ctx.Err()
+		case err == context.DeadlineExceeded:
+			return isShutoff()
+		}
+
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return finish(err)
+	}
+
+	if off, err := isShutoff(); off || err != nil {
+		return finish(err)
+	}
+
+	for i := 0; i <= policy.Retries; i++ {
+		result.Step = DomShutdownStepRequest
+		result.Requests++
+
+		if err := dom.ShutdownFlags(policy.Flags); err != nil {
+			if off, stateErr := isShutoff(); off && stateErr == nil {
+				// it shut off in the meantime
+				return finish(nil)
+			}
+
+			return finish(err)
+		}
+
+		if off, err := waitShutoff(); off || err != nil {
+			return finish(err)
+		}
+	}
+
+	var steps []DomainShutdownStep
+	if policy.DestroyGraceful {
+		steps = append(steps, DomShutdownStepDestroyGraceful)
+	}
+	if policy.DestroyForce {
+		steps = append(steps, DomShutdownStepDestroy)
+	}
+
+	var destroyErr error
+	for _, step := range steps {
+		result.Step = step
+
+		flags := DomDestroyDefault
+		if step == DomShutdownStepDestroyGraceful {
+			flags = DomDestroyGraceful
+		}
+
+		if err := dom.Destroy(flags); err != nil {
+			if off, stateErr := isShutoff(); off && stateErr == nil {
+				return finish(nil)
+			}
+
+			// a graceful destroy fails if the process doesn't terminate,
+			// so the next step is still tried
+			destroyErr = err
+			continue
+		}
+
+		if off, err := waitShutoff(); off || err != nil {
+			return finish(err)
+		}
+	}
+
+	if destroyErr != nil {
+		return finish(destroyErr)
+	}
+
+	return finish(ErrShutdownTimeout)
+}
@@ -0,0 +1,951 @@
+// Code generated by "enumgen -flags DomainModificationImpact -text DomBlockedReasonUnkwown=unknown domain.go DomainListFlag=DomList DomainMetadataType=DomMeta DomainModificationImpact=DomAffect DomainXMLFlag=DomXML DomainCreateFlag=DomCreate DomainDestroyFlag=DomDestroy DomainUndefineFlag=DomUndefine DomainRebootFlag=DomReboot DomainShutdownFlag=DomShutdown DomainState=DomState DomainNostateReason=DomNostateReason DomainRunningReason=DomRunningReason DomainBlockedReason=DomBlockedReason DomainPausedReason=DomPausedReason DomainShutdownReason=DomShutdownReason DomainShutoffReason=DomShutoffReason DomainCrashedReason=DomCrashedReason DomainPMSuspendedReason=DomPMSuspendedReason DomainDumpFlag=DomDump DomainDumpFormat=DomDumpFormat DomainVCPUsFlag=DomVCPUs DomainSaveFlag=DomSave DomainDeviceModifyFlag=DomDeviceModify DomainMemoryModifyFlag=DomMemory DomainKeycodeSet=DomKeycodeSet DomainProcessSignal=DomSIG DomainBackupBeginFlag=DomBackupBegin DomainJobType=DomJob DomainJobOperation=DomJobOperation DomainJobStatsFlag=DomJobStats DomainShutdownStep=DomShutdownStep DomainControlState=DomControl DomainControlErrorReason=DomControlErrorReason DomainBlockCommitFlag=DomBlockCommit DomainBlockJobType=DomBlockJob DomainBlockJobInfoFlag=DomBlockJobInfo DomainBlockJobAbortFlag=DomBlockJobAbort"; DO NOT EDIT.
+
+package libvirt
+
+// domainListFlagNames holds the text form of the values of DomainListFlag.
+var domainListFlagNames = []enumName[DomainListFlag]{
+	{DomListAll, "all"},
+	{DomListActive, "active"},
+	{DomListInactive, "inactive"},
+	{DomListPersistent, "persistent"},
+	{DomListTransient, "transient"},
+	{DomListRunning, "running"},
+	{DomListPaused, "paused"},
+	{DomListShutOff, "shut_off"},
+	{DomListOther, "other"},
+	{DomListManagedSave, "managed_save"},
+	{DomListNoManagedSave, "no_managed_save"},
+	{DomListAutostart, "autostart"},
+	{DomListNoAutostart, "no_autostart"},
+	{DomListHasSnapshot, "has_snapshot"},
+	{DomListNoSnapshot, "no_snapshot"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainListFlag) String() string {
+	return formatFlags(v, domainListFlagNames, "DomainListFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainListFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainListFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainListFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainListFlagNames, "DomainListFlag")
+}
+
+// domainMetadataTypeNames holds the text form of the values of DomainMetadataType.
+var domainMetadataTypeNames = []enumName[DomainMetadataType]{
+	{DomMetaDescription, "description"},
+	{DomMetaTitle, "title"},
+	{DomMetaElement, "element"},
+}
+
+// String returns the text form of the value.
+func (v DomainMetadataType) String() string {
+	return formatEnum(v, domainMetadataTypeNames, "DomainMetadataType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainMetadataType) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainMetadataTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainMetadataType) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainMetadataTypeNames, "DomainMetadataType")
+}
+
+// domainModificationImpactNames holds the text form of the values of DomainModificationImpact.
+var domainModificationImpactNames = []enumName[DomainModificationImpact]{
+	{DomAffectCurrent, "current"},
+	{DomAffectLive, "live"},
+	{DomAffectConfig, "config"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainModificationImpact) String() string {
+	return formatFlags(v, domainModificationImpactNames, "DomainModificationImpact")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainModificationImpact) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainModificationImpactNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainModificationImpact) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainModificationImpactNames, "DomainModificationImpact")
+}
+
+// domainXMLFlagNames holds the text form of the values of DomainXMLFlag.
+var domainXMLFlagNames = []enumName[DomainXMLFlag]{
+	{DomXMLDefault, "default"},
+	{DomXMLSecure, "secure"},
+	{DomXMLInactive, "inactive"},
+	{DomXMLUpdateCPU, "update_cpu"},
+	{DomXMLMigratable, "migratable"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainXMLFlag) String() string {
+	return formatFlags(v, domainXMLFlagNames, "DomainXMLFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainXMLFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainXMLFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainXMLFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainXMLFlagNames, "DomainXMLFlag")
+}
+
+// domainCreateFlagNames holds the text form of the values of DomainCreateFlag.
+var domainCreateFlagNames = []enumName[DomainCreateFlag]{
+	{DomCreateDefault, "default"},
+	{DomCreatePaused, "paused"},
+	{DomCreateAutodestroy, "autodestroy"},
+	{DomCreateBypassCache, "bypass_cache"},
+	{DomCreateForceBoot, "force_boot"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainCreateFlag) String() string {
+	return formatFlags(v, domainCreateFlagNames, "DomainCreateFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainCreateFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainCreateFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainCreateFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainCreateFlagNames, "DomainCreateFlag")
+}
+
+// domainDestroyFlagNames holds the text form of the values of DomainDestroyFlag.
+var domainDestroyFlagNames = []enumName[DomainDestroyFlag]{
+	{DomDestroyDefault, "default"},
+	{DomDestroyGraceful, "graceful"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainDestroyFlag) String() string {
+	return formatFlags(v, domainDestroyFlagNames, "DomainDestroyFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainDestroyFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainDestroyFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainDestroyFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainDestroyFlagNames, "DomainDestroyFlag")
+}
+
+// domainUndefineFlagNames holds the text form of the values of DomainUndefineFlag.
+var domainUndefineFlagNames = []enumName[DomainUndefineFlag]{
+	{DomUndefineDefault, "default"},
+	{DomUndefineManagedSave, "managed_save"},
+	{DomUndefineSnapshotsMetadata, "snapshots_metadata"},
+	{DomUndefineNVRAM, "nvram"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainUndefineFlag) String() string {
+	return formatFlags(v, domainUndefineFlagNames, "DomainUndefineFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainUndefineFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainUndefineFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainUndefineFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainUndefineFlagNames, "DomainUndefineFlag")
+}
+
+// domainRebootFlagNames holds the text form of the values of DomainRebootFlag.
+var domainRebootFlagNames = []enumName[DomainRebootFlag]{
+	{DomRebootDefault, "default"},
+	{DomRebootACPIPowerBtn, "acpi_power_btn"},
+	{DomRebootGuestAgent, "guest_agent"},
+	{DomRebootInitctl, "initctl"},
+	{DomRebootSignal, "signal"},
+	{DomRebootParavirt, "paravirt"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainRebootFlag) String() string {
+	return formatFlags(v, domainRebootFlagNames, "DomainRebootFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainRebootFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainRebootFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainRebootFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainRebootFlagNames, "DomainRebootFlag")
+}
+
+// domainShutdownFlagNames holds the text form of the values of DomainShutdownFlag.
+var domainShutdownFlagNames = []enumName[DomainShutdownFlag]{
+	{DomShutdownDefault, "default"},
+	{DomShutdownACPIPowerBtn, "acpi_power_btn"},
+	{DomShutdownGuestAgent, "guest_agent"},
+	{DomShutdownInitctl, "initctl"},
+	{DomShutdownSignal, "signal"},
+	{DomShutdownParavirt, "paravirt"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainShutdownFlag) String() string {
+	return formatFlags(v, domainShutdownFlagNames, "DomainShutdownFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainShutdownFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainShutdownFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainShutdownFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainShutdownFlagNames, "DomainShutdownFlag")
+}
+
+// domainStateNames holds the text form of the values of DomainState.
+var domainStateNames = []enumName[DomainState]{
+	{DomStateNone, "none"},
+	{DomStateRunning, "running"},
+	{DomStateBlocked, "blocked"},
+	{DomStatePaused, "paused"},
+	{DomStateShutdown, "shutdown"},
+	{DomStateShutoff, "shutoff"},
+	{DomStateCrashed, "crashed"},
+	{DomStatePMSuspended, "pm_suspended"},
+}
+
+// String returns the text form of the value.
+func (v DomainState) String() string {
+	return formatEnum(v, domainStateNames, "DomainState")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainState) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainStateNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainState) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainStateNames, "DomainState")
+}
+
+// domainNostateReasonNames holds the text form of the values of DomainNostateReason.
+var domainNostateReasonNames = []enumName[DomainNostateReason]{
+	{DomNostateReasonUnknown, "unknown"},
+}
+
+// String returns the text form of the value.
+func (v DomainNostateReason) String() string {
+	return formatEnum(v, domainNostateReasonNames, "DomainNostateReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainNostateReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainNostateReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainNostateReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainNostateReasonNames, "DomainNostateReason")
+}
+
+// domainRunningReasonNames holds the text form of the values of DomainRunningReason.
+var domainRunningReasonNames = []enumName[DomainRunningReason]{
+	{DomRunningReasonUnknown, "unknown"},
+	{DomRunningReasonBooted, "booted"},
+	{DomRunningReasonMigrated, "migrated"},
+	{DomRunningReasonRestored, "restored"},
+	{DomRunningReasonFromSnapshot, "from_snapshot"},
+	{DomRunningReasonUnpaused, "unpaused"},
+	{DomRunningReasonMigrationCancelled, "migration_cancelled"},
+	{DomRunningReasonSaveCancelled, "save_cancelled"},
+	{DomRunningReasonWakeUp, "wake_up"},
+	{DomRunningReasonCrashed, "crashed"},
+}
+
+// String returns the text form of the value.
+func (v DomainRunningReason) String() string {
+	return formatEnum(v, domainRunningReasonNames, "DomainRunningReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainRunningReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainRunningReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainRunningReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainRunningReasonNames, "DomainRunningReason")
+}
+
+// domainBlockedReasonNames holds the text form of the values of DomainBlockedReason.
+var domainBlockedReasonNames = []enumName[DomainBlockedReason]{
+	{DomBlockedReasonUnkwown, "unknown"},
+}
+
+// String returns the text form of the value.
+func (v DomainBlockedReason) String() string {
+	return formatEnum(v, domainBlockedReasonNames, "DomainBlockedReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBlockedReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainBlockedReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBlockedReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainBlockedReasonNames, "DomainBlockedReason")
+}
+
+// domainPausedReasonNames holds the text form of the values of DomainPausedReason.
+var domainPausedReasonNames = []enumName[DomainPausedReason]{
+	{DomPausedReasonUnknown, "unknown"},
+	{DomPausedReasonUser, "user"},
+	{DomPausedReasonMigration, "migration"},
+	{DomPausedReasonSave, "save"},
+	{DomPausedReasonDump, "dump"},
+	{DomPausedReasonIOError, "io_error"},
+	{DomPausedReasonWatchdog, "watchdog"},
+	{DomPausedReasonFromSnapshot, "from_snapshot"},
+	{DomPausedReasonShuttingDown, "shutting_down"},
+	{DomPausedReasonSnapshot, "snapshot"},
+	{DomPausedReasonCrashed, "crashed"},
+}
+
+// String returns the text form of the value.
+func (v DomainPausedReason) String() string {
+	return formatEnum(v, domainPausedReasonNames, "DomainPausedReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainPausedReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainPausedReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainPausedReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainPausedReasonNames, "DomainPausedReason")
+}
+
+// domainShutdownReasonNames holds the text form of the values of DomainShutdownReason.
+var domainShutdownReasonNames = []enumName[DomainShutdownReason]{
+	{DomShutdownReasonUnknown, "unknown"},
+	{DomShutdownReasonUser, "user"},
+}
+
+// String returns the text form of the value.
+func (v DomainShutdownReason) String() string {
+	return formatEnum(v, domainShutdownReasonNames, "DomainShutdownReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainShutdownReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainShutdownReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainShutdownReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainShutdownReasonNames, "DomainShutdownReason")
+}
+
+// domainShutoffReasonNames holds the text form of the values of DomainShutoffReason.
+var domainShutoffReasonNames = []enumName[DomainShutoffReason]{
+	{DomShutoffReasonUnknown, "unknown"},
+	{DomShutoffReasonShutdown, "shutdown"},
+	{DomShutoffReasonDestroyed, "destroyed"},
+	{DomShutoffReasonCrashed, "crashed"},
+	{DomShutoffReasonMigrated, "migrated"},
+	{DomShutoffReasonSaved, "saved"},
+	{DomShutoffReasonFailed, "failed"},
+	{DomShutoffReasonFromSnapshot, "from_snapshot"},
+}
+
+// String returns the text form of the value.
+func (v DomainShutoffReason) String() string {
+	return formatEnum(v, domainShutoffReasonNames, "DomainShutoffReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainShutoffReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainShutoffReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainShutoffReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainShutoffReasonNames, "DomainShutoffReason")
+}
+
+// domainCrashedReasonNames holds the text form of the values of DomainCrashedReason.
+var domainCrashedReasonNames = []enumName[DomainCrashedReason]{
+	{DomCrashedReasonUnknown, "unknown"},
+	{DomCrashedReasonPanicked, "panicked"},
+}
+
+// String returns the text form of the value.
+func (v DomainCrashedReason) String() string {
+	return formatEnum(v, domainCrashedReasonNames, "DomainCrashedReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainCrashedReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainCrashedReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainCrashedReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainCrashedReasonNames, "DomainCrashedReason")
+}
+
+// domainPMSuspendedReasonNames holds the text form of the values of DomainPMSuspendedReason.
+var domainPMSuspendedReasonNames = []enumName[DomainPMSuspendedReason]{
+	{DomPMSuspendedReasonUnknown, "unknown"},
+}
+
+// String returns the text form of the value.
+func (v DomainPMSuspendedReason) String() string {
+	return formatEnum(v, domainPMSuspendedReasonNames, "DomainPMSuspendedReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainPMSuspendedReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainPMSuspendedReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainPMSuspendedReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainPMSuspendedReasonNames, "DomainPMSuspendedReason")
+}
+
+// domainDumpFlagNames holds the text form of the values of DomainDumpFlag.
+var domainDumpFlagNames = []enumName[DomainDumpFlag]{
+	{DomDumpDefault, "default"},
+	{DomDumpCrash, "crash"},
+	{DomDumpLive, "live"},
+	{DomDumpBypassCache, "bypass_cache"},
+	{DomDumpReset, "reset"},
+	{DomDumpMemoryOnly, "memory_only"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainDumpFlag) String() string {
+	return formatFlags(v, domainDumpFlagNames, "DomainDumpFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainDumpFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainDumpFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainDumpFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainDumpFlagNames, "DomainDumpFlag")
+}
+
+// domainDumpFormatNames holds the text form of the values of DomainDumpFormat.
+var domainDumpFormatNames = []enumName[DomainDumpFormat]{
+	{DomDumpFormatRaw, "raw"},
+	{DomDumpFormatKdumpZlib, "kdump_zlib"},
+	{DomDumpFormatKdumpLzo, "kdump_lzo"},
+	{DomDumpFormatKdumpSnappy, "kdump_snappy"},
+}
+
+// String returns the text form of the value.
+func (v DomainDumpFormat) String() string {
+	return formatEnum(v, domainDumpFormatNames, "DomainDumpFormat")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainDumpFormat) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainDumpFormatNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainDumpFormat) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainDumpFormatNames, "DomainDumpFormat")
+}
+
+// domainVCPUsFlagNames holds the text form of the values of DomainVCPUsFlag.
+var domainVCPUsFlagNames = []enumName[DomainVCPUsFlag]{
+	{DomVCPusConfig, "config"},
+	{DomVCPUsCurrent, "current"},
+	{DomVCPUsLive, "live"},
+	{DomVCPUsMaximum, "maximum"},
+	{DomVCPUsGuest, "guest"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainVCPUsFlag) String() string {
+	return formatFlags(v, domainVCPUsFlagNames, "DomainVCPUsFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainVCPUsFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainVCPUsFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainVCPUsFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainVCPUsFlagNames, "DomainVCPUsFlag")
+}
+
+// domainSaveFlagNames holds the text form of the values of DomainSaveFlag.
+var domainSaveFlagNames = []enumName[DomainSaveFlag]{
+	{DomSaveDefault, "default"},
+	{DomSaveBypassCache, "bypass_cache"},
+	{DomSaveRunning, "running"},
+	{DomSavePaused, "paused"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainSaveFlag) String() string {
+	return formatFlags(v, domainSaveFlagNames, "DomainSaveFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainSaveFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainSaveFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainSaveFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainSaveFlagNames, "DomainSaveFlag")
+}
+
+// domainDeviceModifyFlagNames holds the text form of the values of DomainDeviceModifyFlag.
+var domainDeviceModifyFlagNames = []enumName[DomainDeviceModifyFlag]{
+	{DomDeviceModifyConfig, "config"},
+	{DomDeviceModifyCurrent, "current"},
+	{DomDeviceModifyLive, "live"},
+	{DomDeviceModifyForce, "force"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainDeviceModifyFlag) String() string {
+	return formatFlags(v, domainDeviceModifyFlagNames, "DomainDeviceModifyFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainDeviceModifyFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainDeviceModifyFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainDeviceModifyFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainDeviceModifyFlagNames, "DomainDeviceModifyFlag")
+}
+
+// domainMemoryModifyFlagNames holds the text form of the values of DomainMemoryModifyFlag.
+var domainMemoryModifyFlagNames = []enumName[DomainMemoryModifyFlag]{
+	{DomMemoryConfig, "config"},
+	{DomMemoryCurrent, "current"},
+	{DomMemoryLive, "live"},
+	{DomMemoryMaximum, "maximum"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainMemoryModifyFlag) String() string {
+	return formatFlags(v, domainMemoryModifyFlagNames, "DomainMemoryModifyFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainMemoryModifyFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainMemoryModifyFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainMemoryModifyFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainMemoryModifyFlagNames, "DomainMemoryModifyFlag")
+}
+
+// domainKeycodeSetNames holds the text form of the values of DomainKeycodeSet.
+var domainKeycodeSetNames = []enumName[DomainKeycodeSet]{
+	{DomKeycodeSetLinux, "linux"},
+	{DomKeycodeSetXT, "xt"},
+	{DomKeycodeSetATSet1, "at_set1"},
+	{DomKeycodeSetATSet2, "at_set2"},
+	{DomKeycodeSetATSet3, "at_set3"},
+	{DomKeycodeSetOSX, "osx"},
+	{DomKeycodeSetXTKbd, "xt_kbd"},
+	{DomKeycodeSetUSB, "usb"},
+	{DomKeycodeSetWin32, "win32"},
+	{DomKeycodeSetRFB, "rfb"},
+}
+
+// String returns the text form of the value.
+func (v DomainKeycodeSet) String() string {
+	return formatEnum(v, domainKeycodeSetNames, "DomainKeycodeSet")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainKeycodeSet) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainKeycodeSetNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainKeycodeSet) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainKeycodeSetNames, "DomainKeycodeSet")
+}
+
+// domainProcessSignalNames holds the text form of the values of DomainProcessSignal.
+var domainProcessSignalNames = []enumName[DomainProcessSignal]{
+	{DomSIGNOP, "nop"},
+	{DomSIGHUP, "hup"},
+	{DomSIGINT, "int"},
+	{DomSIGQUIT, "quit"},
+	{DomSIGILL, "ill"},
+	{DomSIGTRAP, "trap"},
+	{DomSIGABRT, "abrt"},
+	{DomSIGBUS, "bus"},
+	{DomSIGFPE, "fpe"},
+	{DomSIGKILL, "kill"},
+	{DomSIGUSR1, "usr1"},
+	{DomSIGSEGV, "segv"},
+	{DomSIGUSR2, "usr2"},
+	{DomSIGPIPE, "pipe"},
+	{DomSIGALRM, "alrm"},
+	{DomSIGTERM, "term"},
+	{DomSIGSTKFLT, "stkflt"},
+	{DomSIGCHLD, "chld"},
+	{DomSIGCONT, "cont"},
+	{DomSIGSTOP, "stop"},
+	{DomSIGTSTP, "tstp"},
+	{DomSIGTTIN, "ttin"},
+	{DomSIGTTOU, "ttou"},
+	{DomSIGURG, "urg"},
+	{DomSIGXCPU, "xcpu"},
+	{DomSIGXFSZ, "xfsz"},
+	{DomSIGVTALRM, "vtalrm"},
+	{DomSIGPROF, "prof"},
+	{DomSIGWINCH, "winch"},
+	{DomSIGPOLL, "poll"},
+	{DomSIGPWR, "pwr"},
+	{DomSIGSYS, "sys"},
+	{DomSIGRT0, "rt0"},
+	{DomSIGRT1, "rt1"},
+	{DomSIGRT2, "rt2"},
+	{DomSIGRT3, "rt3"},
+	{DomSIGRT4, "rt4"},
+	{DomSIGRT5, "rt5"},
+	{DomSIGRT6, "rt6"},
+	{DomSIGRT7, "rt7"},
+	{DomSIGRT8, "rt8"},
+	{DomSIGRT9, "rt9"},
+	{DomSIGRT10, "rt10"},
+	{DomSIGRT11, "rt11"},
+	{DomSIGRT12, "rt12"},
+	{DomSIGRT13, "rt13"},
+	{DomSIGRT14, "rt14"},
+	{DomSIGRT15, "rt15"},
+	{DomSIGRT16, "rt16"},
+	{DomSIGRT17, "rt17"},
+	{DomSIGRT18, "rt18"},
+	{DomSIGRT19, "rt19"},
+	{DomSIGRT20, "rt20"},
+	{DomSIGRT21, "rt21"},
+	{DomSIGRT22, "rt22"},
+	{DomSIGRT23, "rt23"},
+	{DomSIGRT24, "rt24"},
+	{DomSIGRT25, "rt25"},
+	{DomSIGRT26, "rt26"},
+	{DomSIGRT27, "rt27"},
+	{DomSIGRT28, "rt28"},
+	{DomSIGRT29, "rt29"},
+	{DomSIGRT30, "rt30"},
+	{DomSIGRT31, "rt31"},
+	{DomSIGRT32, "rt32"},
+}
+
+// String returns the text form of the value.
+func (v DomainProcessSignal) String() string {
+	return formatEnum(v, domainProcessSignalNames, "DomainProcessSignal")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainProcessSignal) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainProcessSignalNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainProcessSignal) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainProcessSignalNames, "DomainProcessSignal")
+}
+
+// domainBackupBeginFlagNames holds the text form of the values of DomainBackupBeginFlag.
+var domainBackupBeginFlagNames = []enumName[DomainBackupBeginFlag]{
+	{DomBackupBeginDefault, "default"},
+	{DomBackupBeginReuseExternal, "reuse_external"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainBackupBeginFlag) String() string {
+	return formatFlags(v, domainBackupBeginFlagNames, "DomainBackupBeginFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBackupBeginFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainBackupBeginFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBackupBeginFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainBackupBeginFlagNames, "DomainBackupBeginFlag")
+}
+
+// domainJobTypeNames holds the text form of the values of DomainJobType.
+var domainJobTypeNames = []enumName[DomainJobType]{
+	{DomJobNone, "none"},
+	{DomJobBounded, "bounded"},
+	{DomJobUnbounded, "unbounded"},
+	{DomJobCompleted, "completed"},
+	{DomJobFailed, "failed"},
+	{DomJobCancelled, "cancelled"},
+}
+
+// String returns the text form of the value.
+func (v DomainJobType) String() string {
+	return formatEnum(v, domainJobTypeNames, "DomainJobType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainJobType) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainJobTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainJobType) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainJobTypeNames, "DomainJobType")
+}
+
+// domainJobOperationNames holds the text form of the values of DomainJobOperation.
+var domainJobOperationNames = []enumName[DomainJobOperation]{
+	{DomJobOperationUnknown, "unknown"},
+	{DomJobOperationStart, "start"},
+	{DomJobOperationSave, "save"},
+	{DomJobOperationRestore, "restore"},
+	{DomJobOperationMigrationIn, "migration_in"},
+	{DomJobOperationMigrationOut, "migration_out"},
+	{DomJobOperationSnapshot, "snapshot"},
+	{DomJobOperationSnapshotRevert, "snapshot_revert"},
+	{DomJobOperationDump, "dump"},
+	{DomJobOperationBackup, "backup"},
+}
+
+// String returns the text form of the value.
+func (v DomainJobOperation) String() string {
+	return formatEnum(v, domainJobOperationNames, "DomainJobOperation")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainJobOperation) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainJobOperationNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainJobOperation) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainJobOperationNames, "DomainJobOperation")
+}
+
+// domainJobStatsFlagNames holds the text form of the values of DomainJobStatsFlag.
+var domainJobStatsFlagNames = []enumName[DomainJobStatsFlag]{
+	{DomJobStatsDefault, "default"},
+	{DomJobStatsCompleted, "completed"},
+	{DomJobStatsKeepCompleted, "keep_completed"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainJobStatsFlag) String() string {
+	return formatFlags(v, domainJobStatsFlagNames, "DomainJobStatsFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainJobStatsFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainJobStatsFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainJobStatsFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainJobStatsFlagNames, "DomainJobStatsFlag")
+}
+
+// domainShutdownStepNames holds the text form of the values of DomainShutdownStep.
+var domainShutdownStepNames = []enumName[DomainShutdownStep]{
+	{DomShutdownStepNone, "none"},
+	{DomShutdownStepRequest, "request"},
+	{DomShutdownStepDestroyGraceful, "destroy_graceful"},
+	{DomShutdownStepDestroy, "destroy"},
+}
+
+// String returns the text form of the value.
+func (v DomainShutdownStep) String() string {
+	return formatEnum(v, domainShutdownStepNames, "DomainShutdownStep")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainShutdownStep) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainShutdownStepNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainShutdownStep) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainShutdownStepNames, "DomainShutdownStep")
+}
+
+// domainControlStateNames holds the text form of the values of DomainControlState.
+var domainControlStateNames = []enumName[DomainControlState]{
+	{DomControlOK, "ok"},
+	{DomControlJob, "job"},
+	{DomControlOccupied, "occupied"},
+	{DomControlError, "error"},
+}
+
+// String returns the text form of the value.
+func (v DomainControlState) String() string {
+	return formatEnum(v, domainControlStateNames, "DomainControlState")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainControlState) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainControlStateNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainControlState) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainControlStateNames, "DomainControlState")
+}
+
+// domainControlErrorReasonNames holds the text form of the values of DomainControlErrorReason.
+var domainControlErrorReasonNames = []enumName[DomainControlErrorReason]{
+	{DomControlErrorReasonNone, "none"},
+	{DomControlErrorReasonUnknown, "unknown"},
+	{DomControlErrorReasonMonitor, "monitor"},
+	{DomControlErrorReasonInternal, "internal"},
+}
+
+// String returns the text form of the value.
+func (v DomainControlErrorReason) String() string {
+	return formatEnum(v, domainControlErrorReasonNames, "DomainControlErrorReason")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainControlErrorReason) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainControlErrorReasonNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainControlErrorReason) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainControlErrorReasonNames, "DomainControlErrorReason")
+}
+
+// domainBlockCommitFlagNames holds the text form of the values of DomainBlockCommitFlag.
+var domainBlockCommitFlagNames = []enumName[DomainBlockCommitFlag]{
+	{DomBlockCommitDefault, "default"},
+	{DomBlockCommitShallow, "shallow"},
+	{DomBlockCommitDelete, "delete"},
+	{DomBlockCommitActive, "active"},
+	{DomBlockCommitRelative, "relative"},
+	{DomBlockCommitBandwidthBytes, "bandwidth_bytes"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainBlockCommitFlag) String() string {
+	return formatFlags(v, domainBlockCommitFlagNames, "DomainBlockCommitFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBlockCommitFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainBlockCommitFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBlockCommitFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainBlockCommitFlagNames, "DomainBlockCommitFlag")
+}
+
+// domainBlockJobTypeNames holds the text form of the values of DomainBlockJobType.
+var domainBlockJobTypeNames = []enumName[DomainBlockJobType]{
+	{DomBlockJobUnknown, "unknown"},
+	{DomBlockJobPull, "pull"},
+	{DomBlockJobCopy, "copy"},
+	{DomBlockJobCommit, "commit"},
+	{DomBlockJobActiveCommit, "active_commit"},
+	{DomBlockJobBackup, "backup"},
+}
+
+// String returns the text form of the value.
+func (v DomainBlockJobType) String() string {
+	return formatEnum(v, domainBlockJobTypeNames, "DomainBlockJobType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBlockJobType) MarshalText() ([]byte, error) {
+	return marshalEnum(v, domainBlockJobTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBlockJobType) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, domainBlockJobTypeNames, "DomainBlockJobType")
+}
+
+// domainBlockJobInfoFlagNames holds the text form of the values of DomainBlockJobInfoFlag.
+var domainBlockJobInfoFlagNames = []enumName[DomainBlockJobInfoFlag]{
+	{DomBlockJobInfoDefault, "default"},
+	{DomBlockJobInfoBandwidthBytes, "bandwidth_bytes"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainBlockJobInfoFlag) String() string {
+	return formatFlags(v, domainBlockJobInfoFlagNames, "DomainBlockJobInfoFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBlockJobInfoFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainBlockJobInfoFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBlockJobInfoFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainBlockJobInfoFlagNames, "DomainBlockJobInfoFlag")
+}
+
+// domainBlockJobAbortFlagNames holds the text form of the values of DomainBlockJobAbortFlag.
+var domainBlockJobAbortFlagNames = []enumName[DomainBlockJobAbortFlag]{
+	{DomBlockJobAbortDefault, "default"},
+	{DomBlockJobAbortAsync, "async"},
+	{DomBlockJobAbortPivot, "pivot"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v DomainBlockJobAbortFlag) String() string {
+	return formatFlags(v, domainBlockJobAbortFlagNames, "DomainBlockJobAbortFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v DomainBlockJobAbortFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, domainBlockJobAbortFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *DomainBlockJobAbortFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, domainBlockJobAbortFlagNames, "DomainBlockJobAbortFlag")
+}
@@ -2,6 +2,8 @@ package libvirt
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -598,6 +600,144 @@ func TestDomainDevices(t *testing.T) {
 	}
 }
 
+func TestDomainSaveContext(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	if err := env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	file, ioerr := ioutil.TempFile("", fmt.Sprintf("%v-save-context_", env.domData.Name))
+	if ioerr != nil {
+		t.Fatal(ioerr)
+	}
+	defer os.Remove(file.Name())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := env.dom.SaveContext(ctx, file.Name(), "", DomSaveDefault); err != context.Canceled {
+		t.Errorf("unexpected error when saving with a cancelled context; got=%v, want=%v", err, context.Canceled)
+	}
+
+	if active, err := env.dom.IsActive(); err != nil || !active {
+		t.Errorf("domain should still be running after a cancelled save; active=%v, err=%v", active, err)
+	}
+
+	if err := env.dom.SaveContext(context.Background(), file.Name(), "", DomSaveDefault); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewDomainStateInfo(t *testing.T) {
+	tests := []struct {
+		state      DomainState
+		reason     int32
+		wantReason DomainStateReason
+		wantText   string
+	}{
+		{DomStateRunning, int32(DomRunningReasonBooted), DomRunningReasonBooted, "running (booted)"},
+		{DomStatePaused, int32(DomPausedReasonIOError), DomPausedReasonIOError, "paused (io_error)"},
+		{DomStateShutoff, int32(DomShutoffReasonSaved), DomShutoffReasonSaved, "shutoff (saved)"},
+		{DomStateCrashed, int32(DomCrashedReasonPanicked), DomCrashedReasonPanicked, "crashed (panicked)"},
+		{DomainState(1000), 1, nil, "DomainState(1000)"},
+	}
+
+	for _, tt := range tests {
+		info := NewDomainStateInfo(tt.state, tt.reason)
+
+		if info.State != tt.state || info.Reason != tt.wantReason {
+			t.Errorf("unexpected state info; got=%#v, want=%v/%#v", info, tt.state, tt.wantReason)
+		}
+
+		if text := info.String(); text != tt.wantText {
+			t.Errorf("unexpected state info text; got=%q, want=%q", text, tt.wantText)
+		}
+	}
+}
+
+func TestDomainStateWithReason(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	if _, err := env.dom.ControlInfo(); err == nil {
+		t.Error("an error was not returned when reading the control info of an inactive domain")
+	}
+
+	if err := env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := env.dom.StateWithReason()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reason, ok := info.Reason.(DomainRunningReason); info.State != DomStateRunning || !ok || reason != DomRunningReasonBooted {
+		t.Errorf("unexpected domain state; got=%v, want=%v (%v)", info, DomStateRunning, DomRunningReasonBooted)
+	}
+
+	if err = env.dom.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err = env.dom.StateWithReason(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reason, ok := info.Reason.(DomainPausedReason); info.State != DomStatePaused || !ok || reason != DomPausedReasonUser {
+		t.Errorf("unexpected domain state; got=%v, want=%v (%v)", info, DomStatePaused, DomPausedReasonUser)
+	}
+
+	control, err := env.dom.ControlInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if control.State != DomControlOK {
+		t.Errorf("unexpected control state; got=%v, want=%v", control.State, DomControlOK)
+	}
+}
+
+func TestDomainWaitForState(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	state, reason, err := env.dom.WaitForState(context.Background(), DomStateShutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != DomStateShutoff {
+		t.Errorf("unexpected domain state; got=%v, want=%v", state, DomStateShutoff)
+	}
+
+	if DomainShutoffReason(reason) != DomShutoffReasonUnknown {
+		t.Errorf("unexpected shutoff reason; got=%v, want=%v", reason, DomShutoffReasonUnknown)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, _, err = env.dom.WaitForState(ctx, DomStateRunning); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error when waiting for an unreached state; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	if err = env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	state, reason, err = env.dom.WaitForState(context.Background(), DomStateRunning, DomStatePaused)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != DomStateRunning || DomainRunningReason(reason) != DomRunningReasonBooted {
+		t.Errorf("unexpected domain state; got=%v (reason = %v), want=%v (reason = %v)", state, reason, DomStateRunning, DomRunningReasonBooted)
+	}
+}
+
 func TestDomainManagedSave(t *testing.T) {
 	env := newTestEnvironment(t).withDomain()
 	defer env.cleanUp()
@@ -816,6 +956,153 @@ func TestDomainLookupSnapshot(t *testing.T) {
 	}
 }
 
+func TestDomainListCheckpoints(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	checkpoints, err := env.dom.ListCheckpoints(CheckpointListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cp := range checkpoints {
+		defer cp.Free()
+	}
+
+	if l := len(checkpoints); l != 1 {
+		t.Errorf("unexpected checkpoints count; got=%v, want=1", l)
+	}
+}
+
+func TestDomainLookupCheckpoint(t *testing.T) {
+	env := newTestEnvironment(t).withCheckpoint()
+	defer env.cleanUp()
+
+	if _, err := env.dom.LookupCheckpointByName(""); err == nil {
+		t.Error("an error was not returned when looking up a checkpoint with an empty name")
+	}
+
+	cp, err := env.dom.LookupCheckpointByName(env.cpData.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Free()
+
+	name, err := cp.Name()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if name != env.cpData.Name {
+		t.Errorf("unexpected checkpoint name; got=%v, want=%v", name, env.cpData.Name)
+	}
+}
+
+func TestDomainBackup(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	if err := env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.dom.BackupXML(); err == nil {
+		t.Error("an error was not returned when reading the backup XML without a backup job")
+	}
+
+	backupFile, err := ioutil.TempFile("", fmt.Sprintf("%v-backup_", env.domData.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupFile.Close()
+	defer os.Remove(backupFile.Name())
+
+	backupXML := fmt.Sprintf(`
+<domainbackup>
+    <disks>
+        <disk name="%v" type="file">
+            <target file="%v" />
+            <driver type="raw" />
+        </disk>
+    </disks>
+</domainbackup>`, env.domData.DiskTarget, backupFile.Name())
+
+	if err = env.dom.BackupBegin(backupXML, "", DomBackupBeginReuseExternal); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := env.dom.WaitForJob(context.Background(), 100*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Type != DomJobCompleted {
+		t.Errorf("unexpected backup job type; got=%v, want=%v", stats.Type, DomJobCompleted)
+	}
+
+	if stats.Operation != DomJobOperationBackup {
+		t.Errorf("unexpected backup job operation; got=%v, want=%v", stats.Operation, DomJobOperationBackup)
+	}
+}
+
+// scriptedJob is a jobTarget whose job runs for a number of reads and then
+// completes with "result".
+type scriptedJob struct {
+	runningReads int
+	result       DomainJobStats
+}
+
+func (job *scriptedJob) JobStats(flags DomainJobStatsFlag) (DomainJobStats, error) {
+	if flags&DomJobStatsCompleted != 0 {
+		return job.result, nil
+	}
+
+	if job.runningReads > 0 {
+		job.runningReads--
+		return DomainJobStats{Type: DomJobBounded, DataProcessed: 1, DataTotal: 2}, nil
+	}
+
+	return DomainJobStats{Type: DomJobNone}, nil
+}
+
+func TestDomainWaitForJobResult(t *testing.T) {
+	ctx := context.Background()
+
+	// the progress is reported while the job runs, but not for the result
+	var reports int
+	job := &scriptedJob{runningReads: 2, result: DomainJobStats{Type: DomJobCompleted}}
+	stats, err := waitForJob(ctx, job, time.Millisecond, func(stats DomainJobStats) {
+		if stats.Type != DomJobBounded {
+			t.Errorf("unexpected job type in progress; got=%v, want=%v", stats.Type, DomJobBounded)
+		}
+		reports++
+	})
+	if err != nil || stats.Type != DomJobCompleted {
+		t.Errorf("unexpected result of a completed job; got=%v (err = %v), want=%v", stats.Type, err, DomJobCompleted)
+	}
+
+	if reports != 2 {
+		t.Errorf("unexpected number of progress reports; got=%v, want=2", reports)
+	}
+
+	// a failed job, with and without a message
+	job = &scriptedJob{result: DomainJobStats{Type: DomJobFailed, ErrorMessage: "disk full"}}
+	if _, err = waitForJob(ctx, job, 0, nil); !errors.Is(err, ErrJobFailed) || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("unexpected error of a failed job; got=%v, want=%v with its message", err, ErrJobFailed)
+	}
+
+	job = &scriptedJob{result: DomainJobStats{Type: DomJobFailed}}
+	if _, err = waitForJob(ctx, job, 0, nil); err != ErrJobFailed {
+		t.Errorf("unexpected error of a failed job; got=%v, want=%v", err, ErrJobFailed)
+	}
+
+	// a cancelled job
+	job = &scriptedJob{result: DomainJobStats{Type: DomJobCancelled}}
+	if stats, err = waitForJob(ctx, job, 0, nil); err != ErrJobCancelled || stats.Type != DomJobCancelled {
+		t.Errorf("unexpected result of a cancelled job; got=%v (err = %v), want=%v", stats.Type, err, ErrJobCancelled)
+	}
+}
+
 func BenchmarkDomainSuspendResume(b *testing.B) {
 	env := newTestEnvironment(b).withDomain()
 	defer env.cleanUp()
@@ -912,3 +1199,181 @@ func BenchmarkDomainCreateSnapshot(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+// scriptedDomain is a shutdownTarget which shuts off after a number of
+// shutdown requests.
+type scriptedDomain struct {
+	state         DomainState
+	shutdownAfter int  // requests needed to shut down; 0 means never
+	gracefulFails bool // whether Destroy fails with DomDestroyGraceful
+	transient     bool // whether the domain disappears when it shuts off
+	requests      int
+}
+
+func (dom *scriptedDomain) ShutdownFlags(flags DomainShutdownFlag) error {
+	dom.requests++
+	if dom.shutdownAfter > 0 && dom.requests >= dom.shutdownAfter {
+		dom.state = DomStateShutoff
+	}
+
+	return nil
+}
+
+func (dom *scriptedDomain) Destroy(flags DomainDestroyFlag) error {
+	if flags == DomDestroyGraceful && dom.gracefulFails {
+		return &Error{Code: ErrSystem, Message: "Failed to terminate process with SIGTERM"}
+	}
+
+	dom.state = DomStateShutoff
+
+	return nil
+}
+
+func (dom *scriptedDomain) State() (DomainState, int32, error) {
+	if dom.transient && dom.state == DomStateShutoff {
+		return 0, 0, &Error{Code: ErrNoDomain}
+	}
+
+	return dom.state, 0, nil
+}
+
+func (dom *scriptedDomain) WaitForState(ctx context.Context, desired ...DomainState) (DomainState, int32, error) {
+	var state DomainState
+
+	err := waitUntil(ctx, nil, func() (bool, error) {
+		var err error
+		if state, _, err = dom.State(); err != nil {
+			return false, err
+		}
+
+		return state == desired[0], nil
+	})
+
+	return state, 0, err
+}
+
+func TestDomainShutdownAndWaitSteps(t *testing.T) {
+	policy := DomainShutdownPolicy{
+		Timeout: 5 * time.Millisecond,
+	}
+
+	escalate := policy
+	escalate.DestroyGraceful = true
+	escalate.DestroyForce = true
+
+	retry := policy
+	retry.Retries = 2
+
+	tests := []struct {
+		name         string
+		dom          *scriptedDomain
+		policy       DomainShutdownPolicy
+		wantStep     DomainShutdownStep
+		wantRequests int
+		wantErr      error
+	}{
+		{"already off", &scriptedDomain{state: DomStateShutoff}, policy, DomShutdownStepNone, 0, nil},
+		{"first request", &scriptedDomain{state: DomStateRunning, shutdownAfter: 1}, policy, DomShutdownStepRequest, 1, nil},
+		{"retried request", &scriptedDomain{state: DomStateRunning, shutdownAfter: 2}, retry, DomShutdownStepRequest, 2, nil},
+		{"transient", &scriptedDomain{state: DomStateRunning, shutdownAfter: 1, transient: true}, policy, DomShutdownStepRequest, 1, nil},
+		{"graceful destroy", &scriptedDomain{state: DomStateRunning}, escalate, DomShutdownStepDestroyGraceful, 1, nil},
+		{"forced destroy", &scriptedDomain{state: DomStateRunning, gracefulFails: true}, escalate, DomShutdownStepDestroy, 1, nil},
+		{"timeout", &scriptedDomain{state: DomStateRunning}, retry, DomShutdownStepRequest, 3, ErrShutdownTimeout},
+	}
+
+	for _, tt := range tests {
+		result, err := shutdownAndWait(context.Background(), tt.dom, tt.policy)
+		if err != tt.wantErr {
+			t.Errorf("%v: unexpected error; got=%v, want=%v", tt.name, err, tt.wantErr)
+		}
+
+		if result.Step != tt.wantStep || result.Requests != tt.wantRequests {
+			t.Errorf("%v: unexpected result; got=%v (%v requests), want=%v (%v requests)", tt.name, result.Step, result.Requests, tt.wantStep, tt.wantRequests)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := shutdownAndWait(ctx, &scriptedDomain{state: DomStateRunning}, policy); err != context.Canceled {
+		t.Errorf("unexpected error with a cancelled context; got=%v, want=%v", err, context.Canceled)
+	}
+}
+
+func TestDomainShutdownAndWait(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	if err := env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	// the test domain has no guest OS to handle the shutdown request
+	result, err := env.dom.ShutdownAndWait(context.Background(), DomainShutdownPolicy{
+		Flags:        DomShutdownACPIPowerBtn,
+		Timeout:      time.Second,
+		DestroyForce: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Step != DomShutdownStepDestroy {
+		t.Errorf("unexpected shutdown step; got=%v, want=%v", result.Step, DomShutdownStepDestroy)
+	}
+
+	if active, err := env.dom.IsActive(); err != nil || active {
+		t.Errorf("domain should be shut off; active=%v, err=%v", active, err)
+	}
+}
+
+func TestDomainMergeExternalSnapshot(t *testing.T) {
+	env := newTestEnvironment(t).withDomain()
+	defer env.cleanUp()
+
+	if err := env.dom.Create(DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := env.dom.BlockJobInfo(env.domData.DiskTarget, DomBlockJobInfoDefault); err != nil || ok {
+		t.Errorf("unexpected block job before the merge; running=%v (%v)", ok, err)
+	}
+
+	overlay := fmt.Sprintf("%v/%v-overlay.qcow2", os.TempDir(), env.domData.Name)
+	defer os.Remove(overlay)
+
+	snap, err := env.dom.CreateSnapshotDef(SnapshotDef{
+		Name: newTestSnapshotData().Name,
+		Disks: []SnapshotDiskSpec{{
+			Name:     env.domData.DiskTarget,
+			Snapshot: SnapLocationExternal,
+			Source:   &SnapshotDiskSource{File: overlay},
+			Driver:   &SnapshotDiskDriver{Type: "qcow2"},
+		}},
+	}, SnapCreateDiskOnly|SnapCreateAtomic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Free()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := env.dom.MergeExternalSnapshot(ctx, snap, SnapshotMergePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Disks) != 1 || result.Disks[0] != env.domData.DiskTarget {
+		t.Errorf("unexpected merged disks; got=%v, want=[%v]", result.Disks, env.domData.DiskTarget)
+	}
+
+	// the overlay isn't in a storage pool, so it's not deleted
+	if len(result.KeptOverlays) != 1 || result.KeptOverlays[0] != overlay {
+		t.Errorf("unexpected kept overlays; got=%v, want=[%v]", result.KeptOverlays, overlay)
+	}
+
+	if has, err := env.dom.HasCurrentSnapshot(); err != nil || has {
+		t.Errorf("the snapshot metadata should have been deleted; current=%v (%v)", has, err)
+	}
+}
@@ -0,0 +1,163 @@
+package libvirt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The String, MarshalText and UnmarshalText methods of the enum and flag types
+// are generated from their constant declarations.
+//go:generate go run ./internal/enumgen checkpoint.go CheckpointListFlag=CheckpointList CheckpointCreateFlag=CheckpointCreate CheckpointDeleteFlag=CheckpointDelete CheckpointXMLFlag=CheckpointXML
+//go:generate go run ./internal/enumgen connection.go ConnectionMode= CloseReason=CloseReason
+//go:generate go run ./internal/enumgen -flags DomainModificationImpact -text DomBlockedReasonUnkwown=unknown domain.go DomainListFlag=DomList DomainMetadataType=DomMeta DomainModificationImpact=DomAffect DomainXMLFlag=DomXML DomainCreateFlag=DomCreate DomainDestroyFlag=DomDestroy DomainUndefineFlag=DomUndefine DomainRebootFlag=DomReboot DomainShutdownFlag=DomShutdown DomainState=DomState DomainNostateReason=DomNostateReason DomainRunningReason=DomRunningReason DomainBlockedReason=DomBlockedReason DomainPausedReason=DomPausedReason DomainShutdownReason=DomShutdownReason DomainShutoffReason=DomShutoffReason DomainCrashedReason=DomCrashedReason DomainPMSuspendedReason=DomPMSuspendedReason DomainDumpFlag=DomDump DomainDumpFormat=DomDumpFormat DomainVCPUsFlag=DomVCPUs DomainSaveFlag=DomSave DomainDeviceModifyFlag=DomDeviceModify DomainMemoryModifyFlag=DomMemory DomainKeycodeSet=DomKeycodeSet DomainProcessSignal=DomSIG DomainBackupBeginFlag=DomBackupBegin DomainJobType=DomJob DomainJobOperation=DomJobOperation DomainJobStatsFlag=DomJobStats DomainShutdownStep=DomShutdownStep DomainControlState=DomControl DomainControlErrorReason=DomControlErrorReason DomainBlockCommitFlag=DomBlockCommit DomainBlockJobType=DomBlockJob DomainBlockJobInfoFlag=DomBlockJobInfo DomainBlockJobAbortFlag=DomBlockJobAbort
+//go:generate go run ./internal/enumgen managed.go ConnectionState=ConnState
+//go:generate go run ./internal/enumgen secret.go SecretListFlag=SecList SecretUsageType=SecUsageType
+//go:generate go run ./internal/enumgen snapshot.go SnapshotListFlag=SnapList SnapshotCreateFlag=SnapCreate SnapshotDeleteFlag=SnapDelete SnapshotRevertFlag=SnapRevert SnapshotCurrentFlag=SnapCurrent
+//go:generate go run ./internal/enumgen -text PoolListNetFS=netfs,PoolListMPath=mpath storagepool.go StoragePoolListFlag=PoolList StoragePoolDeleteFlag=PoolDelete StorageXMLFlag=StorageXML StoragePoolState=PoolState StoragePoolBuildFlag=PoolBuild StorageVolumeCreateFlag=VolCreate
+//go:generate go run ./internal/enumgen -text VolWipeAlgDoD=dod storagevolume.go StorageVolumeType=VolType StorageVolumeResizeFlag=VolResize StorageVolumeWipeAlgorithm=VolWipeAlg StorageVolumeUploadFlag=VolUpload StorageVolumeDownloadFlag=VolDownload
+//go:generate go run ./internal/enumgen -flags StreamEventType stream.go StreamFlag=Str StreamRecvFlag=StrRecv StreamEventType=StrEvent
+
+// enumValue is the underlying type of the enum and flag types.
+type enumValue interface {
+	~int | ~int32 | ~uint | ~uint32
+}
+
+// enumName associates a value of an enum or flag type with its text form.
+type enumName[T enumValue] struct {
+	value T
+	name  string
+}
+
+// formatEnum returns the name of "v", or "typ(v)" if it doesn't have one.
+func formatEnum[T enumValue](v T, names []enumName[T], typ string) string {
+	for _, n := range names {
+		if n.value == v {
+			return n.name
+		}
+	}
+
+	return fmt.Sprintf("%v(%d)", typ, int64(v))
+}
+
+// marshalEnum returns the name of "v", or its number if it doesn't have one,
+// so unknown values still round-trip through unmarshalEnum.
+func marshalEnum[T enumValue](v T, names []enumName[T]) ([]byte, error) {
+	for _, n := range names {
+		if n.value == v {
+			return []byte(n.name), nil
+		}
+	}
+
+	return []byte(strconv.FormatInt(int64(v), 10)), nil
+}
+
+// unmarshalEnum stores in "v" the value whose name is "text", ignoring case.
+// A number is accepted as well.
+func unmarshalEnum[T enumValue](v *T, text []byte, names []enumName[T], typ string) error {
+	s := strings.TrimSpace(string(text))
+
+	for _, n := range names {
+		if strings.EqualFold(n.name, s) {
+			*v = n.value
+			return nil
+		}
+	}
+
+	value, ok := parseEnumNumber[T](s)
+	if !ok {
+		return fmt.Errorf("invalid %v: %q", typ, text)
+	}
+
+	*v = value
+
+	return nil
+}
+
+// formatFlags returns the names of the flags set in "v", separated by "|".
+// The bits without a name are added as a hexadecimal number, and the value 0
+// is formatted with the name of the flag which is 0, if there's one.
+func formatFlags[T enumValue](v T, names []enumName[T], typ string) string {
+	if v == 0 {
+		for _, n := range names {
+			if n.value == 0 {
+				return n.name
+			}
+		}
+
+		return "0"
+	}
+
+	var parts []string
+	rest := v
+
+	for _, n := range names {
+		if n.value != 0 && v&n.value == n.value && rest&n.value != 0 {
+			parts = append(parts, n.name)
+			rest &^= n.value
+		}
+	}
+
+	if rest != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", uint64(rest)))
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// marshalFlags returns the text form of the flags set in "v", as returned by
+// formatFlags.
+func marshalFlags[T enumValue](v T, names []enumName[T]) ([]byte, error) {
+	return []byte(formatFlags(v, names, "")), nil
+}
+
+// unmarshalFlags stores in "v" the flags named in "text", separated by "|".
+// The names are compared ignoring case, and numbers are accepted as well.
+func unmarshalFlags[T enumValue](v *T, text []byte, names []enumName[T], typ string) error {
+	var flags T
+
+	for _, part := range strings.Split(string(text), "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		found := false
+		for _, n := range names {
+			if strings.EqualFold(n.name, part) {
+				flags |= n.value
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			value, ok := parseEnumNumber[T](part)
+			if !ok {
+				return fmt.Errorf("invalid %v: unknown flag %q", typ, part)
+			}
+
+			flags |= value
+		}
+	}
+
+	*v = flags
+
+	return nil
+}
+
+// parseEnumNumber parses "s" as a number (in any base accepted by Go literals)
+// and reports whether it fits in T.
+func parseEnumNumber[T enumValue](s string) (T, bool) {
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	value := T(n)
+	if int64(value) != n {
+		return 0, false
+	}
+
+	return value, true
+}
@@ -0,0 +1,175 @@
+package libvirt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cd1/libvirt-golang/remote"
+)
+
+func TestEnumText(t *testing.T) {
+	tests := []struct {
+		value interface {
+			String() string
+			MarshalText() ([]byte, error)
+		}
+		want string
+	}{
+		{DomStateRunning, "running"},
+		{DomStatePMSuspended, "pm_suspended"},
+		{DomShutoffReasonFromSnapshot, "from_snapshot"},
+		{PoolStateInaccessible, "inaccessible"},
+		{VolWipeAlgDoD, "dod"},
+		{CloseReasonKeepAlive, "keep_alive"},
+		{DomDeviceModifyLive | DomDeviceModifyConfig, "config|live"},
+		{DomDeviceModifyCurrent, "current"},
+		{SnapCreateDiskOnly | SnapCreateAtomic, "disk_only|atomic"},
+		{StrEventReadable | StrEventHangup, "readable|hangup"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("unexpected text of %#v; got=%q, want=%q", tt.value, got, tt.want)
+		}
+
+		text, err := tt.value.MarshalText()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if string(text) != tt.want {
+			t.Errorf("unexpected marshalled text of %#v; got=%q, want=%q", tt.value, text, tt.want)
+		}
+	}
+
+	if got, want := DomainState(1000).String(), "DomainState(1000)"; got != want {
+		t.Errorf("unexpected text of an unknown state; got=%q, want=%q", got, want)
+	}
+
+	if got, want := (DomDeviceModifyLive | 0x100).String(), "live|0x100"; got != want {
+		t.Errorf("unexpected text of an unknown flag; got=%q, want=%q", got, want)
+	}
+}
+
+func TestEnumUnmarshalText(t *testing.T) {
+	var state DomainState
+	if err := state.UnmarshalText([]byte("Shutoff")); err != nil || state != DomStateShutoff {
+		t.Errorf("unexpected state; got=%v (err = %v), want=%v", state, err, DomStateShutoff)
+	}
+
+	if err := state.UnmarshalText([]byte("1000")); err != nil || state != 1000 {
+		t.Errorf("unexpected state from a number; got=%d (err = %v), want=1000", state, err)
+	}
+
+	if err := state.UnmarshalText([]byte("sleeping")); err == nil {
+		t.Error("an error was not returned when using an invalid state name")
+	}
+
+	var flags DomainDeviceModifyFlag
+	if err := flags.UnmarshalText([]byte("live | config|0x100")); err != nil || flags != DomDeviceModifyLive|DomDeviceModifyConfig|0x100 {
+		t.Errorf("unexpected flags; got=%v (err = %v)", flags, err)
+	}
+
+	if err := flags.UnmarshalText([]byte("live|sometimes")); err == nil {
+		t.Error("an error was not returned when using an invalid flag name")
+	}
+
+	// the text form is used by the encoding packages
+	type config struct {
+		State DomainState
+		Flags SnapshotCreateFlag
+	}
+
+	in := config{DomStatePaused, SnapCreateHalt | SnapCreateQuiesce}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data), `{"State":"paused","Flags":"halt|quiesce"}`; got != want {
+		t.Errorf("unexpected JSON; got=%v, want=%v", got, want)
+	}
+
+	var out config
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out != in {
+		t.Errorf("unexpected value after a JSON round trip; got=%+v, want=%+v", out, in)
+	}
+}
+
+// TestEnumRemoteValues checks that the enums mirrored by the remote package,
+// which can't use the C headers, have the same values as the ones here.
+func TestEnumRemoteValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  uint32
+		remote uint32
+	}{
+		{"DomStateNone", uint32(DomStateNone), uint32(remote.DomStateNone)},
+		{"DomStateRunning", uint32(DomStateRunning), uint32(remote.DomStateRunning)},
+		{"DomStateBlocked", uint32(DomStateBlocked), uint32(remote.DomStateBlocked)},
+		{"DomStatePaused", uint32(DomStatePaused), uint32(remote.DomStatePaused)},
+		{"DomStateShutdown", uint32(DomStateShutdown), uint32(remote.DomStateShutdown)},
+		{"DomStateShutoff", uint32(DomStateShutoff), uint32(remote.DomStateShutoff)},
+		{"DomStateCrashed", uint32(DomStateCrashed), uint32(remote.DomStateCrashed)},
+		{"DomStatePMSuspended", uint32(DomStatePMSuspended), uint32(remote.DomStatePMSuspended)},
+		{"DomXMLDefault", uint32(DomXMLDefault), uint32(remote.DomXMLDefault)},
+		{"DomXMLSecure", uint32(DomXMLSecure), uint32(remote.DomXMLSecure)},
+		{"DomXMLInactive", uint32(DomXMLInactive), uint32(remote.DomXMLInactive)},
+		{"DomXMLUpdateCPU", uint32(DomXMLUpdateCPU), uint32(remote.DomXMLUpdateCPU)},
+		{"DomXMLMigratable", uint32(DomXMLMigratable), uint32(remote.DomXMLMigratable)},
+		{"DomCreateDefault", uint32(DomCreateDefault), uint32(remote.DomCreateDefault)},
+		{"DomCreatePaused", uint32(DomCreatePaused), uint32(remote.DomCreatePaused)},
+		{"DomCreateAutodestroy", uint32(DomCreateAutodestroy), uint32(remote.DomCreateAutodestroy)},
+		{"DomCreateBypassCache", uint32(DomCreateBypassCache), uint32(remote.DomCreateBypassCache)},
+		{"DomCreateForceBoot", uint32(DomCreateForceBoot), uint32(remote.DomCreateForceBoot)},
+		{"DomDestroyDefault", uint32(DomDestroyDefault), uint32(remote.DomDestroyDefault)},
+		{"DomDestroyGraceful", uint32(DomDestroyGraceful), uint32(remote.DomDestroyGraceful)},
+		{"DomUndefineDefault", uint32(DomUndefineDefault), uint32(remote.DomUndefineDefault)},
+		{"DomUndefineManagedSave", uint32(DomUndefineManagedSave), uint32(remote.DomUndefineManagedSave)},
+		{"DomUndefineSnapshotsMetadata", uint32(DomUndefineSnapshotsMetadata), uint32(remote.DomUndefineSnapshotsMetadata)},
+		{"DomUndefineNVRAM", uint32(DomUndefineNVRAM), uint32(remote.DomUndefineNVRAM)},
+		{"DomRebootDefault", uint32(DomRebootDefault), uint32(remote.DomRebootDefault)},
+		{"DomRebootACPIPowerBtn", uint32(DomRebootACPIPowerBtn), uint32(remote.DomRebootACPIPowerBtn)},
+		{"DomRebootGuestAgent", uint32(DomRebootGuestAgent), uint32(remote.DomRebootGuestAgent)},
+		{"DomRebootInitctl", uint32(DomRebootInitctl), uint32(remote.DomRebootInitctl)},
+		{"DomRebootSignal", uint32(DomRebootSignal), uint32(remote.DomRebootSignal)},
+		{"DomRebootParavirt", uint32(DomRebootParavirt), uint32(remote.DomRebootParavirt)},
+		{"DomShutdownDefault", uint32(DomShutdownDefault), uint32(remote.DomShutdownDefault)},
+		{"DomShutdownACPIPowerBtn", uint32(DomShutdownACPIPowerBtn), uint32(remote.DomShutdownACPIPowerBtn)},
+		{"DomShutdownGuestAgent", uint32(DomShutdownGuestAgent), uint32(remote.DomShutdownGuestAgent)},
+		{"DomShutdownInitctl", uint32(DomShutdownInitctl), uint32(remote.DomShutdownInitctl)},
+		{"DomShutdownSignal", uint32(DomShutdownSignal), uint32(remote.DomShutdownSignal)},
+		{"DomShutdownParavirt", uint32(DomShutdownParavirt), uint32(remote.DomShutdownParavirt)},
+		{"PoolStateInactive", uint32(PoolStateInactive), uint32(remote.PoolStateInactive)},
+		{"PoolStateBuilding", uint32(PoolStateBuilding), uint32(remote.PoolStateBuilding)},
+		{"PoolStateRunning", uint32(PoolStateRunning), uint32(remote.PoolStateRunning)},
+		{"PoolStateDegraded", uint32(PoolStateDegraded), uint32(remote.PoolStateDegraded)},
+		{"PoolStateInaccessible", uint32(PoolStateInaccessible), uint32(remote.PoolStateInaccessible)},
+		{"PoolDeleteNormal", uint32(PoolDeleteNormal), uint32(remote.PoolDeleteNormal)},
+		{"PoolDeleteZeroed", uint32(PoolDeleteZeroed), uint32(remote.PoolDeleteZeroed)},
+		{"PoolBuildNew", uint32(PoolBuildNew), uint32(remote.PoolBuildNew)},
+		{"PoolBuildRepair", uint32(PoolBuildRepair), uint32(remote.PoolBuildRepair)},
+		{"PoolBuildResize", uint32(PoolBuildResize), uint32(remote.PoolBuildResize)},
+		{"PoolBuildNoOverwrite", uint32(PoolBuildNoOverwrite), uint32(remote.PoolBuildNoOverwrite)},
+		{"PoolBuildOverwrite", uint32(PoolBuildOverwrite), uint32(remote.PoolBuildOverwrite)},
+		{"StorageXMLDefault", uint32(StorageXMLDefault), uint32(remote.StorageXMLDefault)},
+		{"StorageXMLInactive", uint32(StorageXMLInactive), uint32(remote.StorageXMLInactive)},
+		{"SecUsageTypeNone", uint32(SecUsageTypeNone), uint32(remote.SecUsageTypeNone)},
+		{"SecUsageTypeVolume", uint32(SecUsageTypeVolume), uint32(remote.SecUsageTypeVolume)},
+		{"SecUsageTypeCeph", uint32(SecUsageTypeCeph), uint32(remote.SecUsageTypeCeph)},
+		{"SecUsageTypeISCSI", uint32(SecUsageTypeISCSI), uint32(remote.SecUsageTypeISCSI)},
+		{"SecUsageTypeTLS", uint32(SecUsageTypeTLS), uint32(remote.SecUsageTypeTLS)},
+		{"SecUsageTypeVTPM", uint32(SecUsageTypeVTPM), uint32(remote.SecUsageTypeVTPM)},
+	}
+
+	for _, tt := range tests {
+		if tt.value != tt.remote {
+			t.Errorf("unexpected value of remote.%v; got=%v, want=%v", tt.name, tt.remote, tt.value)
+		}
+	}
+}
@@ -3,111 +3,116 @@ package libvirt
 // #include <libvirt/virterror.h>
 import "C"
 import (
-	"fmt"
-	"log"
+	"errors"
+
+	"github.com/cd1/libvirt-golang/internal/virterr"
 )
 
-// ErrorCode is the error code.
-type ErrorCode uint32
+// ErrorCode is the error code. The type is shared with the remote package, so
+// the errors returned by both packages match the same codes.
+type ErrorCode = virterr.Code
 
 // Possible values for ErrorCode.
 const (
-	ErrOK                    ErrorCode = C.VIR_ERR_OK
-	ErrInternal              ErrorCode = C.VIR_ERR_INTERNAL_ERROR
-	ErrNoMemory              ErrorCode = C.VIR_ERR_NO_MEMORY
-	ErrNoSupport             ErrorCode = C.VIR_ERR_NO_SUPPORT
-	ErrUnknownHost           ErrorCode = C.VIR_ERR_UNKNOWN_HOST
-	ErrNoConnect             ErrorCode = C.VIR_ERR_NO_CONNECT
-	ErrInvalidConn           ErrorCode = C.VIR_ERR_INVALID_CONN
-	ErrInvalidDomain         ErrorCode = C.VIR_ERR_INVALID_DOMAIN
-	ErrInvalidArg            ErrorCode = C.VIR_ERR_INVALID_ARG
-	ErrOperationFailed       ErrorCode = C.VIR_ERR_OPERATION_FAILED
-	ErrGetFailed             ErrorCode = C.VIR_ERR_GET_FAILED
-	ErrPostFailed            ErrorCode = C.VIR_ERR_POST_FAILED
-	ErrHTTP                  ErrorCode = C.VIR_ERR_HTTP_ERROR
-	ErrSExprSerial           ErrorCode = C.VIR_ERR_SEXPR_SERIAL
-	ErrNoXen                 ErrorCode = C.VIR_ERR_NO_XEN
-	ErrXenCall               ErrorCode = C.VIR_ERR_XEN_CALL
-	ErrOSType                ErrorCode = C.VIR_ERR_OS_TYPE
-	ErrNoKernel              ErrorCode = C.VIR_ERR_NO_KERNEL
-	ErrNoRoot                ErrorCode = C.VIR_ERR_NO_ROOT
-	ErrNoSource              ErrorCode = C.VIR_ERR_NO_SOURCE
-	ErrNoTarget              ErrorCode = C.VIR_ERR_NO_TARGET
-	ErrNoName                ErrorCode = C.VIR_ERR_NO_NAME
-	ErrNoOS                  ErrorCode = C.VIR_ERR_NO_OS
-	ErrNoDevice              ErrorCode = C.VIR_ERR_NO_DEVICE
-	ErrNoXenStore            ErrorCode = C.VIR_ERR_NO_XENSTORE
-	ErrDriverFull            ErrorCode = C.VIR_ERR_DRIVER_FULL
-	ErrCallFailed            ErrorCode = C.VIR_ERR_CALL_FAILED
-	ErrXML                   ErrorCode = C.VIR_ERR_XML_ERROR
-	ErrDomExist              ErrorCode = C.VIR_ERR_DOM_EXIST
-	ErrOperationDenied       ErrorCode = C.VIR_ERR_OPERATION_DENIED
-	ErrOpenFailed            ErrorCode = C.VIR_ERR_OPEN_FAILED
-	ErrReadFailed            ErrorCode = C.VIR_ERR_READ_FAILED
-	ErrParseFailed           ErrorCode = C.VIR_ERR_PARSE_FAILED
-	ErrConfSyntax            ErrorCode = C.VIR_ERR_CONF_SYNTAX
-	ErrWriteFailed           ErrorCode = C.VIR_ERR_WRITE_FAILED
-	ErrXMLDetail             ErrorCode = C.VIR_ERR_XML_DETAIL
-	ErrInvalidNetwork        ErrorCode = C.VIR_ERR_INVALID_NETWORK
-	ErrNetworkExist          ErrorCode = C.VIR_ERR_NETWORK_EXIST
-	ErrSystem                ErrorCode = C.VIR_ERR_SYSTEM_ERROR
-	ErrRPC                   ErrorCode = C.VIR_ERR_RPC
-	ErrGNUTLS                ErrorCode = C.VIR_ERR_GNUTLS_ERROR
-	WarNoNetwork             ErrorCode = C.VIR_WAR_NO_NETWORK
-	ErrNoDomain              ErrorCode = C.VIR_ERR_NO_DOMAIN
-	ErrNoNetwork             ErrorCode = C.VIR_ERR_NO_NETWORK
-	ErrInvalidMAC            ErrorCode = C.VIR_ERR_INVALID_MAC
-	ErrAuthFailed            ErrorCode = C.VIR_ERR_AUTH_FAILED
-	ErrInvalidStoragePool    ErrorCode = C.VIR_ERR_INVALID_STORAGE_POOL
-	ErrInvalidStorageVol     ErrorCode = C.VIR_ERR_INVALID_STORAGE_VOL
-	WarNoStorage             ErrorCode = C.VIR_WAR_NO_STORAGE
-	ErrNoStoragePool         ErrorCode = C.VIR_ERR_NO_STORAGE_POOL
-	ErrNoStorageVol          ErrorCode = C.VIR_ERR_NO_STORAGE_VOL
-	WarNoNode                ErrorCode = C.VIR_WAR_NO_NODE
-	ErrInvalidNodeDevice     ErrorCode = C.VIR_ERR_INVALID_NODE_DEVICE
-	ErrNoNodeDevice          ErrorCode = C.VIR_ERR_NO_NODE_DEVICE
-	ErrNoSecurityModel       ErrorCode = C.VIR_ERR_NO_SECURITY_MODEL
-	ErrOperationInvalid      ErrorCode = C.VIR_ERR_OPERATION_INVALID
-	WarNoInterface           ErrorCode = C.VIR_WAR_NO_INTERFACE
-	ErrNoInterface           ErrorCode = C.VIR_ERR_NO_INTERFACE
-	ErrInvalidInterface      ErrorCode = C.VIR_ERR_INVALID_INTERFACE
-	ErrMultipleInterfaces    ErrorCode = C.VIR_ERR_MULTIPLE_INTERFACES
-	WarNoNwFilter            ErrorCode = C.VIR_WAR_NO_NWFILTER
-	ErrInvalidNwFilter       ErrorCode = C.VIR_ERR_INVALID_NWFILTER
-	ErrNoNwFilter            ErrorCode = C.VIR_ERR_NO_NWFILTER
-	ErrBuildFirewall         ErrorCode = C.VIR_ERR_BUILD_FIREWALL
-	WarNoSecret              ErrorCode = C.VIR_WAR_NO_SECRET
-	ErrInvalidSecret         ErrorCode = C.VIR_ERR_INVALID_SECRET
-	ErrNoSecret              ErrorCode = C.VIR_ERR_NO_SECRET
-	ErrConfigUnsupported     ErrorCode = C.VIR_ERR_CONFIG_UNSUPPORTED
-	ErrOperationTimeout      ErrorCode = C.VIR_ERR_OPERATION_TIMEOUT
-	ErrMigratePersistFailed  ErrorCode = C.VIR_ERR_MIGRATE_PERSIST_FAILED
-	ErrHookScriptFailed      ErrorCode = C.VIR_ERR_HOOK_SCRIPT_FAILED
-	ErrInvalidDomainSnapshot ErrorCode = C.VIR_ERR_INVALID_DOMAIN_SNAPSHOT
-	ErrNoDomainSnapshot      ErrorCode = C.VIR_ERR_NO_DOMAIN_SNAPSHOT
-	ErrInvalidStream         ErrorCode = C.VIR_ERR_INVALID_STREAM
-	ErrArgumentUnsupported   ErrorCode = C.VIR_ERR_ARGUMENT_UNSUPPORTED
-	ErrStorageProbeFailed    ErrorCode = C.VIR_ERR_STORAGE_PROBE_FAILED
-	ErrStoragePoolBuilt      ErrorCode = C.VIR_ERR_STORAGE_POOL_BUILT
-	ErrSnapshotRevertRisky   ErrorCode = C.VIR_ERR_SNAPSHOT_REVERT_RISKY
-	ErrOperationAborted      ErrorCode = C.VIR_ERR_OPERATION_ABORTED
-	ErrAuthCancelled         ErrorCode = C.VIR_ERR_AUTH_CANCELLED
-	ErrNoDomainMetadata      ErrorCode = C.VIR_ERR_NO_DOMAIN_METADATA
-	ErrMigrateUnsafe         ErrorCode = C.VIR_ERR_MIGRATE_UNSAFE
-	ErrOverflow              ErrorCode = C.VIR_ERR_OVERFLOW
-	ErrBlockCopyActive       ErrorCode = C.VIR_ERR_BLOCK_COPY_ACTIVE
-	ErrOperationUnsupported  ErrorCode = C.VIR_ERR_OPERATION_UNSUPPORTED
-	ErrSSH                   ErrorCode = C.VIR_ERR_SSH
-	ErrAgentUnresponsive     ErrorCode = C.VIR_ERR_AGENT_UNRESPONSIVE
-	ErrResourceBusy          ErrorCode = C.VIR_ERR_RESOURCE_BUSY
-	ErrAccessDenied          ErrorCode = C.VIR_ERR_ACCESS_DENIED
-	ErrDBusService           ErrorCode = C.VIR_ERR_DBUS_SERVICE
-	ErrStorageVolExist       ErrorCode = C.VIR_ERR_STORAGE_VOL_EXIST
-	ErrCPUIncompatible       ErrorCode = C.VIR_ERR_CPU_INCOMPATIBLE
+	ErrOK                      ErrorCode = C.VIR_ERR_OK
+	ErrInternal                ErrorCode = C.VIR_ERR_INTERNAL_ERROR
+	ErrNoMemory                ErrorCode = C.VIR_ERR_NO_MEMORY
+	ErrNoSupport               ErrorCode = C.VIR_ERR_NO_SUPPORT
+	ErrUnknownHost             ErrorCode = C.VIR_ERR_UNKNOWN_HOST
+	ErrNoConnect               ErrorCode = C.VIR_ERR_NO_CONNECT
+	ErrInvalidConn             ErrorCode = C.VIR_ERR_INVALID_CONN
+	ErrInvalidDomain           ErrorCode = C.VIR_ERR_INVALID_DOMAIN
+	ErrInvalidArg              ErrorCode = C.VIR_ERR_INVALID_ARG
+	ErrOperationFailed         ErrorCode = C.VIR_ERR_OPERATION_FAILED
+	ErrGetFailed               ErrorCode = C.VIR_ERR_GET_FAILED
+	ErrPostFailed              ErrorCode = C.VIR_ERR_POST_FAILED
+	ErrHTTP                    ErrorCode = C.VIR_ERR_HTTP_ERROR
+	ErrSExprSerial             ErrorCode = C.VIR_ERR_SEXPR_SERIAL
+	ErrNoXen                   ErrorCode = C.VIR_ERR_NO_XEN
+	ErrXenCall                 ErrorCode = C.VIR_ERR_XEN_CALL
+	ErrOSType                  ErrorCode = C.VIR_ERR_OS_TYPE
+	ErrNoKernel                ErrorCode = C.VIR_ERR_NO_KERNEL
+	ErrNoRoot                  ErrorCode = C.VIR_ERR_NO_ROOT
+	ErrNoSource                ErrorCode = C.VIR_ERR_NO_SOURCE
+	ErrNoTarget                ErrorCode = C.VIR_ERR_NO_TARGET
+	ErrNoName                  ErrorCode = C.VIR_ERR_NO_NAME
+	ErrNoOS                    ErrorCode = C.VIR_ERR_NO_OS
+	ErrNoDevice                ErrorCode = C.VIR_ERR_NO_DEVICE
+	ErrNoXenStore              ErrorCode = C.VIR_ERR_NO_XENSTORE
+	ErrDriverFull              ErrorCode = C.VIR_ERR_DRIVER_FULL
+	ErrCallFailed              ErrorCode = C.VIR_ERR_CALL_FAILED
+	ErrXML                     ErrorCode = C.VIR_ERR_XML_ERROR
+	ErrDomExist                ErrorCode = C.VIR_ERR_DOM_EXIST
+	ErrOperationDenied         ErrorCode = C.VIR_ERR_OPERATION_DENIED
+	ErrOpenFailed              ErrorCode = C.VIR_ERR_OPEN_FAILED
+	ErrReadFailed              ErrorCode = C.VIR_ERR_READ_FAILED
+	ErrParseFailed             ErrorCode = C.VIR_ERR_PARSE_FAILED
+	ErrConfSyntax              ErrorCode = C.VIR_ERR_CONF_SYNTAX
+	ErrWriteFailed             ErrorCode = C.VIR_ERR_WRITE_FAILED
+	ErrXMLDetail               ErrorCode = C.VIR_ERR_XML_DETAIL
+	ErrInvalidNetwork          ErrorCode = C.VIR_ERR_INVALID_NETWORK
+	ErrNetworkExist            ErrorCode = C.VIR_ERR_NETWORK_EXIST
+	ErrSystem                  ErrorCode = C.VIR_ERR_SYSTEM_ERROR
+	ErrRPC                     ErrorCode = C.VIR_ERR_RPC
+	ErrGNUTLS                  ErrorCode = C.VIR_ERR_GNUTLS_ERROR
+	WarNoNetwork               ErrorCode = C.VIR_WAR_NO_NETWORK
+	ErrNoDomain                ErrorCode = C.VIR_ERR_NO_DOMAIN
+	ErrNoNetwork               ErrorCode = C.VIR_ERR_NO_NETWORK
+	ErrInvalidMAC              ErrorCode = C.VIR_ERR_INVALID_MAC
+	ErrAuthFailed              ErrorCode = C.VIR_ERR_AUTH_FAILED
+	ErrInvalidStoragePool      ErrorCode = C.VIR_ERR_INVALID_STORAGE_POOL
+	ErrInvalidStorageVol       ErrorCode = C.VIR_ERR_INVALID_STORAGE_VOL
+	WarNoStorage               ErrorCode = C.VIR_WAR_NO_STORAGE
+	ErrNoStoragePool           ErrorCode = C.VIR_ERR_NO_STORAGE_POOL
+	ErrNoStorageVol            ErrorCode = C.VIR_ERR_NO_STORAGE_VOL
+	WarNoNode                  ErrorCode = C.VIR_WAR_NO_NODE
+	ErrInvalidNodeDevice       ErrorCode = C.VIR_ERR_INVALID_NODE_DEVICE
+	ErrNoNodeDevice            ErrorCode = C.VIR_ERR_NO_NODE_DEVICE
+	ErrNoSecurityModel         ErrorCode = C.VIR_ERR_NO_SECURITY_MODEL
+	ErrOperationInvalid        ErrorCode = C.VIR_ERR_OPERATION_INVALID
+	WarNoInterface             ErrorCode = C.VIR_WAR_NO_INTERFACE
+	ErrNoInterface             ErrorCode = C.VIR_ERR_NO_INTERFACE
+	ErrInvalidInterface        ErrorCode = C.VIR_ERR_INVALID_INTERFACE
+	ErrMultipleInterfaces      ErrorCode = C.VIR_ERR_MULTIPLE_INTERFACES
+	WarNoNwFilter              ErrorCode = C.VIR_WAR_NO_NWFILTER
+	ErrInvalidNwFilter         ErrorCode = C.VIR_ERR_INVALID_NWFILTER
+	ErrNoNwFilter              ErrorCode = C.VIR_ERR_NO_NWFILTER
+	ErrBuildFirewall           ErrorCode = C.VIR_ERR_BUILD_FIREWALL
+	WarNoSecret                ErrorCode = C.VIR_WAR_NO_SECRET
+	ErrInvalidSecret           ErrorCode = C.VIR_ERR_INVALID_SECRET
+	ErrNoSecret                ErrorCode = C.VIR_ERR_NO_SECRET
+	ErrConfigUnsupported       ErrorCode = C.VIR_ERR_CONFIG_UNSUPPORTED
+	ErrOperationTimeout        ErrorCode = C.VIR_ERR_OPERATION_TIMEOUT
+	ErrMigratePersistFailed    ErrorCode = C.VIR_ERR_MIGRATE_PERSIST_FAILED
+	ErrHookScriptFailed        ErrorCode = C.VIR_ERR_HOOK_SCRIPT_FAILED
+	ErrInvalidDomainSnapshot   ErrorCode = C.VIR_ERR_INVALID_DOMAIN_SNAPSHOT
+	ErrNoDomainSnapshot        ErrorCode = C.VIR_ERR_NO_DOMAIN_SNAPSHOT
+	ErrInvalidStream           ErrorCode = C.VIR_ERR_INVALID_STREAM
+	ErrArgumentUnsupported     ErrorCode = C.VIR_ERR_ARGUMENT_UNSUPPORTED
+	ErrStorageProbeFailed      ErrorCode = C.VIR_ERR_STORAGE_PROBE_FAILED
+	ErrStoragePoolBuilt        ErrorCode = C.VIR_ERR_STORAGE_POOL_BUILT
+	ErrSnapshotRevertRisky     ErrorCode = C.VIR_ERR_SNAPSHOT_REVERT_RISKY
+	ErrOperationAborted        ErrorCode = C.VIR_ERR_OPERATION_ABORTED
+	ErrAuthCancelled           ErrorCode = C.VIR_ERR_AUTH_CANCELLED
+	ErrNoDomainMetadata        ErrorCode = C.VIR_ERR_NO_DOMAIN_METADATA
+	ErrMigrateUnsafe           ErrorCode = C.VIR_ERR_MIGRATE_UNSAFE
+	ErrOverflow                ErrorCode = C.VIR_ERR_OVERFLOW
+	ErrBlockCopyActive         ErrorCode = C.VIR_ERR_BLOCK_COPY_ACTIVE
+	ErrOperationUnsupported    ErrorCode = C.VIR_ERR_OPERATION_UNSUPPORTED
+	ErrSSH                     ErrorCode = C.VIR_ERR_SSH
+	ErrAgentUnresponsive       ErrorCode = C.VIR_ERR_AGENT_UNRESPONSIVE
+	ErrResourceBusy            ErrorCode = C.VIR_ERR_RESOURCE_BUSY
+	ErrAccessDenied            ErrorCode = C.VIR_ERR_ACCESS_DENIED
+	ErrDBusService             ErrorCode = C.VIR_ERR_DBUS_SERVICE
+	ErrStorageVolExist         ErrorCode = C.VIR_ERR_STORAGE_VOL_EXIST
+	ErrCPUIncompatible         ErrorCode = C.VIR_ERR_CPU_INCOMPATIBLE
+	ErrInvalidDomainCheckpoint ErrorCode = C.VIR_ERR_INVALID_DOMAIN_CHECKPOINT
+	ErrNoDomainCheckpoint      ErrorCode = C.VIR_ERR_NO_DOMAIN_CHECKPOINT
 )
 
-// ErrorDomain describes what part of the library raised the error.
-type ErrorDomain uint32
+// ErrorDomain describes what part of the library raised the error. The type is
+// shared with the remote package.
+type ErrorDomain = virterr.Domain
 
 // Possible values for ErrorDomain.
 const (
@@ -172,10 +177,12 @@ const (
 	ErrDomCrypto         ErrorDomain = C.VIR_FROM_CRYPTO
 	ErrDomFirewall       ErrorDomain = C.VIR_FROM_FIREWALL
 	//ErrDomPolkit         ErrorDomain = C.VIR_FROM_POLKIT
+	ErrDomDomainCheckpoint ErrorDomain = C.VIR_FROM_DOMAIN_CHECKPOINT
 )
 
-// ErrorLevel specifies how consequent is the error.
-type ErrorLevel uint32
+// ErrorLevel specifies how consequent is the error. The type is shared with the
+// remote package.
+type ErrorLevel = virterr.Level
 
 // Possible values for ErrorLevel.
 const (
@@ -184,19 +191,10 @@ const (
 	ErrLvlError   ErrorLevel = C.VIR_ERR_ERROR
 )
 
-// Error is a wrapper for a native libvirt error.
-type Error struct {
-	Code             ErrorCode
-	Domain           ErrorDomain
-	Message          string
-	Level            ErrorLevel
-	Str1, Str2, Str3 string
-	Int1, Int2       int32
-}
-
-func (err *Error) Error() string {
-	return fmt.Sprintf("%s [error code = %d]", err.Message, err.Code)
-}
+// Error is a wrapper for a native libvirt error. The type is shared with the
+// remote package, so errors.As and the predicates below (e.g. IsNotFound) work
+// with the errors returned by both packages.
+type Error = virterr.Error
 
 // NewError creates an error based on a native libvirt error. If the libvirt
 // error pointer is nil, returns nil.
@@ -212,20 +210,99 @@ func NewError(virError C.virErrorPtr) *Error {
 		ErrorLevel(virError.level),
 		C.GoString(virError.str1),
 		C.GoString(virError.str2),
-		C.GoString(virError.str2),
+		C.GoString(virError.str3),
 		int32(virError.int1),
 		int32(virError.int2),
 	}
 }
 
-// LastError provides a pointer to the last error caught at the library level.
-// The error object is kept in thread local storage, so separate threads can
-// safely access this concurrently.
+// LastError provides a pointer to the last error caught at the library level,
+// or nil if there is none.
+// The error object is kept in thread local storage, so it's only meaningful if
+// this function runs on the same OS thread as the failing libvirt call. As the
+// Go scheduler may move goroutines between threads at any time, callers must
+// lock the goroutine to its thread (runtime.LockOSThread) before calling
+// libvirt. The methods in this package already do that and return the error
+// directly, so this function is rarely needed.
 func LastError() *Error {
-	cError := C.virGetLastError()
-	if cError == nil {
-		log.Println("LastError() did not return an error")
+	return NewError(C.virGetLastError())
+}
+
+// lastError returns a copy of the last error caught at the library level, in
+// the current OS thread, and resets it. The caller must have locked the
+// goroutine to its thread before calling the failing libvirt function.
+// Unlike LastError, this function never returns nil: if libvirt didn't report
+// an error, a generic one is returned, so callers can always return it as a
+// non-nil error.
+func lastError() *Error {
+	var cError C.virError
+
+	if C.virCopyLastError(&cError) <= 0 {
+		return &Error{
+			Code:    ErrInternal,
+			Domain:  ErrDomNone,
+			Message: "libvirt call failed without reporting an error",
+			Level:   ErrLvlError,
+		}
+	}
+	defer C.virResetError(&cError)
+
+	C.virResetLastError()
+
+	return NewError(&cError)
+}
+
+// errorCode returns the code of "err" if it is (or wraps) an *Error.
+func errorCode(err error) (ErrorCode, ErrorDomain, bool) {
+	var virErr *Error
+	if !errors.As(err, &virErr) {
+		return 0, 0, false
 	}
 
-	return NewError(cError)
+	return virErr.Code, virErr.Domain, true
+}
+
+// IsNotFound returns whether "err" reports that the requested object (domain,
+// storage pool, storage volume, secret, snapshot, checkpoint, network, etc.)
+// doesn't exist.
+func IsNotFound(err error) bool {
+	code, _, ok := errorCode(err)
+	if !ok {
+		return false
+	}
+
+	switch code {
+	case ErrNoDomain, ErrNoNetwork, ErrNoStoragePool, ErrNoStorageVol,
+		ErrNoNodeDevice, ErrNoInterface, ErrNoNwFilter, ErrNoSecret,
+		ErrNoDomainSnapshot, ErrNoDomainCheckpoint, ErrNoDomainMetadata:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsOperationInvalid returns whether "err" reports an operation which isn't
+// valid in the current state of the object (e.g. starting a running domain).
+func IsOperationInvalid(err error) bool {
+	code, _, ok := errorCode(err)
+	return ok && code == ErrOperationInvalid
+}
+
+// IsConnectionLost returns whether "err" reports that the connection to the
+// hypervisor is broken or closed, in which case a new connection must be
+// opened.
+func IsConnectionLost(err error) bool {
+	code, domain, ok := errorCode(err)
+	if !ok {
+		return false
+	}
+
+	switch code {
+	case ErrInvalidConn, ErrNoConnect:
+		return true
+	case ErrSystem, ErrInternal, ErrRPC:
+		return domain == ErrDomRPC || domain == ErrDomRemote
+	default:
+		return false
+	}
 }
@@ -1,7 +1,13 @@
 package libvirt
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/cd1/utils-golang"
 )
 
 func TestErrorNew(t *testing.T) {
@@ -9,3 +15,282 @@ func TestErrorNew(t *testing.T) {
 		t.Error("creating an error with a nil value should return nil")
 	}
 }
+
+func TestErrorString(t *testing.T) {
+	tests := []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{ErrNoDomain, "ErrNoDomain"},
+		{ErrorCode(99999), "ErrorCode(99999)"},
+		{ErrDomStorage, "ErrDomStorage"},
+		{ErrorDomain(99999), "ErrorDomain(99999)"},
+		{ErrLvlWarning, "ErrLvlWarning"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("unexpected name; got=%v, want=%v", got, tt.want)
+		}
+	}
+}
+
+// TestErrorSharedValues checks that the values of the shared error types,
+// which are also used by the remote package, match the C headers.
+func TestErrorSharedValues(t *testing.T) {
+	tests := []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{ErrOK, "ErrOK"},
+		{ErrInternal, "ErrInternal"},
+		{ErrNoMemory, "ErrNoMemory"},
+		{ErrNoSupport, "ErrNoSupport"},
+		{ErrUnknownHost, "ErrUnknownHost"},
+		{ErrNoConnect, "ErrNoConnect"},
+		{ErrInvalidConn, "ErrInvalidConn"},
+		{ErrInvalidDomain, "ErrInvalidDomain"},
+		{ErrInvalidArg, "ErrInvalidArg"},
+		{ErrOperationFailed, "ErrOperationFailed"},
+		{ErrGetFailed, "ErrGetFailed"},
+		{ErrPostFailed, "ErrPostFailed"},
+		{ErrHTTP, "ErrHTTP"},
+		{ErrSExprSerial, "ErrSExprSerial"},
+		{ErrNoXen, "ErrNoXen"},
+		{ErrXenCall, "ErrXenCall"},
+		{ErrOSType, "ErrOSType"},
+		{ErrNoKernel, "ErrNoKernel"},
+		{ErrNoRoot, "ErrNoRoot"},
+		{ErrNoSource, "ErrNoSource"},
+		{ErrNoTarget, "ErrNoTarget"},
+		{ErrNoName, "ErrNoName"},
+		{ErrNoOS, "ErrNoOS"},
+		{ErrNoDevice, "ErrNoDevice"},
+		{ErrNoXenStore, "ErrNoXenStore"},
+		{ErrDriverFull, "ErrDriverFull"},
+		{ErrCallFailed, "ErrCallFailed"},
+		{ErrXML, "ErrXML"},
+		{ErrDomExist, "ErrDomExist"},
+		{ErrOperationDenied, "ErrOperationDenied"},
+		{ErrOpenFailed, "ErrOpenFailed"},
+		{ErrReadFailed, "ErrReadFailed"},
+		{ErrParseFailed, "ErrParseFailed"},
+		{ErrConfSyntax, "ErrConfSyntax"},
+		{ErrWriteFailed, "ErrWriteFailed"},
+		{ErrXMLDetail, "ErrXMLDetail"},
+		{ErrInvalidNetwork, "ErrInvalidNetwork"},
+		{ErrNetworkExist, "ErrNetworkExist"},
+		{ErrSystem, "ErrSystem"},
+		{ErrRPC, "ErrRPC"},
+		{ErrGNUTLS, "ErrGNUTLS"},
+		{WarNoNetwork, "WarNoNetwork"},
+		{ErrNoDomain, "ErrNoDomain"},
+		{ErrNoNetwork, "ErrNoNetwork"},
+		{ErrInvalidMAC, "ErrInvalidMAC"},
+		{ErrAuthFailed, "ErrAuthFailed"},
+		{ErrInvalidStoragePool, "ErrInvalidStoragePool"},
+		{ErrInvalidStorageVol, "ErrInvalidStorageVol"},
+		{WarNoStorage, "WarNoStorage"},
+		{ErrNoStoragePool, "ErrNoStoragePool"},
+		{ErrNoStorageVol, "ErrNoStorageVol"},
+		{WarNoNode, "WarNoNode"},
+		{ErrInvalidNodeDevice, "ErrInvalidNodeDevice"},
+		{ErrNoNodeDevice, "ErrNoNodeDevice"},
+		{ErrNoSecurityModel, "ErrNoSecurityModel"},
+		{ErrOperationInvalid, "ErrOperationInvalid"},
+		{WarNoInterface, "WarNoInterface"},
+		{ErrNoInterface, "ErrNoInterface"},
+		{ErrInvalidInterface, "ErrInvalidInterface"},
+		{ErrMultipleInterfaces, "ErrMultipleInterfaces"},
+		{WarNoNwFilter, "WarNoNwFilter"},
+		{ErrInvalidNwFilter, "ErrInvalidNwFilter"},
+		{ErrNoNwFilter, "ErrNoNwFilter"},
+		{ErrBuildFirewall, "ErrBuildFirewall"},
+		{WarNoSecret, "WarNoSecret"},
+		{ErrInvalidSecret, "ErrInvalidSecret"},
+		{ErrNoSecret, "ErrNoSecret"},
+		{ErrConfigUnsupported, "ErrConfigUnsupported"},
+		{ErrOperationTimeout, "ErrOperationTimeout"},
+		{ErrMigratePersistFailed, "ErrMigratePersistFailed"},
+		{ErrHookScriptFailed, "ErrHookScriptFailed"},
+		{ErrInvalidDomainSnapshot, "ErrInvalidDomainSnapshot"},
+		{ErrNoDomainSnapshot, "ErrNoDomainSnapshot"},
+		{ErrInvalidStream, "ErrInvalidStream"},
+		{ErrArgumentUnsupported, "ErrArgumentUnsupported"},
+		{ErrStorageProbeFailed, "ErrStorageProbeFailed"},
+		{ErrStoragePoolBuilt, "ErrStoragePoolBuilt"},
+		{ErrSnapshotRevertRisky, "ErrSnapshotRevertRisky"},
+		{ErrOperationAborted, "ErrOperationAborted"},
+		{ErrAuthCancelled, "ErrAuthCancelled"},
+		{ErrNoDomainMetadata, "ErrNoDomainMetadata"},
+		{ErrMigrateUnsafe, "ErrMigrateUnsafe"},
+		{ErrOverflow, "ErrOverflow"},
+		{ErrBlockCopyActive, "ErrBlockCopyActive"},
+		{ErrOperationUnsupported, "ErrOperationUnsupported"},
+		{ErrSSH, "ErrSSH"},
+		{ErrAgentUnresponsive, "ErrAgentUnresponsive"},
+		{ErrResourceBusy, "ErrResourceBusy"},
+		{ErrAccessDenied, "ErrAccessDenied"},
+		{ErrDBusService, "ErrDBusService"},
+		{ErrStorageVolExist, "ErrStorageVolExist"},
+		{ErrCPUIncompatible, "ErrCPUIncompatible"},
+		{ErrInvalidDomainCheckpoint, "ErrInvalidDomainCheckpoint"},
+		{ErrNoDomainCheckpoint, "ErrNoDomainCheckpoint"},
+		{ErrDomNone, "ErrDomNone"},
+		{ErrDomXen, "ErrDomXen"},
+		{ErrDomXend, "ErrDomXend"},
+		{ErrDomXenStore, "ErrDomXenStore"},
+		{ErrDomSExpr, "ErrDomSExpr"},
+		{ErrDomXML, "ErrDomXML"},
+		{ErrDomDom, "ErrDomDom"},
+		{ErrDomRPC, "ErrDomRPC"},
+		{ErrDomProxy, "ErrDomProxy"},
+		{ErrDomConf, "ErrDomConf"},
+		{ErrDomQEMU, "ErrDomQEMU"},
+		{ErrDomNet, "ErrDomNet"},
+		{ErrDomTest, "ErrDomTest"},
+		{ErrDomRemote, "ErrDomRemote"},
+		{ErrDomOpenVZ, "ErrDomOpenVZ"},
+		{ErrDomXenXM, "ErrDomXenXM"},
+		{ErrDomStatsLinux, "ErrDomStatsLinux"},
+		{ErrDomLXC, "ErrDomLXC"},
+		{ErrDomStorage, "ErrDomStorage"},
+		{ErrDomNetwork, "ErrDomNetwork"},
+		{ErrDomDomain, "ErrDomDomain"},
+		{ErrDomUML, "ErrDomUML"},
+		{ErrDomNodeDev, "ErrDomNodeDev"},
+		{ErrDomXenInotify, "ErrDomXenInotify"},
+		{ErrDomSecurity, "ErrDomSecurity"},
+		{ErrDomVBox, "ErrDomVBox"},
+		{ErrDomInterface, "ErrDomInterface"},
+		{ErrDomONE, "ErrDomONE"},
+		{ErrDomESX, "ErrDomESX"},
+		{ErrDomPHYP, "ErrDomPHYP"},
+		{ErrDomSecret, "ErrDomSecret"},
+		{ErrDomCPU, "ErrDomCPU"},
+		{ErrDomXenAPI, "ErrDomXenAPI"},
+		{ErrDomNwFilter, "ErrDomNwFilter"},
+		{ErrDomHook, "ErrDomHook"},
+		{ErrDomDomainSnapshot, "ErrDomDomainSnapshot"},
+		{ErrDomAudit, "ErrDomAudit"},
+		{ErrDomSysinfo, "ErrDomSysinfo"},
+		{ErrDomStreams, "ErrDomStreams"},
+		{ErrDomVMWare, "ErrDomVMWare"},
+		{ErrDomEvent, "ErrDomEvent"},
+		{ErrDomLibXL, "ErrDomLibXL"},
+		{ErrDomLocking, "ErrDomLocking"},
+		{ErrDomHyperv, "ErrDomHyperv"},
+		{ErrDomCapabilities, "ErrDomCapabilities"},
+		{ErrDomURI, "ErrDomURI"},
+		{ErrDomAuth, "ErrDomAuth"},
+		{ErrDomDBus, "ErrDomDBus"},
+		{ErrDomParallels, "ErrDomParallels"},
+		{ErrDomDevice, "ErrDomDevice"},
+		{ErrDomSSH, "ErrDomSSH"},
+		{ErrDomLockspace, "ErrDomLockspace"},
+		{ErrDomInitctl, "ErrDomInitctl"},
+		{ErrDomIdentity, "ErrDomIdentity"},
+		{ErrDomCgroup, "ErrDomCgroup"},
+		{ErrDomAccess, "ErrDomAccess"},
+		{ErrDomSystemd, "ErrDomSystemd"},
+		{ErrDomBhyve, "ErrDomBhyve"},
+		{ErrDomCrypto, "ErrDomCrypto"},
+		{ErrDomFirewall, "ErrDomFirewall"},
+		{ErrDomDomainCheckpoint, "ErrDomDomainCheckpoint"},
+		{ErrLvlNone, "ErrLvlNone"},
+		{ErrLvlWarning, "ErrLvlWarning"},
+		{ErrLvlError, "ErrLvlError"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("value of %v doesn't match the C headers; got name=%v", tt.want, got)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("lookup failed: %w", &Error{
+		Code:   ErrNoDomain,
+		Domain: ErrDomQEMU,
+	})
+
+	if !errors.Is(err, ErrNoDomain) {
+		t.Error("error should match its code")
+	}
+
+	if !errors.Is(err, ErrDomQEMU) {
+		t.Error("error should match its domain")
+	}
+
+	if !errors.Is(err, &Error{Code: ErrNoDomain, Domain: ErrDomQEMU}) {
+		t.Error("error should match an error with the same code and domain")
+	}
+
+	if errors.Is(err, ErrNoStoragePool) {
+		t.Error("error should not match another code")
+	}
+
+	if !IsNotFound(err) {
+		t.Error("missing domain error should be reported as not found")
+	}
+
+	if IsOperationInvalid(err) || IsConnectionLost(err) {
+		t.Error("missing domain error should only be reported as not found")
+	}
+
+	if !IsConnectionLost(&Error{Code: ErrSystem, Domain: ErrDomRPC}) {
+		t.Error("RPC system error should be reported as connection lost")
+	}
+
+	if IsNotFound(errors.New("not a libvirt error")) {
+		t.Error("non-libvirt errors should not be reported as not found")
+	}
+}
+
+func TestErrorConcurrentLookups(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.cleanUp()
+
+	const lookups = 500
+
+	var wg sync.WaitGroup
+	errs := make(chan error, lookups)
+
+	for i := 0; i < lookups; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("%v-%v", utils.RandomString(), i)
+
+			var err error
+			var want ErrorCode
+			if i%2 == 0 {
+				_, err = env.conn.LookupDomainByName(name)
+				want = ErrNoDomain
+			} else {
+				_, err = env.conn.LookupStoragePoolByName(name)
+				want = ErrNoStoragePool
+			}
+
+			var virErr *Error
+			if !errors.As(err, &virErr) {
+				errs <- fmt.Errorf("lookup of %q: unexpected error; got=%v, want=%v", name, err, want)
+				return
+			}
+
+			if virErr.Code != want || !strings.Contains(virErr.Message, name) {
+				errs <- fmt.Errorf("lookup of %q: got error from another call: %v", name, virErr)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
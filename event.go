@@ -0,0 +1,124 @@
+package libvirt
+
+// #include <libvirt/libvirt.h>
+import "C"
+import (
+	"runtime"
+	"sync"
+)
+
+// callbacks holds the Go callbacks registered in libvirt. C code can't keep Go
+// pointers, so libvirt only knows about their IDs.
+var callbacks = struct {
+	sync.Mutex
+	nextID int64
+	funcs  map[int64]interface{}
+}{
+	funcs: make(map[int64]interface{}),
+}
+
+// registerCallback stores "callback" and returns the ID which should be passed
+// to libvirt.
+func registerCallback(callback interface{}) int64 {
+	callbacks.Lock()
+	defer callbacks.Unlock()
+
+	callbacks.nextID++
+	callbacks.funcs[callbacks.nextID] = callback
+
+	return callbacks.nextID
+}
+
+// lookupCallback returns the callback registered with "id", or nil if it
+// doesn't exist (anymore).
+func lookupCallback(id int64) interface{} {
+	callbacks.Lock()
+	defer callbacks.Unlock()
+
+	return callbacks.funcs[id]
+}
+
+// unregisterCallback removes the callback registered with "id".
+func unregisterCallback(id int64) {
+	callbacks.Lock()
+	defer callbacks.Unlock()
+
+	delete(callbacks.funcs, id)
+}
+
+//export freeCallback
+func freeCallback(id C.long) {
+	unregisterCallback(int64(id))
+}
+
+//export connectCloseCallback
+func connectCloseCallback(cConn C.virConnectPtr, cReason C.int, callbackID C.long) {
+	callback, ok := lookupCallback(int64(callbackID)).(CloseCallback)
+	if !ok {
+		return
+	}
+
+	callback(CloseReason(cReason))
+}
+
+// lifecycleCallback is called when a lifecycle event is received for the
+// domain or storage pool it was registered for. The event details aren't
+// used, the callback only re-reads the object state.
+type lifecycleCallback func()
+
+//export domainEventLifecycleCallback
+func domainEventLifecycleCallback(cDom C.virDomainPtr, cEvent C.int, cDetail C.int, callbackID C.long) {
+	callback, ok := lookupCallback(int64(callbackID)).(lifecycleCallback)
+	if !ok {
+		return
+	}
+
+	callback()
+}
+
+//export storagePoolEventLifecycleCallback
+func storagePoolEventLifecycleCallback(cPool C.virStoragePoolPtr, cEvent C.int, cDetail C.int, callbackID C.long) {
+	callback, ok := lookupCallback(int64(callbackID)).(lifecycleCallback)
+	if !ok {
+		return
+	}
+
+	callback()
+}
+
+// EventRegisterDefaultImpl registers a default event implementation based on
+// the poll() system call. Once registered, the application has to invoke
+// EventRunDefaultImpl in a loop to process events; without it, no callback
+// (e.g. "<Stream>.AddEventCallback") will ever be called.
+// This function should be called before opening any connection.
+func EventRegisterDefaultImpl() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cRet := C.virEventRegisterDefaultImpl()
+	ret := int32(cRet)
+
+	if ret == -1 {
+		return lastError()
+	}
+
+	return nil
+}
+
+// EventRunDefaultImpl runs one iteration of the default event loop registered
+// by EventRegisterDefaultImpl, dispatching the callbacks of all the events
+// which are ready. This function blocks until at least one event happens, so
+// it's usually called in a loop in a dedicated goroutine.
+func EventRunDefaultImpl() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cRet := C.virEventRunDefaultImpl()
+	ret := int32(cRet)
+
+	if ret == -1 {
+		return lastError()
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package libvirt
+
+// #include <libvirt/libvirt.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"unsafe"
+)
+
+// objectKind is the type of a libvirt object referenced by a handle.
+type objectKind int
+
+// Possible values for objectKind.
+const (
+	kindDomain objectKind = iota
+	kindStoragePool
+	kindStorageVolume
+	kindSecret
+	kindSnapshot
+	kindCheckpoint
+	kindStream
+)
+
+// objectKindNames holds the names of the object types, as used in the log
+// records.
+var objectKindNames = map[objectKind]string{
+	kindDomain:        "domain",
+	kindStoragePool:   "storage_pool",
+	kindStorageVolume: "storage_volume",
+	kindSecret:        "secret",
+	kindSnapshot:      "snapshot",
+	kindCheckpoint:    "checkpoint",
+	kindStream:        "stream",
+}
+
+// String returns the name of the object type.
+func (kind objectKind) String() string {
+	return objectKindNames[kind]
+}
+
+// Leak describes an object which wasn't freed before the connection used to
+// create it was closed. Leaks are only detected in builds with the
+// "libvirt_leakcheck" tag.
+type Leak struct {
+	// Object is the type of the object, e.g. "domain".
+	Object string
+	// Stack is the stack trace of the goroutine which created the object.
+	Stack string
+}
+
+// String returns a description of the leak.
+func (leak Leak) String() string {
+	return fmt.Sprintf("%v object was not freed before closing the connection; created by:\n%v", leak.Object, leak.Stack)
+}
+
+// ReportLeak is called by "<Connection>.Close", in builds with the
+// "libvirt_leakcheck" tag, for each object created from the connection which
+// wasn't freed when its last reference is closed. The default implementation
+// prints the leak to the standard error output; tests usually replace it with
+// a function which fails the test.
+var ReportLeak = func(leak Leak) {
+	fmt.Fprintf(os.Stderr, "libvirt-golang: %v\n", leak)
+}
+
+// tracker keeps track of the objects created from a connection. It's nil
+// unless the objects should be freed automatically or leaks should be
+// detected.
+type tracker struct {
+	autoFree bool
+
+	mu   sync.Mutex
+	refs int
+	live map[*handle]struct{}
+}
+
+// newTracker creates the tracker of a new connection, or returns nil if the
+// objects don't need to be tracked.
+func newTracker(autoFree bool) *tracker {
+	if !autoFree && !leakCheck {
+		return nil
+	}
+
+	return &tracker{
+		autoFree: autoFree,
+		refs:     1,
+		live:     make(map[*handle]struct{}),
+	}
+}
+
+// track returns the handle of a new object created from the connection.
+// Objects are kept alive by the tracker when leaks are detected, so they're
+// only freed automatically when they aren't.
+func (t *tracker) track(kind objectKind, ptr unsafe.Pointer) *handle {
+	if t == nil {
+		return nil
+	}
+
+	h := &handle{
+		tracker: t,
+		kind:    kind,
+		ptr:     ptr,
+		refs:    1,
+	}
+
+	if leakCheck {
+		h.stack = string(debug.Stack())
+
+		t.mu.Lock()
+		t.live[h] = struct{}{}
+		t.mu.Unlock()
+	} else if t.autoFree {
+		runtime.SetFinalizer(h, (*handle).finalize)
+	}
+
+	return h
+}
+
+// ref increments the reference count of the connection.
+func (t *tracker) ref() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refs++
+}
+
+// close decrements the reference count of the connection and, when the last
+// reference is closed, reports the objects which weren't freed.
+func (t *tracker) close() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.refs--
+	if t.refs > 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	var leaks []Leak
+	for h := range t.live {
+		leaks = append(leaks, Leak{
+			Object: h.kind.String(),
+			Stack:  h.stack,
+		})
+	}
+	t.live = make(map[*handle]struct{})
+	t.mu.Unlock()
+
+	for _, leak := range leaks {
+		ReportLeak(leak)
+	}
+}
+
+// handle is shared by all the copies of a Go object referencing the same
+// libvirt object, so it can be freed once it becomes unreachable. The methods
+// of the objects must keep it alive (with runtime.KeepAlive) while the
+// underlying pointer is in use.
+type handle struct {
+	tracker *tracker
+	kind    objectKind
+	ptr     unsafe.Pointer
+	stack   string
+
+	mu   sync.Mutex
+	refs int
+}
+
+// track returns the handle of a new object created from the same connection
+// as the object of "h".
+func (h *handle) track(kind objectKind, ptr unsafe.Pointer) *handle {
+	if h == nil {
+		return nil
+	}
+
+	return h.tracker.track(kind, ptr)
+}
+
+// connection returns the tracker of the connection of the object of "h", to
+// be used by a new reference to the connection.
+func (h *handle) connection() *tracker {
+	if h == nil {
+		return nil
+	}
+
+	return h.tracker
+}
+
+// ref increments the reference count of the object, after a successful call
+// to its Ref method.
+func (h *handle) ref() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.refs++
+}
+
+// release decrements the reference count of the object, after a successful
+// call to its Free method. The object isn't tracked anymore once the last
+// reference is released.
+func (h *handle) release() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.refs--
+	refs := h.refs
+	h.mu.Unlock()
+
+	if refs > 0 {
+		return
+	}
+
+	runtime.SetFinalizer(h, nil)
+
+	h.tracker.mu.Lock()
+	delete(h.tracker.live, h)
+	h.tracker.mu.Unlock()
+}
+
+// finalize frees the remaining references of an unreachable object.
+func (h *handle) finalize() {
+	for ; h.refs > 0; h.refs-- {
+		switch h.kind {
+		case kindDomain:
+			C.virDomainFree(C.virDomainPtr(h.ptr))
+		case kindStoragePool:
+			C.virStoragePoolFree(C.virStoragePoolPtr(h.ptr))
+		case kindStorageVolume:
+			C.virStorageVolFree(C.virStorageVolPtr(h.ptr))
+		case kindSecret:
+			C.virSecretFree(C.virSecretPtr(h.ptr))
+		case kindSnapshot:
+			C.virDomainSnapshotFree(C.virDomainSnapshotPtr(h.ptr))
+		case kindCheckpoint:
+			C.virDomainCheckpointFree(C.virDomainCheckpointPtr(h.ptr))
+		case kindStream:
+			C.virStreamFree(C.virStreamPtr(h.ptr))
+		}
+	}
+}
+
+// FreeAll frees all the objects in "objs", e.g. the ones returned by
+// "<Connection>.ListDomains". Every object is freed even if some of them fail;
+// the errors are joined in the returned value.
+func FreeAll[T interface{ Free() error }](objs []T) error {
+	var errs []error
+	for _, obj := range objs {
+		if err := obj.Free(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,758 @@
+package libvirt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrForeignObject is returned when an object which wasn't created by this
+// package (e.g. a fake stream) is passed to a method of an adapter returned by
+// one of the NewXxxAPI functions.
+var ErrForeignObject = errors.New("libvirt: object was not created by this package")
+
+// ConnectionAPI is the method set of Connection. Methods which return or
+// receive other libvirt objects use their interfaces instead, so the whole
+// API can be replaced by another implementation (e.g. a fake in tests).
+type ConnectionAPI interface {
+	Close() (int32, error)
+	Version() (uint64, error)
+	LibVersion() (uint64, error)
+	IsAlive() (bool, error)
+	SetKeepAlive(interval time.Duration, count uint32) error
+	RegisterCloseCallback(callback CloseCallback) error
+	UnregisterCloseCallback() error
+	IsEncrypted() (bool, error)
+	IsSecure() (bool, error)
+	Capabilities() (string, error)
+	Hostname() (string, error)
+	Sysinfo() (string, error)
+	Type() (string, error)
+	URI() (string, error)
+	Ref() error
+	CPUModelNames(arch string) ([]string, error)
+	MaxVCPUs(typ string) (int32, error)
+	ListDomains(flags DomainListFlag) ([]DomainAPI, error)
+	CreateDomain(xml string, flags DomainCreateFlag) (DomainAPI, error)
+	DefineDomain(xml string) (DomainAPI, error)
+	LookupDomainByID(id uint32) (DomainAPI, error)
+	LookupDomainByName(name string) (DomainAPI, error)
+	LookupDomainByUUID(uuid string) (DomainAPI, error)
+	RestoreDomain(from string, xml string, flags DomainSaveFlag) error
+	ListSecrets(flags SecretListFlag) ([]SecretAPI, error)
+	DefineSecret(xml string) (SecretAPI, error)
+	CreateSecret(usage SecretUsageType, usageID string, value []byte, private bool, ephemeral bool) (SecretAPI, error)
+	LookupSecretByUUID(uuid string) (SecretAPI, error)
+	LookupSecretByUsage(usageType SecretUsageType, usageID string) (SecretAPI, error)
+	FindStoragePoolSources(typ string, source string) (string, error)
+	ListStoragePools(flags StoragePoolListFlag) ([]StoragePoolAPI, error)
+	DefineStoragePool(xml string) (StoragePoolAPI, error)
+	CreateStoragePool(xml string) (StoragePoolAPI, error)
+	LookupStoragePoolByName(name string) (StoragePoolAPI, error)
+	LookupStoragePoolByUUID(uuid string) (StoragePoolAPI, error)
+	LookupStorageVolumeByPath(path string) (StorageVolumeAPI, error)
+	LookupStorageVolumeByKey(key string) (StorageVolumeAPI, error)
+	NewStream(flags StreamFlag) (StreamAPI, error)
+}
+
+// DomainAPI is the method set of Domain.
+type DomainAPI interface {
+	Free() error
+	Autostart() (bool, error)
+	HasCurrentSnapshot() (bool, error)
+	SnapshotTree() (*SnapshotTree, error)
+	HasManagedSaveImage() (bool, error)
+	IsActive() (bool, error)
+	IsPersistent() (bool, error)
+	IsUpdated() (bool, error)
+	OSType() (string, error)
+	Name() (string, error)
+	Hostname() (string, error)
+	ID() (uint32, error)
+	UUID() (string, error)
+	XML(typ DomainXMLFlag) (string, error)
+	Metadata(typ DomainMetadataType, xmlns string, impact DomainModificationImpact) (string, error)
+	Destroy(flags DomainDestroyFlag) error
+	Create(flags DomainCreateFlag) error
+	Undefine(flags DomainUndefineFlag) error
+	Reboot(flags DomainRebootFlag) error
+	Reset() error
+	Shutdown() error
+	ShutdownFlags(flags DomainShutdownFlag) error
+	ShutdownAndWait(ctx context.Context, policy DomainShutdownPolicy) (DomainShutdownResult, error)
+	State() (DomainState, int32, error)
+	StateWithReason() (DomainStateInfo, error)
+	ControlInfo() (DomainControlInfo, error)
+	WaitForState(ctx context.Context, desired ...DomainState) (DomainState, int32, error)
+	Suspend() error
+	Resume() error
+	CoreDump(file string, format DomainDumpFormat, flags DomainDumpFlag) error
+	CoreDumpContext(ctx context.Context, file string, format DomainDumpFormat, flags DomainDumpFlag) error
+	Ref() error
+	MaxMemory() (uint64, error)
+	VCPUs(flags DomainVCPUsFlag) (int32, error)
+	InfoState() (DomainState, error)
+	InfoMaxMemory() (uint64, error)
+	InfoMemory() (uint64, error)
+	InfoVCPUs() (uint16, error)
+	InfoCPUTime() (uint64, error)
+	Save(to string, xml string, flags DomainSaveFlag) error
+	SaveContext(ctx context.Context, to string, xml string, flags DomainSaveFlag) error
+	AttachDevice(deviceXML string, flags DomainDeviceModifyFlag) error
+	DetachDevice(deviceXML string, flags DomainDeviceModifyFlag) error
+	UpdateDevice(deviceXML string, flags DomainDeviceModifyFlag) error
+	SetAutostart(autostart bool) error
+	SetMemory(memory uint64, flags DomainMemoryModifyFlag) error
+	SetMetadata(typ DomainMetadataType, metadata string, key string, uri string, impact DomainModificationImpact) error
+	SetVCPUs(vcpus uint32, flags DomainVCPUsFlag) error
+	ManagedSave(flags DomainSaveFlag) error
+	ManagedSaveContext(ctx context.Context, flags DomainSaveFlag) error
+	ManagedSaveRemove() error
+	SendKey(codeSet DomainKeycodeSet, hold time.Duration, keycodes []uint32) error
+	SendProcessSignal(pid int64, signal DomainProcessSignal) error
+	ListSnapshots(flags SnapshotListFlag) ([]SnapshotAPI, error)
+	CreateSnapshot(xml string, flags SnapshotCreateFlag) (SnapshotAPI, error)
+	CreateSnapshotDef(def SnapshotDef, flags SnapshotCreateFlag) (SnapshotAPI, error)
+	CurrentSnapshot(flags SnapshotCurrentFlag) (SnapshotAPI, error)
+	LookupSnapshotByName(name string) (SnapshotAPI, error)
+	ListCheckpoints(flags CheckpointListFlag) ([]CheckpointAPI, error)
+	CreateCheckpoint(xml string, flags CheckpointCreateFlag) (CheckpointAPI, error)
+	LookupCheckpointByName(name string) (CheckpointAPI, error)
+	BackupBegin(backupXML string, checkpointXML string, flags DomainBackupBeginFlag) error
+	BackupXML() (string, error)
+	JobStats(flags DomainJobStatsFlag) (DomainJobStats, error)
+	AbortJob() error
+	BlockCommit(disk string, base string, top string, bandwidth uint64, flags DomainBlockCommitFlag) error
+	BlockJobInfo(disk string, flags DomainBlockJobInfoFlag) (DomainBlockJobInfo, bool, error)
+	BlockJobAbort(disk string, flags DomainBlockJobAbortFlag) error
+	MergeExternalSnapshot(ctx context.Context, snap SnapshotAPI, policy SnapshotMergePolicy) (SnapshotMergeResult, error)
+	WaitForJob(ctx context.Context, interval time.Duration, progress func(DomainJobStats)) (DomainJobStats, error)
+}
+
+// StoragePoolAPI is the method set of StoragePool.
+type StoragePoolAPI interface {
+	Free() error
+	Undefine() error
+	Create() error
+	Destroy() error
+	Delete(flags StoragePoolDeleteFlag) error
+	IsActive() (bool, error)
+	IsPersistent() (bool, error)
+	Name() (string, error)
+	UUID() (string, error)
+	XML(flags StorageXMLFlag) (string, error)
+	InfoState() (StoragePoolState, error)
+	WaitForState(ctx context.Context, desired ...StoragePoolState) (StoragePoolState, error)
+	InfoCapacity() (uint64, error)
+	InfoAllocation() (uint64, error)
+	InfoAvailable() (uint64, error)
+	Autostart() (bool, error)
+	SetAutostart(autostart bool) error
+	Build(flags StoragePoolBuildFlag) error
+	Refresh() error
+	Ref() error
+	ListStorageVolumes() ([]StorageVolumeAPI, error)
+	CreateStorageVolume(xml string, flags StorageVolumeCreateFlag) (StorageVolumeAPI, error)
+	CreateStorageVolumeFrom(xml string, cloneVol StorageVolumeAPI, flags StorageVolumeCreateFlag) (StorageVolumeAPI, error)
+	LookupStorageVolumeByName(name string) (StorageVolumeAPI, error)
+}
+
+// StorageVolumeAPI is the method set of StorageVolume.
+type StorageVolumeAPI interface {
+	Free() error
+	Delete() error
+	Key() (string, error)
+	Name() (string, error)
+	Path() (string, error)
+	XML() (string, error)
+	InfoType() (StorageVolumeType, error)
+	InfoCapacity() (uint64, error)
+	InfoAllocation() (uint64, error)
+	Resize(capacity uint64, flags StorageVolumeResizeFlag) error
+	Wipe(alg StorageVolumeWipeAlgorithm) error
+	Ref() error
+	StoragePool() (StoragePoolAPI, error)
+	Upload(str StreamAPI, offset uint64, length uint64) error
+	UploadFlags(str StreamAPI, offset uint64, length uint64, flags StorageVolumeUploadFlag) error
+	Download(str StreamAPI, offset uint64, length uint64) error
+	DownloadFlags(str StreamAPI, offset uint64, length uint64, flags StorageVolumeDownloadFlag) error
+	DownloadTo(w io.WriterAt, offset uint64, length uint64) error
+	UploadFrom(r io.ReaderAt, offset uint64, length uint64) error
+	UploadFromReader(ctx context.Context, r io.Reader, offset uint64, length uint64, progress TransferProgressFunc) error
+	DownloadToWriter(ctx context.Context, w io.Writer, offset uint64, length uint64, progress TransferProgressFunc) error
+}
+
+// SecretAPI is the method set of Secret.
+type SecretAPI interface {
+	Free() error
+	Undefine() error
+	UUID() (string, error)
+	XML() (string, error)
+	Definition() (*SecretDef, error)
+	UsageID() (string, error)
+	UsageType() (SecretUsageType, error)
+	SetValue(value string) error
+	SetValueBytes(value []byte) error
+	Value() (string, error)
+	ValueBytes() (SecretValue, error)
+	Rotate(newValue []byte) (*SecretRotation, error)
+	Ref() error
+}
+
+// SnapshotAPI is the method set of Snapshot.
+type SnapshotAPI interface {
+	Free() error
+	Delete(flags SnapshotDeleteFlag) error
+	Name() (string, error)
+	Parent() (SnapshotAPI, error)
+	Domain() (DomainAPI, error)
+	Connection() (ConnectionAPI, error)
+	XML(flags DomainXMLFlag) (string, error)
+	Definition(flags DomainXMLFlag) (*SnapshotDef, error)
+	HasMetadata() (bool, error)
+	IsCurrent() (bool, error)
+	Ref() error
+	ListChildren(flags SnapshotListFlag) ([]SnapshotAPI, error)
+	NumChildren(flags SnapshotListFlag) (int32, error)
+	Revert(flags SnapshotRevertFlag) error
+}
+
+// CheckpointAPI is the method set of Checkpoint.
+type CheckpointAPI interface {
+	Free() error
+	Delete(flags CheckpointDeleteFlag) error
+	Name() (string, error)
+	Parent() (CheckpointAPI, error)
+	XML(flags CheckpointXMLFlag) (string, error)
+	Ref() error
+	ListChildren(flags CheckpointListFlag) ([]CheckpointAPI, error)
+}
+
+// StreamAPIEventCallback is the type of the function called when an event
+// happens on a StreamAPI.
+type StreamAPIEventCallback func(str StreamAPI, events StreamEventType)
+
+// StreamAPI is the method set of Stream.
+type StreamAPI interface {
+	Free() error
+	Abort() error
+	Finish() error
+	Ref() error
+	Write(data []byte) (int, error)
+	WriteContext(ctx context.Context, data []byte) (int, error)
+	Read(data []byte) (int, error)
+	ReadContext(ctx context.Context, data []byte) (int, error)
+	RecvFlags(data []byte, flags StreamRecvFlag) (int, error)
+	RecvHole() (int64, error)
+	SendHole(length int64) error
+	AddEventCallback(events StreamEventType, callback StreamAPIEventCallback) error
+	UpdateEventCallback(events StreamEventType) error
+	RemoveEventCallback() error
+}
+
+// NewConnectionAPI wraps "conn" so it implements ConnectionAPI. The objects
+// returned by the wrapper are wrapped as well.
+func NewConnectionAPI(conn Connection) ConnectionAPI {
+	return connectionAPI{conn}
+}
+
+// NewDomainAPI wraps "dom" so it implements DomainAPI.
+func NewDomainAPI(dom Domain) DomainAPI {
+	return domainAPI{dom}
+}
+
+// NewStoragePoolAPI wraps "pool" so it implements StoragePoolAPI.
+func NewStoragePoolAPI(pool StoragePool) StoragePoolAPI {
+	return storagePoolAPI{pool}
+}
+
+// NewStorageVolumeAPI wraps "vol" so it implements StorageVolumeAPI.
+func NewStorageVolumeAPI(vol StorageVolume) StorageVolumeAPI {
+	return storageVolumeAPI{vol}
+}
+
+// NewSecretAPI wraps "sec" so it implements SecretAPI.
+func NewSecretAPI(sec Secret) SecretAPI {
+	return sec
+}
+
+// NewSnapshotAPI wraps "snap" so it implements SnapshotAPI.
+func NewSnapshotAPI(snap Snapshot) SnapshotAPI {
+	return snapshotAPI{snap}
+}
+
+// NewCheckpointAPI wraps "cp" so it implements CheckpointAPI.
+func NewCheckpointAPI(cp Checkpoint) CheckpointAPI {
+	return checkpointAPI{cp}
+}
+
+// NewStreamAPI wraps "str" so it implements StreamAPI.
+func NewStreamAPI(str Stream) StreamAPI {
+	return streamAPI{str}
+}
+
+// connectionAPI adapts Connection to ConnectionAPI.
+type connectionAPI struct {
+	Connection
+}
+
+func (conn connectionAPI) ListDomains(flags DomainListFlag) ([]DomainAPI, error) {
+	doms, err := conn.Connection.ListDomains(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]DomainAPI, len(doms))
+	for i, dom := range doms {
+		apis[i] = domainAPI{dom}
+	}
+
+	return apis, nil
+}
+
+func (conn connectionAPI) CreateDomain(xml string, flags DomainCreateFlag) (DomainAPI, error) {
+	dom, err := conn.Connection.CreateDomain(xml, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (conn connectionAPI) DefineDomain(xml string) (DomainAPI, error) {
+	dom, err := conn.Connection.DefineDomain(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (conn connectionAPI) LookupDomainByID(id uint32) (DomainAPI, error) {
+	dom, err := conn.Connection.LookupDomainByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (conn connectionAPI) LookupDomainByName(name string) (DomainAPI, error) {
+	dom, err := conn.Connection.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (conn connectionAPI) LookupDomainByUUID(uuid string) (DomainAPI, error) {
+	dom, err := conn.Connection.LookupDomainByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (conn connectionAPI) ListSecrets(flags SecretListFlag) ([]SecretAPI, error) {
+	secs, err := conn.Connection.ListSecrets(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]SecretAPI, len(secs))
+	for i, sec := range secs {
+		apis[i] = sec
+	}
+
+	return apis, nil
+}
+
+func (conn connectionAPI) DefineSecret(xml string) (SecretAPI, error) {
+	sec, err := conn.Connection.DefineSecret(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	return sec, nil
+}
+
+func (conn connectionAPI) CreateSecret(usage SecretUsageType, usageID string, value []byte, private bool, ephemeral bool) (SecretAPI, error) {
+	return CreateSecret(conn, usage, usageID, value, private, ephemeral)
+}
+
+func (conn connectionAPI) LookupSecretByUUID(uuid string) (SecretAPI, error) {
+	sec, err := conn.Connection.LookupSecretByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return sec, nil
+}
+
+func (conn connectionAPI) LookupSecretByUsage(usageType SecretUsageType, usageID string) (SecretAPI, error) {
+	sec, err := conn.Connection.LookupSecretByUsage(usageType, usageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sec, nil
+}
+
+func (conn connectionAPI) ListStoragePools(flags StoragePoolListFlag) ([]StoragePoolAPI, error) {
+	pools, err := conn.Connection.ListStoragePools(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]StoragePoolAPI, len(pools))
+	for i, pool := range pools {
+		apis[i] = storagePoolAPI{pool}
+	}
+
+	return apis, nil
+}
+
+func (conn connectionAPI) DefineStoragePool(xml string) (StoragePoolAPI, error) {
+	pool, err := conn.Connection.DefineStoragePool(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	return storagePoolAPI{pool}, nil
+}
+
+func (conn connectionAPI) CreateStoragePool(xml string) (StoragePoolAPI, error) {
+	pool, err := conn.Connection.CreateStoragePool(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	return storagePoolAPI{pool}, nil
+}
+
+func (conn connectionAPI) LookupStoragePoolByName(name string) (StoragePoolAPI, error) {
+	pool, err := conn.Connection.LookupStoragePoolByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return storagePoolAPI{pool}, nil
+}
+
+func (conn connectionAPI) LookupStoragePoolByUUID(uuid string) (StoragePoolAPI, error) {
+	pool, err := conn.Connection.LookupStoragePoolByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return storagePoolAPI{pool}, nil
+}
+
+func (conn connectionAPI) LookupStorageVolumeByPath(path string) (StorageVolumeAPI, error) {
+	vol, err := conn.Connection.LookupStorageVolumeByPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageVolumeAPI{vol}, nil
+}
+
+func (conn connectionAPI) LookupStorageVolumeByKey(key string) (StorageVolumeAPI, error) {
+	vol, err := conn.Connection.LookupStorageVolumeByKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageVolumeAPI{vol}, nil
+}
+
+func (conn connectionAPI) NewStream(flags StreamFlag) (StreamAPI, error) {
+	str, err := conn.Connection.NewStream(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamAPI{str}, nil
+}
+
+// domainAPI adapts Domain to DomainAPI.
+type domainAPI struct {
+	Domain
+}
+
+func (dom domainAPI) ListSnapshots(flags SnapshotListFlag) ([]SnapshotAPI, error) {
+	snaps, err := dom.Domain.ListSnapshots(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]SnapshotAPI, len(snaps))
+	for i, snap := range snaps {
+		apis[i] = snapshotAPI{snap}
+	}
+
+	return apis, nil
+}
+
+func (dom domainAPI) CreateSnapshot(xml string, flags SnapshotCreateFlag) (SnapshotAPI, error) {
+	snap, err := dom.Domain.CreateSnapshot(xml, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotAPI{snap}, nil
+}
+
+func (dom domainAPI) CreateSnapshotDef(def SnapshotDef, flags SnapshotCreateFlag) (SnapshotAPI, error) {
+	snap, err := dom.Domain.CreateSnapshotDef(def, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotAPI{snap}, nil
+}
+
+func (dom domainAPI) CurrentSnapshot(flags SnapshotCurrentFlag) (SnapshotAPI, error) {
+	snap, err := dom.Domain.CurrentSnapshot(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotAPI{snap}, nil
+}
+
+func (dom domainAPI) MergeExternalSnapshot(ctx context.Context, snap SnapshotAPI, policy SnapshotMergePolicy) (SnapshotMergeResult, error) {
+	return MergeExternalSnapshot(ctx, dom, snap, policy)
+}
+
+func (dom domainAPI) LookupSnapshotByName(name string) (SnapshotAPI, error) {
+	snap, err := dom.Domain.LookupSnapshotByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotAPI{snap}, nil
+}
+
+func (dom domainAPI) ListCheckpoints(flags CheckpointListFlag) ([]CheckpointAPI, error) {
+	cps, err := dom.Domain.ListCheckpoints(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]CheckpointAPI, len(cps))
+	for i, cp := range cps {
+		apis[i] = checkpointAPI{cp}
+	}
+
+	return apis, nil
+}
+
+func (dom domainAPI) CreateCheckpoint(xml string, flags CheckpointCreateFlag) (CheckpointAPI, error) {
+	cp, err := dom.Domain.CreateCheckpoint(xml, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointAPI{cp}, nil
+}
+
+func (dom domainAPI) LookupCheckpointByName(name string) (CheckpointAPI, error) {
+	cp, err := dom.Domain.LookupCheckpointByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointAPI{cp}, nil
+}
+
+// storagePoolAPI adapts StoragePool to StoragePoolAPI.
+type storagePoolAPI struct {
+	StoragePool
+}
+
+func (pool storagePoolAPI) ListStorageVolumes() ([]StorageVolumeAPI, error) {
+	vols, err := pool.StoragePool.ListStorageVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]StorageVolumeAPI, len(vols))
+	for i, vol := range vols {
+		apis[i] = storageVolumeAPI{vol}
+	}
+
+	return apis, nil
+}
+
+func (pool storagePoolAPI) CreateStorageVolume(xml string, flags StorageVolumeCreateFlag) (StorageVolumeAPI, error) {
+	vol, err := pool.StoragePool.CreateStorageVolume(xml, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageVolumeAPI{vol}, nil
+}
+
+func (pool storagePoolAPI) CreateStorageVolumeFrom(xml string, cloneVol StorageVolumeAPI, flags StorageVolumeCreateFlag) (StorageVolumeAPI, error) {
+	clone, ok := cloneVol.(storageVolumeAPI)
+	if !ok {
+		return nil, ErrForeignObject
+	}
+
+	vol, err := pool.StoragePool.CreateStorageVolumeFrom(xml, clone.StorageVolume, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageVolumeAPI{vol}, nil
+}
+
+func (pool storagePoolAPI) LookupStorageVolumeByName(name string) (StorageVolumeAPI, error) {
+	vol, err := pool.StoragePool.LookupStorageVolumeByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageVolumeAPI{vol}, nil
+}
+
+// storageVolumeAPI adapts StorageVolume to StorageVolumeAPI.
+type storageVolumeAPI struct {
+	StorageVolume
+}
+
+func (vol storageVolumeAPI) StoragePool() (StoragePoolAPI, error) {
+	pool, err := vol.StorageVolume.StoragePool()
+	if err != nil {
+		return nil, err
+	}
+
+	return storagePoolAPI{pool}, nil
+}
+
+func (vol storageVolumeAPI) Upload(str StreamAPI, offset uint64, length uint64) error {
+	return vol.UploadFlags(str, offset, length, VolUploadDefault)
+}
+
+func (vol storageVolumeAPI) UploadFlags(str StreamAPI, offset uint64, length uint64, flags StorageVolumeUploadFlag) error {
+	s, ok := str.(streamAPI)
+	if !ok {
+		return ErrForeignObject
+	}
+
+	return vol.StorageVolume.UploadFlags(s.Stream, offset, length, flags)
+}
+
+func (vol storageVolumeAPI) Download(str StreamAPI, offset uint64, length uint64) error {
+	return vol.DownloadFlags(str, offset, length, VolDownloadDefault)
+}
+
+func (vol storageVolumeAPI) DownloadFlags(str StreamAPI, offset uint64, length uint64, flags StorageVolumeDownloadFlag) error {
+	s, ok := str.(streamAPI)
+	if !ok {
+		return ErrForeignObject
+	}
+
+	return vol.StorageVolume.DownloadFlags(s.Stream, offset, length, flags)
+}
+
+// snapshotAPI adapts Snapshot to SnapshotAPI.
+type snapshotAPI struct {
+	Snapshot
+}
+
+func (snap snapshotAPI) Parent() (SnapshotAPI, error) {
+	parent, err := snap.Snapshot.Parent()
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotAPI{parent}, nil
+}
+
+func (snap snapshotAPI) Domain() (DomainAPI, error) {
+	dom, err := snap.Snapshot.Domain()
+	if err != nil {
+		return nil, err
+	}
+
+	return domainAPI{dom}, nil
+}
+
+func (snap snapshotAPI) Connection() (ConnectionAPI, error) {
+	conn, err := snap.Snapshot.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return connectionAPI{conn}, nil
+}
+
+func (snap snapshotAPI) ListChildren(flags SnapshotListFlag) ([]SnapshotAPI, error) {
+	snaps, err := snap.Snapshot.ListChildren(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]SnapshotAPI, len(snaps))
+	for i, s := range snaps {
+		apis[i] = snapshotAPI{s}
+	}
+
+	return apis, nil
+}
+
+// checkpointAPI adapts Checkpoint to CheckpointAPI.
+type checkpointAPI struct {
+	Checkpoint
+}
+
+func (cp checkpointAPI) Parent() (CheckpointAPI, error) {
+	parent, err := cp.Checkpoint.Parent()
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointAPI{parent}, nil
+}
+
+func (cp checkpointAPI) ListChildren(flags CheckpointListFlag) ([]CheckpointAPI, error) {
+	cps, err := cp.Checkpoint.ListChildren(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	apis := make([]CheckpointAPI, len(cps))
+	for i, c := range cps {
+		apis[i] = checkpointAPI{c}
+	}
+
+	return apis, nil
+}
+
+// streamAPI adapts Stream to StreamAPI.
+type streamAPI struct {
+	Stream
+}
+
+func (str streamAPI) AddEventCallback(events StreamEventType, callback StreamAPIEventCallback) error {
+	return str.Stream.AddEventCallback(events, func(s Stream, events StreamEventType) {
+		callback(streamAPI{s}, events)
+	})
+}
+
+// Compile-time checks that the adapters implement the interfaces.
+var (
+	_ ConnectionAPI    = connectionAPI{}
+	_ DomainAPI        = domainAPI{}
+	_ StoragePoolAPI   = storagePoolAPI{}
+	_ StorageVolumeAPI = storageVolumeAPI{}
+	_ SecretAPI        = Secret{}
+	_ SnapshotAPI      = snapshotAPI{}
+	_ CheckpointAPI    = checkpointAPI{}
+	_ StreamAPI        = streamAPI{}
+)
@@ -0,0 +1,259 @@
+// Command enumgen generates the String, MarshalText and UnmarshalText methods
+// of the enum and flag types declared in a file of the libvirt package.
+//
+// Usage:
+//
+//	enumgen [-output file] [-flags Type,...] [-text Const=text,...] file Type=Prefix...
+//
+// The values of each type are the constants declared with it in "file", and
+// the text form of each value is the name of its constant without "Prefix"
+// (compared case-insensitively), converted to snake case; e.g. with
+// "DomainState=DomState", DomStatePMSuspended becomes "pm_suspended". The
+// types whose names end with "Flag", and the ones listed by "-flags", are
+// formatted as sets of flags, e.g. "live|config". The text form of a constant
+// can be overridden with "-text", e.g. for names which don't convert well.
+//
+// Only the constant names are read, not their values, which usually come
+// from the libvirt C headers; the generated tables reference the constants, so
+// they stay in sync with them.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// enumType describes a type whose methods will be generated.
+type enumType struct {
+	Name   string
+	Var    string // name of the variable which holds the value names
+	Flags  bool
+	Values []enumValue
+}
+
+// enumValue is a constant of an enumType and its text form.
+type enumValue struct {
+	Const string
+	Text  string
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("enumgen: ")
+
+	output := flag.String("output", "", "output file name; default <file>_string.go")
+	flagTypes := flag.String("flags", "", "comma-separated list of additional flag types")
+	texts := flag.String("text", "", "comma-separated list of Const=text overrides")
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		log.Fatal("usage: enumgen [-output file] [-flags Type,...] [-text Const=text,...] file Type=Prefix...")
+	}
+
+	file := flag.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(file, ".go") + "_string.go"
+	}
+
+	extraFlags := make(map[string]bool)
+	for _, name := range strings.Split(*flagTypes, ",") {
+		if name != "" {
+			extraFlags[name] = true
+		}
+	}
+
+	overrides := make(map[string]string)
+	for _, override := range strings.Split(*texts, ",") {
+		if override == "" {
+			continue
+		}
+
+		name, text, ok := strings.Cut(override, "=")
+		if !ok {
+			log.Fatalf("invalid text override %q; expected Const=text", override)
+		}
+		overrides[name] = text
+	}
+
+	pkg, consts, err := parseConstants(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var types []enumType
+	for _, spec := range flag.Args()[1:] {
+		name, prefix, ok := strings.Cut(spec, "=")
+		if !ok {
+			log.Fatalf("invalid type %q; expected Type=Prefix", spec)
+		}
+
+		typ, err := newEnumType(name, prefix, consts[name], overrides)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		typ.Flags = strings.HasSuffix(name, "Flag") || extraFlags[name]
+		types = append(types, typ)
+	}
+
+	src, err := generate(pkg, filepath.Base(file), types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseConstants returns the package name of "file" and the names of the
+// constants declared in it, grouped by type in declaration order. A constant
+// without an explicit type or value has the type of the previous one in the
+// same block, as with iota.
+func parseConstants(file string) (string, map[string][]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	consts := make(map[string][]string)
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		typ := ""
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+
+			if ident, ok := value.Type.(*ast.Ident); ok {
+				typ = ident.Name
+			} else if value.Type != nil || len(value.Values) > 0 {
+				typ = ""
+			}
+
+			if typ == "" {
+				continue
+			}
+
+			for _, name := range value.Names {
+				if name.Name != "_" {
+					consts[typ] = append(consts[typ], name.Name)
+				}
+			}
+		}
+	}
+
+	return f.Name.Name, consts, nil
+}
+
+// newEnumType returns the description of the type "name", whose constants
+// are "consts". "overrides" maps constant names to their text form, if it
+// isn't derived from the name.
+func newEnumType(name, prefix string, consts []string, overrides map[string]string) (enumType, error) {
+	typ := enumType{
+		Name: name,
+		Var:  string(unicode.ToLower(rune(name[0]))) + name[1:] + "Names",
+	}
+
+	if len(consts) == 0 {
+		return typ, fmt.Errorf("no constants found for type %v", name)
+	}
+
+	seen := make(map[string]string)
+	for _, c := range consts {
+		if len(c) <= len(prefix) || !strings.EqualFold(c[:len(prefix)], prefix) {
+			return typ, fmt.Errorf("constant %v doesn't start with the prefix %q", c, prefix)
+		}
+
+		text, ok := overrides[c]
+		if !ok {
+			text = snakeCase(c[len(prefix):])
+		}
+
+		if other, ok := seen[text]; ok {
+			return typ, fmt.Errorf("constants %v and %v have the same text %q", other, c, text)
+		}
+		seen[text] = c
+
+		typ.Values = append(typ.Values, enumValue{Const: c, Text: text})
+	}
+
+	return typ, nil
+}
+
+// snakeCase converts a CamelCase identifier to snake case, keeping acronyms
+// and trailing digits together: "ACPIPowerBtn" becomes "acpi_power_btn" and
+// "ATSet1" becomes "at_set1".
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// generate returns the formatted source of the generated file.
+func generate(pkg, file string, types []enumType) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by \"enumgen %v\"; DO NOT EDIT.\n\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintf(&buf, "package %v\n", pkg)
+
+	for _, typ := range types {
+		fmt.Fprintf(&buf, "\n// %v holds the text form of the values of %v.\n", typ.Var, typ.Name)
+		fmt.Fprintf(&buf, "var %v = []enumName[%v]{\n", typ.Var, typ.Name)
+		for _, value := range typ.Values {
+			fmt.Fprintf(&buf, "\t{%v, %q},\n", value.Const, value.Text)
+		}
+		fmt.Fprintf(&buf, "}\n")
+
+		kind, what := "Enum", "value"
+		if typ.Flags {
+			kind, what = "Flags", "set of flags, e.g. \"a|b\""
+		}
+
+		fmt.Fprintf(&buf, "\n// String returns the text form of the %v.\n", what)
+		fmt.Fprintf(&buf, "func (v %v) String() string {\n", typ.Name)
+		fmt.Fprintf(&buf, "\treturn format%v(v, %v, %q)\n}\n", kind, typ.Var, typ.Name)
+
+		fmt.Fprintf(&buf, "\n// MarshalText implements encoding.TextMarshaler.\n")
+		fmt.Fprintf(&buf, "func (v %v) MarshalText() ([]byte, error) {\n", typ.Name)
+		fmt.Fprintf(&buf, "\treturn marshal%v(v, %v)\n}\n", kind, typ.Var)
+
+		fmt.Fprintf(&buf, "\n// UnmarshalText implements encoding.TextUnmarshaler.\n")
+		fmt.Fprintf(&buf, "func (v *%v) UnmarshalText(text []byte) error {\n", typ.Name)
+		fmt.Fprintf(&buf, "\treturn unmarshal%v(v, text, %v, %q)\n}\n", kind, typ.Var, typ.Name)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the code generated for %v: %v", file, err)
+	}
+
+	return src, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Running":       "running",
+		"PMSuspended":   "pm_suspended",
+		"ACPIPowerBtn":  "acpi_power_btn",
+		"ATSet1":        "at_set1",
+		"Pfitzner33":    "pfitzner33",
+		"NoManagedSave": "no_managed_save",
+		"EOF":           "eof",
+	}
+
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("unexpected snake case of %v; got=%v, want=%v", name, got, want)
+		}
+	}
+}
+
+func TestNewEnumType(t *testing.T) {
+	consts := []string{"DomVCPusConfig", "DomVCPUsLive", "DomVCPUsDoD"}
+
+	typ, err := newEnumType("DomainVCPUsFlag", "DomVCPUs", consts, map[string]string{"DomVCPUsDoD": "dod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []enumValue{{"DomVCPusConfig", "config"}, {"DomVCPUsLive", "live"}, {"DomVCPUsDoD", "dod"}}
+	for i, value := range typ.Values {
+		if value != want[i] {
+			t.Errorf("unexpected value; got=%+v, want=%+v", value, want[i])
+		}
+	}
+
+	if typ.Var != "domainVCPUsFlagNames" {
+		t.Errorf("unexpected variable name; got=%v, want=domainVCPUsFlagNames", typ.Var)
+	}
+
+	if _, err := newEnumType("DomainState", "DomState", []string{"DomStateLive", "DomStatelive"}, nil); err == nil {
+		t.Error("an error was not returned when two constants have the same text")
+	}
+
+	if _, err := newEnumType("DomainState", "DomState", []string{"DomLive"}, nil); err == nil {
+		t.Error("an error was not returned when a constant doesn't have the prefix")
+	}
+}
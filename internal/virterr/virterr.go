@@ -0,0 +1,431 @@
+// Package virterr holds the error types shared by the cgo package and the
+// pure-Go remote client, so errors returned by both can be matched with the
+// same codes and domains. The values are the ones of virterror.h; the cgo
+// package declares its constants from the C headers, and its tests check they
+// match.
+package virterr
+
+import "fmt"
+
+// Code is the error code.
+type Code uint32
+
+// Possible values for Code.
+const (
+	ErrOK                      Code = 0
+	ErrInternal                Code = 1
+	ErrNoMemory                Code = 2
+	ErrNoSupport               Code = 3
+	ErrUnknownHost             Code = 4
+	ErrNoConnect               Code = 5
+	ErrInvalidConn             Code = 6
+	ErrInvalidDomain           Code = 7
+	ErrInvalidArg              Code = 8
+	ErrOperationFailed         Code = 9
+	ErrGetFailed               Code = 10
+	ErrPostFailed              Code = 11
+	ErrHTTP                    Code = 12
+	ErrSExprSerial             Code = 13
+	ErrNoXen                   Code = 14
+	ErrXenCall                 Code = 15
+	ErrOSType                  Code = 16
+	ErrNoKernel                Code = 17
+	ErrNoRoot                  Code = 18
+	ErrNoSource                Code = 19
+	ErrNoTarget                Code = 20
+	ErrNoName                  Code = 21
+	ErrNoOS                    Code = 22
+	ErrNoDevice                Code = 23
+	ErrNoXenStore              Code = 24
+	ErrDriverFull              Code = 25
+	ErrCallFailed              Code = 26
+	ErrXML                     Code = 27
+	ErrDomExist                Code = 28
+	ErrOperationDenied         Code = 29
+	ErrOpenFailed              Code = 30
+	ErrReadFailed              Code = 31
+	ErrParseFailed             Code = 32
+	ErrConfSyntax              Code = 33
+	ErrWriteFailed             Code = 34
+	ErrXMLDetail               Code = 35
+	ErrInvalidNetwork          Code = 36
+	ErrNetworkExist            Code = 37
+	ErrSystem                  Code = 38
+	ErrRPC                     Code = 39
+	ErrGNUTLS                  Code = 40
+	WarNoNetwork               Code = 41
+	ErrNoDomain                Code = 42
+	ErrNoNetwork               Code = 43
+	ErrInvalidMAC              Code = 44
+	ErrAuthFailed              Code = 45
+	ErrInvalidStoragePool      Code = 46
+	ErrInvalidStorageVol       Code = 47
+	WarNoStorage               Code = 48
+	ErrNoStoragePool           Code = 49
+	ErrNoStorageVol            Code = 50
+	WarNoNode                  Code = 51
+	ErrInvalidNodeDevice       Code = 52
+	ErrNoNodeDevice            Code = 53
+	ErrNoSecurityModel         Code = 54
+	ErrOperationInvalid        Code = 55
+	WarNoInterface             Code = 56
+	ErrNoInterface             Code = 57
+	ErrInvalidInterface        Code = 58
+	ErrMultipleInterfaces      Code = 59
+	WarNoNwFilter              Code = 60
+	ErrInvalidNwFilter         Code = 61
+	ErrNoNwFilter              Code = 62
+	ErrBuildFirewall           Code = 63
+	WarNoSecret                Code = 64
+	ErrInvalidSecret           Code = 65
+	ErrNoSecret                Code = 66
+	ErrConfigUnsupported       Code = 67
+	ErrOperationTimeout        Code = 68
+	ErrMigratePersistFailed    Code = 69
+	ErrHookScriptFailed        Code = 70
+	ErrInvalidDomainSnapshot   Code = 71
+	ErrNoDomainSnapshot        Code = 72
+	ErrInvalidStream           Code = 73
+	ErrArgumentUnsupported     Code = 74
+	ErrStorageProbeFailed      Code = 75
+	ErrStoragePoolBuilt        Code = 76
+	ErrSnapshotRevertRisky     Code = 77
+	ErrOperationAborted        Code = 78
+	ErrAuthCancelled           Code = 79
+	ErrNoDomainMetadata        Code = 80
+	ErrMigrateUnsafe           Code = 81
+	ErrOverflow                Code = 82
+	ErrBlockCopyActive         Code = 83
+	ErrOperationUnsupported    Code = 84
+	ErrSSH                     Code = 85
+	ErrAgentUnresponsive       Code = 86
+	ErrResourceBusy            Code = 87
+	ErrAccessDenied            Code = 88
+	ErrDBusService             Code = 89
+	ErrStorageVolExist         Code = 90
+	ErrCPUIncompatible         Code = 91
+	ErrInvalidDomainCheckpoint Code = 102
+	ErrNoDomainCheckpoint      Code = 103
+)
+
+// Domain describes what part of the library raised the error.
+type Domain uint32
+
+// Possible values for Domain.
+const (
+	ErrDomNone             Domain = 0
+	ErrDomXen              Domain = 1
+	ErrDomXend             Domain = 2
+	ErrDomXenStore         Domain = 3
+	ErrDomSExpr            Domain = 4
+	ErrDomXML              Domain = 5
+	ErrDomDom              Domain = 6
+	ErrDomRPC              Domain = 7
+	ErrDomProxy            Domain = 8
+	ErrDomConf             Domain = 9
+	ErrDomQEMU             Domain = 10
+	ErrDomNet              Domain = 11
+	ErrDomTest             Domain = 12
+	ErrDomRemote           Domain = 13
+	ErrDomOpenVZ           Domain = 14
+	ErrDomXenXM            Domain = 15
+	ErrDomStatsLinux       Domain = 16
+	ErrDomLXC              Domain = 17
+	ErrDomStorage          Domain = 18
+	ErrDomNetwork          Domain = 19
+	ErrDomDomain           Domain = 20
+	ErrDomUML              Domain = 21
+	ErrDomNodeDev          Domain = 22
+	ErrDomXenInotify       Domain = 23
+	ErrDomSecurity         Domain = 24
+	ErrDomVBox             Domain = 25
+	ErrDomInterface        Domain = 26
+	ErrDomONE              Domain = 27
+	ErrDomESX              Domain = 28
+	ErrDomPHYP             Domain = 29
+	ErrDomSecret           Domain = 30
+	ErrDomCPU              Domain = 31
+	ErrDomXenAPI           Domain = 32
+	ErrDomNwFilter         Domain = 33
+	ErrDomHook             Domain = 34
+	ErrDomDomainSnapshot   Domain = 35
+	ErrDomAudit            Domain = 36
+	ErrDomSysinfo          Domain = 37
+	ErrDomStreams          Domain = 38
+	ErrDomVMWare           Domain = 39
+	ErrDomEvent            Domain = 40
+	ErrDomLibXL            Domain = 41
+	ErrDomLocking          Domain = 42
+	ErrDomHyperv           Domain = 43
+	ErrDomCapabilities     Domain = 44
+	ErrDomURI              Domain = 45
+	ErrDomAuth             Domain = 46
+	ErrDomDBus             Domain = 47
+	ErrDomParallels        Domain = 48
+	ErrDomDevice           Domain = 49
+	ErrDomSSH              Domain = 50
+	ErrDomLockspace        Domain = 51
+	ErrDomInitctl          Domain = 52
+	ErrDomIdentity         Domain = 53
+	ErrDomCgroup           Domain = 54
+	ErrDomAccess           Domain = 55
+	ErrDomSystemd          Domain = 56
+	ErrDomBhyve            Domain = 57
+	ErrDomCrypto           Domain = 58
+	ErrDomFirewall         Domain = 59
+	ErrDomDomainCheckpoint Domain = 69
+)
+
+// Level specifies how consequent is the error.
+type Level uint32
+
+// Possible values for Level.
+const (
+	ErrLvlNone    Level = 0
+	ErrLvlWarning Level = 1
+	ErrLvlError   Level = 2
+)
+
+// codeNames maps the values of Code to their names.
+var codeNames = map[Code]string{
+	ErrOK:                      "ErrOK",
+	ErrInternal:                "ErrInternal",
+	ErrNoMemory:                "ErrNoMemory",
+	ErrNoSupport:               "ErrNoSupport",
+	ErrUnknownHost:             "ErrUnknownHost",
+	ErrNoConnect:               "ErrNoConnect",
+	ErrInvalidConn:             "ErrInvalidConn",
+	ErrInvalidDomain:           "ErrInvalidDomain",
+	ErrInvalidArg:              "ErrInvalidArg",
+	ErrOperationFailed:         "ErrOperationFailed",
+	ErrGetFailed:               "ErrGetFailed",
+	ErrPostFailed:              "ErrPostFailed",
+	ErrHTTP:                    "ErrHTTP",
+	ErrSExprSerial:             "ErrSExprSerial",
+	ErrNoXen:                   "ErrNoXen",
+	ErrXenCall:                 "ErrXenCall",
+	ErrOSType:                  "ErrOSType",
+	ErrNoKernel:                "ErrNoKernel",
+	ErrNoRoot:                  "ErrNoRoot",
+	ErrNoSource:                "ErrNoSource",
+	ErrNoTarget:                "ErrNoTarget",
+	ErrNoName:                  "ErrNoName",
+	ErrNoOS:                    "ErrNoOS",
+	ErrNoDevice:                "ErrNoDevice",
+	ErrNoXenStore:              "ErrNoXenStore",
+	ErrDriverFull:              "ErrDriverFull",
+	ErrCallFailed:              "ErrCallFailed",
+	ErrXML:                     "ErrXML",
+	ErrDomExist:                "ErrDomExist",
+	ErrOperationDenied:         "ErrOperationDenied",
+	ErrOpenFailed:              "ErrOpenFailed",
+	ErrReadFailed:              "ErrReadFailed",
+	ErrParseFailed:             "ErrParseFailed",
+	ErrConfSyntax:              "ErrConfSyntax",
+	ErrWriteFailed:             "ErrWriteFailed",
+	ErrXMLDetail:               "ErrXMLDetail",
+	ErrInvalidNetwork:          "ErrInvalidNetwork",
+	ErrNetworkExist:            "ErrNetworkExist",
+	ErrSystem:                  "ErrSystem",
+	ErrRPC:                     "ErrRPC",
+	ErrGNUTLS:                  "ErrGNUTLS",
+	WarNoNetwork:               "WarNoNetwork",
+	ErrNoDomain:                "ErrNoDomain",
+	ErrNoNetwork:               "ErrNoNetwork",
+	ErrInvalidMAC:              "ErrInvalidMAC",
+	ErrAuthFailed:              "ErrAuthFailed",
+	ErrInvalidStoragePool:      "ErrInvalidStoragePool",
+	ErrInvalidStorageVol:       "ErrInvalidStorageVol",
+	WarNoStorage:               "WarNoStorage",
+	ErrNoStoragePool:           "ErrNoStoragePool",
+	ErrNoStorageVol:            "ErrNoStorageVol",
+	WarNoNode:                  "WarNoNode",
+	ErrInvalidNodeDevice:       "ErrInvalidNodeDevice",
+	ErrNoNodeDevice:            "ErrNoNodeDevice",
+	ErrNoSecurityModel:         "ErrNoSecurityModel",
+	ErrOperationInvalid:        "ErrOperationInvalid",
+	WarNoInterface:             "WarNoInterface",
+	ErrNoInterface:             "ErrNoInterface",
+	ErrInvalidInterface:        "ErrInvalidInterface",
+	ErrMultipleInterfaces:      "ErrMultipleInterfaces",
+	WarNoNwFilter:              "WarNoNwFilter",
+	ErrInvalidNwFilter:         "ErrInvalidNwFilter",
+	ErrNoNwFilter:              "ErrNoNwFilter",
+	ErrBuildFirewall:           "ErrBuildFirewall",
+	WarNoSecret:                "WarNoSecret",
+	ErrInvalidSecret:           "ErrInvalidSecret",
+	ErrNoSecret:                "ErrNoSecret",
+	ErrConfigUnsupported:       "ErrConfigUnsupported",
+	ErrOperationTimeout:        "ErrOperationTimeout",
+	ErrMigratePersistFailed:    "ErrMigratePersistFailed",
+	ErrHookScriptFailed:        "ErrHookScriptFailed",
+	ErrInvalidDomainSnapshot:   "ErrInvalidDomainSnapshot",
+	ErrNoDomainSnapshot:        "ErrNoDomainSnapshot",
+	ErrInvalidStream:           "ErrInvalidStream",
+	ErrArgumentUnsupported:     "ErrArgumentUnsupported",
+	ErrStorageProbeFailed:      "ErrStorageProbeFailed",
+	ErrStoragePoolBuilt:        "ErrStoragePoolBuilt",
+	ErrSnapshotRevertRisky:     "ErrSnapshotRevertRisky",
+	ErrOperationAborted:        "ErrOperationAborted",
+	ErrAuthCancelled:           "ErrAuthCancelled",
+	ErrNoDomainMetadata:        "ErrNoDomainMetadata",
+	ErrMigrateUnsafe:           "ErrMigrateUnsafe",
+	ErrOverflow:                "ErrOverflow",
+	ErrBlockCopyActive:         "ErrBlockCopyActive",
+	ErrOperationUnsupported:    "ErrOperationUnsupported",
+	ErrSSH:                     "ErrSSH",
+	ErrAgentUnresponsive:       "ErrAgentUnresponsive",
+	ErrResourceBusy:            "ErrResourceBusy",
+	ErrAccessDenied:            "ErrAccessDenied",
+	ErrDBusService:             "ErrDBusService",
+	ErrStorageVolExist:         "ErrStorageVolExist",
+	ErrCPUIncompatible:         "ErrCPUIncompatible",
+	ErrInvalidDomainCheckpoint: "ErrInvalidDomainCheckpoint",
+	ErrNoDomainCheckpoint:      "ErrNoDomainCheckpoint",
+}
+
+// domainNames maps the values of Domain to their names.
+var domainNames = map[Domain]string{
+	ErrDomNone:             "ErrDomNone",
+	ErrDomXen:              "ErrDomXen",
+	ErrDomXend:             "ErrDomXend",
+	ErrDomXenStore:         "ErrDomXenStore",
+	ErrDomSExpr:            "ErrDomSExpr",
+	ErrDomXML:              "ErrDomXML",
+	ErrDomDom:              "ErrDomDom",
+	ErrDomRPC:              "ErrDomRPC",
+	ErrDomProxy:            "ErrDomProxy",
+	ErrDomConf:             "ErrDomConf",
+	ErrDomQEMU:             "ErrDomQEMU",
+	ErrDomNet:              "ErrDomNet",
+	ErrDomTest:             "ErrDomTest",
+	ErrDomRemote:           "ErrDomRemote",
+	ErrDomOpenVZ:           "ErrDomOpenVZ",
+	ErrDomXenXM:            "ErrDomXenXM",
+	ErrDomStatsLinux:       "ErrDomStatsLinux",
+	ErrDomLXC:              "ErrDomLXC",
+	ErrDomStorage:          "ErrDomStorage",
+	ErrDomNetwork:          "ErrDomNetwork",
+	ErrDomDomain:           "ErrDomDomain",
+	ErrDomUML:              "ErrDomUML",
+	ErrDomNodeDev:          "ErrDomNodeDev",
+	ErrDomXenInotify:       "ErrDomXenInotify",
+	ErrDomSecurity:         "ErrDomSecurity",
+	ErrDomVBox:             "ErrDomVBox",
+	ErrDomInterface:        "ErrDomInterface",
+	ErrDomONE:              "ErrDomONE",
+	ErrDomESX:              "ErrDomESX",
+	ErrDomPHYP:             "ErrDomPHYP",
+	ErrDomSecret:           "ErrDomSecret",
+	ErrDomCPU:              "ErrDomCPU",
+	ErrDomXenAPI:           "ErrDomXenAPI",
+	ErrDomNwFilter:         "ErrDomNwFilter",
+	ErrDomHook:             "ErrDomHook",
+	ErrDomDomainSnapshot:   "ErrDomDomainSnapshot",
+	ErrDomAudit:            "ErrDomAudit",
+	ErrDomSysinfo:          "ErrDomSysinfo",
+	ErrDomStreams:          "ErrDomStreams",
+	ErrDomVMWare:           "ErrDomVMWare",
+	ErrDomEvent:            "ErrDomEvent",
+	ErrDomLibXL:            "ErrDomLibXL",
+	ErrDomLocking:          "ErrDomLocking",
+	ErrDomHyperv:           "ErrDomHyperv",
+	ErrDomCapabilities:     "ErrDomCapabilities",
+	ErrDomURI:              "ErrDomURI",
+	ErrDomAuth:             "ErrDomAuth",
+	ErrDomDBus:             "ErrDomDBus",
+	ErrDomParallels:        "ErrDomParallels",
+	ErrDomDevice:           "ErrDomDevice",
+	ErrDomSSH:              "ErrDomSSH",
+	ErrDomLockspace:        "ErrDomLockspace",
+	ErrDomInitctl:          "ErrDomInitctl",
+	ErrDomIdentity:         "ErrDomIdentity",
+	ErrDomCgroup:           "ErrDomCgroup",
+	ErrDomAccess:           "ErrDomAccess",
+	ErrDomSystemd:          "ErrDomSystemd",
+	ErrDomBhyve:            "ErrDomBhyve",
+	ErrDomCrypto:           "ErrDomCrypto",
+	ErrDomFirewall:         "ErrDomFirewall",
+	ErrDomDomainCheckpoint: "ErrDomDomainCheckpoint",
+}
+
+// levelNames maps the values of Level to their names.
+var levelNames = map[Level]string{
+	ErrLvlNone:    "ErrLvlNone",
+	ErrLvlWarning: "ErrLvlWarning",
+	ErrLvlError:   "ErrLvlError",
+}
+
+// String returns the name of the error code.
+func (code Code) String() string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorCode(%d)", uint32(code))
+}
+
+// Error implements the error interface, so error codes can be used as targets
+// of errors.Is (e.g. errors.Is(err, ErrNoDomain)).
+func (code Code) Error() string {
+	return "libvirt error code " + code.String()
+}
+
+// String returns the name of the error domain.
+func (dom Domain) String() string {
+	if name, ok := domainNames[dom]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorDomain(%d)", uint32(dom))
+}
+
+// Error implements the error interface, so error domains can be used as
+// targets of errors.Is (e.g. errors.Is(err, ErrDomStorage)).
+func (dom Domain) Error() string {
+	return "libvirt error domain " + dom.String()
+}
+
+// String returns the name of the error level.
+func (lvl Level) String() string {
+	if name, ok := levelNames[lvl]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorLevel(%d)", uint32(lvl))
+}
+
+// Error is an error reported by libvirt, either by the C library or by a
+// remote server.
+type Error struct {
+	Code             Code
+	Domain           Domain
+	Message          string
+	Level            Level
+	Str1, Str2, Str3 string
+	Int1, Int2       int32
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s [error code = %d]", err.Message, err.Code)
+}
+
+// Is reports whether the error matches "target", which may be a Code, a
+// Domain or another *Error with the same code and domain. It allows errors to
+// be checked with errors.Is:
+//
+//	if errors.Is(err, libvirt.ErrNoDomain) {
+//		// the domain doesn't exist
+//	}
+func (err *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Code:
+		return err.Code == t
+	case Domain:
+		return err.Domain == t
+	case *Error:
+		return t != nil && err.Code == t.Code && err.Domain == t.Domain
+	default:
+		return false
+	}
+}
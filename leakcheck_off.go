@@ -0,0 +1,7 @@
+//go:build !libvirt_leakcheck
+
+package libvirt
+
+// leakCheck enables the detection of objects which aren't freed before their
+// connection is closed.
+const leakCheck = false
@@ -14,6 +14,11 @@ import (
 	"github.com/cd1/utils-golang"
 )
 
+const testCheckpointXML = `
+<domaincheckpoint>
+    <name>{{.Name}}</name>
+</domaincheckpoint>`
+
 const testDeviceLogXML = `
 <disk type="dir" device="cdrom">
     <driver name="qemu" type="raw" />
@@ -94,6 +99,7 @@ var (
 
 // These variables shouldn't be changed.
 var (
+	testCheckpointTmpl     = template.Must(template.New("test-checkpoint").Parse(testCheckpointXML))
 	testDomainMetadataTmpl = template.Must(template.New("test-domain-metadata").Parse(testDomainMetadataXML))
 	testDomainTmpl         = template.Must(template.New("test-domain").Parse(testDomainXML))
 	testSecretTmpl         = template.Must(template.New("test-secret").Parse(testSecretXML))
@@ -102,6 +108,27 @@ var (
 	testStorageVolumeTmpl  = template.Must(template.New("test-storagevolume").Parse(testStorageVolumeXML))
 )
 
+func init() {
+	// The event loop must be registered before any connection is opened, so
+	// the tests which depend on callbacks can work.
+	if err := EventRegisterDefaultImpl(); err != nil {
+		panic(err)
+	}
+
+	go func() {
+		for {
+			if err := EventRunDefaultImpl(); err != nil {
+				panic(err)
+			}
+		}
+	}()
+}
+
+// testCheckpointData contains the data of a checkpoint used for testing.
+type testCheckpointData struct {
+	Name string
+}
+
 // testDomainData contains the data of a domain used for testing.
 type testDomainData struct {
 	DiskFormat        string
@@ -158,6 +185,8 @@ type testStorageVolumeData struct {
 // responsible for opening the connection to libvirt, creating test domains and
 // other resources, and cleaning them up.
 type testEnvironment struct {
+	cp       *Checkpoint
+	cpData   *testCheckpointData
 	conn     *Connection
 	dom      *Domain
 	domData  *testDomainData
@@ -268,6 +297,14 @@ func (data *testDomainData) cleanUp(conn Connection) error {
 	return nil
 }
 
+// newTestCheckpointData creates new data for a test checkpoint. The values are
+// generated randomly every time this function is called.
+func newTestCheckpointData() *testCheckpointData {
+	return &testCheckpointData{
+		Name: fmt.Sprintf("checkpoint-%v", utils.RandomString()),
+	}
+}
+
 // newTestSecretData creates new data for a test secret. The values are
 // generated randomly every time this function is called.
 func newTestSecretData() *testSecretData {
@@ -347,6 +384,16 @@ func newTestEnvironment(t testing.TB) *testEnvironment {
 // exists, and the connection to libvirt is closed.
 func (env *testEnvironment) cleanUp() {
 	if env.dom != nil {
+		if env.cp != nil {
+			if err := env.cp.Delete(CheckpointDeleteDefault); err != nil {
+				env.t.Error(err)
+			}
+
+			if err := env.cp.Free(); err != nil {
+				env.t.Error(err)
+			}
+		}
+
 		if env.snap != nil {
 			if err := env.snap.Delete(SnapDeleteDefault); err != nil {
 				env.t.Error(err)
@@ -465,6 +512,31 @@ func (env *testEnvironment) withDomain() *testEnvironment {
 	return env
 }
 
+// withCheckpoint creates a new test checkpoint on the test domain.
+func (env *testEnvironment) withCheckpoint() *testEnvironment {
+	if env.dom == nil {
+		env.withDomain()
+	}
+
+	data := newTestCheckpointData()
+
+	var xml bytes.Buffer
+
+	if err := testCheckpointTmpl.Execute(&xml, data); err != nil {
+		env.t.Fatal(err)
+	}
+
+	cp, err := env.dom.CreateCheckpoint(xml.String(), CheckpointCreateDefault)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+
+	env.cpData = data
+	env.cp = &cp
+
+	return env
+}
+
 func (env *testEnvironment) withSnapshot() *testEnvironment {
 	if env.dom == nil {
 		env.withDomain()
@@ -0,0 +1,314 @@
+package libvirtfake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// checkpointDef is the part of the checkpoint XML understood by the fake.
+type checkpointDef struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+}
+
+// checkpointRecord is the state of a fake domain checkpoint.
+type checkpointRecord struct {
+	name         string
+	description  string
+	creationTime int64
+	parent       *checkpointRecord
+}
+
+// xml renders the XML description of the checkpoint.
+func (cp *checkpointRecord) xml() string {
+	var b strings.Builder
+
+	b.WriteString("<domaincheckpoint>\n")
+	fmt.Fprintf(&b, "  <name>%v</name>\n", escape(cp.name))
+	if cp.description != "" {
+		fmt.Fprintf(&b, "  <description>%v</description>\n", escape(cp.description))
+	}
+	if cp.parent != nil {
+		fmt.Fprintf(&b, "  <parent>\n    <name>%v</name>\n  </parent>\n", escape(cp.parent.name))
+	}
+	fmt.Fprintf(&b, "  <creationTime>%v</creationTime>\n", cp.creationTime)
+	b.WriteString("</domaincheckpoint>\n")
+
+	return b.String()
+}
+
+// findCheckpoint returns the checkpoint of the domain named "name".
+func (rec *domainRecord) findCheckpoint(name string) *checkpointRecord {
+	for _, cp := range rec.checkpoints {
+		if cp.name == name {
+			return cp
+		}
+	}
+
+	return nil
+}
+
+// checkpointChildren returns the direct children of "parent", or the root
+// checkpoints if "parent" is nil.
+func (rec *domainRecord) checkpointChildren(parent *checkpointRecord) []*checkpointRecord {
+	var children []*checkpointRecord
+	for _, cp := range rec.checkpoints {
+		if cp.parent == parent {
+			children = append(children, cp)
+		}
+	}
+
+	return children
+}
+
+// checkpointDescendants returns all checkpoints below "parent", in creation
+// order.
+func (rec *domainRecord) checkpointDescendants(parent *checkpointRecord) []*checkpointRecord {
+	var descendants []*checkpointRecord
+	for _, cp := range rec.checkpoints {
+		for p := cp.parent; p != nil; p = p.parent {
+			if p == parent {
+				descendants = append(descendants, cp)
+				break
+			}
+		}
+	}
+
+	return descendants
+}
+
+// filterCheckpoints returns the checkpoints of "cps" which match the filters
+// of "flags". Checkpoints are always kept in topological order.
+func (rec *domainRecord) filterCheckpoints(cps []*checkpointRecord, flags libvirt.CheckpointListFlag) []*checkpointRecord {
+	var filtered []*checkpointRecord
+	for _, cp := range cps {
+		leaf := len(rec.checkpointChildren(cp)) == 0
+		ok := matches(filterGroup{
+			{flags&libvirt.CheckpointListLeaves != 0, leaf},
+			{flags&libvirt.CheckpointListNoLeaves != 0, !leaf},
+		})
+
+		if ok {
+			filtered = append(filtered, cp)
+		}
+	}
+
+	return filtered
+}
+
+// createCheckpoint adds a new checkpoint, child of the most recent one, to
+// the domain. The state must be locked.
+func (dom Domain) createCheckpoint(rec *domainRecord, xml string, flags libvirt.CheckpointCreateFlag) (*checkpointRecord, error) {
+	var def checkpointDef
+	if err := parseXML(xml, &def, libvirt.ErrDomDomainCheckpoint); err != nil {
+		return nil, err
+	}
+
+	if flags&libvirt.CheckpointCreateRedefine != 0 {
+		return nil, errNoSupport("checkpoint redefinition")
+	}
+
+	if !rec.isActive() {
+		return nil, newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomainCheckpoint, "domain is not running")
+	}
+
+	now := time.Now().Unix()
+	name := def.Name
+	if name == "" {
+		name = strconv.FormatInt(now, 10)
+	}
+
+	if rec.findCheckpoint(name) != nil {
+		return nil, newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomainCheckpoint, "checkpoint '%v' already exists", name)
+	}
+
+	cp := &checkpointRecord{
+		name:         name,
+		description:  def.Description,
+		creationTime: now,
+	}
+	if n := len(rec.checkpoints); n > 0 {
+		cp.parent = rec.checkpoints[n-1]
+	}
+
+	rec.checkpoints = append(rec.checkpoints, cp)
+
+	return cp, nil
+}
+
+// ListCheckpoints returns the checkpoints of the domain matching "flags".
+// With CheckpointListRoots, only checkpoints without a parent are returned.
+func (dom Domain) ListCheckpoints(flags libvirt.CheckpointListFlag) (cps []libvirt.CheckpointAPI, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		candidates := rec.checkpoints
+		if flags&libvirt.CheckpointListRoots != 0 {
+			candidates = rec.checkpointChildren(nil)
+		}
+
+		cps = make([]libvirt.CheckpointAPI, 0, len(candidates))
+		for _, cp := range rec.filterCheckpoints(candidates, flags) {
+			cps = append(cps, Checkpoint{dom, cp.name})
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// CreateCheckpoint creates a checkpoint of a running domain.
+func (dom Domain) CreateCheckpoint(xml string, flags libvirt.CheckpointCreateFlag) (libvirt.CheckpointAPI, error) {
+	var cp *checkpointRecord
+	err := dom.withDomain(func(rec *domainRecord) (err error) {
+		cp, err = dom.createCheckpoint(rec, xml, flags)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Checkpoint{dom, cp.name}, nil
+}
+
+// LookupCheckpointByName returns the checkpoint of the domain named "name".
+func (dom Domain) LookupCheckpointByName(name string) (libvirt.CheckpointAPI, error) {
+	err := dom.withDomain(func(rec *domainRecord) error {
+		if rec.findCheckpoint(name) == nil {
+			return errNoCheckpoint(name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Checkpoint{dom, name}, nil
+}
+
+// errNoCheckpoint is returned when a checkpoint can't be found.
+func errNoCheckpoint(name string) error {
+	return newError(libvirt.ErrNoDomainCheckpoint, libvirt.ErrDomDomainCheckpoint, "Domain checkpoint not found: no domain checkpoint with matching name '%v'", name)
+}
+
+// Checkpoint is a fake libvirt domain checkpoint. It implements
+// libvirt.CheckpointAPI.
+type Checkpoint struct {
+	dom  Domain
+	name string
+}
+
+// withCheckpoint runs "fn" with the domain and checkpoint records while the
+// state is locked.
+func (cp Checkpoint) withCheckpoint(fn func(rec *domainRecord, c *checkpointRecord) error) error {
+	return cp.dom.withDomain(func(rec *domainRecord) error {
+		c := rec.findCheckpoint(cp.name)
+		if c == nil {
+			return errNoCheckpoint(cp.name)
+		}
+
+		return fn(rec, c)
+	})
+}
+
+// Free does nothing; it exists to implement the interface.
+func (cp Checkpoint) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (cp Checkpoint) Ref() error {
+	return nil
+}
+
+// Delete removes the checkpoint. Its children are attached to its parent,
+// unless CheckpointDeleteChildren or CheckpointDeleteChildrenOnly is used.
+func (cp Checkpoint) Delete(flags libvirt.CheckpointDeleteFlag) error {
+	return cp.withCheckpoint(func(rec *domainRecord, c *checkpointRecord) error {
+		var doomed []*checkpointRecord
+		if flags&(libvirt.CheckpointDeleteChildren|libvirt.CheckpointDeleteChildrenOnly) != 0 {
+			doomed = rec.checkpointDescendants(c)
+		}
+		if flags&libvirt.CheckpointDeleteChildrenOnly == 0 {
+			doomed = append(doomed, c)
+		}
+
+		for _, d := range doomed {
+			for _, child := range rec.checkpointChildren(d) {
+				child.parent = d.parent
+			}
+
+			for i, other := range rec.checkpoints {
+				if other == d {
+					rec.checkpoints = append(rec.checkpoints[:i], rec.checkpoints[i+1:]...)
+					break
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Name returns the name of the checkpoint.
+func (cp Checkpoint) Name() (string, error) {
+	err := cp.withCheckpoint(func(rec *domainRecord, c *checkpointRecord) error {
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return cp.name, nil
+}
+
+// Parent returns the parent of the checkpoint.
+func (cp Checkpoint) Parent() (parent libvirt.CheckpointAPI, err error) {
+	err = cp.withCheckpoint(func(rec *domainRecord, c *checkpointRecord) error {
+		if c.parent == nil {
+			return newError(libvirt.ErrNoDomainCheckpoint, libvirt.ErrDomDomainCheckpoint, "checkpoint '%v' does not have a parent", c.name)
+		}
+
+		parent = Checkpoint{cp.dom, c.parent.name}
+		return nil
+	})
+
+	return
+}
+
+// XML returns the XML description of the checkpoint.
+func (cp Checkpoint) XML(flags libvirt.CheckpointXMLFlag) (doc string, err error) {
+	err = cp.withCheckpoint(func(rec *domainRecord, c *checkpointRecord) error {
+		doc = c.xml()
+		return nil
+	})
+
+	return
+}
+
+// ListChildren returns the children of the checkpoint matching "flags". With
+// CheckpointListDescendants, all checkpoints below it are returned.
+func (cp Checkpoint) ListChildren(flags libvirt.CheckpointListFlag) (children []libvirt.CheckpointAPI, err error) {
+	err = cp.withCheckpoint(func(rec *domainRecord, c *checkpointRecord) error {
+		candidates := rec.checkpointChildren(c)
+		if flags&libvirt.CheckpointListDescendants != 0 {
+			candidates = rec.checkpointDescendants(c)
+		}
+
+		children = make([]libvirt.CheckpointAPI, 0, len(candidates))
+		for _, child := range rec.filterCheckpoints(candidates, flags) {
+			children = append(children, Checkpoint{cp.dom, child.name})
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// Compile-time check that Checkpoint implements the interface.
+var _ libvirt.CheckpointAPI = Checkpoint{}
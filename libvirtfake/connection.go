@@ -0,0 +1,450 @@
+// Package libvirtfake provides an in-memory implementation of the libvirt
+// interfaces (ConnectionAPI, DomainAPI and so on), so code depending on them
+// can be unit-tested without a running libvirt daemon.
+//
+// The fake models the state transitions of domains, storage pools, storage
+// volumes, secrets, snapshots and checkpoints closely enough for most tests,
+// and reports failures with *libvirt.Error values carrying the same error
+// codes used by libvirt. It doesn't try to validate XML documents beyond the
+// elements it needs, and operations which only make sense on a real
+// hypervisor either succeed without side effects or fail with ErrNoSupport.
+//
+// Several connections can be opened to the same Hypervisor, which can be
+// stopped and started again to test how the code handles lost connections.
+package libvirtfake
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// Values reported by a fake connection.
+const (
+	FakeURI        = "test:///default"
+	FakeType       = "Test"
+	FakeHostname   = "localhost"
+	FakeVersion    = 2
+	FakeLibVersion = 10000000
+	FakeMaxVCPUs   = 32
+)
+
+// waitPollInterval is how often WaitForState reads the state of a fake object.
+const waitPollInterval = 10 * time.Millisecond
+
+// fakeCapabilities is the capabilities XML returned by a fake connection.
+const fakeCapabilities = `<capabilities>
+  <host>
+    <cpu>
+      <arch>x86_64</arch>
+    </cpu>
+  </host>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name='x86_64'>
+      <domain type='test'/>
+    </arch>
+  </guest>
+</capabilities>
+`
+
+// fakeCPUModels are the CPU models returned for the x86_64 architecture.
+var fakeCPUModels = []string{"qemu64", "kvm64", "Haswell", "Skylake-Client"}
+
+// Hypervisor is a fake hypervisor, which holds the state shared by every
+// connection to it and every object created from those connections. It can
+// be stopped and started again, to simulate a daemon restart.
+type Hypervisor struct {
+	mu sync.Mutex
+
+	stopped bool
+	conns   []*Connection
+	nextID  uint32
+	domains []*domainRecord
+	pools   []*poolRecord
+	secrets []*secretRecord
+
+	// images are the domains saved with Domain.Save, by file name.
+	images map[string]*domainRecord
+}
+
+// Connection is a fake libvirt connection. It implements
+// libvirt.ConnectionAPI and it's safe for concurrent use.
+type Connection struct {
+	hv *Hypervisor
+
+	// These fields are protected by the hypervisor lock.
+	closed  bool
+	lost    bool
+	refs    int32
+	onClose libvirt.CloseCallback
+}
+
+// NewHypervisor creates an empty fake hypervisor.
+func NewHypervisor() *Hypervisor {
+	return &Hypervisor{
+		nextID: 1,
+		images: make(map[string]*domainRecord),
+	}
+}
+
+// NewConnection creates a fake connection to an empty hypervisor.
+func NewConnection() *Connection {
+	conn, err := NewHypervisor().Open()
+	if err != nil {
+		panic(err)
+	}
+
+	return conn
+}
+
+// Open creates a new connection to the hypervisor. It fails with ErrSystem,
+// as when the daemon socket can't be reached, while the hypervisor is
+// stopped.
+func (hv *Hypervisor) Open() (*Connection, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if hv.stopped {
+		return nil, newError(libvirt.ErrSystem, libvirt.ErrDomRPC, "Failed to connect socket to fake hypervisor: Connection refused")
+	}
+
+	conn := &Connection{
+		hv:   hv,
+		refs: 1,
+	}
+	hv.conns = append(hv.conns, conn)
+
+	return conn, nil
+}
+
+// Stop simulates the daemon being stopped: every open connection is lost,
+// and its close callback (if any) is called with "reason". New connections
+// can't be opened until Start is called. The state of the hypervisor (e.g. its
+// domains) is preserved.
+func (hv *Hypervisor) Stop(reason libvirt.CloseReason) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	hv.stopped = true
+
+	for _, conn := range hv.conns {
+		conn.lost = true
+
+		if conn.onClose != nil {
+			go conn.onClose(reason)
+			conn.onClose = nil
+		}
+	}
+	hv.conns = nil
+}
+
+// Start allows new connections to be opened after Stop.
+func (hv *Hypervisor) Start() {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	hv.stopped = false
+}
+
+// newError creates an error equivalent to the ones reported by libvirt.
+func newError(code libvirt.ErrorCode, domain libvirt.ErrorDomain, format string, args ...interface{}) error {
+	return &libvirt.Error{
+		Code:    code,
+		Domain:  domain,
+		Message: fmt.Sprintf(format, args...),
+		Level:   libvirt.ErrLvlError,
+	}
+}
+
+// errNoSupport is returned by operations which aren't modeled by the fake.
+func errNoSupport(operation string) error {
+	return newError(libvirt.ErrNoSupport, libvirt.ErrDomTest, "this function is not supported by the connection driver: %v", operation)
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// lock locks the hypervisor state and checks whether the connection is still
+// open. The state is only locked when there is no error.
+func (conn *Connection) lock() error {
+	conn.hv.mu.Lock()
+
+	if conn.closed {
+		conn.hv.mu.Unlock()
+		return newError(libvirt.ErrInvalidConn, libvirt.ErrDomNone, "invalid connection pointer in fake connection")
+	}
+
+	if conn.lost {
+		conn.hv.mu.Unlock()
+		return newError(libvirt.ErrInternal, libvirt.ErrDomRPC, "internal error: client socket is closed")
+	}
+
+	return nil
+}
+
+// Close closes the connection. Every object created from it becomes unusable
+// once there are no references left.
+func (conn *Connection) Close() (int32, error) {
+	conn.hv.mu.Lock()
+	defer conn.hv.mu.Unlock()
+
+	// lost connections can still be closed
+	if conn.closed {
+		return 0, newError(libvirt.ErrInvalidConn, libvirt.ErrDomNone, "invalid connection pointer in fake connection")
+	}
+
+	conn.refs--
+	if conn.refs == 0 {
+		conn.closed = true
+		// as in the remote driver, the close callback isn't called when
+		// the client closes the connection
+		conn.onClose = nil
+
+		for i, c := range conn.hv.conns {
+			if c == conn {
+				conn.hv.conns = append(conn.hv.conns[:i], conn.hv.conns[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return conn.refs, nil
+}
+
+// SetKeepAlive fails with ErrNoSupport, because keepalive messages are only
+// supported by remote connections.
+func (conn *Connection) SetKeepAlive(interval time.Duration, count uint32) error {
+	if err := conn.lock(); err != nil {
+		return err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return errNoSupport("virConnectSetKeepAlive")
+}
+
+// RegisterCloseCallback registers a callback to be notified when the
+// connection is closed. As in libvirt, only one callback can be registered
+// and it's called from another goroutine.
+func (conn *Connection) RegisterCloseCallback(callback libvirt.CloseCallback) error {
+	if err := conn.lock(); err != nil {
+		return err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if conn.onClose != nil {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomNone, "A close callback is already registered")
+	}
+
+	conn.onClose = callback
+
+	return nil
+}
+
+// UnregisterCloseCallback removes the callback registered with
+// RegisterCloseCallback.
+func (conn *Connection) UnregisterCloseCallback() error {
+	if err := conn.lock(); err != nil {
+		return err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if conn.onClose == nil {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomNone, "A different callback was requested")
+	}
+
+	conn.onClose = nil
+
+	return nil
+}
+
+// Ref increments the reference count of the connection.
+func (conn *Connection) Ref() error {
+	if err := conn.lock(); err != nil {
+		return err
+	}
+	defer conn.hv.mu.Unlock()
+
+	conn.refs++
+
+	return nil
+}
+
+// Version returns FakeVersion.
+func (conn *Connection) Version() (uint64, error) {
+	if err := conn.lock(); err != nil {
+		return 0, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeVersion, nil
+}
+
+// LibVersion returns FakeLibVersion.
+func (conn *Connection) LibVersion() (uint64, error) {
+	if err := conn.lock(); err != nil {
+		return 0, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeLibVersion, nil
+}
+
+// IsAlive returns whether the connection is still open.
+func (conn *Connection) IsAlive() (bool, error) {
+	conn.hv.mu.Lock()
+	defer conn.hv.mu.Unlock()
+
+	return !conn.closed && !conn.lost, nil
+}
+
+// IsEncrypted returns false: a fake connection is local.
+func (conn *Connection) IsEncrypted() (bool, error) {
+	if err := conn.lock(); err != nil {
+		return false, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return false, nil
+}
+
+// IsSecure returns true: a fake connection is local.
+func (conn *Connection) IsSecure() (bool, error) {
+	if err := conn.lock(); err != nil {
+		return false, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return true, nil
+}
+
+// Capabilities returns a minimal capabilities XML for an x86_64 host.
+func (conn *Connection) Capabilities() (string, error) {
+	if err := conn.lock(); err != nil {
+		return "", err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return fakeCapabilities, nil
+}
+
+// Hostname returns FakeHostname.
+func (conn *Connection) Hostname() (string, error) {
+	if err := conn.lock(); err != nil {
+		return "", err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeHostname, nil
+}
+
+// Sysinfo is not supported by the fake.
+func (conn *Connection) Sysinfo() (string, error) {
+	return "", errNoSupport("Sysinfo")
+}
+
+// Type returns FakeType.
+func (conn *Connection) Type() (string, error) {
+	if err := conn.lock(); err != nil {
+		return "", err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeType, nil
+}
+
+// URI returns FakeURI.
+func (conn *Connection) URI() (string, error) {
+	if err := conn.lock(); err != nil {
+		return "", err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeURI, nil
+}
+
+// CPUModelNames returns a few CPU models for the "x86_64" architecture.
+func (conn *Connection) CPUModelNames(arch string) ([]string, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if arch != "x86_64" {
+		return nil, newError(libvirt.ErrInvalidArg, libvirt.ErrDomCPU, "cannot find CPU models for architecture %v", arch)
+	}
+
+	models := make([]string, len(fakeCPUModels))
+	copy(models, fakeCPUModels)
+
+	return models, nil
+}
+
+// MaxVCPUs returns FakeMaxVCPUs.
+func (conn *Connection) MaxVCPUs(typ string) (int32, error) {
+	if err := conn.lock(); err != nil {
+		return 0, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return FakeMaxVCPUs, nil
+}
+
+// FindStoragePoolSources is not supported by the fake.
+func (conn *Connection) FindStoragePoolSources(typ string, source string) (string, error) {
+	return "", errNoSupport("FindStoragePoolSources")
+}
+
+// NewStream creates a new stream, which can be used for transferring data to
+// and from storage volumes.
+func (conn *Connection) NewStream(flags libvirt.StreamFlag) (libvirt.StreamAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	return newStream(flags), nil
+}
+
+// filterGroup is a group of mutually exclusive list flags. An object passes
+// the group if none of its flags are set, or if the predicate of any set flag
+// is true.
+type filterGroup []struct {
+	set   bool
+	match bool
+}
+
+// matches checks every group against an object.
+func matches(groups ...filterGroup) bool {
+	for _, g := range groups {
+		selected, ok := false, false
+		for _, f := range g {
+			if f.set {
+				selected = true
+				ok = ok || f.match
+			}
+		}
+
+		if selected && !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Compile-time check that Connection implements the interface.
+var _ libvirt.ConnectionAPI = (*Connection)(nil)
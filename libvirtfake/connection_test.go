@@ -0,0 +1,170 @@
+package libvirtfake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// checkErrorCode fails the test if "err" isn't a libvirt error with "code".
+func checkErrorCode(t *testing.T, err error, code libvirt.ErrorCode) {
+	t.Helper()
+
+	virErr, ok := err.(*libvirt.Error)
+	if !ok {
+		t.Fatalf("unexpected error type; got=%T (%v), want=*libvirt.Error", err, err)
+	}
+
+	if virErr.Code != code {
+		t.Errorf("unexpected error code; got=%v, want=%v (%v)", virErr.Code, code, virErr)
+	}
+}
+
+func TestConnectionInfo(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	uri, err := conn.URI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri != FakeURI {
+		t.Errorf("wrong URI; got=%v, want=%v", uri, FakeURI)
+	}
+
+	alive, err := conn.IsAlive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !alive {
+		t.Error("fake connection should be alive")
+	}
+
+	models, err := conn.CPUModelNames("x86_64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) == 0 {
+		t.Error("no CPU models for x86_64")
+	}
+
+	if _, err := conn.Sysinfo(); err == nil {
+		t.Error("fake connection should not support Sysinfo")
+	} else {
+		checkErrorCode(t, err, libvirt.ErrNoSupport)
+	}
+}
+
+func TestConnectionClose(t *testing.T) {
+	conn := NewConnection()
+
+	if err := conn.Ref(); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refs != 1 {
+		t.Errorf("unexpected reference count; got=%v, want=1", refs)
+	}
+
+	if _, err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.ListDomains(libvirt.DomListAll)
+	checkErrorCode(t, err, libvirt.ErrInvalidConn)
+}
+
+func TestConnectionCloseCallback(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	if err := conn.SetKeepAlive(5*time.Second, 3); err == nil {
+		t.Error("fake connection should not support keepalive messages")
+	} else {
+		checkErrorCode(t, err, libvirt.ErrNoSupport)
+	}
+
+	if err := conn.UnregisterCloseCallback(); err == nil {
+		t.Error("unregistering a close callback which wasn't registered should fail")
+	}
+
+	callback := func(reason libvirt.CloseReason) {}
+	if err := conn.RegisterCloseCallback(callback); err != nil {
+		t.Fatal(err)
+	}
+
+	err := conn.RegisterCloseCallback(callback)
+	checkErrorCode(t, err, libvirt.ErrOperationInvalid)
+
+	if err := conn.UnregisterCloseCallback(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHypervisorRestart(t *testing.T) {
+	hv := NewHypervisor()
+
+	conn, err := hv.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = conn.DefineDomain(testDomainXML); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := make(chan libvirt.CloseReason, 1)
+	if err = conn.RegisterCloseCallback(func(reason libvirt.CloseReason) {
+		reasons <- reason
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	hv.Stop(libvirt.CloseReasonEOF)
+
+	select {
+	case reason := <-reasons:
+		if reason != libvirt.CloseReasonEOF {
+			t.Errorf("unexpected close reason; got=%v, want=%v", reason, libvirt.CloseReasonEOF)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the close callback was not called")
+	}
+
+	if alive, _ := conn.IsAlive(); alive {
+		t.Error("connection should not be alive after the hypervisor stopped")
+	}
+
+	_, err = conn.ListDomains(libvirt.DomListAll)
+	if !libvirt.IsConnectionLost(err) {
+		t.Errorf("unexpected error after the hypervisor stopped; got=%v", err)
+	}
+
+	if _, err = conn.Close(); err != nil {
+		t.Error(err)
+	}
+
+	_, err = hv.Open()
+	checkErrorCode(t, err, libvirt.ErrSystem)
+
+	hv.Start()
+
+	conn, err = hv.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.LookupDomainByName("fake-dom"); err != nil {
+		t.Errorf("domain should survive the hypervisor restart: %v", err)
+	}
+}
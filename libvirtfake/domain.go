@@ -0,0 +1,1292 @@
+package libvirtfake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// domainDef is the part of the domain XML understood by the fake.
+type domainDef struct {
+	Type          string       `xml:"type,attr"`
+	Name          string       `xml:"name"`
+	UUID          string       `xml:"uuid"`
+	Title         string       `xml:"title"`
+	Description   string       `xml:"description"`
+	Memory        *sizeElement `xml:"memory"`
+	CurrentMemory *sizeElement `xml:"currentMemory"`
+	VCPU          uint32       `xml:"vcpu"`
+	OS            struct {
+		Type string `xml:"type"`
+	} `xml:"os"`
+	Devices struct {
+		XML string `xml:",innerxml"`
+	} `xml:"devices"`
+}
+
+// domainRecord is the state of a fake domain.
+type domainRecord struct {
+	name        string
+	uuid        string
+	typ         string
+	title       string
+	description string
+	metadata    map[string]string
+	osType      string
+	maxMemory   uint64 // KiB
+	memory      uint64 // KiB
+	maxVCPUs    uint32
+	vcpus       uint32
+	devices     []string
+
+	id          uint32
+	state       libvirt.DomainState
+	reason      int32
+	persistent  bool
+	autostart   bool
+	updated     bool
+	managedSave bool
+
+	snapshots   []*snapshotRecord
+	current     *snapshotRecord
+	checkpoints []*checkpointRecord
+
+	backupXML     string
+	completedJob  *libvirt.DomainJobStats
+	jobInProgress bool
+	blockJobs     map[string]*libvirt.DomainBlockJobInfo // by disk
+
+	guest GuestBehavior
+}
+
+// GuestBehavior simulates a guest which doesn't react when it's asked to stop.
+// By default, a fake guest shuts down as soon as it's asked to.
+type GuestBehavior struct {
+	// IgnoreShutdown makes the shutdown requests succeed while the guest
+	// keeps running.
+	IgnoreShutdown bool
+	// IgnoreSIGTERM makes Destroy with DomDestroyGraceful fail, as if the
+	// hypervisor process didn't terminate with SIGTERM.
+	IgnoreSIGTERM bool
+}
+
+// SetGuestBehavior changes how the guest of the domain "name" reacts when it's
+// asked to stop. It fails with ErrNoDomain if there's no such domain.
+func (hv *Hypervisor) SetGuestBehavior(name string, behavior GuestBehavior) error {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	rec := hv.findDomain(func(r *domainRecord) bool { return r.name == name })
+	if rec == nil {
+		return newError(libvirt.ErrNoDomain, libvirt.ErrDomDomain, "Domain not found: no domain with matching name '%v'", name)
+	}
+
+	rec.guest = behavior
+	return nil
+}
+
+// parseDomain creates a domain record from its XML description.
+func parseDomain(doc string) (*domainRecord, error) {
+	var def domainDef
+	if err := parseXML(doc, &def, libvirt.ErrDomDomain); err != nil {
+		return nil, err
+	}
+
+	if def.Name == "" {
+		return nil, newError(libvirt.ErrNoName, libvirt.ErrDomDomain, "missing domain name information")
+	}
+
+	maxMemory, err := def.Memory.bytes("KiB")
+	if err != nil {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomDomain, "invalid memory: %v", err)
+	}
+	memory, err := def.CurrentMemory.bytes("KiB")
+	if err != nil {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomDomain, "invalid current memory: %v", err)
+	}
+	if def.CurrentMemory == nil {
+		memory = maxMemory
+	}
+
+	rec := &domainRecord{
+		name:        def.Name,
+		uuid:        strings.ToLower(def.UUID),
+		typ:         def.Type,
+		title:       def.Title,
+		description: def.Description,
+		metadata:    make(map[string]string),
+		osType:      def.OS.Type,
+		maxMemory:   maxMemory / 1024,
+		memory:      memory / 1024,
+		maxVCPUs:    def.VCPU,
+		vcpus:       def.VCPU,
+		state:       libvirt.DomStateShutoff,
+		reason:      int32(libvirt.DomShutoffReasonUnknown),
+	}
+
+	if rec.uuid == "" {
+		rec.uuid = newUUID()
+	}
+	if rec.typ == "" {
+		rec.typ = "test"
+	}
+	if rec.osType == "" {
+		rec.osType = "hvm"
+	}
+	if rec.vcpus == 0 {
+		rec.maxVCPUs, rec.vcpus = 1, 1
+	}
+
+	if devices := strings.TrimSpace(def.Devices.XML); devices != "" {
+		rec.devices = []string{devices}
+	}
+
+	return rec, nil
+}
+
+// xml renders the XML description of the domain.
+func (rec *domainRecord) xml() string {
+	var b strings.Builder
+
+	if rec.isActive() {
+		fmt.Fprintf(&b, "<domain type='%v' id='%v'>\n", escape(rec.typ), rec.id)
+	} else {
+		fmt.Fprintf(&b, "<domain type='%v'>\n", escape(rec.typ))
+	}
+	fmt.Fprintf(&b, "  <name>%v</name>\n", escape(rec.name))
+	fmt.Fprintf(&b, "  <uuid>%v</uuid>\n", rec.uuid)
+	if rec.title != "" {
+		fmt.Fprintf(&b, "  <title>%v</title>\n", escape(rec.title))
+	}
+	if rec.description != "" {
+		fmt.Fprintf(&b, "  <description>%v</description>\n", escape(rec.description))
+	}
+	fmt.Fprintf(&b, "  <memory unit='KiB'>%v</memory>\n", rec.maxMemory)
+	fmt.Fprintf(&b, "  <currentMemory unit='KiB'>%v</currentMemory>\n", rec.memory)
+	fmt.Fprintf(&b, "  <vcpu>%v</vcpu>\n", rec.vcpus)
+	fmt.Fprintf(&b, "  <os>\n    <type>%v</type>\n  </os>\n", escape(rec.osType))
+	b.WriteString("  <devices>\n")
+	for _, dev := range rec.devices {
+		fmt.Fprintf(&b, "    %v\n", dev)
+	}
+	b.WriteString("  </devices>\n")
+	b.WriteString("</domain>\n")
+
+	return b.String()
+}
+
+// isActive returns whether the domain is running.
+func (rec *domainRecord) isActive() bool {
+	return rec.state != libvirt.DomStateShutoff
+}
+
+// findDomain returns the domain which matches "pred". The hypervisor must be
+// locked.
+func (hv *Hypervisor) findDomain(pred func(*domainRecord) bool) *domainRecord {
+	for _, rec := range hv.domains {
+		if pred(rec) {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// removeDomain forgets about a domain. The hypervisor must be locked.
+func (hv *Hypervisor) removeDomain(rec *domainRecord) {
+	for i, r := range hv.domains {
+		if r == rec {
+			hv.domains = append(hv.domains[:i], hv.domains[i+1:]...)
+			return
+		}
+	}
+}
+
+// start starts a domain. The hypervisor must be locked.
+func (hv *Hypervisor) start(rec *domainRecord, paused bool, reason libvirt.DomainRunningReason) {
+	rec.id = hv.nextID
+	hv.nextID++
+
+	if paused {
+		rec.state = libvirt.DomStatePaused
+		rec.reason = int32(libvirt.DomPausedReasonUser)
+	} else {
+		rec.state = libvirt.DomStateRunning
+		rec.reason = int32(reason)
+	}
+}
+
+// stop stops a domain, removing it if it's transient. The hypervisor must be
+// locked.
+func (hv *Hypervisor) stop(rec *domainRecord, reason libvirt.DomainShutoffReason) {
+	rec.id = 0
+	rec.state = libvirt.DomStateShutoff
+	rec.reason = int32(reason)
+	rec.jobInProgress = false
+	rec.backupXML = ""
+	rec.blockJobs = nil
+
+	if !rec.persistent {
+		hv.removeDomain(rec)
+	}
+}
+
+// addDomain checks whether a new domain conflicts with an existing one and
+// adds it. The hypervisor must be locked.
+func (hv *Hypervisor) addDomain(rec *domainRecord) error {
+	if other := hv.findDomain(func(r *domainRecord) bool { return r.name == rec.name || r.uuid == rec.uuid }); other != nil {
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomDomain, "domain '%v' already exists with uuid %v", other.name, other.uuid)
+	}
+
+	hv.domains = append(hv.domains, rec)
+
+	return nil
+}
+
+// ListDomains returns the domains matching "flags".
+func (conn *Connection) ListDomains(flags libvirt.DomainListFlag) ([]libvirt.DomainAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	doms := make([]libvirt.DomainAPI, 0, len(conn.hv.domains))
+	for _, rec := range conn.hv.domains {
+		other := rec.state != libvirt.DomStateRunning && rec.state != libvirt.DomStatePaused && rec.state != libvirt.DomStateShutoff
+		ok := matches(
+			filterGroup{
+				{flags&libvirt.DomListActive != 0, rec.isActive()},
+				{flags&libvirt.DomListInactive != 0, !rec.isActive()},
+			},
+			filterGroup{
+				{flags&libvirt.DomListPersistent != 0, rec.persistent},
+				{flags&libvirt.DomListTransient != 0, !rec.persistent},
+			},
+			filterGroup{
+				{flags&libvirt.DomListRunning != 0, rec.state == libvirt.DomStateRunning},
+				{flags&libvirt.DomListPaused != 0, rec.state == libvirt.DomStatePaused},
+				{flags&libvirt.DomListShutOff != 0, rec.state == libvirt.DomStateShutoff},
+				{flags&libvirt.DomListOther != 0, other},
+			},
+			filterGroup{
+				{flags&libvirt.DomListManagedSave != 0, rec.managedSave},
+				{flags&libvirt.DomListNoManagedSave != 0, !rec.managedSave},
+			},
+			filterGroup{
+				{flags&libvirt.DomListAutostart != 0, rec.autostart},
+				{flags&libvirt.DomListNoAutostart != 0, !rec.autostart},
+			},
+			filterGroup{
+				{flags&libvirt.DomListHasSnapshot != 0, len(rec.snapshots) > 0},
+				{flags&libvirt.DomListNoSnapshot != 0, len(rec.snapshots) == 0},
+			},
+		)
+
+		if ok {
+			doms = append(doms, Domain{conn, rec.uuid})
+		}
+	}
+
+	return doms, nil
+}
+
+// CreateDomain launches a new transient domain.
+func (conn *Connection) CreateDomain(xml string, flags libvirt.DomainCreateFlag) (libvirt.DomainAPI, error) {
+	rec, err := parseDomain(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if err := conn.hv.addDomain(rec); err != nil {
+		return nil, err
+	}
+	conn.hv.start(rec, flags&libvirt.DomCreatePaused != 0, libvirt.DomRunningReasonBooted)
+
+	return Domain{conn, rec.uuid}, nil
+}
+
+// DefineDomain defines a new persistent domain, or updates the definition of
+// an existing one with the same name and UUID.
+func (conn *Connection) DefineDomain(xml string) (libvirt.DomainAPI, error) {
+	rec, err := parseDomain(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	existing := conn.hv.findDomain(func(r *domainRecord) bool { return r.name == rec.name })
+	if existing == nil {
+		rec.persistent = true
+		if err := conn.hv.addDomain(rec); err != nil {
+			return nil, err
+		}
+
+		return Domain{conn, rec.uuid}, nil
+	}
+
+	if rec.uuid != existing.uuid && strings.Contains(xml, "<uuid>") {
+		return nil, newError(libvirt.ErrOperationFailed, libvirt.ErrDomDomain, "domain '%v' is already defined with uuid %v", existing.name, existing.uuid)
+	}
+
+	// keep the runtime state and replace the definition
+	existing.typ = rec.typ
+	existing.title = rec.title
+	existing.description = rec.description
+	existing.osType = rec.osType
+	existing.maxMemory, existing.memory = rec.maxMemory, rec.memory
+	existing.maxVCPUs, existing.vcpus = rec.maxVCPUs, rec.vcpus
+	existing.devices = rec.devices
+	existing.persistent = true
+	existing.updated = existing.isActive()
+
+	return Domain{conn, existing.uuid}, nil
+}
+
+// lookupDomain returns the domain matching "pred" or a "not found" error
+// built from "format" and "args".
+func (conn *Connection) lookupDomain(pred func(*domainRecord) bool, format string, args ...interface{}) (libvirt.DomainAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	rec := conn.hv.findDomain(pred)
+	if rec == nil {
+		return nil, newError(libvirt.ErrNoDomain, libvirt.ErrDomDomain, "Domain not found: "+format, args...)
+	}
+
+	return Domain{conn, rec.uuid}, nil
+}
+
+// LookupDomainByID looks up a running domain by its ID.
+func (conn *Connection) LookupDomainByID(id uint32) (libvirt.DomainAPI, error) {
+	return conn.lookupDomain(func(r *domainRecord) bool {
+		return r.isActive() && r.id == id
+	}, "no domain with matching id %v", id)
+}
+
+// LookupDomainByName looks up a domain by its name.
+func (conn *Connection) LookupDomainByName(name string) (libvirt.DomainAPI, error) {
+	return conn.lookupDomain(func(r *domainRecord) bool {
+		return r.name == name
+	}, "no domain with matching name '%v'", name)
+}
+
+// LookupDomainByUUID looks up a domain by its UUID.
+func (conn *Connection) LookupDomainByUUID(uuid string) (libvirt.DomainAPI, error) {
+	uuid = strings.ToLower(uuid)
+
+	return conn.lookupDomain(func(r *domainRecord) bool {
+		return r.uuid == uuid
+	}, "no domain with matching uuid '%v'", uuid)
+}
+
+// RestoreDomain starts a domain saved with Domain.Save to "from". If "xml"
+// isn't empty, it replaces the saved definition.
+func (conn *Connection) RestoreDomain(from string, xml string, flags libvirt.DomainSaveFlag) error {
+	if err := conn.lock(); err != nil {
+		return err
+	}
+	defer conn.hv.mu.Unlock()
+
+	image, ok := conn.hv.images[from]
+	if !ok {
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomDomain, "cannot read domain image '%v'", from)
+	}
+
+	rec := conn.hv.findDomain(func(r *domainRecord) bool { return r.uuid == image.uuid })
+	if rec == nil {
+		restored := *image
+		rec = &restored
+		conn.hv.domains = append(conn.hv.domains, rec)
+	} else if rec.isActive() {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "domain '%v' is already active", rec.name)
+	}
+
+	if xml != "" {
+		def, err := parseDomain(xml)
+		if err != nil {
+			return err
+		}
+		rec.maxMemory, rec.memory = def.maxMemory, def.memory
+		rec.maxVCPUs, rec.vcpus = def.maxVCPUs, def.vcpus
+		rec.devices = def.devices
+	}
+
+	paused := image.state == libvirt.DomStatePaused
+	if flags&libvirt.DomSaveRunning != 0 {
+		paused = false
+	}
+	if flags&libvirt.DomSavePaused != 0 {
+		paused = true
+	}
+
+	conn.hv.start(rec, paused, libvirt.DomRunningReasonRestored)
+	delete(conn.hv.images, from)
+
+	return nil
+}
+
+// Domain is a fake libvirt domain. It implements libvirt.DomainAPI.
+type Domain struct {
+	conn *Connection
+	uuid string
+}
+
+// lock locks the hypervisor state and returns the record of the domain. The
+// state is only locked when there is no error.
+func (dom Domain) lock() (*domainRecord, error) {
+	if err := dom.conn.lock(); err != nil {
+		return nil, err
+	}
+
+	rec := dom.conn.hv.findDomain(func(r *domainRecord) bool { return r.uuid == dom.uuid })
+	if rec == nil {
+		dom.conn.hv.mu.Unlock()
+		return nil, newError(libvirt.ErrNoDomain, libvirt.ErrDomDomain, "Domain not found: no domain with matching uuid '%v'", dom.uuid)
+	}
+
+	return rec, nil
+}
+
+// unlock unlocks the hypervisor state.
+func (dom Domain) unlock() {
+	dom.conn.hv.mu.Unlock()
+}
+
+// withDomain runs "fn" with the domain record while the state is locked.
+func (dom Domain) withDomain(fn func(rec *domainRecord) error) error {
+	rec, err := dom.lock()
+	if err != nil {
+		return err
+	}
+	defer dom.unlock()
+
+	return fn(rec)
+}
+
+// errNotRunning is returned by operations which require an active domain.
+func errNotRunning() error {
+	return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "domain is not running")
+}
+
+// Free does nothing; it exists to implement the interface.
+func (dom Domain) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (dom Domain) Ref() error {
+	return nil
+}
+
+// Autostart returns whether the domain is started when the host boots.
+func (dom Domain) Autostart() (autostart bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		autostart = rec.autostart
+		return nil
+	})
+
+	return
+}
+
+// SetAutostart configures the domain to be started when the host boots.
+// Transient domains can't be autostarted.
+func (dom Domain) SetAutostart(autostart bool) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.persistent {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "cannot set autostart for transient domain")
+		}
+
+		rec.autostart = autostart
+		return nil
+	})
+}
+
+// HasCurrentSnapshot returns whether the domain has a current snapshot.
+func (dom Domain) HasCurrentSnapshot() (has bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		has = rec.current != nil
+		return nil
+	})
+
+	return
+}
+
+// HasManagedSaveImage returns whether the domain has a managed save image.
+func (dom Domain) HasManagedSaveImage() (has bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		has = rec.managedSave
+		return nil
+	})
+
+	return
+}
+
+// IsActive returns whether the domain is running.
+func (dom Domain) IsActive() (active bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		active = rec.isActive()
+		return nil
+	})
+
+	return
+}
+
+// IsPersistent returns whether the domain has a persistent configuration.
+func (dom Domain) IsPersistent() (persistent bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		persistent = rec.persistent
+		return nil
+	})
+
+	return
+}
+
+// IsUpdated returns whether the persistent configuration of a running domain
+// was changed.
+func (dom Domain) IsUpdated() (updated bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		updated = rec.updated
+		return nil
+	})
+
+	return
+}
+
+// OSType returns the OS type of the domain.
+func (dom Domain) OSType() (osType string, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		osType = rec.osType
+		return nil
+	})
+
+	return
+}
+
+// Name returns the name of the domain.
+func (dom Domain) Name() (name string, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		name = rec.name
+		return nil
+	})
+
+	return
+}
+
+// Hostname is not supported by the fake.
+func (dom Domain) Hostname() (string, error) {
+	return "", errNoSupport("Domain.Hostname")
+}
+
+// ID returns the ID of a running domain.
+func (dom Domain) ID() (id uint32, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return fmt.Errorf("domain doesn't have an ID")
+		}
+
+		id = rec.id
+		return nil
+	})
+
+	return
+}
+
+// UUID returns the UUID of the domain.
+func (dom Domain) UUID() (string, error) {
+	if _, err := dom.lock(); err != nil {
+		return "", err
+	}
+	defer dom.unlock()
+
+	return dom.uuid, nil
+}
+
+// XML returns the XML description of the domain, as understood by the fake.
+func (dom Domain) XML(typ libvirt.DomainXMLFlag) (doc string, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		doc = rec.xml()
+		return nil
+	})
+
+	return
+}
+
+// Metadata returns the title, the description or a custom metadata element of
+// the domain.
+func (dom Domain) Metadata(typ libvirt.DomainMetadataType, xmlns string, impact libvirt.DomainModificationImpact) (metadata string, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		switch typ {
+		case libvirt.DomMetaTitle:
+			metadata = rec.title
+		case libvirt.DomMetaDescription:
+			metadata = rec.description
+		case libvirt.DomMetaElement:
+			metadata = rec.metadata[xmlns]
+		default:
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "unknown metadata type %v", typ)
+		}
+
+		if metadata == "" {
+			return newError(libvirt.ErrNoDomainMetadata, libvirt.ErrDomDomain, "metadata not found: Requested metadata element is not present")
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// SetMetadata sets the title, the description or a custom metadata element of
+// the domain. An empty "metadata" removes it.
+func (dom Domain) SetMetadata(typ libvirt.DomainMetadataType, metadata string, key string, uri string, impact libvirt.DomainModificationImpact) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		switch typ {
+		case libvirt.DomMetaTitle:
+			rec.title = metadata
+		case libvirt.DomMetaDescription:
+			rec.description = metadata
+		case libvirt.DomMetaElement:
+			if uri == "" {
+				return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "metadata element requires a namespace URI")
+			}
+
+			if metadata == "" {
+				delete(rec.metadata, uri)
+			} else {
+				rec.metadata[uri] = metadata
+			}
+		default:
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "unknown metadata type %v", typ)
+		}
+
+		return nil
+	})
+}
+
+// Create starts a defined domain, restoring its managed save image if there is
+// one.
+func (dom Domain) Create(flags libvirt.DomainCreateFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if rec.isActive() {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "domain is already running")
+		}
+
+		reason := libvirt.DomRunningReasonBooted
+		if rec.managedSave && flags&libvirt.DomCreateForceBoot == 0 {
+			reason = libvirt.DomRunningReasonRestored
+		}
+		rec.managedSave = false
+
+		dom.conn.hv.start(rec, flags&libvirt.DomCreatePaused != 0, reason)
+		return nil
+	})
+}
+
+// Destroy stops a running domain immediately. Transient domains disappear.
+// With DomDestroyGraceful, it fails with ErrSystem if the guest ignores
+// SIGTERM (see GuestBehavior).
+func (dom Domain) Destroy(flags libvirt.DomainDestroyFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if flags&libvirt.DomDestroyGraceful != 0 && rec.guest.IgnoreSIGTERM {
+			return newError(libvirt.ErrSystem, libvirt.ErrDomDomain, "Failed to terminate process %v with SIGTERM", rec.id)
+		}
+
+		dom.conn.hv.stop(rec, libvirt.DomShutoffReasonDestroyed)
+		return nil
+	})
+}
+
+// Shutdown stops a running domain. The fake guest shuts down immediately,
+// unless it ignores the shutdown requests (see GuestBehavior).
+func (dom Domain) Shutdown() error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if !rec.guest.IgnoreShutdown {
+			dom.conn.hv.stop(rec, libvirt.DomShutoffReasonShutdown)
+		}
+
+		return nil
+	})
+}
+
+// ShutdownFlags stops a running domain, like Shutdown; the flags are ignored.
+func (dom Domain) ShutdownFlags(flags libvirt.DomainShutdownFlag) error {
+	return dom.Shutdown()
+}
+
+// ShutdownAndWait stops a running domain following "policy", as
+// libvirt.ShutdownAndWait: the shutdown requests are retried while the guest
+// ignores them (see GuestBehavior), and then the domain is destroyed
+// gracefully and forcefully, if the policy allows it.
+func (dom Domain) ShutdownAndWait(ctx context.Context, policy libvirt.DomainShutdownPolicy) (libvirt.DomainShutdownResult, error) {
+	return libvirt.ShutdownAndWait(ctx, dom, policy)
+}
+
+// Undefine removes the persistent configuration of the domain. Running
+// domains become transient.
+func (dom Domain) Undefine(flags libvirt.DomainUndefineFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.persistent {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "cannot undefine transient domain")
+		}
+
+		if rec.managedSave && flags&libvirt.DomUndefineManagedSave == 0 {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "Refusing to undefine while domain managed save image exists")
+		}
+
+		if len(rec.snapshots) > 0 && flags&libvirt.DomUndefineSnapshotsMetadata == 0 {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "cannot delete inactive domain with %v snapshots", len(rec.snapshots))
+		}
+
+		rec.managedSave = false
+		rec.snapshots = nil
+		rec.current = nil
+		rec.persistent = false
+		rec.autostart = false
+		if !rec.isActive() {
+			dom.conn.hv.removeDomain(rec)
+		}
+
+		return nil
+	})
+}
+
+// Reboot reboots a running domain. The fake guest keeps running.
+func (dom Domain) Reboot(flags libvirt.DomainRebootFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		return nil
+	})
+}
+
+// Reset resets a running domain. The fake guest keeps running.
+func (dom Domain) Reset() error {
+	return dom.Reboot(libvirt.DomRebootDefault)
+}
+
+// State returns the state of the domain and the reason which led to it.
+func (dom Domain) State() (state libvirt.DomainState, reason int32, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		state, reason = rec.state, rec.reason
+		return nil
+	})
+
+	return
+}
+
+// StateWithReason returns the state of the domain with its typed reason.
+func (dom Domain) StateWithReason() (libvirt.DomainStateInfo, error) {
+	state, reason, err := dom.State()
+	if err != nil {
+		return libvirt.DomainStateInfo{}, err
+	}
+
+	return libvirt.NewDomainStateInfo(state, reason), nil
+}
+
+// ControlInfo reports that the control interface of a running domain is
+// always available.
+func (dom Domain) ControlInfo() (info libvirt.DomainControlInfo, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		info.State = libvirt.DomControlOK
+		return nil
+	})
+
+	return
+}
+
+// WaitForState polls the domain state until it's one of "desired" or the
+// context is done. The fake doesn't send lifecycle events.
+func (dom Domain) WaitForState(ctx context.Context, desired ...libvirt.DomainState) (libvirt.DomainState, int32, error) {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		state, reason, err := dom.State()
+		if err != nil {
+			return state, reason, err
+		}
+
+		for _, d := range desired {
+			if state == d {
+				return state, reason, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return state, reason, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Suspend pauses a running domain.
+func (dom Domain) Suspend() error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		rec.state = libvirt.DomStatePaused
+		rec.reason = int32(libvirt.DomPausedReasonUser)
+		return nil
+	})
+}
+
+// Resume resumes a paused domain.
+func (dom Domain) Resume() error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if rec.state != libvirt.DomStatePaused {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "domain is not paused")
+		}
+
+		rec.state = libvirt.DomStateRunning
+		rec.reason = int32(libvirt.DomRunningReasonUnpaused)
+		return nil
+	})
+}
+
+// CoreDump checks that the domain is running; no file is written.
+func (dom Domain) CoreDump(file string, format libvirt.DomainDumpFormat, flags libvirt.DomainDumpFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if flags&libvirt.DomDumpCrash != 0 {
+			dom.conn.hv.stop(rec, libvirt.DomShutoffReasonCrashed)
+		}
+
+		return nil
+	})
+}
+
+// CoreDumpContext is like CoreDump; the fake dump finishes immediately, so the
+// context is only checked before it starts.
+func (dom Domain) CoreDumpContext(ctx context.Context, file string, format libvirt.DomainDumpFormat, flags libvirt.DomainDumpFlag) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return dom.CoreDump(file, format, flags)
+}
+
+// MaxMemory returns the maximum memory of the domain, in KiB.
+func (dom Domain) MaxMemory() (memory uint64, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		memory = rec.maxMemory
+		return nil
+	})
+
+	return
+}
+
+// VCPUs returns the current (or maximum, with DomVCPUsMaximum) number of
+// virtual CPUs.
+func (dom Domain) VCPUs(flags libvirt.DomainVCPUsFlag) (vcpus int32, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if flags&libvirt.DomVCPUsMaximum != 0 {
+			vcpus = int32(rec.maxVCPUs)
+		} else {
+			vcpus = int32(rec.vcpus)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// InfoState returns the state of the domain.
+func (dom Domain) InfoState() (libvirt.DomainState, error) {
+	state, _, err := dom.State()
+	return state, err
+}
+
+// InfoMaxMemory returns the maximum memory of the domain, in KiB.
+func (dom Domain) InfoMaxMemory() (uint64, error) {
+	return dom.MaxMemory()
+}
+
+// InfoMemory returns the current memory of the domain, in KiB.
+func (dom Domain) InfoMemory() (memory uint64, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		memory = rec.memory
+		return nil
+	})
+
+	return
+}
+
+// InfoVCPUs returns the number of virtual CPUs of the domain.
+func (dom Domain) InfoVCPUs() (uint16, error) {
+	vcpus, err := dom.VCPUs(libvirt.DomVCPUsCurrent)
+	return uint16(vcpus), err
+}
+
+// InfoCPUTime always returns zero: fake guests don't use any CPU.
+func (dom Domain) InfoCPUTime() (uint64, error) {
+	_, _, err := dom.State()
+	return 0, err
+}
+
+// Save stops a running domain and keeps its state under the name "to", so it
+// can be restored with Connection.RestoreDomain. No file is written.
+func (dom Domain) Save(to string, xml string, flags libvirt.DomainSaveFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		image := *rec
+		image.persistent = false
+		image.blockJobs = nil
+		dom.conn.hv.images[to] = &image
+		dom.conn.hv.stop(rec, libvirt.DomShutoffReasonSaved)
+
+		return nil
+	})
+}
+
+// SaveContext is like Save; the fake save finishes immediately, so the context
+// is only checked before it starts.
+func (dom Domain) SaveContext(ctx context.Context, to string, xml string, flags libvirt.DomainSaveFlag) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return dom.Save(to, xml, flags)
+}
+
+// ManagedSave stops a running domain and keeps its state, which is restored
+// by the next Create.
+func (dom Domain) ManagedSave(flags libvirt.DomainSaveFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if !rec.persistent {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "cannot do managed save for transient domain")
+		}
+
+		rec.managedSave = true
+		dom.conn.hv.stop(rec, libvirt.DomShutoffReasonSaved)
+		return nil
+	})
+}
+
+// ManagedSaveContext is like ManagedSave; the fake save finishes immediately,
+// so the context is only checked before it starts.
+func (dom Domain) ManagedSaveContext(ctx context.Context, flags libvirt.DomainSaveFlag) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return dom.ManagedSave(flags)
+}
+
+// ManagedSaveRemove removes the managed save image of the domain.
+func (dom Domain) ManagedSaveRemove() error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		rec.managedSave = false
+		return nil
+	})
+}
+
+// AttachDevice adds a device, described by its XML, to the domain.
+func (dom Domain) AttachDevice(deviceXML string, flags libvirt.DomainDeviceModifyFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		rec.devices = append(rec.devices, strings.TrimSpace(deviceXML))
+		return nil
+	})
+}
+
+// DetachDevice removes a device from the domain. The device XML must be the
+// same used to attach it.
+func (dom Domain) DetachDevice(deviceXML string, flags libvirt.DomainDeviceModifyFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		deviceXML = strings.TrimSpace(deviceXML)
+		for i, dev := range rec.devices {
+			if dev == deviceXML {
+				rec.devices = append(rec.devices[:i], rec.devices[i+1:]...)
+				return nil
+			}
+		}
+
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomDomain, "device not found")
+	})
+}
+
+// UpdateDevice checks that a device with the same XML is attached to the
+// domain; the fake doesn't model device properties.
+func (dom Domain) UpdateDevice(deviceXML string, flags libvirt.DomainDeviceModifyFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		deviceXML = strings.TrimSpace(deviceXML)
+		for _, dev := range rec.devices {
+			if dev == deviceXML {
+				return nil
+			}
+		}
+
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomDomain, "device not found")
+	})
+}
+
+// SetMemory changes the current (or maximum, with DomMemoryMaximum) memory of
+// the domain, in KiB.
+func (dom Domain) SetMemory(memory uint64, flags libvirt.DomainMemoryModifyFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if flags&libvirt.DomMemoryMaximum != 0 {
+			rec.maxMemory = memory
+			if rec.memory > memory {
+				rec.memory = memory
+			}
+
+			return nil
+		}
+
+		if memory > rec.maxMemory {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "cannot set memory higher than max memory")
+		}
+
+		rec.memory = memory
+		return nil
+	})
+}
+
+// SetVCPUs changes the current (or maximum, with DomVCPUsMaximum) number of
+// virtual CPUs.
+func (dom Domain) SetVCPUs(vcpus uint32, flags libvirt.DomainVCPUsFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if vcpus == 0 {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "argument unsupported: vcpus must be positive")
+		}
+
+		if flags&libvirt.DomVCPUsMaximum != 0 {
+			rec.maxVCPUs = vcpus
+			if rec.vcpus > vcpus {
+				rec.vcpus = vcpus
+			}
+
+			return nil
+		}
+
+		if vcpus > rec.maxVCPUs {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "requested vcpus is greater than max allowable vcpus for the domain: %v > %v", vcpus, rec.maxVCPUs)
+		}
+
+		rec.vcpus = vcpus
+		return nil
+	})
+}
+
+// SendKey checks that the domain is running; the keys go nowhere.
+func (dom Domain) SendKey(codeSet libvirt.DomainKeycodeSet, hold time.Duration, keycodes []uint32) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		return nil
+	})
+}
+
+// SendProcessSignal checks that the domain is running; the signal goes
+// nowhere.
+func (dom Domain) SendProcessSignal(pid int64, signal libvirt.DomainProcessSignal) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		return nil
+	})
+}
+
+// BackupBegin starts a backup job, which the fake completes immediately.
+func (dom Domain) BackupBegin(backupXML string, checkpointXML string, flags libvirt.DomainBackupBeginFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if rec.jobInProgress {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "another job is already active on the domain")
+		}
+
+		if checkpointXML != "" {
+			if _, err := dom.createCheckpoint(rec, checkpointXML, 0); err != nil {
+				return err
+			}
+		}
+
+		rec.completedJob = &libvirt.DomainJobStats{
+			Type:      libvirt.DomJobCompleted,
+			Operation: libvirt.DomJobOperationBackup,
+			Success:   true,
+		}
+
+		return nil
+	})
+}
+
+// BackupXML returns the description of the backup job in progress. As the
+// fake completes backups immediately, there's never one.
+func (dom Domain) BackupXML() (string, error) {
+	err := dom.withDomain(func(rec *domainRecord) error {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "no domain backup job present")
+	})
+
+	return "", err
+}
+
+// JobStats returns the statistics of the current job (there's never one) or,
+// with DomJobStatsCompleted, of the last completed job.
+func (dom Domain) JobStats(flags libvirt.DomainJobStatsFlag) (stats libvirt.DomainJobStats, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if flags&libvirt.DomJobStatsCompleted != 0 {
+			if rec.completedJob != nil {
+				stats = *rec.completedJob
+			}
+
+			if flags&libvirt.DomJobStatsKeepCompleted == 0 {
+				rec.completedJob = nil
+			}
+
+			return nil
+		}
+
+		stats = libvirt.DomainJobStats{Type: libvirt.DomJobNone}
+		return nil
+	})
+
+	return
+}
+
+// AbortJob fails, as there's never a job in progress.
+func (dom Domain) AbortJob() error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "no job is active on the domain")
+	})
+}
+
+// WaitForJob waits for the job of the domain, as libvirt.WaitForJob. Fake jobs
+// complete immediately, so only the statistics of the completed job are read.
+func (dom Domain) WaitForJob(ctx context.Context, interval time.Duration, progress func(libvirt.DomainJobStats)) (libvirt.DomainJobStats, error) {
+	return libvirt.WaitForJob(ctx, dom, interval, progress)
+}
+
+// BlockCommit starts a commit job on "disk"; the fake doesn't know the disks
+// of the domain, so any name is accepted. A commit of the active image (with
+// DomBlockCommitActive) is ready immediately and lasts until it's aborted or
+// pivoted, while other commits complete immediately.
+func (dom Domain) BlockCommit(disk string, base string, top string, bandwidth uint64, flags libvirt.DomainBlockCommitFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if _, ok := rec.blockJobs[disk]; ok {
+			return newError(libvirt.ErrBlockCopyActive, libvirt.ErrDomDomain, "disk '%v' already in active block job", disk)
+		}
+
+		active := flags&libvirt.DomBlockCommitActive != 0
+		if top == "" && !active {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomDomain, "commit of '%v' active layer requires active flag", disk)
+		}
+
+		if !active {
+			return nil
+		}
+
+		if rec.blockJobs == nil {
+			rec.blockJobs = make(map[string]*libvirt.DomainBlockJobInfo)
+		}
+
+		rec.blockJobs[disk] = &libvirt.DomainBlockJobInfo{
+			Type:      libvirt.DomBlockJobActiveCommit,
+			Bandwidth: bandwidth,
+			Cur:       1,
+			End:       1,
+		}
+
+		return nil
+	})
+}
+
+// BlockJobInfo returns the progress of the block job running on "disk".
+func (dom Domain) BlockJobInfo(disk string, flags libvirt.DomainBlockJobInfoFlag) (info libvirt.DomainBlockJobInfo, ok bool, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		if job, found := rec.blockJobs[disk]; found {
+			info, ok = *job, true
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// BlockJobAbort cancels or, with DomBlockJobAbortPivot, completes the block
+// job running on "disk".
+func (dom Domain) BlockJobAbort(disk string, flags libvirt.DomainBlockJobAbortFlag) error {
+	return dom.withDomain(func(rec *domainRecord) error {
+		if !rec.isActive() {
+			return errNotRunning()
+		}
+
+		job, ok := rec.blockJobs[disk]
+		if !ok {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomain, "disk '%v' does not have an active block job", disk)
+		}
+
+		if flags&libvirt.DomBlockJobAbortPivot != 0 && !job.Ready() {
+			return newError(libvirt.ErrBlockCopyActive, libvirt.ErrDomDomain, "disk '%v' not ready for pivot yet", disk)
+		}
+
+		delete(rec.blockJobs, disk)
+
+		return nil
+	})
+}
+
+// Compile-time check that Domain implements the interface.
+var _ libvirt.DomainAPI = Domain{}
@@ -0,0 +1,502 @@
+package libvirtfake
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+const testDomainXML = `<domain type='test'>
+  <name>fake-dom</name>
+  <memory unit='MiB'>512</memory>
+  <vcpu>2</vcpu>
+  <os>
+    <type>hvm</type>
+  </os>
+</domain>`
+
+// defineTestDomain defines the test domain on a new fake connection.
+func defineTestDomain(t *testing.T) (*Connection, libvirt.DomainAPI) {
+	t.Helper()
+
+	conn := NewConnection()
+
+	dom, err := conn.DefineDomain(testDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, dom
+}
+
+// checkState fails the test if the domain isn't in "state" because of
+// "reason".
+func checkState(t *testing.T, dom libvirt.DomainAPI, state libvirt.DomainState, reason int32) {
+	t.Helper()
+
+	gotState, gotReason, err := dom.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotState != state || gotReason != reason {
+		t.Errorf("unexpected domain state; got=%v/%v, want=%v/%v", gotState, gotReason, state, reason)
+	}
+}
+
+func TestDomainDefine(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	if _, err := conn.DefineDomain("<domain>"); err == nil {
+		t.Error("invalid XML should not be accepted")
+	} else {
+		checkErrorCode(t, err, libvirt.ErrXMLDetail)
+	}
+
+	memory, err := dom.MaxMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if memory != 512*1024 {
+		t.Errorf("wrong max memory; got=%v, want=%v", memory, 512*1024)
+	}
+
+	uuid, err := dom.UUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byUUID, err := conn.LookupDomainByUUID(strings.ToUpper(uuid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := byUUID.Name(); name != "fake-dom" {
+		t.Errorf("wrong domain found by UUID; got=%v, want=fake-dom", name)
+	}
+
+	_, err = conn.LookupDomainByName("missing")
+	checkErrorCode(t, err, libvirt.ErrNoDomain)
+
+	_, err = dom.ID()
+	if err == nil {
+		t.Error("inactive domain should not have an ID")
+	}
+
+	xml, err := dom.XML(libvirt.DomXMLDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(xml, "<uuid>"+uuid+"</uuid>") {
+		t.Errorf("domain XML doesn't contain the UUID: %v", xml)
+	}
+}
+
+func TestDomainLifecycle(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	checkErrorCode(t, dom.Shutdown(), libvirt.ErrOperationInvalid)
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateRunning, int32(libvirt.DomRunningReasonBooted))
+
+	checkErrorCode(t, dom.Create(libvirt.DomCreateDefault), libvirt.ErrOperationInvalid)
+	checkErrorCode(t, dom.Resume(), libvirt.ErrOperationInvalid)
+
+	id, err := dom.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID, err := conn.LookupDomainByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := byID.Name(); name != "fake-dom" {
+		t.Errorf("wrong domain found by ID; got=%v, want=fake-dom", name)
+	}
+
+	if err := dom.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStatePaused, int32(libvirt.DomPausedReasonUser))
+
+	if err := dom.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateRunning, int32(libvirt.DomRunningReasonUnpaused))
+
+	if err := dom.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateShutoff, int32(libvirt.DomShutoffReasonShutdown))
+
+	if err := dom.Undefine(libvirt.DomUndefineDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = dom.State()
+	checkErrorCode(t, err, libvirt.ErrNoDomain)
+}
+
+func TestDomainStateWithReason(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	_, err := dom.ControlInfo()
+	checkErrorCode(t, err, libvirt.ErrOperationInvalid)
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := dom.StateWithReason()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.State != libvirt.DomStateRunning || info.Reason != libvirt.DomRunningReasonBooted {
+		t.Errorf("unexpected domain state; got=%v, want=running (booted)", info)
+	}
+
+	control, err := dom.ControlInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if control.State != libvirt.DomControlOK {
+		t.Errorf("unexpected control state; got=%v, want=%v", control.State, libvirt.DomControlOK)
+	}
+}
+
+func TestDomainWaitForState(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		dom.Create(libvirt.DomCreateDefault)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, reason, err := dom.WaitForState(ctx, libvirt.DomStateRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != libvirt.DomStateRunning || libvirt.DomainRunningReason(reason) != libvirt.DomRunningReasonBooted {
+		t.Errorf("unexpected domain state; got=%v/%v, want=%v/%v", state, reason, libvirt.DomStateRunning, libvirt.DomRunningReasonBooted)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, _, err = dom.WaitForState(ctx, libvirt.DomStatePaused); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error when waiting for an unreached state; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDomainShutdownAndWait(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	ctx := context.Background()
+	policy := libvirt.DomainShutdownPolicy{
+		Timeout:         10 * time.Millisecond,
+		Retries:         1,
+		DestroyGraceful: true,
+		DestroyForce:    true,
+	}
+
+	// the guest shuts down after the first request
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := dom.ShutdownAndWait(ctx, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Step != libvirt.DomShutdownStepRequest || result.Requests != 1 {
+		t.Errorf("unexpected shutdown result; got=%v/%v, want=%v/1", result.Step, result.Requests, libvirt.DomShutdownStepRequest)
+	}
+
+	// the guest ignores the requests and SIGTERM, so it's destroyed forcefully
+	if err = conn.hv.SetGuestBehavior("fake-dom", GuestBehavior{IgnoreShutdown: true, IgnoreSIGTERM: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err = dom.ShutdownAndWait(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Step != libvirt.DomShutdownStepDestroy || result.Requests != 2 {
+		t.Errorf("unexpected shutdown result; got=%v/%v, want=%v/2", result.Step, result.Requests, libvirt.DomShutdownStepDestroy)
+	}
+
+	if result.Duration < 2*policy.Timeout {
+		t.Errorf("the shutdown requests should wait for the timeout; duration=%v", result.Duration)
+	}
+
+	checkState(t, dom, libvirt.DomStateShutoff, int32(libvirt.DomShutoffReasonDestroyed))
+
+	// without a forced destroy, the error of the graceful one is returned
+	if err = dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	policy.DestroyForce = false
+	result, err = dom.ShutdownAndWait(ctx, policy)
+	checkErrorCode(t, err, libvirt.ErrSystem)
+
+	if result.Step != libvirt.DomShutdownStepDestroyGraceful {
+		t.Errorf("unexpected shutdown step; got=%v, want=%v", result.Step, libvirt.DomShutdownStepDestroyGraceful)
+	}
+
+	// the guest ignores only the requests
+	if err = conn.hv.SetGuestBehavior("fake-dom", GuestBehavior{IgnoreShutdown: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	policy.DestroyGraceful = false
+	if _, err = dom.ShutdownAndWait(ctx, policy); err != libvirt.ErrShutdownTimeout {
+		t.Errorf("unexpected error when no step stops the domain; got=%v, want=%v", err, libvirt.ErrShutdownTimeout)
+	}
+
+	policy.DestroyGraceful = true
+	if result, err = dom.ShutdownAndWait(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Step != libvirt.DomShutdownStepDestroyGraceful {
+		t.Errorf("unexpected shutdown step; got=%v, want=%v", result.Step, libvirt.DomShutdownStepDestroyGraceful)
+	}
+
+	checkErrorCode(t, conn.hv.SetGuestBehavior("missing", GuestBehavior{}), libvirt.ErrNoDomain)
+}
+
+func TestDomainTransient(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	dom, err := conn.CreateDomain(testDomainXML, libvirt.DomCreatePaused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStatePaused, int32(libvirt.DomPausedReasonUser))
+
+	if _, err := conn.CreateDomain(testDomainXML, libvirt.DomCreateDefault); err == nil {
+		t.Error("duplicate domain should not be created")
+	}
+
+	checkErrorCode(t, dom.SetAutostart(true), libvirt.ErrOperationInvalid)
+	checkErrorCode(t, dom.ManagedSave(libvirt.DomSaveDefault), libvirt.ErrOperationInvalid)
+
+	if err := dom.Destroy(libvirt.DomDestroyDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	doms, err := conn.ListDomains(libvirt.DomListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doms) != 0 {
+		t.Errorf("transient domain should disappear when stopped; got %v domains", len(doms))
+	}
+}
+
+func TestDomainUndefineActive(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.Undefine(libvirt.DomUndefineDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	persistent, err := dom.IsPersistent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if persistent {
+		t.Error("undefined running domain should become transient")
+	}
+
+	if err := dom.Destroy(libvirt.DomDestroyDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dom.IsActive(); err == nil {
+		t.Error("domain should be gone after stopping")
+	}
+}
+
+func TestDomainList(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	if _, err := conn.CreateDomain(strings.Replace(testDomainXML, "fake-dom", "other-dom", 1), libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.SetAutostart(true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flags libvirt.DomainListFlag
+		want  int
+	}{
+		{libvirt.DomListAll, 2},
+		{libvirt.DomListActive, 1},
+		{libvirt.DomListInactive, 1},
+		{libvirt.DomListActive | libvirt.DomListInactive, 2},
+		{libvirt.DomListPersistent, 1},
+		{libvirt.DomListTransient | libvirt.DomListRunning, 1},
+		{libvirt.DomListTransient | libvirt.DomListShutOff, 0},
+		{libvirt.DomListAutostart, 1},
+		{libvirt.DomListNoSnapshot, 2},
+	}
+
+	for _, tt := range tests {
+		doms, err := conn.ListDomains(tt.flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(doms) != tt.want {
+			t.Errorf("unexpected number of domains with flags %v; got=%v, want=%v", tt.flags, len(doms), tt.want)
+		}
+	}
+}
+
+func TestDomainSaveRestore(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.Save("/tmp/fake-dom.save", "", libvirt.DomSaveDefault); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateShutoff, int32(libvirt.DomShutoffReasonSaved))
+
+	if err := conn.RestoreDomain("/tmp/fake-dom.save", "", libvirt.DomSavePaused); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStatePaused, int32(libvirt.DomPausedReasonUser))
+
+	if err := conn.RestoreDomain("/tmp/fake-dom.save", "", libvirt.DomSaveDefault); err == nil {
+		t.Error("a save image should only be restored once")
+	}
+
+	if err := dom.ManagedSave(libvirt.DomSaveDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	has, err := dom.HasManagedSaveImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !has {
+		t.Error("domain should have a managed save image")
+	}
+
+	checkErrorCode(t, dom.Undefine(libvirt.DomUndefineDefault), libvirt.ErrOperationInvalid)
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateRunning, int32(libvirt.DomRunningReasonRestored))
+}
+
+func TestDomainResources(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	checkErrorCode(t, dom.SetVCPUs(3, libvirt.DomVCPUsCurrent), libvirt.ErrInvalidArg)
+
+	if err := dom.SetVCPUs(4, libvirt.DomVCPUsMaximum); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.SetVCPUs(3, libvirt.DomVCPUsCurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	vcpus, err := dom.InfoVCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vcpus != 3 {
+		t.Errorf("wrong number of VCPUs; got=%v, want=3", vcpus)
+	}
+
+	if err := dom.SetMemory(256*1024, libvirt.DomMemoryMaximum); err != nil {
+		t.Fatal(err)
+	}
+
+	memory, err := dom.InfoMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if memory != 256*1024 {
+		t.Errorf("current memory should be capped by max memory; got=%v, want=%v", memory, 256*1024)
+	}
+
+	_, err = dom.Metadata(libvirt.DomMetaTitle, "", libvirt.DomAffectCurrent)
+	checkErrorCode(t, err, libvirt.ErrNoDomainMetadata)
+
+	if err := dom.SetMetadata(libvirt.DomMetaTitle, "a title", "", "", libvirt.DomAffectCurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	title, err := dom.Metadata(libvirt.DomMetaTitle, "", libvirt.DomAffectCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if title != "a title" {
+		t.Errorf("wrong title; got=%q, want=%q", title, "a title")
+	}
+
+	const disk = "<disk type='file' device='disk'/>"
+	if err := dom.AttachDevice(disk, libvirt.DomDeviceModifyConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.DetachDevice(disk, libvirt.DomDeviceModifyConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dom.DetachDevice(disk, libvirt.DomDeviceModifyConfig); err == nil {
+		t.Error("detached device should not be found again")
+	}
+}
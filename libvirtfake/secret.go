@@ -0,0 +1,353 @@
+package libvirtfake
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// secretRecord is the state of a fake secret.
+type secretRecord struct {
+	uuid        string
+	description string
+	ephemeral   bool
+	private     bool
+	usageType   libvirt.SecretUsageType
+	usageID     string
+	value       []byte
+}
+
+// secretUsages maps the usage types to their names in the XML and the element
+// which holds the usage ID.
+var secretUsages = map[libvirt.SecretUsageType]struct{ name, element string }{
+	libvirt.SecUsageTypeVolume: {"volume", "volume"},
+	libvirt.SecUsageTypeCeph:   {"ceph", "name"},
+	libvirt.SecUsageTypeISCSI:  {"iscsi", "target"},
+	libvirt.SecUsageTypeTLS:    {"tls", "name"},
+	libvirt.SecUsageTypeVTPM:   {"vtpm", "name"},
+}
+
+// parseSecret creates a secret record from its XML description.
+func parseSecret(doc string) (*secretRecord, error) {
+	var def libvirt.SecretDef
+	if err := parseXML(doc, &def, libvirt.ErrDomSecret); err != nil {
+		return nil, err
+	}
+
+	rec := &secretRecord{
+		uuid:        strings.ToLower(def.UUID),
+		description: def.Description,
+		ephemeral:   def.Ephemeral,
+		private:     def.Private,
+		usageType:   libvirt.SecUsageTypeNone,
+	}
+
+	if rec.uuid == "" {
+		rec.uuid = newUUID()
+	}
+
+	if def.Usage != nil {
+		if _, ok := secretUsages[def.Usage.Type]; !ok {
+			return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomSecret, "unknown secret usage type %v", def.Usage.Type)
+		}
+
+		rec.usageType, rec.usageID = def.Usage.Type, def.Usage.ID()
+
+		if rec.usageID == "" {
+			return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomSecret, "%v usage specified, but no usage ID", def.Usage.Type)
+		}
+	}
+
+	return rec, nil
+}
+
+// xml renders the XML description of the secret.
+func (rec *secretRecord) xml() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<secret ephemeral='%v' private='%v'>\n", yesNo(rec.ephemeral), yesNo(rec.private))
+	fmt.Fprintf(&b, "  <uuid>%v</uuid>\n", rec.uuid)
+	if rec.description != "" {
+		fmt.Fprintf(&b, "  <description>%v</description>\n", escape(rec.description))
+	}
+	if usage, ok := secretUsages[rec.usageType]; ok {
+		fmt.Fprintf(&b, "  <usage type='%v'>\n", usage.name)
+		fmt.Fprintf(&b, "    <%v>%v</%v>\n", usage.element, escape(rec.usageID), usage.element)
+		b.WriteString("  </usage>\n")
+	}
+	b.WriteString("</secret>\n")
+
+	return b.String()
+}
+
+// yesNo formats a boolean like libvirt XML attributes.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// findSecret returns the secret which matches "pred". The hypervisor must be
+// locked.
+func (hv *Hypervisor) findSecret(pred func(*secretRecord) bool) *secretRecord {
+	for _, rec := range hv.secrets {
+		if pred(rec) {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// ListSecrets returns the secrets matching "flags".
+func (conn *Connection) ListSecrets(flags libvirt.SecretListFlag) ([]libvirt.SecretAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	secs := make([]libvirt.SecretAPI, 0, len(conn.hv.secrets))
+	for _, rec := range conn.hv.secrets {
+		ok := matches(
+			filterGroup{
+				{flags&libvirt.SecListEphemeral != 0, rec.ephemeral},
+				{flags&libvirt.SecListNoEphemeral != 0, !rec.ephemeral},
+			},
+			filterGroup{
+				{flags&libvirt.SecListPrivate != 0, rec.private},
+				{flags&libvirt.SecListNoPrivate != 0, !rec.private},
+			},
+		)
+
+		if ok {
+			secs = append(secs, Secret{conn, rec.uuid})
+		}
+	}
+
+	return secs, nil
+}
+
+// DefineSecret defines a new secret, or updates the secret with the same
+// UUID. The value of an updated secret is kept.
+func (conn *Connection) DefineSecret(xml string) (libvirt.SecretAPI, error) {
+	rec, err := parseSecret(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if rec.usageType != libvirt.SecUsageTypeNone {
+		other := conn.hv.findSecret(func(r *secretRecord) bool {
+			return r.usageType == rec.usageType && r.usageID == rec.usageID && r.uuid != rec.uuid
+		})
+		if other != nil {
+			return nil, newError(libvirt.ErrInternal, libvirt.ErrDomSecret, "a secret with UUID %v already defined for use with %v", other.uuid, other.usageID)
+		}
+	}
+
+	if existing := conn.hv.findSecret(func(r *secretRecord) bool { return r.uuid == rec.uuid }); existing != nil {
+		rec.value = existing.value
+		*existing = *rec
+	} else {
+		conn.hv.secrets = append(conn.hv.secrets, rec)
+	}
+
+	return Secret{conn, rec.uuid}, nil
+}
+
+// CreateSecret defines a secret and sets its value, as
+// libvirt.CreateSecret.
+func (conn *Connection) CreateSecret(usage libvirt.SecretUsageType, usageID string, value []byte, private bool, ephemeral bool) (libvirt.SecretAPI, error) {
+	return libvirt.CreateSecret(conn, usage, usageID, value, private, ephemeral)
+}
+
+// lookupSecret returns the secret matching "pred" or a "not found" error
+// built from "format" and "args".
+func (conn *Connection) lookupSecret(pred func(*secretRecord) bool, format string, args ...interface{}) (libvirt.SecretAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	rec := conn.hv.findSecret(pred)
+	if rec == nil {
+		return nil, newError(libvirt.ErrNoSecret, libvirt.ErrDomSecret, "secret not found: "+format, args...)
+	}
+
+	return Secret{conn, rec.uuid}, nil
+}
+
+// LookupSecretByUUID looks up a secret by its UUID.
+func (conn *Connection) LookupSecretByUUID(uuid string) (libvirt.SecretAPI, error) {
+	uuid = strings.ToLower(uuid)
+
+	return conn.lookupSecret(func(r *secretRecord) bool {
+		return r.uuid == uuid
+	}, "no secret with matching uuid '%v'", uuid)
+}
+
+// LookupSecretByUsage looks up a secret by its usage.
+func (conn *Connection) LookupSecretByUsage(usageType libvirt.SecretUsageType, usageID string) (libvirt.SecretAPI, error) {
+	return conn.lookupSecret(func(r *secretRecord) bool {
+		return r.usageType == usageType && r.usageID == usageID
+	}, "no secret with matching usage '%v'", usageID)
+}
+
+// Secret is a fake libvirt secret. It implements libvirt.SecretAPI.
+type Secret struct {
+	conn *Connection
+	uuid string
+}
+
+// withSecret runs "fn" with the secret record while the state is locked.
+func (sec Secret) withSecret(fn func(rec *secretRecord) error) error {
+	if err := sec.conn.lock(); err != nil {
+		return err
+	}
+	defer sec.conn.hv.mu.Unlock()
+
+	rec := sec.conn.hv.findSecret(func(r *secretRecord) bool { return r.uuid == sec.uuid })
+	if rec == nil {
+		return newError(libvirt.ErrNoSecret, libvirt.ErrDomSecret, "secret not found: no secret with matching uuid '%v'", sec.uuid)
+	}
+
+	return fn(rec)
+}
+
+// Free does nothing; it exists to implement the interface.
+func (sec Secret) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (sec Secret) Ref() error {
+	return nil
+}
+
+// Undefine removes the secret.
+func (sec Secret) Undefine() error {
+	return sec.withSecret(func(rec *secretRecord) error {
+		for i, r := range sec.conn.hv.secrets {
+			if r == rec {
+				sec.conn.hv.secrets = append(sec.conn.hv.secrets[:i], sec.conn.hv.secrets[i+1:]...)
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// UUID returns the UUID of the secret.
+func (sec Secret) UUID() (string, error) {
+	err := sec.withSecret(func(rec *secretRecord) error {
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return sec.uuid, nil
+}
+
+// XML returns the XML description of the secret.
+func (sec Secret) XML() (doc string, err error) {
+	err = sec.withSecret(func(rec *secretRecord) error {
+		doc = rec.xml()
+		return nil
+	})
+
+	return
+}
+
+// Definition returns the parsed XML description of the secret.
+func (sec Secret) Definition() (*libvirt.SecretDef, error) {
+	doc, err := sec.XML()
+	if err != nil {
+		return nil, err
+	}
+
+	def := &libvirt.SecretDef{}
+	if err := parseXML(doc, def, libvirt.ErrDomSecret); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+// UsageID returns the usage ID of the secret.
+func (sec Secret) UsageID() (usageID string, err error) {
+	err = sec.withSecret(func(rec *secretRecord) error {
+		usageID = rec.usageID
+		return nil
+	})
+
+	return
+}
+
+// UsageType returns the usage type of the secret.
+func (sec Secret) UsageType() (usageType libvirt.SecretUsageType, err error) {
+	err = sec.withSecret(func(rec *secretRecord) error {
+		usageType = rec.usageType
+		return nil
+	})
+
+	return
+}
+
+// SetValue sets the value of the secret.
+func (sec Secret) SetValue(value string) error {
+	return sec.SetValueBytes([]byte(value))
+}
+
+// SetValueBytes sets the value of the secret to a copy of "value".
+func (sec Secret) SetValueBytes(value []byte) error {
+	return sec.withSecret(func(rec *secretRecord) error {
+		rec.value = append([]byte{}, value...)
+		return nil
+	})
+}
+
+// Value returns the value of the secret, as ValueBytes.
+func (sec Secret) Value() (string, error) {
+	value, err := sec.ValueBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// ValueBytes returns a copy of the value of the secret. Like libvirt's public
+// API, the value of private secrets can't be read.
+func (sec Secret) ValueBytes() (value libvirt.SecretValue, err error) {
+	err = sec.withSecret(func(rec *secretRecord) error {
+		if rec.private {
+			return newError(libvirt.ErrOperationDenied, libvirt.ErrDomSecret, "operation forbidden: secret is private")
+		}
+
+		if rec.value == nil {
+			return newError(libvirt.ErrNoSecret, libvirt.ErrDomSecret, "secret not found: secret '%v' does not have a value", rec.uuid)
+		}
+
+		value = append(libvirt.SecretValue{}, rec.value...)
+		return nil
+	})
+
+	return
+}
+
+// Rotate replaces the value of the secret, as libvirt.RotateSecret.
+func (sec Secret) Rotate(newValue []byte) (*libvirt.SecretRotation, error) {
+	return libvirt.RotateSecret(sec, newValue)
+}
+
+// Compile-time check that Secret implements the interface.
+var _ libvirt.SecretAPI = Secret{}
@@ -0,0 +1,247 @@
+package libvirtfake
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+const testSecretXML = `<secret ephemeral='no' private='no'>
+  <usage type='ceph'>
+    <name>client.fake secret</name>
+  </usage>
+</secret>`
+
+func TestSecretValue(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	sec, err := conn.DefineSecret(testSecretXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sec.Value()
+	checkErrorCode(t, err, libvirt.ErrNoSecret)
+
+	if err = sec.SetValue("s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	byUsage, err := conn.LookupSecretByUsage(libvirt.SecUsageTypeCeph, "client.fake secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := byUsage.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "s3cr3t" {
+		t.Errorf("wrong secret value; got=%v, want=s3cr3t", value)
+	}
+
+	xml, err := sec.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(xml, "<name>client.fake secret</name>") {
+		t.Errorf("secret XML doesn't contain the usage: %v", xml)
+	}
+
+	if _, err = conn.DefineSecret(testSecretXML); err == nil {
+		t.Error("secret with a duplicate usage should not be defined")
+	}
+
+	if err = sec.Undefine(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.LookupSecretByUsage(libvirt.SecUsageTypeCeph, "client.fake secret")
+	checkErrorCode(t, err, libvirt.ErrNoSecret)
+}
+
+func TestSecretValueBytes(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	sec, err := conn.DefineSecret(testSecretXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte{0x00, 0x01, 0xfe, 0x00, 0xff}
+	if err = sec.SetValueBytes(key); err != nil {
+		t.Fatal(err)
+	}
+	key[1] = 0x02
+
+	value, err := sec.ValueBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(value, []byte{0x00, 0x01, 0xfe, 0x00, 0xff}) {
+		t.Errorf("wrong secret value; got=%x, want=0001fe00ff", []byte(value))
+	}
+
+	value.Wipe()
+
+	again, err := sec.ValueBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(again, []byte{0x00, 0x01, 0xfe, 0x00, 0xff}) {
+		t.Errorf("wiping a returned value changed the secret; got=%x", []byte(again))
+	}
+}
+
+func TestCreateSecret(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	sec, err := conn.CreateSecret(libvirt.SecUsageTypeISCSI, "iqn.2024-01.fake:target", []byte("s3cr3t"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byUsage, err := conn.LookupSecretByUsage(libvirt.SecUsageTypeISCSI, "iqn.2024-01.fake:target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := byUsage.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "s3cr3t" {
+		t.Errorf("wrong secret value; got=%v, want=s3cr3t", value)
+	}
+
+	if _, err = conn.CreateSecret(libvirt.SecUsageTypeISCSI, "iqn.2024-01.fake:target", []byte("other"), false, false); err == nil {
+		t.Error("secret with a duplicate usage should not be created")
+	}
+
+	rot, err := sec.Rotate([]byte("n3w"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := sec.Value(); value != "n3w" {
+		t.Errorf("wrong secret value after rotation; got=%v, want=n3w", value)
+	}
+
+	if err = rot.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := sec.Value(); value != "s3cr3t" {
+		t.Errorf("wrong secret value after rollback; got=%v, want=s3cr3t", value)
+	}
+
+	if err = rot.Rollback(); err != libvirt.ErrSecretRotationDone {
+		t.Errorf("unexpected error rolling back twice; got=%v, want=%v", err, libvirt.ErrSecretRotationDone)
+	}
+
+	rot, err = sec.Rotate([]byte("n3w"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := rot.OldValue()
+	rot.Confirm()
+
+	if !bytes.Equal(old, make([]byte, len(old))) || rot.OldValue() != nil {
+		t.Errorf("the old value was not wiped after confirmation: %x", []byte(old))
+	}
+
+	if value, _ := sec.Value(); value != "n3w" {
+		t.Errorf("wrong secret value after confirmation; got=%v, want=n3w", value)
+	}
+
+	private, err := conn.CreateSecret(libvirt.SecUsageTypeNone, "", []byte("hidden"), true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = private.Rotate([]byte("other"))
+	checkErrorCode(t, err, libvirt.ErrOperationDenied)
+}
+
+func TestSecretDefinition(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	for usageType, usageID := range map[libvirt.SecretUsageType]string{
+		libvirt.SecUsageTypeTLS:  "fake-tls",
+		libvirt.SecUsageTypeVTPM: "fake-vtpm",
+	} {
+		sec, err := conn.CreateSecret(usageType, usageID, []byte("s3cr3t"), true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		def, err := sec.Definition()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !def.Private || def.Ephemeral {
+			t.Errorf("wrong secret flags; got private=%v ephemeral=%v, want private=true ephemeral=false", def.Private, def.Ephemeral)
+		}
+
+		if def.Usage == nil || def.Usage.Type != usageType || def.Usage.Name != usageID {
+			t.Errorf("wrong secret usage; got=%+v, want type=%v name=%v", def.Usage, usageType, usageID)
+		}
+
+		byUsage, err := conn.LookupSecretByUsage(usageType, usageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byUsage.Free()
+	}
+
+	_, err := conn.DefineSecret("<secret><usage type='tls'/></secret>")
+	checkErrorCode(t, err, libvirt.ErrXMLDetail)
+}
+
+func TestSecretPrivate(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	sec, err := conn.DefineSecret("<secret ephemeral='yes' private='yes'/>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sec.SetValue("hidden"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sec.Value()
+	checkErrorCode(t, err, libvirt.ErrOperationDenied)
+
+	secs, err := conn.ListSecrets(libvirt.SecListPrivate | libvirt.SecListEphemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secs) != 1 {
+		t.Errorf("unexpected number of private ephemeral secrets; got=%v, want=1", len(secs))
+	}
+
+	usageType, err := sec.UsageType()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usageType != libvirt.SecUsageTypeNone {
+		t.Errorf("wrong usage type; got=%v, want=%v", usageType, libvirt.SecUsageTypeNone)
+	}
+}
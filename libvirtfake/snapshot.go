@@ -0,0 +1,542 @@
+package libvirtfake
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// snapshotRecord is the state of a fake domain snapshot, including a copy of
+// the domain configuration to be restored on revert.
+type snapshotRecord struct {
+	name         string
+	description  string
+	creationTime int64
+	state        libvirt.DomainState
+	diskOnly     bool
+	disks        []libvirt.SnapshotDiskSpec
+	parent       *snapshotRecord
+	domain       domainRecord
+}
+
+// stateName returns the snapshot state as written in the XML.
+func (snap *snapshotRecord) stateName() string {
+	if snap.diskOnly {
+		return "disk-snapshot"
+	}
+
+	switch snap.state {
+	case libvirt.DomStateRunning:
+		return "running"
+	case libvirt.DomStatePaused:
+		return "paused"
+	default:
+		return "shutoff"
+	}
+}
+
+// xml renders the XML description of the snapshot.
+func (snap *snapshotRecord) xml() string {
+	var b strings.Builder
+
+	b.WriteString("<domainsnapshot>\n")
+	fmt.Fprintf(&b, "  <name>%v</name>\n", escape(snap.name))
+	if snap.description != "" {
+		fmt.Fprintf(&b, "  <description>%v</description>\n", escape(snap.description))
+	}
+	fmt.Fprintf(&b, "  <state>%v</state>\n", snap.stateName())
+	if snap.parent != nil {
+		fmt.Fprintf(&b, "  <parent>\n    <name>%v</name>\n  </parent>\n", escape(snap.parent.name))
+	}
+	fmt.Fprintf(&b, "  <creationTime>%v</creationTime>\n", snap.creationTime)
+	switch {
+	case snap.diskOnly:
+		b.WriteString("  <memory snapshot='no'/>\n")
+	case snap.state == libvirt.DomStateShutoff:
+		b.WriteString("  <memory snapshot='no'/>\n")
+	default:
+		b.WriteString("  <memory snapshot='internal'/>\n")
+	}
+	if len(snap.disks) > 0 {
+		disks, err := xml.MarshalIndent(struct {
+			XMLName xml.Name                   `xml:"disks"`
+			Disks   []libvirt.SnapshotDiskSpec `xml:"disk"`
+		}{Disks: snap.disks}, "  ", "  ")
+		if err == nil {
+			fmt.Fprintf(&b, "  %s\n", disks)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(snap.domain.xml(), "\n"), "\n") {
+		fmt.Fprintf(&b, "  %v\n", line)
+	}
+	b.WriteString("</domainsnapshot>\n")
+
+	return b.String()
+}
+
+// findSnapshot returns the snapshot of the domain named "name".
+func (rec *domainRecord) findSnapshot(name string) *snapshotRecord {
+	for _, snap := range rec.snapshots {
+		if snap.name == name {
+			return snap
+		}
+	}
+
+	return nil
+}
+
+// snapshotChildren returns the direct children of "parent", or the root
+// snapshots if "parent" is nil.
+func (rec *domainRecord) snapshotChildren(parent *snapshotRecord) []*snapshotRecord {
+	var children []*snapshotRecord
+	for _, snap := range rec.snapshots {
+		if snap.parent == parent {
+			children = append(children, snap)
+		}
+	}
+
+	return children
+}
+
+// snapshotDescendants returns all snapshots below "parent", in creation
+// order.
+func (rec *domainRecord) snapshotDescendants(parent *snapshotRecord) []*snapshotRecord {
+	var descendants []*snapshotRecord
+	for _, snap := range rec.snapshots {
+		for p := snap.parent; p != nil; p = p.parent {
+			if p == parent {
+				descendants = append(descendants, snap)
+				break
+			}
+		}
+	}
+
+	return descendants
+}
+
+// filterSnapshots returns the snapshots of "snaps" which match the filters of
+// "flags".
+func (rec *domainRecord) filterSnapshots(snaps []*snapshotRecord, flags libvirt.SnapshotListFlag) []*snapshotRecord {
+	var filtered []*snapshotRecord
+	for _, snap := range snaps {
+		leaf := len(rec.snapshotChildren(snap)) == 0
+		ok := matches(
+			filterGroup{
+				{flags&libvirt.SnapListLeaves != 0, leaf},
+				{flags&libvirt.SnapListNoLeaves != 0, !leaf},
+			},
+			filterGroup{
+				{flags&libvirt.SnapListMetadata != 0, true},
+				{flags&libvirt.SnapListNoMetadata != 0, false},
+			},
+			filterGroup{
+				{flags&libvirt.SnapListInactive != 0, !snap.diskOnly && snap.state == libvirt.DomStateShutoff},
+				{flags&libvirt.SnapListActive != 0, !snap.diskOnly && snap.state != libvirt.DomStateShutoff},
+				{flags&libvirt.SnapListDiskOnly != 0, snap.diskOnly},
+			},
+			filterGroup{
+				{flags&libvirt.SnapListInternal != 0, !snap.diskOnly},
+				{flags&libvirt.SnapListExternal != 0, snap.diskOnly},
+			},
+		)
+
+		if ok {
+			filtered = append(filtered, snap)
+		}
+	}
+
+	return filtered
+}
+
+// ListSnapshots returns the snapshots of the domain matching "flags". With
+// SnapListRoots, only snapshots without a parent are returned.
+func (dom Domain) ListSnapshots(flags libvirt.SnapshotListFlag) (snaps []libvirt.SnapshotAPI, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		candidates := rec.snapshots
+		if flags&libvirt.SnapListRoots != 0 {
+			candidates = rec.snapshotChildren(nil)
+		}
+
+		snaps = make([]libvirt.SnapshotAPI, 0, len(candidates))
+		for _, snap := range rec.filterSnapshots(candidates, flags) {
+			snaps = append(snaps, Snapshot{dom, snap.name})
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// CreateSnapshot creates a snapshot of the domain, which becomes the current
+// one. Disk-only snapshots are treated as external snapshots.
+func (dom Domain) CreateSnapshot(xml string, flags libvirt.SnapshotCreateFlag) (libvirt.SnapshotAPI, error) {
+	var def libvirt.SnapshotDef
+	if err := parseXML(xml, &def, libvirt.ErrDomDomainSnapshot); err != nil {
+		return nil, err
+	}
+
+	var snap *snapshotRecord
+	err := dom.withDomain(func(rec *domainRecord) error {
+		if flags&libvirt.SnapCreateRedefine != 0 {
+			return errNoSupport("snapshot redefinition")
+		}
+
+		if flags&libvirt.SnapCreateDiskOnly != 0 && !rec.isActive() {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomainSnapshot, "disk-only snapshots of inactive domains are not supported")
+		}
+
+		now := time.Now().Unix()
+		name := def.Name
+		if name == "" {
+			name = strconv.FormatInt(now, 10)
+		}
+
+		if rec.findSnapshot(name) != nil {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomDomainSnapshot, "snapshot '%v' already exists", name)
+		}
+
+		snap = &snapshotRecord{
+			name:         name,
+			description:  def.Description,
+			creationTime: now,
+			state:        rec.state,
+			diskOnly:     flags&libvirt.SnapCreateDiskOnly != 0,
+			disks:        def.Disks,
+			parent:       rec.current,
+			domain:       *rec,
+		}
+		snap.domain.devices = append([]string(nil), rec.devices...)
+		snap.domain.snapshots, snap.domain.current, snap.domain.checkpoints = nil, nil, nil
+		snap.domain.blockJobs = nil
+
+		if flags&libvirt.SnapCreateNoMetadata != 0 {
+			return nil
+		}
+
+		rec.snapshots = append(rec.snapshots, snap)
+		rec.current = snap
+
+		if flags&libvirt.SnapCreateHalt != 0 && rec.isActive() {
+			dom.conn.hv.stop(rec, libvirt.DomShutoffReasonFromSnapshot)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Snapshot{dom, snap.name}, nil
+}
+
+// CreateSnapshotDef creates a snapshot of the domain from "def", as
+// CreateSnapshot.
+func (dom Domain) CreateSnapshotDef(def libvirt.SnapshotDef, flags libvirt.SnapshotCreateFlag) (libvirt.SnapshotAPI, error) {
+	xml, err := def.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return dom.CreateSnapshot(xml, flags)
+}
+
+// CurrentSnapshot returns the current snapshot of the domain.
+func (dom Domain) CurrentSnapshot(flags libvirt.SnapshotCurrentFlag) (current libvirt.SnapshotAPI, err error) {
+	err = dom.withDomain(func(rec *domainRecord) error {
+		if rec.current == nil {
+			return newError(libvirt.ErrNoDomainSnapshot, libvirt.ErrDomDomainSnapshot, "the domain does not have a current snapshot")
+		}
+
+		current = Snapshot{dom, rec.current.name}
+		return nil
+	})
+
+	return
+}
+
+// LookupSnapshotByName returns the snapshot of the domain named "name".
+func (dom Domain) LookupSnapshotByName(name string) (libvirt.SnapshotAPI, error) {
+	err := dom.withDomain(func(rec *domainRecord) error {
+		if rec.findSnapshot(name) == nil {
+			return errNoSnapshot(name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Snapshot{dom, name}, nil
+}
+
+// MergeExternalSnapshot merges the overlays of an external snapshot with the
+// fake block jobs, as libvirt.MergeExternalSnapshot.
+func (dom Domain) MergeExternalSnapshot(ctx context.Context, snap libvirt.SnapshotAPI, policy libvirt.SnapshotMergePolicy) (libvirt.SnapshotMergeResult, error) {
+	return libvirt.MergeExternalSnapshot(ctx, dom, snap, policy)
+}
+
+// SnapshotTree returns the hierarchy of the snapshots of the domain.
+func (dom Domain) SnapshotTree() (*libvirt.SnapshotTree, error) {
+	return libvirt.NewSnapshotTree(dom)
+}
+
+// errNoSnapshot is returned when a snapshot can't be found.
+func errNoSnapshot(name string) error {
+	return newError(libvirt.ErrNoDomainSnapshot, libvirt.ErrDomDomainSnapshot, "Domain snapshot not found: no domain snapshot with matching name '%v'", name)
+}
+
+// Snapshot is a fake libvirt domain snapshot. It implements
+// libvirt.SnapshotAPI.
+type Snapshot struct {
+	dom  Domain
+	name string
+}
+
+// withSnapshot runs "fn" with the domain and snapshot records while the state
+// is locked.
+func (snap Snapshot) withSnapshot(fn func(rec *domainRecord, s *snapshotRecord) error) error {
+	return snap.dom.withDomain(func(rec *domainRecord) error {
+		s := rec.findSnapshot(snap.name)
+		if s == nil {
+			return errNoSnapshot(snap.name)
+		}
+
+		return fn(rec, s)
+	})
+}
+
+// Free does nothing; it exists to implement the interface.
+func (snap Snapshot) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (snap Snapshot) Ref() error {
+	return nil
+}
+
+// Delete removes the snapshot. Its children are attached to its parent,
+// unless SnapDeleteChildren or SnapDeleteChildrenOnly is used. External
+// snapshots can only have their metadata removed, like on older hypervisors.
+func (snap Snapshot) Delete(flags libvirt.SnapshotDeleteFlag) error {
+	return snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		var doomed []*snapshotRecord
+		if flags&(libvirt.SnapDeleteChildren|libvirt.SnapDeleteChildrenOnly) != 0 {
+			doomed = rec.snapshotDescendants(s)
+		}
+		if flags&libvirt.SnapDeleteChildrenOnly == 0 {
+			doomed = append(doomed, s)
+		}
+
+		if flags&libvirt.SnapDeleteMetadataOnly == 0 {
+			for _, d := range doomed {
+				if d.diskOnly {
+					return newError(libvirt.ErrNoSupport, libvirt.ErrDomDomainSnapshot, "deletion of %v external disk snapshots not supported yet", d.name)
+				}
+			}
+		}
+
+		for _, d := range doomed {
+			for _, child := range rec.snapshotChildren(d) {
+				child.parent = d.parent
+			}
+
+			if rec.current == d {
+				rec.current = d.parent
+			}
+
+			for i, other := range rec.snapshots {
+				if other == d {
+					rec.snapshots = append(rec.snapshots[:i], rec.snapshots[i+1:]...)
+					break
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Name returns the name of the snapshot.
+func (snap Snapshot) Name() (string, error) {
+	err := snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return snap.name, nil
+}
+
+// Parent returns the parent of the snapshot.
+func (snap Snapshot) Parent() (parent libvirt.SnapshotAPI, err error) {
+	err = snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		if s.parent == nil {
+			return newError(libvirt.ErrNoDomainSnapshot, libvirt.ErrDomDomainSnapshot, "snapshot '%v' does not have a parent", s.name)
+		}
+
+		parent = Snapshot{snap.dom, s.parent.name}
+		return nil
+	})
+
+	return
+}
+
+// Domain returns the domain of the snapshot.
+func (snap Snapshot) Domain() (libvirt.DomainAPI, error) {
+	err := snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snap.dom, nil
+}
+
+// Connection returns a new reference to the connection of the snapshot,
+// which must be closed by the caller.
+func (snap Snapshot) Connection() (libvirt.ConnectionAPI, error) {
+	err := snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := snap.dom.conn.Ref(); err != nil {
+		return nil, err
+	}
+
+	return snap.dom.conn, nil
+}
+
+// XML returns the XML description of the snapshot.
+func (snap Snapshot) XML(flags libvirt.DomainXMLFlag) (doc string, err error) {
+	err = snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		doc = s.xml()
+		return nil
+	})
+
+	return
+}
+
+// Definition returns the parsed XML description of the snapshot.
+func (snap Snapshot) Definition(flags libvirt.DomainXMLFlag) (*libvirt.SnapshotDef, error) {
+	doc, err := snap.XML(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	def := &libvirt.SnapshotDef{}
+	if err := parseXML(doc, def, libvirt.ErrDomDomainSnapshot); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+// HasMetadata always returns true: the fake doesn't keep snapshots without
+// metadata.
+func (snap Snapshot) HasMetadata() (bool, error) {
+	err := snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		return nil
+	})
+
+	return err == nil, err
+}
+
+// IsCurrent returns whether the snapshot is the current snapshot of the
+// domain.
+func (snap Snapshot) IsCurrent() (current bool, err error) {
+	err = snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		current = rec.current == s
+		return nil
+	})
+
+	return
+}
+
+// ListChildren returns the children of the snapshot matching "flags". With
+// SnapListDescendants, all snapshots below it are returned.
+func (snap Snapshot) ListChildren(flags libvirt.SnapshotListFlag) (children []libvirt.SnapshotAPI, err error) {
+	err = snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		candidates := rec.snapshotChildren(s)
+		if flags&libvirt.SnapListDescendants != 0 {
+			candidates = rec.snapshotDescendants(s)
+		}
+
+		children = make([]libvirt.SnapshotAPI, 0, len(candidates))
+		for _, child := range rec.filterSnapshots(candidates, flags) {
+			children = append(children, Snapshot{snap.dom, child.name})
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// NumChildren returns the number of children of the snapshot matching
+// "flags", as ListChildren.
+func (snap Snapshot) NumChildren(flags libvirt.SnapshotListFlag) (int32, error) {
+	children, err := snap.ListChildren(flags)
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(len(children)), nil
+}
+
+// Revert restores the domain configuration and state saved by the snapshot,
+// which becomes the current one. External snapshots can't be reverted to.
+func (snap Snapshot) Revert(flags libvirt.SnapshotRevertFlag) error {
+	return snap.withSnapshot(func(rec *domainRecord, s *snapshotRecord) error {
+		if s.diskOnly {
+			return newError(libvirt.ErrNoSupport, libvirt.ErrDomDomainSnapshot, "revert to external snapshot not supported yet")
+		}
+
+		rec.maxMemory, rec.memory = s.domain.maxMemory, s.domain.memory
+		rec.maxVCPUs, rec.vcpus = s.domain.maxVCPUs, s.domain.vcpus
+		rec.devices = append([]string(nil), s.domain.devices...)
+		rec.current = s
+
+		state := s.state
+		if flags&libvirt.SnapRevertRunning != 0 {
+			state = libvirt.DomStateRunning
+		}
+		if flags&libvirt.SnapRevertPaused != 0 {
+			state = libvirt.DomStatePaused
+		}
+
+		switch {
+		case state == libvirt.DomStateShutoff && rec.isActive():
+			rec.id = 0
+			rec.state = libvirt.DomStateShutoff
+			rec.reason = int32(libvirt.DomShutoffReasonFromSnapshot)
+		case state == libvirt.DomStateShutoff:
+			rec.reason = int32(libvirt.DomShutoffReasonFromSnapshot)
+		case !rec.isActive():
+			snap.dom.conn.hv.start(rec, state == libvirt.DomStatePaused, libvirt.DomRunningReasonFromSnapshot)
+		case state == libvirt.DomStatePaused:
+			rec.state = libvirt.DomStatePaused
+			rec.reason = int32(libvirt.DomPausedReasonFromSnapshot)
+		default:
+			rec.state = libvirt.DomStateRunning
+			rec.reason = int32(libvirt.DomRunningReasonFromSnapshot)
+		}
+
+		return nil
+	})
+}
+
+// Compile-time check that Snapshot implements the interface.
+var _ libvirt.SnapshotAPI = Snapshot{}
@@ -0,0 +1,377 @@
+package libvirtfake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// snapshotNames returns the names of "snaps".
+func snapshotNames(t *testing.T, snaps []libvirt.SnapshotAPI) []string {
+	t.Helper()
+
+	names := make([]string, len(snaps))
+	for i, snap := range snaps {
+		name, err := snap.Name()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names[i] = name
+	}
+
+	return names
+}
+
+func TestSnapshotTree(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	first, err := dom.CreateSnapshot("<domainsnapshot><name>first</name></domainsnapshot>", libvirt.SnapCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dom.CreateSnapshot("<domainsnapshot><name>second</name></domainsnapshot>", libvirt.SnapCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dom.CreateSnapshot("<domainsnapshot><name>first</name></domainsnapshot>", libvirt.SnapCreateDefault); err == nil {
+		t.Error("duplicate snapshot should not be created")
+	}
+
+	if err = first.Revert(libvirt.SnapRevertDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dom.CreateSnapshot("<domainsnapshot><name>third</name></domainsnapshot>", libvirt.SnapCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := first.ListChildren(libvirt.SnapListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := snapshotNames(t, children); len(names) != 2 || names[0] != "second" || names[1] != "third" {
+		t.Errorf("unexpected children; got=%v, want=[second third]", names)
+	}
+
+	roots, err := dom.ListSnapshots(libvirt.SnapListRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := snapshotNames(t, roots); len(names) != 1 || names[0] != "first" {
+		t.Errorf("unexpected roots; got=%v, want=[first]", names)
+	}
+
+	leaves, err := dom.ListSnapshots(libvirt.SnapListLeaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaves) != 2 {
+		t.Errorf("unexpected number of leaves; got=%v, want=2", len(leaves))
+	}
+
+	third, err := dom.LookupSnapshotByName("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current, _ := third.IsCurrent(); !current {
+		t.Error("last created snapshot should be the current one")
+	}
+
+	_, err = first.Parent()
+	checkErrorCode(t, err, libvirt.ErrNoDomainSnapshot)
+
+	if err = first.Delete(libvirt.SnapDeleteDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err = dom.ListSnapshots(libvirt.SnapListRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roots) != 2 {
+		t.Errorf("children of a deleted snapshot should become roots; got %v roots", len(roots))
+	}
+
+	checkErrorCode(t, dom.Undefine(libvirt.DomUndefineDefault), libvirt.ErrOperationInvalid)
+}
+
+func TestSnapshotCurrent(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	_, err := dom.CurrentSnapshot(libvirt.SnapCurrentDefault)
+	checkErrorCode(t, err, libvirt.ErrNoDomainSnapshot)
+
+	root, err := dom.CreateSnapshotDef(libvirt.SnapshotDef{Name: "root", Description: "first one"}, libvirt.SnapCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dom.CreateSnapshotDef(libvirt.SnapshotDef{Name: "child"}, libvirt.SnapCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := dom.CurrentSnapshot(libvirt.SnapCurrentDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := current.Name(); name != "child" {
+		t.Errorf("unexpected current snapshot; got=%v, want=child", name)
+	}
+
+	def, err := current.Definition(libvirt.DomXMLDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Parent == nil || def.Parent.Name != "root" {
+		t.Errorf("unexpected parent; got=%+v, want=root", def.Parent)
+	}
+
+	if def.State != libvirt.SnapStateShutoff {
+		t.Errorf("unexpected state; got=%v, want=%v", def.State, libvirt.SnapStateShutoff)
+	}
+
+	if n, err := root.NumChildren(libvirt.SnapListDescendants); err != nil || n != 1 {
+		t.Errorf("unexpected number of children; got=%v (%v), want=1", n, err)
+	}
+
+	snapDom, err := root.Domain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := snapDom.Name(); name != "fake-dom" {
+		t.Errorf("unexpected snapshot domain; got=%v, want=fake-dom", name)
+	}
+
+	snapConn, err := root.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := snapConn.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if alive, err := conn.IsAlive(); err != nil || !alive {
+		t.Errorf("the connection should still be open after closing the snapshot's reference; alive=%v (%v)", alive, err)
+	}
+}
+
+func TestSnapshotRevert(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	if err := dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := dom.CreateSnapshot("<domainsnapshot/>", libvirt.SnapCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dom.SetVCPUs(1, libvirt.DomVCPUsCurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dom.Destroy(libvirt.DomDestroyDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = snap.Revert(libvirt.SnapRevertDefault); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, dom, libvirt.DomStateRunning, int32(libvirt.DomRunningReasonFromSnapshot))
+
+	vcpus, err := dom.VCPUs(libvirt.DomVCPUsCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vcpus != 2 {
+		t.Errorf("revert should restore the VCPUs; got=%v, want=2", vcpus)
+	}
+
+	external, err := dom.CreateSnapshot("<domainsnapshot><name>ext</name></domainsnapshot>", libvirt.SnapCreateDiskOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkErrorCode(t, external.Revert(libvirt.SnapRevertDefault), libvirt.ErrNoSupport)
+	checkErrorCode(t, external.Delete(libvirt.SnapDeleteDefault), libvirt.ErrNoSupport)
+
+	if err = external.Delete(libvirt.SnapDeleteMetadataOnly); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// overlaySnapshotDef is an external snapshot of the disks "vda" and "vdb",
+// with their overlays in the test pool.
+var overlaySnapshotDef = libvirt.SnapshotDef{
+	Name: "overlay",
+	Disks: []libvirt.SnapshotDiskSpec{
+		{Name: "vda", Snapshot: libvirt.SnapLocationExternal, Source: &libvirt.SnapshotDiskSource{File: "/fake/pool/vda.overlay"}},
+		{Name: "vdb", Snapshot: libvirt.SnapLocationExternal, Source: &libvirt.SnapshotDiskSource{File: "/fake/pool/vdb.overlay"}},
+	},
+}
+
+func TestMergeExternalSnapshot(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	pool, err := conn.CreateStoragePool(testPoolXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.CreateStorageVolume("<volume><name>vda.overlay</name><capacity>1</capacity></volume>", libvirt.VolCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	internal, err := dom.CreateSnapshotDef(libvirt.SnapshotDef{Name: "internal"}, libvirt.SnapCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dom.MergeExternalSnapshot(context.Background(), internal, libvirt.SnapshotMergePolicy{}); err != libvirt.ErrSnapshotNotMergeable {
+		t.Errorf("unexpected error merging an internal snapshot; got=%v, want=%v", err, libvirt.ErrSnapshotNotMergeable)
+	}
+
+	snap, err := dom.CreateSnapshotDef(overlaySnapshotDef, libvirt.SnapCreateDiskOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a job already running on a disk makes the merge fail, and the job
+	// started on the other disk must be cancelled
+	if err = dom.BlockCommit("vdb", "", "", 0, libvirt.DomBlockCommitActive); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dom.MergeExternalSnapshot(context.Background(), snap, libvirt.SnapshotMergePolicy{})
+
+	var mergeErr *libvirt.SnapshotMergeError
+	if !errors.As(err, &mergeErr) {
+		t.Fatalf("unexpected error; got=%v, want a *SnapshotMergeError", err)
+	}
+
+	if mergeErr.Disk != "vdb" || len(mergeErr.Pivoted) != 0 || len(mergeErr.Stuck) != 0 {
+		t.Errorf("unexpected merge error; got=%+v", mergeErr)
+	}
+	checkErrorCode(t, mergeErr.Err, libvirt.ErrBlockCopyActive)
+
+	if _, ok, _ := dom.BlockJobInfo("vda", libvirt.DomBlockJobInfoDefault); ok {
+		t.Error("the block job on vda should have been cancelled")
+	}
+
+	if err = dom.BlockJobAbort("vdb", libvirt.DomBlockJobAbortDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := dom.MergeExternalSnapshot(context.Background(), snap, libvirt.SnapshotMergePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Disks) != 2 || result.Disks[0] != "vda" || result.Disks[1] != "vdb" {
+		t.Errorf("unexpected merged disks; got=%v, want=[vda vdb]", result.Disks)
+	}
+
+	if len(result.RemovedOverlays) != 1 || result.RemovedOverlays[0] != "/fake/pool/vda.overlay" {
+		t.Errorf("unexpected removed overlays; got=%v, want=[/fake/pool/vda.overlay]", result.RemovedOverlays)
+	}
+
+	if len(result.KeptOverlays) != 1 || result.KeptOverlays[0] != "/fake/pool/vdb.overlay" {
+		t.Errorf("unexpected kept overlays; got=%v, want=[/fake/pool/vdb.overlay]", result.KeptOverlays)
+	}
+
+	_, err = conn.LookupStorageVolumeByPath("/fake/pool/vda.overlay")
+	checkErrorCode(t, err, libvirt.ErrNoStorageVol)
+
+	_, err = dom.LookupSnapshotByName("overlay")
+	checkErrorCode(t, err, libvirt.ErrNoDomainSnapshot)
+
+	for _, disk := range []string{"vda", "vdb"} {
+		if _, ok, _ := dom.BlockJobInfo(disk, libvirt.DomBlockJobInfoDefault); ok {
+			t.Errorf("the block job on %v should have been pivoted", disk)
+		}
+	}
+}
+
+func TestCheckpointBackup(t *testing.T) {
+	conn, dom := defineTestDomain(t)
+	defer conn.Close()
+
+	_, err := dom.CreateCheckpoint("<domaincheckpoint/>", libvirt.CheckpointCreateDefault)
+	checkErrorCode(t, err, libvirt.ErrOperationInvalid)
+
+	if err = dom.Create(libvirt.DomCreateDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := dom.CreateCheckpoint("<domaincheckpoint><name>first</name></domaincheckpoint>", libvirt.CheckpointCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dom.BackupBegin("<domainbackup/>", "<domaincheckpoint><name>second</name></domaincheckpoint>", libvirt.DomBackupBeginDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := dom.LookupCheckpointByName("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent, err := second.Parent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := parent.Name(); name != "first" {
+		t.Errorf("wrong checkpoint parent; got=%v, want=first", name)
+	}
+
+	stats, err := dom.WaitForJob(context.Background(), 0, func(stats libvirt.DomainJobStats) {
+		t.Errorf("the progress of a completed job should not be reported; got=%+v", stats)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Type != libvirt.DomJobCompleted || stats.Operation != libvirt.DomJobOperationBackup {
+		t.Errorf("unexpected completed job; got=%+v", stats)
+	}
+
+	checkErrorCode(t, dom.AbortJob(), libvirt.ErrOperationInvalid)
+
+	if err = first.Delete(libvirt.CheckpointDeleteChildren); err != nil {
+		t.Fatal(err)
+	}
+
+	cps, err := dom.ListCheckpoints(libvirt.CheckpointListAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cps) != 0 {
+		t.Errorf("checkpoints should be deleted with their children; got %v left", len(cps))
+	}
+}
@@ -0,0 +1,562 @@
+package libvirtfake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// defaultPoolCapacity is the capacity of pools which don't declare one, in
+// bytes.
+const defaultPoolCapacity = 100 << 30
+
+// poolDef is the part of the storage pool XML understood by the fake.
+type poolDef struct {
+	Type     string       `xml:"type,attr"`
+	Name     string       `xml:"name"`
+	UUID     string       `xml:"uuid"`
+	Capacity *sizeElement `xml:"capacity"`
+	Target   struct {
+		Path string `xml:"path"`
+	} `xml:"target"`
+}
+
+// poolRecord is the state of a fake storage pool.
+type poolRecord struct {
+	name       string
+	uuid       string
+	typ        string
+	path       string
+	capacity   uint64
+	state      libvirt.StoragePoolState
+	persistent bool
+	autostart  bool
+	built      bool
+	volumes    []*volumeRecord
+}
+
+// poolTypeFlags maps pool types to their listing filters.
+var poolTypeFlags = map[string]libvirt.StoragePoolListFlag{
+	"dir":      libvirt.PoolListDir,
+	"fs":       libvirt.PoolListFS,
+	"netfs":    libvirt.PoolListNetFS,
+	"logical":  libvirt.PoolListLogical,
+	"disk":     libvirt.PoolListDisk,
+	"iscsi":    libvirt.PoolListISCSI,
+	"scsi":     libvirt.PoolListSCSI,
+	"mpath":    libvirt.PoolListMPath,
+	"rbd":      libvirt.PoolListRBD,
+	"sheepdog": libvirt.PoolListSheepdog,
+	"gluster":  libvirt.PoolListGluster,
+	"zfs":      libvirt.PoolListZFS,
+}
+
+// parsePool creates a storage pool record from its XML description.
+func parsePool(doc string) (*poolRecord, error) {
+	var def poolDef
+	if err := parseXML(doc, &def, libvirt.ErrDomStorage); err != nil {
+		return nil, err
+	}
+
+	if def.Name == "" {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "missing pool source name element")
+	}
+
+	if _, ok := poolTypeFlags[def.Type]; !ok {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "unknown storage pool type '%v'", def.Type)
+	}
+
+	capacity, err := def.Capacity.bytes("bytes")
+	if err != nil {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "invalid capacity: %v", err)
+	}
+	if capacity == 0 {
+		capacity = defaultPoolCapacity
+	}
+
+	rec := &poolRecord{
+		name:     def.Name,
+		uuid:     strings.ToLower(def.UUID),
+		typ:      def.Type,
+		path:     strings.TrimSuffix(def.Target.Path, "/"),
+		capacity: capacity,
+		state:    libvirt.PoolStateInactive,
+	}
+
+	if rec.uuid == "" {
+		rec.uuid = newUUID()
+	}
+	if rec.path == "" {
+		rec.path = "/var/lib/libvirt/images/" + rec.name
+	}
+
+	return rec, nil
+}
+
+// xml renders the XML description of the storage pool.
+func (rec *poolRecord) xml() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<pool type='%v'>\n", escape(rec.typ))
+	fmt.Fprintf(&b, "  <name>%v</name>\n", escape(rec.name))
+	fmt.Fprintf(&b, "  <uuid>%v</uuid>\n", rec.uuid)
+	fmt.Fprintf(&b, "  <capacity unit='bytes'>%v</capacity>\n", rec.capacity)
+	fmt.Fprintf(&b, "  <allocation unit='bytes'>%v</allocation>\n", rec.allocation())
+	fmt.Fprintf(&b, "  <available unit='bytes'>%v</available>\n", rec.capacity-rec.allocation())
+	fmt.Fprintf(&b, "  <target>\n    <path>%v</path>\n  </target>\n", escape(rec.path))
+	b.WriteString("</pool>\n")
+
+	return b.String()
+}
+
+// isActive returns whether the storage pool is running.
+func (rec *poolRecord) isActive() bool {
+	return rec.state == libvirt.PoolStateRunning
+}
+
+// allocation returns the space used by the volumes of the pool, in bytes.
+func (rec *poolRecord) allocation() uint64 {
+	var total uint64
+	for _, vol := range rec.volumes {
+		total += vol.allocation
+	}
+
+	if total > rec.capacity {
+		return rec.capacity
+	}
+
+	return total
+}
+
+// findPool returns the storage pool which matches "pred". The hypervisor must
+// be locked.
+func (hv *Hypervisor) findPool(pred func(*poolRecord) bool) *poolRecord {
+	for _, rec := range hv.pools {
+		if pred(rec) {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+// removePool forgets about a storage pool. The hypervisor must be locked.
+func (hv *Hypervisor) removePool(rec *poolRecord) {
+	for i, r := range hv.pools {
+		if r == rec {
+			hv.pools = append(hv.pools[:i], hv.pools[i+1:]...)
+			return
+		}
+	}
+}
+
+// addPool checks whether a new storage pool conflicts with an existing one
+// and adds it. The hypervisor must be locked.
+func (hv *Hypervisor) addPool(rec *poolRecord) error {
+	if other := hv.findPool(func(r *poolRecord) bool { return r.name == rec.name || r.uuid == rec.uuid }); other != nil {
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomStorage, "pool '%v' already exists with uuid %v", other.name, other.uuid)
+	}
+
+	hv.pools = append(hv.pools, rec)
+
+	return nil
+}
+
+// ListStoragePools returns the storage pools matching "flags".
+func (conn *Connection) ListStoragePools(flags libvirt.StoragePoolListFlag) ([]libvirt.StoragePoolAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	typeGroup := make(filterGroup, 0, len(poolTypeFlags))
+	pools := make([]libvirt.StoragePoolAPI, 0, len(conn.hv.pools))
+	for _, rec := range conn.hv.pools {
+		typeGroup = typeGroup[:0]
+		for typ, flag := range poolTypeFlags {
+			typeGroup = append(typeGroup, struct{ set, match bool }{flags&flag != 0, rec.typ == typ})
+		}
+
+		ok := matches(
+			filterGroup{
+				{flags&libvirt.PoolListActive != 0, rec.isActive()},
+				{flags&libvirt.PoolListInactive != 0, !rec.isActive()},
+			},
+			filterGroup{
+				{flags&libvirt.PoolListPersistent != 0, rec.persistent},
+				{flags&libvirt.PoolListTransient != 0, !rec.persistent},
+			},
+			filterGroup{
+				{flags&libvirt.PoolListAutostart != 0, rec.autostart},
+				{flags&libvirt.PoolListNoAutostart != 0, !rec.autostart},
+			},
+			typeGroup,
+		)
+
+		if ok {
+			pools = append(pools, StoragePool{conn, rec.uuid})
+		}
+	}
+
+	return pools, nil
+}
+
+// DefineStoragePool defines a new persistent, inactive storage pool.
+func (conn *Connection) DefineStoragePool(xml string) (libvirt.StoragePoolAPI, error) {
+	rec, err := parsePool(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	rec.persistent = true
+	if err := conn.hv.addPool(rec); err != nil {
+		return nil, err
+	}
+
+	return StoragePool{conn, rec.uuid}, nil
+}
+
+// CreateStoragePool creates and starts a new transient storage pool.
+func (conn *Connection) CreateStoragePool(xml string) (libvirt.StoragePoolAPI, error) {
+	rec, err := parsePool(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	rec.state = libvirt.PoolStateRunning
+	if err := conn.hv.addPool(rec); err != nil {
+		return nil, err
+	}
+
+	return StoragePool{conn, rec.uuid}, nil
+}
+
+// lookupPool returns the storage pool matching "pred" or a "not found" error
+// built from "format" and "args".
+func (conn *Connection) lookupPool(pred func(*poolRecord) bool, format string, args ...interface{}) (libvirt.StoragePoolAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	rec := conn.hv.findPool(pred)
+	if rec == nil {
+		return nil, newError(libvirt.ErrNoStoragePool, libvirt.ErrDomStorage, "Storage pool not found: "+format, args...)
+	}
+
+	return StoragePool{conn, rec.uuid}, nil
+}
+
+// LookupStoragePoolByName looks up a storage pool by its name.
+func (conn *Connection) LookupStoragePoolByName(name string) (libvirt.StoragePoolAPI, error) {
+	return conn.lookupPool(func(r *poolRecord) bool {
+		return r.name == name
+	}, "no storage pool with matching name '%v'", name)
+}
+
+// LookupStoragePoolByUUID looks up a storage pool by its UUID.
+func (conn *Connection) LookupStoragePoolByUUID(uuid string) (libvirt.StoragePoolAPI, error) {
+	uuid = strings.ToLower(uuid)
+
+	return conn.lookupPool(func(r *poolRecord) bool {
+		return r.uuid == uuid
+	}, "no storage pool with matching uuid '%v'", uuid)
+}
+
+// StoragePool is a fake libvirt storage pool. It implements
+// libvirt.StoragePoolAPI.
+type StoragePool struct {
+	conn *Connection
+	uuid string
+}
+
+// withPool runs "fn" with the storage pool record while the state is locked.
+func (pool StoragePool) withPool(fn func(rec *poolRecord) error) error {
+	if err := pool.conn.lock(); err != nil {
+		return err
+	}
+	defer pool.conn.hv.mu.Unlock()
+
+	rec := pool.conn.hv.findPool(func(r *poolRecord) bool { return r.uuid == pool.uuid })
+	if rec == nil {
+		return newError(libvirt.ErrNoStoragePool, libvirt.ErrDomStorage, "Storage pool not found: no storage pool with matching uuid '%v'", pool.uuid)
+	}
+
+	return fn(rec)
+}
+
+// withActivePool runs "fn" with the storage pool record while the state is
+// locked, if the pool is running.
+func (pool StoragePool) withActivePool(fn func(rec *poolRecord) error) error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if !rec.isActive() {
+			return errPoolNotActive(rec)
+		}
+
+		return fn(rec)
+	})
+}
+
+// errPoolNotActive is returned by operations which require a running storage
+// pool.
+func errPoolNotActive(rec *poolRecord) error {
+	return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "storage pool '%v' is not active", rec.name)
+}
+
+// Free does nothing; it exists to implement the interface.
+func (pool StoragePool) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (pool StoragePool) Ref() error {
+	return nil
+}
+
+// Undefine removes the persistent configuration of the storage pool. Running
+// pools become transient.
+func (pool StoragePool) Undefine() error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if !rec.persistent {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "storage pool '%v' is not persistent", rec.name)
+		}
+
+		rec.persistent = false
+		rec.autostart = false
+		if !rec.isActive() {
+			pool.conn.hv.removePool(rec)
+		}
+
+		return nil
+	})
+}
+
+// Create starts an inactive storage pool.
+func (pool StoragePool) Create() error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if rec.isActive() {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "storage pool '%v' is already active", rec.name)
+		}
+
+		rec.state = libvirt.PoolStateRunning
+		return nil
+	})
+}
+
+// Destroy stops a running storage pool. Transient pools disappear. The
+// volumes are kept and show up again when the pool is restarted.
+func (pool StoragePool) Destroy() error {
+	return pool.withActivePool(func(rec *poolRecord) error {
+		rec.state = libvirt.PoolStateInactive
+		if !rec.persistent {
+			pool.conn.hv.removePool(rec)
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the underlying storage of an inactive pool, including its
+// volumes.
+func (pool StoragePool) Delete(flags libvirt.StoragePoolDeleteFlag) error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if rec.isActive() {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "storage pool '%v' is still active", rec.name)
+		}
+
+		rec.built = false
+		rec.volumes = nil
+		return nil
+	})
+}
+
+// IsActive returns whether the storage pool is running.
+func (pool StoragePool) IsActive() (active bool, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		active = rec.isActive()
+		return nil
+	})
+
+	return
+}
+
+// IsPersistent returns whether the storage pool has a persistent
+// configuration.
+func (pool StoragePool) IsPersistent() (persistent bool, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		persistent = rec.persistent
+		return nil
+	})
+
+	return
+}
+
+// Name returns the name of the storage pool.
+func (pool StoragePool) Name() (name string, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		name = rec.name
+		return nil
+	})
+
+	return
+}
+
+// UUID returns the UUID of the storage pool.
+func (pool StoragePool) UUID() (string, error) {
+	err := pool.withPool(func(rec *poolRecord) error {
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return pool.uuid, nil
+}
+
+// XML returns the XML description of the storage pool.
+func (pool StoragePool) XML(flags libvirt.StorageXMLFlag) (doc string, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		doc = rec.xml()
+		return nil
+	})
+
+	return
+}
+
+// InfoState returns the state of the storage pool.
+func (pool StoragePool) InfoState() (state libvirt.StoragePoolState, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		state = rec.state
+		return nil
+	})
+
+	return
+}
+
+// WaitForState polls the storage pool state until it's one of "desired" or
+// the context is done.
+func (pool StoragePool) WaitForState(ctx context.Context, desired ...libvirt.StoragePoolState) (libvirt.StoragePoolState, error) {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		state, err := pool.InfoState()
+		if err != nil {
+			return state, err
+		}
+
+		for _, d := range desired {
+			if state == d {
+				return state, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// InfoCapacity returns the capacity of the storage pool, in bytes.
+func (pool StoragePool) InfoCapacity() (capacity uint64, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		capacity = rec.capacity
+		return nil
+	})
+
+	return
+}
+
+// InfoAllocation returns the space used by the volumes of the storage pool,
+// in bytes.
+func (pool StoragePool) InfoAllocation() (allocation uint64, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		allocation = rec.allocation()
+		return nil
+	})
+
+	return
+}
+
+// InfoAvailable returns the free space of the storage pool, in bytes.
+func (pool StoragePool) InfoAvailable() (available uint64, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		available = rec.capacity - rec.allocation()
+		return nil
+	})
+
+	return
+}
+
+// Autostart returns whether the storage pool is started when the host boots.
+func (pool StoragePool) Autostart() (autostart bool, err error) {
+	err = pool.withPool(func(rec *poolRecord) error {
+		autostart = rec.autostart
+		return nil
+	})
+
+	return
+}
+
+// SetAutostart configures the storage pool to be started when the host
+// boots. Transient pools can't be autostarted.
+func (pool StoragePool) SetAutostart(autostart bool) error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if !rec.persistent {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "cannot set autostart for transient pool")
+		}
+
+		rec.autostart = autostart
+		return nil
+	})
+}
+
+// Build creates the underlying storage of an inactive pool.
+func (pool StoragePool) Build(flags libvirt.StoragePoolBuildFlag) error {
+	return pool.withPool(func(rec *poolRecord) error {
+		if rec.isActive() {
+			return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStorage, "storage pool '%v' is already active", rec.name)
+		}
+
+		if flags&libvirt.PoolBuildNoOverwrite != 0 && flags&libvirt.PoolBuildOverwrite != 0 {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "overwrite and no_overwrite are mutually exclusive")
+		}
+
+		if rec.built && flags&libvirt.PoolBuildNoOverwrite != 0 {
+			return newError(libvirt.ErrStoragePoolBuilt, libvirt.ErrDomStorage, "storage pool already built: %v", rec.path)
+		}
+
+		if flags&libvirt.PoolBuildOverwrite != 0 {
+			rec.volumes = nil
+		}
+
+		rec.built = true
+		return nil
+	})
+}
+
+// Refresh checks that the storage pool is running; there's nothing to
+// refresh in memory.
+func (pool StoragePool) Refresh() error {
+	return pool.withActivePool(func(rec *poolRecord) error {
+		return nil
+	})
+}
+
+// Compile-time check that StoragePool implements the interface.
+var _ libvirt.StoragePoolAPI = StoragePool{}
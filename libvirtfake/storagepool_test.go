@@ -0,0 +1,373 @@
+package libvirtfake
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+const testPoolXML = `<pool type='dir'>
+  <name>fake-pool</name>
+  <capacity unit='MiB'>64</capacity>
+  <target>
+    <path>/fake/pool</path>
+  </target>
+</pool>`
+
+const testVolumeXML = `<volume>
+  <name>fake-vol</name>
+  <capacity unit='KiB'>64</capacity>
+  <allocation>0</allocation>
+</volume>`
+
+// createTestVolume creates the test volume in a new running pool, on a new
+// fake connection.
+func createTestVolume(t *testing.T) (*Connection, libvirt.StoragePoolAPI, libvirt.StorageVolumeAPI) {
+	t.Helper()
+
+	conn := NewConnection()
+
+	pool, err := conn.CreateStoragePool(testPoolXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vol, err := pool.CreateStorageVolume(testVolumeXML, libvirt.VolCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, pool, vol
+}
+
+func TestStoragePoolLifecycle(t *testing.T) {
+	conn := NewConnection()
+	defer conn.Close()
+
+	pool, err := conn.DefineStoragePool(testPoolXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.ListStorageVolumes(); err == nil {
+		t.Error("volumes of an inactive pool should not be listed")
+	}
+
+	if err = pool.Build(libvirt.PoolBuildNew); err != nil {
+		t.Fatal(err)
+	}
+
+	checkErrorCode(t, pool.Build(libvirt.PoolBuildNoOverwrite), libvirt.ErrStoragePoolBuilt)
+
+	if err = pool.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := pool.InfoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != libvirt.PoolStateRunning {
+		t.Errorf("unexpected pool state; got=%v, want=%v", state, libvirt.PoolStateRunning)
+	}
+
+	capacity, err := pool.InfoCapacity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if capacity != 64<<20 {
+		t.Errorf("wrong pool capacity; got=%v, want=%v", capacity, 64<<20)
+	}
+
+	checkErrorCode(t, pool.Delete(libvirt.PoolDeleteNormal), libvirt.ErrOperationInvalid)
+
+	dirPools, err := conn.ListStoragePools(libvirt.PoolListDir | libvirt.PoolListActive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dirPools) != 1 {
+		t.Errorf("unexpected number of active dir pools; got=%v, want=1", len(dirPools))
+	}
+
+	if err = pool.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = pool.Undefine(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.LookupStoragePoolByName("fake-pool")
+	checkErrorCode(t, err, libvirt.ErrNoStoragePool)
+}
+
+func TestStorageVolumeCreate(t *testing.T) {
+	conn, pool, vol := createTestVolume(t)
+	defer conn.Close()
+
+	_, err := pool.CreateStorageVolume(testVolumeXML, libvirt.VolCreateDefault)
+	checkErrorCode(t, err, libvirt.ErrStorageVolExist)
+
+	path, err := vol.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/fake/pool/fake-vol" {
+		t.Errorf("wrong volume path; got=%v, want=/fake/pool/fake-vol", path)
+	}
+
+	byPath, err := conn.LookupStorageVolumeByPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := byPath.Name(); name != "fake-vol" {
+		t.Errorf("wrong volume found by path; got=%v, want=fake-vol", name)
+	}
+
+	checkErrorCode(t, vol.Resize(1024, libvirt.VolResizeDefault), libvirt.ErrInvalidArg)
+
+	if err = vol.Resize(64<<10, libvirt.VolResizeDelta); err != nil {
+		t.Fatal(err)
+	}
+
+	capacity, err := vol.InfoCapacity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if capacity != 128<<10 {
+		t.Errorf("wrong volume capacity after resize; got=%v, want=%v", capacity, 128<<10)
+	}
+
+	if err = vol.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pool.LookupStorageVolumeByName("fake-vol")
+	checkErrorCode(t, err, libvirt.ErrNoStorageVol)
+}
+
+func TestStorageVolumeTransfer(t *testing.T) {
+	conn, pool, vol := createTestVolume(t)
+	defer conn.Close()
+
+	data := bytes.Repeat([]byte("fake\x00data"), 100)
+
+	var progress uint64
+	if err := vol.UploadFromReader(context.Background(), bytes.NewReader(data), 1024, 0, func(n uint64) {
+		progress = n
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if progress != uint64(len(data)) {
+		t.Errorf("wrong progress reported; got=%v, want=%v", progress, len(data))
+	}
+
+	var buf bytes.Buffer
+	if err := vol.DownloadToWriter(context.Background(), &buf, 1024, uint64(len(data)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("downloaded data differs from uploaded data")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := vol.UploadFromReader(ctx, bytes.NewReader([]byte("lost")), 0, 0, nil); err != context.Canceled {
+		t.Errorf("unexpected error on cancelled upload; got=%v, want=%v", err, context.Canceled)
+	}
+
+	clone, err := pool.CreateStorageVolumeFrom("<volume><name>clone</name><capacity unit='KiB'>64</capacity></volume>", vol, libvirt.VolCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.CreateTemp("", "libvirtfake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// the previous content must not show through the holes
+	if _, err = f.Write(bytes.Repeat([]byte{0xff}, 128<<10)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = clone.DownloadTo(f, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 64<<10 {
+		t.Errorf("wrong downloaded file size; got=%v, want=%v", info.Size(), 64<<10)
+	}
+
+	got := make([]byte, len(data))
+	if _, err = f.ReadAt(got, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Error("cloned volume data differs from the original")
+	}
+
+	head := make([]byte, 1024)
+	if _, err = f.ReadAt(head, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(head, make([]byte, len(head))) {
+		t.Error("the hole before the data should be downloaded as zero bytes")
+	}
+
+	if err = vol.UploadFrom(bytes.NewReader([]byte("short")), 0, 1024); err != io.ErrUnexpectedEOF {
+		t.Errorf("unexpected error on short upload; got=%v, want=%v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestStreamSparseDownload(t *testing.T) {
+	conn, _, vol := createTestVolume(t)
+	defer conn.Close()
+
+	if err := vol.UploadFromReader(context.Background(), bytes.NewReader([]byte("end")), 64<<10-3, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	str, err := conn.NewStream(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = vol.DownloadFlags(str, 0, 0, libvirt.VolDownloadSparseStream); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	if _, err = str.RecvFlags(buf, libvirt.StrRecvStopAtHole); err != libvirt.ErrStreamHole {
+		t.Fatalf("stream should start at a hole; got=%v", err)
+	}
+
+	hole, err := str.RecvHole()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hole != 64<<10-3 {
+		t.Errorf("wrong hole size; got=%v, want=%v", hole, 64<<10-3)
+	}
+
+	if err = str.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkErrorCode(t, str.Finish(), libvirt.ErrOperationInvalid)
+}
+
+func TestStreamSparseSendAll(t *testing.T) {
+	conn, _, vol := createTestVolume(t)
+	defer conn.Close()
+
+	data := []byte("data after a hole")
+	src := make([]byte, 1024+len(data))
+	copy(src[1024:], data)
+
+	inData := func(offset int64) (bool, int64, error) {
+		if offset < 1024 {
+			return false, 1024 - offset, nil
+		}
+
+		return true, int64(len(src)) - offset, nil
+	}
+
+	str, err := conn.NewStream(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = vol.UploadFlags(str, 0, uint64(len(src)), libvirt.VolUploadSparseStream); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = libvirt.SparseSendAll(str, bytes.NewReader(src), inData, int64(len(src))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = str.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err = vol.DownloadToWriter(context.Background(), &got, 0, uint64(len(src)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), src) {
+		t.Errorf("wrong volume content after a sparse upload; got=%q, want=%q", got.Bytes(), src)
+	}
+}
+
+// stalledStream is a stream whose writes block until it's aborted, like a
+// stream to an unresponsive peer.
+type stalledStream struct {
+	libvirt.StreamAPI
+	aborted chan struct{}
+	aborts  *int32
+}
+
+func (str stalledStream) Write(data []byte) (int, error) {
+	<-str.aborted
+	return 0, newError(libvirt.ErrOperationAborted, libvirt.ErrDomStreams, "stream aborted")
+}
+
+func (str stalledStream) Abort() error {
+	atomic.AddInt32(str.aborts, 1)
+
+	select {
+	case <-str.aborted:
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not open")
+	default:
+		close(str.aborted)
+		return nil
+	}
+}
+
+func TestStreamSendAllCancelStalled(t *testing.T) {
+	str := stalledStream{aborted: make(chan struct{}), aborts: new(int32)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := libvirt.SendAll(ctx, str, bytes.NewReader([]byte("data")), nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("unexpected error when sending to a stalled stream; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-str.aborted:
+	default:
+		t.Error("stalled stream was not aborted after the context was done")
+	}
+
+	if aborts := atomic.LoadInt32(str.aborts); aborts != 1 {
+		t.Errorf("wrong number of aborts on the stalled stream; got=%v, want=1", aborts)
+	}
+}
@@ -0,0 +1,628 @@
+package libvirtfake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// volumeDef is the part of the storage volume XML understood by the fake.
+type volumeDef struct {
+	Name       string       `xml:"name"`
+	Capacity   *sizeElement `xml:"capacity"`
+	Allocation *sizeElement `xml:"allocation"`
+	Target     struct {
+		Format struct {
+			Type string `xml:"type,attr"`
+		} `xml:"format"`
+	} `xml:"target"`
+}
+
+// volumeRecord is the state of a fake storage volume. Only the data up to the
+// last byte written is kept; the rest of the volume reads as zeros.
+type volumeRecord struct {
+	name       string
+	path       string
+	format     string
+	capacity   uint64
+	allocation uint64
+	data       []byte
+}
+
+// parseVolume creates a storage volume record, in the pool "pool", from its
+// XML description.
+func parseVolume(doc string, pool *poolRecord) (*volumeRecord, error) {
+	var def volumeDef
+	if err := parseXML(doc, &def, libvirt.ErrDomStorage); err != nil {
+		return nil, err
+	}
+
+	if def.Name == "" {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "missing volume name element")
+	}
+
+	if def.Capacity == nil {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "missing capacity element")
+	}
+
+	capacity, err := def.Capacity.bytes("bytes")
+	if err != nil {
+		return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "invalid capacity: %v", err)
+	}
+
+	allocation := capacity
+	if def.Allocation != nil {
+		if allocation, err = def.Allocation.bytes("bytes"); err != nil {
+			return nil, newError(libvirt.ErrXMLDetail, libvirt.ErrDomStorage, "invalid allocation: %v", err)
+		}
+	}
+
+	format := def.Target.Format.Type
+	if format == "" {
+		format = "raw"
+	}
+
+	return &volumeRecord{
+		name:       def.Name,
+		path:       pool.path + "/" + def.Name,
+		format:     format,
+		capacity:   capacity,
+		allocation: allocation,
+	}, nil
+}
+
+// xml renders the XML description of the storage volume.
+func (vol *volumeRecord) xml() string {
+	var b strings.Builder
+
+	b.WriteString("<volume type='file'>\n")
+	fmt.Fprintf(&b, "  <name>%v</name>\n", escape(vol.name))
+	fmt.Fprintf(&b, "  <key>%v</key>\n", escape(vol.path))
+	fmt.Fprintf(&b, "  <capacity unit='bytes'>%v</capacity>\n", vol.capacity)
+	fmt.Fprintf(&b, "  <allocation unit='bytes'>%v</allocation>\n", vol.allocation)
+	b.WriteString("  <target>\n")
+	fmt.Fprintf(&b, "    <path>%v</path>\n", escape(vol.path))
+	fmt.Fprintf(&b, "    <format type='%v'/>\n", escape(vol.format))
+	b.WriteString("  </target>\n")
+	b.WriteString("</volume>\n")
+
+	return b.String()
+}
+
+// write stores "data" at "offset" in the volume.
+func (vol *volumeRecord) write(data []byte, offset uint64) error {
+	end := offset + uint64(len(data))
+	if end > vol.capacity {
+		return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "can't write %v bytes at offset %v into a volume of %v bytes", len(data), offset, vol.capacity)
+	}
+
+	if end > uint64(len(vol.data)) {
+		vol.data = append(vol.data, make([]byte, end-uint64(len(vol.data)))...)
+	}
+	copy(vol.data[offset:], data)
+
+	if vol.allocation < end {
+		vol.allocation = end
+	}
+
+	return nil
+}
+
+// span checks the range starting at "offset" with "length" bytes (or up to the
+// end of the volume, if zero) and returns its end.
+func (vol *volumeRecord) span(offset uint64, length uint64) (uint64, error) {
+	if offset > vol.capacity {
+		return 0, newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "offset %v is beyond the volume capacity %v", offset, vol.capacity)
+	}
+
+	if length == 0 || offset+length > vol.capacity {
+		return vol.capacity, nil
+	}
+
+	return offset + length, nil
+}
+
+// findVolume returns the volume named "name".
+func (rec *poolRecord) findVolume(name string) *volumeRecord {
+	for _, vol := range rec.volumes {
+		if vol.name == name {
+			return vol
+		}
+	}
+
+	return nil
+}
+
+// addVolume checks whether a new volume fits into the pool and adds it.
+func (rec *poolRecord) addVolume(vol *volumeRecord) error {
+	if rec.findVolume(vol.name) != nil {
+		return newError(libvirt.ErrStorageVolExist, libvirt.ErrDomStorage, "storage volume '%v' exists already", vol.name)
+	}
+
+	if vol.allocation > rec.capacity-rec.allocation() {
+		return newError(libvirt.ErrOperationFailed, libvirt.ErrDomStorage, "not enough space in storage pool '%v' for volume '%v'", rec.name, vol.name)
+	}
+
+	rec.volumes = append(rec.volumes, vol)
+
+	return nil
+}
+
+// ListStorageVolumes returns the volumes of a running storage pool.
+func (pool StoragePool) ListStorageVolumes() (vols []libvirt.StorageVolumeAPI, err error) {
+	err = pool.withActivePool(func(rec *poolRecord) error {
+		vols = make([]libvirt.StorageVolumeAPI, len(rec.volumes))
+		for i, vol := range rec.volumes {
+			vols[i] = StorageVolume{pool.conn, vol.path}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// CreateStorageVolume creates a new, zeroed volume in a running storage pool.
+func (pool StoragePool) CreateStorageVolume(xml string, flags libvirt.StorageVolumeCreateFlag) (vol libvirt.StorageVolumeAPI, err error) {
+	err = pool.withActivePool(func(rec *poolRecord) error {
+		v, err := parseVolume(xml, rec)
+		if err != nil {
+			return err
+		}
+
+		if err := rec.addVolume(v); err != nil {
+			return err
+		}
+
+		vol = StorageVolume{pool.conn, v.path}
+		return nil
+	})
+
+	return
+}
+
+// CreateStorageVolumeFrom creates a new volume in a running storage pool with
+// the same contents as "cloneVol", which must have been created by the same
+// fake connection.
+func (pool StoragePool) CreateStorageVolumeFrom(xml string, cloneVol libvirt.StorageVolumeAPI, flags libvirt.StorageVolumeCreateFlag) (vol libvirt.StorageVolumeAPI, err error) {
+	source, ok := cloneVol.(StorageVolume)
+	if !ok || source.conn.hv != pool.conn.hv {
+		return nil, libvirt.ErrForeignObject
+	}
+
+	err = pool.withActivePool(func(rec *poolRecord) error {
+		_, src, err := pool.conn.hv.findVolume(source.key)
+		if err != nil {
+			return err
+		}
+
+		v, err := parseVolume(xml, rec)
+		if err != nil {
+			return err
+		}
+
+		if uint64(len(src.data)) > v.capacity {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "volume '%v' is smaller than the data of '%v'", v.name, src.name)
+		}
+
+		v.data = append([]byte(nil), src.data...)
+		if err := rec.addVolume(v); err != nil {
+			return err
+		}
+
+		vol = StorageVolume{pool.conn, v.path}
+		return nil
+	})
+
+	return
+}
+
+// LookupStorageVolumeByName returns the volume named "name" of a running
+// storage pool.
+func (pool StoragePool) LookupStorageVolumeByName(name string) (vol libvirt.StorageVolumeAPI, err error) {
+	err = pool.withActivePool(func(rec *poolRecord) error {
+		v := rec.findVolume(name)
+		if v == nil {
+			return newError(libvirt.ErrNoStorageVol, libvirt.ErrDomStorage, "Storage volume not found: no storage vol with matching name '%v'", name)
+		}
+
+		vol = StorageVolume{pool.conn, v.path}
+		return nil
+	})
+
+	return
+}
+
+// findVolume returns the volume whose key is "key" and its pool, which must
+// be running. The hypervisor must be locked.
+func (hv *Hypervisor) findVolume(key string) (*poolRecord, *volumeRecord, error) {
+	for _, pool := range hv.pools {
+		if !pool.isActive() {
+			continue
+		}
+
+		for _, vol := range pool.volumes {
+			if vol.path == key {
+				return pool, vol, nil
+			}
+		}
+	}
+
+	return nil, nil, newError(libvirt.ErrNoStorageVol, libvirt.ErrDomStorage, "Storage volume not found: no storage vol with matching key %v", key)
+}
+
+// LookupStorageVolumeByPath looks up a volume of a running storage pool by its
+// path.
+func (conn *Connection) LookupStorageVolumeByPath(path string) (libvirt.StorageVolumeAPI, error) {
+	if err := conn.lock(); err != nil {
+		return nil, err
+	}
+	defer conn.hv.mu.Unlock()
+
+	if _, _, err := conn.hv.findVolume(path); err != nil {
+		return nil, err
+	}
+
+	return StorageVolume{conn, path}, nil
+}
+
+// LookupStorageVolumeByKey looks up a volume of a running storage pool by its
+// key. Volume keys are the same as their paths.
+func (conn *Connection) LookupStorageVolumeByKey(key string) (libvirt.StorageVolumeAPI, error) {
+	return conn.LookupStorageVolumeByPath(key)
+}
+
+// StorageVolume is a fake libvirt storage volume. It implements
+// libvirt.StorageVolumeAPI.
+type StorageVolume struct {
+	conn *Connection
+	key  string
+}
+
+// withVolume runs "fn" with the storage pool and volume records while the
+// state is locked.
+func (vol StorageVolume) withVolume(fn func(pool *poolRecord, rec *volumeRecord) error) error {
+	if err := vol.conn.lock(); err != nil {
+		return err
+	}
+	defer vol.conn.hv.mu.Unlock()
+
+	pool, rec, err := vol.conn.hv.findVolume(vol.key)
+	if err != nil {
+		return err
+	}
+
+	return fn(pool, rec)
+}
+
+// Free does nothing; it exists to implement the interface.
+func (vol StorageVolume) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (vol StorageVolume) Ref() error {
+	return nil
+}
+
+// Delete removes the volume from its storage pool.
+func (vol StorageVolume) Delete() error {
+	return vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		for i, v := range pool.volumes {
+			if v == rec {
+				pool.volumes = append(pool.volumes[:i], pool.volumes[i+1:]...)
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// Key returns the key of the volume, which is the same as its path.
+func (vol StorageVolume) Key() (string, error) {
+	err := vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return vol.key, nil
+}
+
+// Name returns the name of the volume.
+func (vol StorageVolume) Name() (name string, err error) {
+	err = vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		name = rec.name
+		return nil
+	})
+
+	return
+}
+
+// Path returns the path of the volume.
+func (vol StorageVolume) Path() (string, error) {
+	return vol.Key()
+}
+
+// XML returns the XML description of the volume.
+func (vol StorageVolume) XML() (doc string, err error) {
+	err = vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		doc = rec.xml()
+		return nil
+	})
+
+	return
+}
+
+// InfoType always returns VolTypeFile.
+func (vol StorageVolume) InfoType() (libvirt.StorageVolumeType, error) {
+	if _, err := vol.Key(); err != nil {
+		return 0, err
+	}
+
+	return libvirt.VolTypeFile, nil
+}
+
+// InfoCapacity returns the capacity of the volume, in bytes.
+func (vol StorageVolume) InfoCapacity() (capacity uint64, err error) {
+	err = vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		capacity = rec.capacity
+		return nil
+	})
+
+	return
+}
+
+// InfoAllocation returns the space used by the volume, in bytes.
+func (vol StorageVolume) InfoAllocation() (allocation uint64, err error) {
+	err = vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		allocation = rec.allocation
+		return nil
+	})
+
+	return
+}
+
+// Resize changes the capacity of the volume. Shrinking requires
+// VolResizeShrink and discards the data beyond the new capacity.
+func (vol StorageVolume) Resize(capacity uint64, flags libvirt.StorageVolumeResizeFlag) error {
+	return vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		if flags&libvirt.VolResizeDelta != 0 {
+			if flags&libvirt.VolResizeShrink != 0 {
+				if capacity > rec.capacity {
+					return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "can't shrink capacity below zero")
+				}
+
+				capacity = rec.capacity - capacity
+			} else {
+				capacity += rec.capacity
+			}
+		}
+
+		if capacity < rec.capacity && flags&libvirt.VolResizeShrink == 0 {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "Can't shrink capacity below current capacity unless shrink flag explicitly specified")
+		}
+
+		if capacity > rec.capacity && capacity-rec.capacity > pool.capacity-pool.allocation() {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "Not enough space left in storage pool")
+		}
+
+		rec.capacity = capacity
+		if uint64(len(rec.data)) > capacity {
+			rec.data = rec.data[:capacity]
+		}
+		if rec.allocation > capacity || flags&libvirt.VolResizeAllocate != 0 {
+			rec.allocation = capacity
+		}
+
+		return nil
+	})
+}
+
+// Wipe clears the contents of the volume, whatever the algorithm.
+func (vol StorageVolume) Wipe(alg libvirt.StorageVolumeWipeAlgorithm) error {
+	return vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		rec.data = nil
+		return nil
+	})
+}
+
+// StoragePool returns the storage pool which contains the volume.
+func (vol StorageVolume) StoragePool() (p libvirt.StoragePoolAPI, err error) {
+	err = vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		p = StoragePool{vol.conn, pool.uuid}
+		return nil
+	})
+
+	return
+}
+
+// Upload prepares "str", a stream created by the same fake connection, to
+// receive data to be written to the volume at "offset". The data is only
+// written when the stream is finished.
+func (vol StorageVolume) Upload(str libvirt.StreamAPI, offset uint64, length uint64) error {
+	return vol.UploadFlags(str, offset, length, libvirt.VolUploadDefault)
+}
+
+// UploadFlags is Upload, but it also accepts sparse streams.
+func (vol StorageVolume) UploadFlags(str libvirt.StreamAPI, offset uint64, length uint64, flags libvirt.StorageVolumeUploadFlag) error {
+	s, ok := str.(Stream)
+	if !ok {
+		return libvirt.ErrForeignObject
+	}
+
+	var end uint64
+	err := vol.withVolume(func(pool *poolRecord, rec *volumeRecord) (err error) {
+		end, err = rec.span(offset, length)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.startUpload(flags&libvirt.VolUploadSparseStream != 0, func(data []byte) error {
+		if uint64(len(data)) > end-offset {
+			return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStorage, "%v bytes were sent but only %v were expected", len(data), end-offset)
+		}
+
+		return vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+			return rec.write(data, offset)
+		})
+	})
+}
+
+// Download prepares "str", a stream created by the same fake connection, to
+// send the contents of the volume starting at "offset".
+func (vol StorageVolume) Download(str libvirt.StreamAPI, offset uint64, length uint64) error {
+	return vol.DownloadFlags(str, offset, length, libvirt.VolDownloadDefault)
+}
+
+// DownloadFlags is Download, but it also accepts sparse streams.
+func (vol StorageVolume) DownloadFlags(str libvirt.StreamAPI, offset uint64, length uint64, flags libvirt.StorageVolumeDownloadFlag) error {
+	s, ok := str.(Stream)
+	if !ok {
+		return libvirt.ErrForeignObject
+	}
+
+	var data []byte
+	var trailing int64
+	err := vol.withVolume(func(pool *poolRecord, rec *volumeRecord) error {
+		end, err := rec.span(offset, length)
+		if err != nil {
+			return err
+		}
+
+		stored := uint64(len(rec.data))
+		if offset < stored {
+			dataEnd := end
+			if dataEnd > stored {
+				dataEnd = stored
+			}
+
+			data = append([]byte(nil), rec.data[offset:dataEnd]...)
+		}
+		trailing = int64(end-offset) - int64(len(data))
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.startDownload(data, trailing, flags&libvirt.VolDownloadSparseStream != 0)
+}
+
+// newStream creates a stream and prepares it for a transfer with "start".
+func (vol StorageVolume) newStream(start func(str libvirt.StreamAPI) error) (libvirt.StreamAPI, error) {
+	str, err := vol.conn.NewStream(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = start(str); err != nil {
+		return nil, err
+	}
+
+	return str, nil
+}
+
+// DownloadTo downloads the contents of the volume into "w", skipping holes.
+// As in libvirt, "w" is truncated first if it supports it.
+func (vol StorageVolume) DownloadTo(w io.WriterAt, offset uint64, length uint64) error {
+	t, truncate := w.(interface {
+		Truncate(int64) error
+	})
+	if truncate {
+		if err := t.Truncate(0); err != nil {
+			return err
+		}
+	}
+
+	str, err := vol.newStream(func(str libvirt.StreamAPI) error {
+		return vol.DownloadFlags(str, offset, length, libvirt.VolDownloadSparseStream)
+	})
+	if err != nil {
+		return err
+	}
+
+	pos, err := libvirt.SparseRecvAll(str, w)
+	if err != nil {
+		return err
+	}
+
+	if err = str.Finish(); err != nil {
+		return err
+	}
+
+	if truncate {
+		return t.Truncate(pos)
+	}
+
+	return nil
+}
+
+// UploadFrom uploads the contents of "r" to the volume at "offset". Holes in
+// local files aren't detected by the fake; they're uploaded as zero bytes.
+// Like the real implementation, io.ErrUnexpectedEOF is returned, and nothing
+// is written, if "r" is shorter than a non-zero "length".
+func (vol StorageVolume) UploadFrom(r io.ReaderAt, offset uint64, length uint64) error {
+	str, err := vol.newStream(func(str libvirt.StreamAPI) error {
+		return vol.Upload(str, offset, length)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = libvirt.SparseSendAll(str, r, nil, int64(length)); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
+
+// UploadFromReader uploads the contents of "r" to the volume at "offset". The
+// upload is aborted, and nothing is written, if the context is cancelled.
+func (vol StorageVolume) UploadFromReader(ctx context.Context, r io.Reader, offset uint64, length uint64, progress libvirt.TransferProgressFunc) error {
+	str, err := vol.newStream(func(str libvirt.StreamAPI) error {
+		return vol.Upload(str, offset, length)
+	})
+	if err != nil {
+		return err
+	}
+
+	if length > 0 {
+		r = io.LimitReader(r, int64(length))
+	}
+
+	if err = libvirt.SendAll(ctx, str, r, progress); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
+
+// DownloadToWriter downloads the contents of the volume, starting at
+// "offset", and writes it to "w". The download stops if the context is
+// cancelled.
+func (vol StorageVolume) DownloadToWriter(ctx context.Context, w io.Writer, offset uint64, length uint64, progress libvirt.TransferProgressFunc) error {
+	str, err := vol.newStream(func(str libvirt.StreamAPI) error {
+		return vol.Download(str, offset, length)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = libvirt.RecvAll(ctx, str, w, progress); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
+
+// Compile-time check that StorageVolume implements the interface.
+var _ libvirt.StorageVolumeAPI = StorageVolume{}
@@ -0,0 +1,424 @@
+package libvirtfake
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// holeGranularity is the minimum length of a run of zero bytes to be sent as
+// a hole on sparse downloads.
+const holeGranularity = 4096
+
+// streamMode tells whether a stream is being used to upload or download data.
+type streamMode int
+
+const (
+	streamIdle streamMode = iota
+	streamUpload
+	streamDownload
+)
+
+// segment is a piece of data transferred over a sparse stream: either data
+// bytes or a hole.
+type segment struct {
+	data []byte
+	hole int64
+}
+
+// streamState is the state shared by all copies of a Stream.
+type streamState struct {
+	mu       sync.Mutex
+	flags    libvirt.StreamFlag
+	mode     streamMode
+	sparse   bool
+	segments []segment
+	upload   []byte
+	commit   func(data []byte) error
+	done     bool
+	callback libvirt.StreamAPIEventCallback
+	events   libvirt.StreamEventType
+}
+
+// Stream is a fake libvirt stream. It implements libvirt.StreamAPI.
+type Stream struct {
+	state *streamState
+}
+
+// newStream creates an idle stream.
+func newStream(flags libvirt.StreamFlag) Stream {
+	return Stream{&streamState{flags: flags}}
+}
+
+// startDownload prepares the stream to send "data" followed by "trailing" zero
+// bytes to the reader. Runs of zero bytes are reported as holes if "sparse" is
+// set; otherwise they're received as regular data.
+func (str Stream) startDownload(data []byte, trailing int64, sparse bool) error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.mode != streamIdle || st.done {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is already in use")
+	}
+
+	st.mode = streamDownload
+	st.sparse = sparse
+	st.segments = splitHoles(data)
+	if trailing > 0 {
+		st.segments = append(st.segments, segment{hole: trailing})
+	}
+
+	return nil
+}
+
+// startUpload prepares the stream to receive data, which is handed to
+// "commit" when the stream is finished.
+func (str Stream) startUpload(sparse bool, commit func(data []byte) error) error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.mode != streamIdle || st.done {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is already in use")
+	}
+
+	st.mode = streamUpload
+	st.sparse = sparse
+	st.commit = commit
+
+	return nil
+}
+
+// splitHoles splits "data" into data segments and holes.
+func splitHoles(data []byte) []segment {
+	var segments []segment
+
+	start := 0
+	for i := 0; i < len(data); {
+		end := i + holeGranularity
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if isZero(data[i:end]) && end-i == holeGranularity {
+			if i > start {
+				segments = append(segments, segment{data: data[start:i]})
+			}
+
+			hole := i
+			for i < len(data) && data[i] == 0 {
+				i++
+			}
+
+			segments = append(segments, segment{hole: int64(i - hole)})
+			start = i
+			continue
+		}
+
+		i = end
+	}
+
+	if start < len(data) {
+		segments = append(segments, segment{data: data[start:]})
+	}
+
+	return segments
+}
+
+// isZero returns whether all bytes of "data" are zero.
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check returns an error if the stream can't transfer data in "mode". The
+// stream must be locked.
+func (st *streamState) check(mode streamMode) error {
+	if st.done {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not open")
+	}
+
+	if st.mode != mode {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not open for this operation")
+	}
+
+	return nil
+}
+
+// Free does nothing; it exists to implement the interface.
+func (str Stream) Free() error {
+	return nil
+}
+
+// Ref does nothing; it exists to implement the interface.
+func (str Stream) Ref() error {
+	return nil
+}
+
+// Abort closes the stream, discarding any uploaded data.
+func (str Stream) Abort() error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.done {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not open")
+	}
+
+	st.done = true
+	st.segments, st.upload, st.commit = nil, nil, nil
+
+	return nil
+}
+
+// Finish closes the stream. Uploaded data is written to its destination only
+// now.
+func (str Stream) Finish() error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.done {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not open")
+	}
+
+	st.done = true
+
+	if st.mode == streamUpload && st.commit != nil {
+		return st.commit(st.upload)
+	}
+
+	return nil
+}
+
+// Write sends "data" to an upload stream.
+func (str Stream) Write(data []byte) (int, error) {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.check(streamUpload); err != nil {
+		return 0, err
+	}
+
+	st.upload = append(st.upload, data...)
+
+	return len(data), nil
+}
+
+// WriteContext is like Write, but aborts the stream and returns ctx.Err() if
+// the context is already done. Fake streams never block.
+func (str Stream) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		str.Abort()
+		return 0, err
+	}
+
+	return str.Write(data)
+}
+
+// SendHole sends a hole of "length" bytes to a sparse upload stream.
+func (str Stream) SendHole(length int64) error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.check(streamUpload); err != nil {
+		return err
+	}
+
+	if !st.sparse {
+		return newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not sparse")
+	}
+
+	if length < 0 {
+		return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStreams, "hole length must be positive")
+	}
+
+	st.upload = append(st.upload, make([]byte, length)...)
+
+	return nil
+}
+
+// Read receives data from a download stream. Holes are received as zero
+// bytes.
+func (str Stream) Read(data []byte) (int, error) {
+	return str.recv(data, false)
+}
+
+// ReadContext is like Read, but aborts the stream and returns ctx.Err() if the
+// context is already done. Fake streams never block.
+func (str Stream) ReadContext(ctx context.Context, data []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		str.Abort()
+		return 0, err
+	}
+
+	return str.Read(data)
+}
+
+// RecvFlags receives data from a download stream. If "flags" contains
+// StrRecvStopAtHole, libvirt.ErrStreamHole is returned when the stream is
+// positioned at a hole.
+func (str Stream) RecvFlags(data []byte, flags libvirt.StreamRecvFlag) (int, error) {
+	return str.recv(data, flags&libvirt.StrRecvStopAtHole != 0)
+}
+
+func (str Stream) recv(data []byte, stopAtHole bool) (int, error) {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.check(streamDownload); err != nil {
+		return 0, err
+	}
+
+	if len(st.segments) == 0 {
+		if len(data) > 0 {
+			return 0, io.EOF
+		}
+
+		return 0, nil
+	}
+
+	seg := &st.segments[0]
+	if seg.data == nil {
+		if stopAtHole && st.sparse {
+			return 0, libvirt.ErrStreamHole
+		}
+
+		n := int64(len(data))
+		if n > seg.hole {
+			n = seg.hole
+		}
+
+		for i := range data[:n] {
+			data[i] = 0
+		}
+
+		seg.hole -= n
+		if seg.hole == 0 {
+			st.segments = st.segments[1:]
+		}
+
+		return int(n), nil
+	}
+
+	n := copy(data, seg.data)
+	seg.data = seg.data[n:]
+	if len(seg.data) == 0 {
+		st.segments = st.segments[1:]
+	}
+
+	return n, nil
+}
+
+// RecvHole returns the size of the hole the download stream is positioned at.
+func (str Stream) RecvHole() (int64, error) {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.check(streamDownload); err != nil {
+		return 0, err
+	}
+
+	if !st.sparse || len(st.segments) == 0 || st.segments[0].data != nil {
+		return 0, newError(libvirt.ErrOperationInvalid, libvirt.ErrDomStreams, "stream is not positioned at a hole")
+	}
+
+	hole := st.segments[0].hole
+	st.segments = st.segments[1:]
+
+	return hole, nil
+}
+
+// AddEventCallback registers "callback" to be called when one of "events"
+// happens. As the fake stream never blocks, the stream is always readable or
+// writable and the callback is called right away, on another goroutine.
+func (str Stream) AddEventCallback(events libvirt.StreamEventType, callback libvirt.StreamAPIEventCallback) error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.flags&libvirt.StrNonBlock == 0 {
+		return newError(libvirt.ErrInvalidArg, libvirt.ErrDomStreams, "stream is not non-blocking")
+	}
+
+	if st.callback != nil {
+		return newError(libvirt.ErrInternal, libvirt.ErrDomStreams, "multiple stream callbacks not supported")
+	}
+
+	st.callback = callback
+	st.events = events
+	str.notify()
+
+	return nil
+}
+
+// UpdateEventCallback changes the events the callback is interested in.
+func (str Stream) UpdateEventCallback(events libvirt.StreamEventType) error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.callback == nil {
+		return newError(libvirt.ErrInternal, libvirt.ErrDomStreams, "no stream callback registered")
+	}
+
+	st.events = events
+	str.notify()
+
+	return nil
+}
+
+// RemoveEventCallback unregisters the stream callback.
+func (str Stream) RemoveEventCallback() error {
+	st := str.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.callback == nil {
+		return newError(libvirt.ErrInternal, libvirt.ErrDomStreams, "no stream callback registered")
+	}
+
+	st.callback = nil
+	st.events = 0
+
+	return nil
+}
+
+// notify calls the event callback, asynchronously, with the events which
+// are currently pending. The stream must be locked.
+func (str Stream) notify() {
+	st := str.state
+
+	var pending libvirt.StreamEventType
+	switch {
+	case st.done:
+		pending = libvirt.StrEventHangup
+	case st.mode == streamUpload:
+		pending = libvirt.StrEventWritable
+	case st.mode == streamDownload:
+		pending = libvirt.StrEventReadable
+	}
+
+	pending &= st.events
+	if pending == 0 {
+		return
+	}
+
+	callback := st.callback
+	go callback(str, pending)
+}
+
+// Compile-time check that Stream implements the interface.
+var _ libvirt.StreamAPI = Stream{}
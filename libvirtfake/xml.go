@@ -0,0 +1,73 @@
+package libvirtfake
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/cd1/libvirt-golang"
+)
+
+// sizeElement is an XML element holding a size with an optional unit, such as
+// <memory unit='MiB'>512</memory>.
+type sizeElement struct {
+	Value uint64 `xml:",chardata"`
+	Unit  string `xml:"unit,attr"`
+}
+
+// bytes converts the size to bytes; "defaultUnit" is used when the element
+// has no unit.
+func (s *sizeElement) bytes(defaultUnit string) (uint64, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	unit := s.Unit
+	if unit == "" {
+		unit = defaultUnit
+	}
+
+	var scale uint64
+	switch strings.ToLower(unit) {
+	case "b", "bytes":
+		scale = 1
+	case "kb":
+		scale = 1000
+	case "k", "kib":
+		scale = 1 << 10
+	case "mb":
+		scale = 1000 * 1000
+	case "m", "mib":
+		scale = 1 << 20
+	case "gb":
+		scale = 1000 * 1000 * 1000
+	case "g", "gib":
+		scale = 1 << 30
+	case "tb":
+		scale = 1000 * 1000 * 1000 * 1000
+	case "t", "tib":
+		scale = 1 << 40
+	default:
+		return 0, fmt.Errorf("unknown size unit '%v'", unit)
+	}
+
+	return s.Value * scale, nil
+}
+
+// parseXML decodes "doc" into "v", reporting failures as libvirt XML errors.
+func parseXML(doc string, v interface{}, domain libvirt.ErrorDomain) error {
+	if err := xml.Unmarshal([]byte(doc), v); err != nil {
+		return newError(libvirt.ErrXMLDetail, domain, "XML error: %v", err)
+	}
+
+	return nil
+}
+
+// escape escapes "s" to be used as XML text or attribute value.
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+
+	return buf.String()
+}
@@ -0,0 +1,332 @@
+package libvirt
+
+// #include <libvirt/libvirt.h>
+import "C"
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Levels of the records emitted by this package: every call to libvirt is
+// logged at slog.LevelDebug, opening and closing connections is logged at
+// slog.LevelInfo and failed calls are logged at slog.LevelError.
+const (
+	levelCall      = slog.LevelDebug
+	levelLifecycle = slog.LevelInfo
+	levelFailure   = slog.LevelError
+)
+
+// logger emits the structured log records of a connection and of the
+// objects created from it. The zero value discards every record.
+type logger struct {
+	// base is the logger of the connection, without object attributes.
+	base *slog.Logger
+	// slog is the logger used to emit the records.
+	slog *slog.Logger
+	// level is the minimum level of the records emitted, in addition to
+	// the one configured in the handler. It's ignored if nil.
+	level slog.Leveler
+	// attrs identify the object of the logger, if any, in every record.
+	attrs *objectAttrs
+}
+
+// objectAttrs are the attributes which identify an object (e.g. its name) in
+// the records. Reading them requires calls to libvirt, so they're only read
+// the first time a record of the object is emitted: with the default level,
+// most objects never log anything.
+type objectAttrs struct {
+	once  sync.Once
+	read  func() []any
+	attrs []any
+}
+
+// get returns the attributes, reading them if needed.
+func (o *objectAttrs) get() []any {
+	if o == nil {
+		return nil
+	}
+
+	o.once.Do(func() {
+		o.attrs = o.read()
+		o.read = nil
+	})
+
+	return o.attrs
+}
+
+// discardHandler is a slog.Handler which doesn't handle any record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// newLogger creates a logger object to be used across a libvirt
+// connection. The records are written as text to "output"; if it is
+// io.Discard, they are not even formatted.
+func newLogger(output io.Writer) *slog.Logger {
+	if output == io.Discard {
+		return slog.New(discardHandler{})
+	}
+
+	return slog.New(slog.NewTextHandler(output, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+}
+
+// newConnectionLogger creates the logger of a connection to "uri". It
+// discards every record if "sl" is nil.
+func newConnectionLogger(sl *slog.Logger, level slog.Leveler, uri string) *logger {
+	if sl == nil {
+		sl = slog.New(discardHandler{})
+	}
+
+	sl = sl.With("uri", uri)
+
+	return &logger{
+		base:  sl,
+		slog:  sl,
+		level: level,
+	}
+}
+
+// enabled reports whether records with "level" will be emitted.
+func (l *logger) enabled(level slog.Level) bool {
+	if l == nil || l.slog == nil {
+		return false
+	}
+
+	if l.level != nil && level < l.level.Level() {
+		return false
+	}
+
+	return l.slog.Enabled(context.Background(), level)
+}
+
+// with returns a logger which includes the attributes "args" (alternating
+// keys and values, as in slog.Logger.With) in every record. The attributes
+// are only evaluated if some record may be emitted.
+func (l *logger) with(args ...any) *logger {
+	if !l.enabled(levelFailure) {
+		return l
+	}
+
+	return &logger{
+		base:  l.base,
+		slog:  l.slog.With(args...),
+		level: l.level,
+		attrs: l.attrs,
+	}
+}
+
+// object returns a logger for an object of type "typ" created from the
+// connection of "l"; the connection attributes are kept, but not the ones
+// from the object which created it. The attributes which identify the object
+// are returned by "read", which is only called when a record is emitted, and
+// at most once; it must be called while the object is still valid.
+func (l *logger) object(typ string, read func() []any) *logger {
+	if !l.enabled(levelFailure) {
+		return l
+	}
+
+	var attrs *objectAttrs
+	if read != nil {
+		attrs = &objectAttrs{read: read}
+	}
+
+	return &logger{
+		base:  l.base,
+		slog:  l.base.With("object", typ),
+		level: l.level,
+		attrs: attrs,
+	}
+}
+
+// log emits a record with the message "msg" and the attributes "args"
+// (alternating keys and values, as in slog.Logger.Log).
+func (l *logger) log(level slog.Level, msg string, args ...any) {
+	if !l.enabled(level) {
+		return
+	}
+
+	if attrs := l.attrs.get(); len(attrs) > 0 {
+		args = append(append([]any(nil), attrs...), args...)
+	}
+
+	l.slog.Log(context.Background(), level, msg, args...)
+}
+
+// debug logs a call to libvirt, or something related to it.
+func (l *logger) debug(msg string, args ...any) {
+	l.log(levelCall, msg, args...)
+}
+
+// failed logs an error returned by libvirt.
+func (l *logger) failed(err error, args ...any) {
+	if l.enabled(levelFailure) {
+		l.log(levelFailure, "an error occurred", append(errorAttrs(err), args...)...)
+	}
+}
+
+// begin logs the start of an operation and returns the object used to log
+// its progress, which includes how long the operation has been running. The
+// attributes "args" (e.g. the flags of the call) are included in every record
+// of the operation, so the message should be constant.
+func (l *logger) begin(msg string, args ...any) operation {
+	if len(args) > 0 {
+		l = l.with(args...)
+	}
+
+	l.debug(msg)
+
+	return operation{
+		log:   l,
+		start: time.Now(),
+	}
+}
+
+// errorAttrs returns the attributes describing "err".
+func errorAttrs(err error) []any {
+	args := []any{"error", err.Error()}
+
+	var virErr *Error
+	if errors.As(err, &virErr) {
+		args = append(args, "error_code", virErr.Code.String(), "error_domain", virErr.Domain.String())
+	}
+
+	return args
+}
+
+// operation logs the progress of a single call to libvirt, started by
+// "<logger>.begin".
+type operation struct {
+	log   *logger
+	start time.Time
+}
+
+// done logs the progress or the result of the operation, described by the
+// attributes "args".
+func (op operation) done(msg string, args ...any) {
+	if op.log.enabled(levelCall) {
+		op.log.log(levelCall, msg, append(args, "duration", time.Since(op.start))...)
+	}
+}
+
+// lifecycle logs the completion of an operation which changes the lifecycle
+// of the connection.
+func (op operation) lifecycle(msg string, args ...any) {
+	if op.log.enabled(levelLifecycle) {
+		op.log.log(levelLifecycle, msg, append(args, "duration", time.Since(op.start))...)
+	}
+}
+
+// failed logs an error returned by libvirt during the operation.
+func (op operation) failed(err error) {
+	op.log.failed(err, "duration", time.Since(op.start))
+}
+
+// uuidString converts an UUID returned by libvirt into a Go string.
+func uuidString(cUUID []C.char) string {
+	return C.GoString((*C.char)(unsafe.Pointer(&cUUID[0])))
+}
+
+// connection returns the logger of the connection of "l", without the
+// attributes of the object it was created from.
+func (l *logger) connection() *logger {
+	if !l.enabled(levelFailure) {
+		return l
+	}
+
+	return &logger{
+		base:  l.base,
+		slog:  l.base,
+		level: l.level,
+	}
+}
+
+// appendString appends the attribute "key" to "attrs" if "cStr", returned by
+// libvirt, is not NULL.
+func appendString(attrs []any, key string, cStr *C.char) []any {
+	if cStr == nil {
+		return attrs
+	}
+
+	return append(attrs, key, C.GoString(cStr))
+}
+
+// domain returns the logger of the domain "cDom".
+func (l *logger) domain(cDom C.virDomainPtr) *logger {
+	return l.object(kindDomain.String(), func() []any {
+		attrs := appendString(nil, "name", C.virDomainGetName(cDom))
+
+		cUUID := make([]C.char, C.VIR_UUID_STRING_BUFLEN)
+		if C.virDomainGetUUIDString(cDom, &cUUID[0]) == 0 {
+			attrs = append(attrs, "uuid", uuidString(cUUID))
+		}
+
+		return attrs
+	})
+}
+
+// storagePool returns the logger of the storage pool "cPool".
+func (l *logger) storagePool(cPool C.virStoragePoolPtr) *logger {
+	return l.object(kindStoragePool.String(), func() []any {
+		attrs := appendString(nil, "name", C.virStoragePoolGetName(cPool))
+
+		cUUID := make([]C.char, C.VIR_UUID_STRING_BUFLEN)
+		if C.virStoragePoolGetUUIDString(cPool, &cUUID[0]) == 0 {
+			attrs = append(attrs, "uuid", uuidString(cUUID))
+		}
+
+		return attrs
+	})
+}
+
+// storageVolume returns the logger of the storage volume "cVol".
+func (l *logger) storageVolume(cVol C.virStorageVolPtr) *logger {
+	return l.object(kindStorageVolume.String(), func() []any {
+		attrs := appendString(nil, "name", C.virStorageVolGetName(cVol))
+		return appendString(attrs, "key", C.virStorageVolGetKey(cVol))
+	})
+}
+
+// secret returns the logger of the secret "cSec".
+func (l *logger) secret(cSec C.virSecretPtr) *logger {
+	return l.object(kindSecret.String(), func() []any {
+		var attrs []any
+
+		cUUID := make([]C.char, C.VIR_UUID_STRING_BUFLEN)
+		if C.virSecretGetUUIDString(cSec, &cUUID[0]) == 0 {
+			attrs = append(attrs, "uuid", uuidString(cUUID))
+		}
+
+		return appendString(attrs, "usage_id", C.virSecretGetUsageID(cSec))
+	})
+}
+
+// snapshot returns the logger of the snapshot "cSnap".
+func (l *logger) snapshot(cSnap C.virDomainSnapshotPtr) *logger {
+	return l.object(kindSnapshot.String(), func() []any {
+		attrs := appendString(nil, "name", C.virDomainSnapshotGetName(cSnap))
+		return appendString(attrs, "domain", C.virDomainGetName(C.virDomainSnapshotGetDomain(cSnap)))
+	})
+}
+
+// checkpoint returns the logger of the checkpoint "cCheckpoint".
+func (l *logger) checkpoint(cCheckpoint C.virDomainCheckpointPtr) *logger {
+	return l.object(kindCheckpoint.String(), func() []any {
+		attrs := appendString(nil, "name", C.virDomainCheckpointGetName(cCheckpoint))
+		return appendString(attrs, "domain", C.virDomainGetName(C.virDomainCheckpointGetDomain(cCheckpoint)))
+	})
+}
+
+// stream returns the logger of a stream.
+func (l *logger) stream() *logger {
+	return l.object(kindStream.String(), nil)
+}
@@ -0,0 +1,471 @@
+package libvirt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnectionState is the state of a ManagedConnection.
+type ConnectionState int
+
+// Possible values for ConnectionState.
+const (
+	ConnStateConnected ConnectionState = iota
+	ConnStateDisconnected
+	ConnStateClosed
+)
+
+// Default delays between the attempts to reestablish a ManagedConnection.
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// ErrNotConnected is returned by a ManagedConnection, and by the objects
+// created from it, while the connection is being reestablished.
+var ErrNotConnected = errors.New("libvirt connection is not established")
+
+// ErrManagedConnectionClosed is returned by a ManagedConnection, and by the
+// objects created from it, after it has been closed.
+var ErrManagedConnectionClosed = errors.New("managed libvirt connection is closed")
+
+// ManagedOptions holds the settings used by NewManagedConnection.
+type ManagedOptions struct {
+	// OpenOptions are used to open each connection with OpenWithOptions.
+	OpenOptions
+	// Dial opens a new connection. It replaces the call to OpenWithOptions,
+	// e.g. to use a fake connection in tests.
+	Dial func() (ConnectionAPI, error)
+	// MinBackoff is the delay before the first attempt to reestablish the
+	// connection; it doubles after each failed attempt, up to MaxBackoff.
+	// The defaults are 1 second and 1 minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// KeepAliveInterval and KeepAliveCount are passed to
+	// "<Connection>.SetKeepAlive" after each connection is opened, if the
+	// interval is positive, so a dead connection is detected even if no
+	// call is made. It requires a running event loop.
+	KeepAliveInterval time.Duration
+	KeepAliveCount    uint32
+	// OnStateChange is called whenever the state of the connection changes,
+	// with the error which caused the connection to be lost, if any. The
+	// calls are made in order from a separate goroutine.
+	OnStateChange func(state ConnectionState, err error)
+}
+
+// stateChange is a notification waiting to be delivered to OnStateChange.
+type stateChange struct {
+	state ConnectionState
+	err   error
+}
+
+// ManagedConnection is a libvirt connection which is reestablished when it's
+// lost, e.g. because the daemon was restarted. The loss is detected either by
+// the close callback of the connection or by a call which fails with a
+// connection error (see IsConnectionLost). The connection is then reopened in
+// the background, with exponential backoff; in the meantime, the calls fail
+// with ErrNotConnected.
+// The objects returned by its methods (e.g. Domain) are identified by their
+// UUID and are looked up again in the new connection on their next use.
+// A ManagedConnection is safe for concurrent use.
+type ManagedConnection struct {
+	uri  string
+	opts ManagedOptions
+	log  *logger
+
+	mu    sync.Mutex
+	conn  ConnectionAPI
+	state ConnectionState
+	stop  chan struct{}
+
+	notifyMu   sync.Mutex
+	notifyCond *sync.Cond
+	pending    []stateChange
+}
+
+// NewManagedConnection opens a connection to "uri" which is reestablished
+// automatically, as described in ManagedConnection. It fails if the first
+// connection can't be opened.
+func NewManagedConnection(uri string, opts ManagedOptions) (*ManagedConnection, error) {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = defaultMaxBackoff
+		if opts.MaxBackoff < opts.MinBackoff {
+			opts.MaxBackoff = opts.MinBackoff
+		}
+	}
+
+	mc := &ManagedConnection{
+		uri:  uri,
+		opts: opts,
+		log:  newConnectionLogger(opts.Logger, opts.Level, uri),
+		stop: make(chan struct{}),
+	}
+	mc.notifyCond = sync.NewCond(&mc.notifyMu)
+
+	conn, err := mc.open()
+	if err != nil {
+		return nil, err
+	}
+
+	mc.conn = conn
+	mc.state = ConnStateConnected
+
+	go mc.deliverNotifications()
+
+	return mc, nil
+}
+
+// open opens a new connection and sets up the detection of its loss.
+func (mc *ManagedConnection) open() (ConnectionAPI, error) {
+	var conn ConnectionAPI
+	if mc.opts.Dial != nil {
+		var err error
+		if conn, err = mc.opts.Dial(); err != nil {
+			return nil, err
+		}
+	} else {
+		c, err := OpenWithOptions(mc.uri, mc.opts.OpenOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		conn = NewConnectionAPI(c)
+	}
+
+	if mc.opts.KeepAliveInterval > 0 {
+		err := conn.SetKeepAlive(mc.opts.KeepAliveInterval, mc.opts.KeepAliveCount)
+		if err != nil && err != ErrKeepAliveNotSupported && !errors.Is(err, ErrNoSupport) {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	err := conn.RegisterCloseCallback(func(reason CloseReason) {
+		if reason != CloseReasonClient {
+			mc.lost(conn, fmt.Errorf("libvirt connection closed (reason = %v)", reason))
+		}
+	})
+	if err != nil && !errors.Is(err, ErrNoSupport) {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// State returns the current state of the connection.
+func (mc *ManagedConnection) State() ConnectionState {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.state
+}
+
+// current returns the current connection, if it's established.
+func (mc *ManagedConnection) current() (ConnectionAPI, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	switch mc.state {
+	case ConnStateConnected:
+		return mc.conn, nil
+	case ConnStateClosed:
+		return nil, ErrManagedConnectionClosed
+	default:
+		return nil, ErrNotConnected
+	}
+}
+
+// Do calls "fn" with the current connection. If "fn" fails because the
+// connection was lost, it starts to be reestablished. The connection must not
+// be used after "fn" returns.
+func (mc *ManagedConnection) Do(fn func(conn ConnectionAPI) error) error {
+	conn, err := mc.current()
+	if err != nil {
+		return err
+	}
+
+	err = fn(conn)
+	if IsConnectionLost(err) {
+		mc.lost(conn, err)
+	}
+
+	return err
+}
+
+// lost handles the loss of "conn", detected because of "err", and starts to
+// reestablish the connection. It does nothing if "conn" isn't the current
+// connection anymore.
+func (mc *ManagedConnection) lost(conn ConnectionAPI, err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.state != ConnStateConnected || mc.conn != conn {
+		return
+	}
+
+	mc.log.failed(err)
+
+	mc.conn = nil
+	mc.state = ConnStateDisconnected
+	mc.notify(ConnStateDisconnected, err)
+
+	// closing a dead connection may block until it times out
+	go conn.Close()
+	go mc.reconnect()
+}
+
+// reconnect tries to open a new connection until it succeeds or the managed
+// connection is closed.
+func (mc *ManagedConnection) reconnect() {
+	backoff := mc.opts.MinBackoff
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		mc.log.debug("reconnecting", "backoff", backoff)
+
+		select {
+		case <-mc.stop:
+			return
+		case <-timer.C:
+		}
+
+		conn, err := mc.open()
+		if err == nil {
+			mc.mu.Lock()
+			if mc.state == ConnStateClosed {
+				mc.mu.Unlock()
+				conn.Close()
+				return
+			}
+
+			mc.conn = conn
+			mc.state = ConnStateConnected
+			mc.notify(ConnStateConnected, nil)
+			mc.mu.Unlock()
+
+			mc.log.debug("connection reestablished")
+
+			return
+		}
+
+		mc.log.failed(err)
+
+		if backoff *= 2; backoff > mc.opts.MaxBackoff {
+			backoff = mc.opts.MaxBackoff
+		}
+		timer.Reset(backoff)
+	}
+}
+
+// Close closes the current connection, if it's established, and stops trying
+// to reestablish it.
+func (mc *ManagedConnection) Close() error {
+	mc.mu.Lock()
+	if mc.state == ConnStateClosed {
+		mc.mu.Unlock()
+		return ErrManagedConnectionClosed
+	}
+
+	conn := mc.conn
+	mc.conn = nil
+	mc.state = ConnStateClosed
+	close(mc.stop)
+	mc.notify(ConnStateClosed, nil)
+	mc.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	if err := conn.UnregisterCloseCallback(); err != nil && !errors.Is(err, ErrNoSupport) {
+		mc.log.failed(err)
+	}
+
+	_, err := conn.Close()
+
+	return err
+}
+
+// notify queues a notification for OnStateChange. The connection must be
+// locked, so the notifications are queued in order.
+func (mc *ManagedConnection) notify(state ConnectionState, err error) {
+	mc.notifyMu.Lock()
+	defer mc.notifyMu.Unlock()
+
+	mc.pending = append(mc.pending, stateChange{
+		state: state,
+		err:   err,
+	})
+	mc.notifyCond.Signal()
+}
+
+// deliverNotifications calls OnStateChange with the queued notifications,
+// until the connection is closed.
+func (mc *ManagedConnection) deliverNotifications() {
+	for {
+		mc.notifyMu.Lock()
+		for len(mc.pending) == 0 {
+			mc.notifyCond.Wait()
+		}
+		change := mc.pending[0]
+		mc.pending = mc.pending[1:]
+		mc.notifyMu.Unlock()
+
+		if mc.opts.OnStateChange != nil {
+			mc.opts.OnStateChange(change.state, change.err)
+		}
+
+		if change.state == ConnStateClosed {
+			return
+		}
+	}
+}
+
+// managedObject is an object of a ManagedConnection identified by its UUID,
+// which is looked up again when the connection is reestablished.
+type managedObject[T interface{ Free() error }] struct {
+	mc     *ManagedConnection
+	uuid   string
+	lookup func(conn ConnectionAPI, uuid string) (T, error)
+
+	mu   sync.Mutex
+	conn ConnectionAPI
+	obj  T
+}
+
+// resolve returns the object in "conn", looking it up if it was created by
+// another connection.
+func (mo *managedObject[T]) resolve(conn ConnectionAPI) (T, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	if mo.conn == conn {
+		return mo.obj, nil
+	}
+
+	if mo.conn != nil {
+		// the old connection is gone; only the local memory is freed
+		mo.obj.Free()
+		mo.conn = nil
+	}
+
+	obj, err := mo.lookup(conn, mo.uuid)
+	if err != nil {
+		return obj, err
+	}
+
+	mo.conn = conn
+	mo.obj = obj
+
+	return obj, nil
+}
+
+// do calls "fn" with the object in the current connection.
+func (mo *managedObject[T]) do(fn func(obj T) error) error {
+	return mo.mc.Do(func(conn ConnectionAPI) error {
+		obj, err := mo.resolve(conn)
+		if err != nil {
+			return err
+		}
+
+		return fn(obj)
+	})
+}
+
+// free frees the object looked up most recently, if any.
+func (mo *managedObject[T]) free() error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	if mo.conn == nil {
+		return nil
+	}
+
+	mo.conn = nil
+
+	return mo.obj.Free()
+}
+
+// ManagedDomain is a domain of a ManagedConnection. It's looked up by UUID in
+// the current connection whenever it's used after the connection is
+// reestablished.
+type ManagedDomain struct {
+	mo managedObject[DomainAPI]
+}
+
+// Domain returns the domain with "uuid". The domain is only looked up when
+// it's used, so no error is returned if it doesn't exist.
+func (mc *ManagedConnection) Domain(uuid string) *ManagedDomain {
+	return &ManagedDomain{
+		mo: managedObject[DomainAPI]{
+			mc:   mc,
+			uuid: uuid,
+			lookup: func(conn ConnectionAPI, uuid string) (DomainAPI, error) {
+				return conn.LookupDomainByUUID(uuid)
+			},
+		},
+	}
+}
+
+// UUID returns the UUID of the domain.
+func (md *ManagedDomain) UUID() string {
+	return md.mo.uuid
+}
+
+// Do calls "fn" with the domain in the current connection, looking it up if
+// needed. The domain must not be used after "fn" returns.
+func (md *ManagedDomain) Do(fn func(dom DomainAPI) error) error {
+	return md.mo.do(fn)
+}
+
+// Free frees the domain looked up in the current connection, if any. The
+// ManagedDomain can still be used afterwards.
+func (md *ManagedDomain) Free() error {
+	return md.mo.free()
+}
+
+// ManagedStoragePool is a storage pool of a ManagedConnection. It's looked up
+// by UUID in the current connection whenever it's used after the connection
+// is reestablished.
+type ManagedStoragePool struct {
+	mo managedObject[StoragePoolAPI]
+}
+
+// StoragePool returns the storage pool with "uuid". The storage pool is only
+// looked up when it's used, so no error is returned if it doesn't exist.
+func (mc *ManagedConnection) StoragePool(uuid string) *ManagedStoragePool {
+	return &ManagedStoragePool{
+		mo: managedObject[StoragePoolAPI]{
+			mc:   mc,
+			uuid: uuid,
+			lookup: func(conn ConnectionAPI, uuid string) (StoragePoolAPI, error) {
+				return conn.LookupStoragePoolByUUID(uuid)
+			},
+		},
+	}
+}
+
+// UUID returns the UUID of the storage pool.
+func (mp *ManagedStoragePool) UUID() string {
+	return mp.mo.uuid
+}
+
+// Do calls "fn" with the storage pool in the current connection, looking it up
+// if needed. The storage pool must not be used after "fn" returns.
+func (mp *ManagedStoragePool) Do(fn func(pool StoragePoolAPI) error) error {
+	return mp.mo.do(fn)
+}
+
+// Free frees the storage pool looked up in the current connection, if any.
+// The ManagedStoragePool can still be used afterwards.
+func (mp *ManagedStoragePool) Free() error {
+	return mp.mo.free()
+}
@@ -0,0 +1,172 @@
+package libvirt_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cd1/libvirt-golang"
+	"github.com/cd1/libvirt-golang/libvirtfake"
+)
+
+const testManagedDomainXML = `<domain type='test'>
+  <name>managed-dom</name>
+  <memory unit='MiB'>512</memory>
+  <vcpu>1</vcpu>
+  <os>
+    <type>hvm</type>
+  </os>
+</domain>`
+
+// noCloseCallbackConnection is a fake connection which never calls its close
+// callback, so the connection loss can only be detected by failed calls.
+type noCloseCallbackConnection struct {
+	*libvirtfake.Connection
+}
+
+func (noCloseCallbackConnection) RegisterCloseCallback(libvirt.CloseCallback) error {
+	return nil
+}
+
+func (noCloseCallbackConnection) UnregisterCloseCallback() error {
+	return nil
+}
+
+// newTestManagedConnection opens a managed connection to a fake hypervisor
+// with a domain, and returns it with the domain UUID and a channel which
+// receives the state changes.
+func newTestManagedConnection(t *testing.T, callbacks bool) (*libvirt.ManagedConnection, *libvirtfake.Hypervisor, string, <-chan libvirt.ConnectionState) {
+	hv := libvirtfake.NewHypervisor()
+
+	conn, err := hv.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dom, err := conn.DefineDomain(testManagedDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid, err := dom.UUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	states := make(chan libvirt.ConnectionState, 10)
+	mc, err := libvirt.NewManagedConnection(libvirtfake.FakeURI, libvirt.ManagedOptions{
+		Dial: func() (libvirt.ConnectionAPI, error) {
+			conn, err := hv.Open()
+			if err != nil {
+				return nil, err
+			}
+
+			if !callbacks {
+				return noCloseCallbackConnection{conn}, nil
+			}
+
+			return conn, nil
+		},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		OnStateChange: func(state libvirt.ConnectionState, err error) {
+			states <- state
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mc, hv, uuid, states
+}
+
+// waitState fails the test if the next state change isn't "want".
+func waitState(t *testing.T, states <-chan libvirt.ConnectionState, want libvirt.ConnectionState) {
+	t.Helper()
+
+	select {
+	case state := <-states:
+		if state != want {
+			t.Fatalf("unexpected connection state; got=%v, want=%v", state, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for connection state %v", want)
+	}
+}
+
+// checkManagedDomain fails the test if the managed domain can't be used.
+func checkManagedDomain(t *testing.T, md *libvirt.ManagedDomain) {
+	t.Helper()
+
+	err := md.Do(func(dom libvirt.DomainAPI) error {
+		name, err := dom.Name()
+		if err == nil && name != "managed-dom" {
+			t.Errorf("unexpected domain name; got=%v, want=managed-dom", name)
+		}
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagedConnectionCloseCallback(t *testing.T) {
+	mc, hv, uuid, states := newTestManagedConnection(t, true)
+	defer mc.Close()
+
+	md := mc.Domain(uuid)
+	checkManagedDomain(t, md)
+
+	hv.Stop(libvirt.CloseReasonEOF)
+	waitState(t, states, libvirt.ConnStateDisconnected)
+
+	if err := md.Do(func(libvirt.DomainAPI) error { return nil }); err != libvirt.ErrNotConnected {
+		t.Errorf("unexpected error while disconnected; got=%v, want=%v", err, libvirt.ErrNotConnected)
+	}
+
+	hv.Start()
+	waitState(t, states, libvirt.ConnStateConnected)
+
+	checkManagedDomain(t, md)
+
+	if err := md.Free(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestManagedConnectionFailedCall(t *testing.T) {
+	mc, hv, uuid, states := newTestManagedConnection(t, false)
+
+	md := mc.Domain(uuid)
+	checkManagedDomain(t, md)
+
+	hv.Stop(libvirt.CloseReasonKeepAlive)
+	hv.Start()
+
+	err := md.Do(func(dom libvirt.DomainAPI) error {
+		_, err := dom.Name()
+		return err
+	})
+	if !libvirt.IsConnectionLost(err) {
+		t.Fatalf("unexpected error after losing the connection; got=%v", err)
+	}
+
+	waitState(t, states, libvirt.ConnStateDisconnected)
+	waitState(t, states, libvirt.ConnStateConnected)
+
+	checkManagedDomain(t, md)
+
+	if err := mc.Close(); err != nil {
+		t.Error(err)
+	}
+	waitState(t, states, libvirt.ConnStateClosed)
+
+	if err := md.Do(func(libvirt.DomainAPI) error { return nil }); !errors.Is(err, libvirt.ErrManagedConnectionClosed) {
+		t.Errorf("unexpected error after closing; got=%v, want=%v", err, libvirt.ErrManagedConnectionClosed)
+	}
+}
@@ -0,0 +1,338 @@
+// Package remote implements a client for the libvirt remote protocol, written
+// in pure Go. It talks directly to libvirtd (or virtqemud and friends) over a
+// unix socket or TCP, so it doesn't require cgo nor the libvirt development
+// files at build time.
+//
+// The package covers the basic management of connections, domains, storage
+// pools and secrets: lookups, definitions, lifecycle (create, destroy,
+// shutdown, reboot, suspend, resume, undefine), state and information, XML,
+// autostart and secret values. Methods which exist here have the same names,
+// flag types and values as in the cgo package, and errors are the same
+// *Error type, so they match the same error codes with errors.Is and the
+// predicates of the cgo package (e.g. IsNotFound).
+//
+// The other procedures (storage volumes, streams, snapshots, checkpoints,
+// backups, jobs and events) are not implemented. The types of this package
+// don't implement the ConnectionAPI, DomainAPI, StoragePoolAPI and SecretAPI
+// interfaces of the cgo package either: those interfaces are declared in terms
+// of the cgo types, so satisfying them would bring cgo back into this package.
+package remote
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSocket is the path of the read-write unix socket used by the system
+// instance of libvirtd.
+const DefaultSocket = "/var/run/libvirt/libvirt-sock"
+
+// reply is the answer of the server to a call.
+type reply struct {
+	pkt packet
+	err error
+}
+
+// Connection holds a connection to a libvirt server. There are no exported
+// fields.
+type Connection struct {
+	conn net.Conn
+
+	// writeMu serializes the packets written to "conn".
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	serial  uint32
+	pending map[uint32]chan reply
+	err     error
+
+	// closing is set by Close, so the transport errors which follow the
+	// close request are reported as ErrClosed, like a normal close.
+	closing bool
+
+	done chan struct{}
+
+	// lastRecv is the time (in Unix nanoseconds) of the last packet read
+	// from the server; it is used by the keepalive logic.
+	lastRecv int64
+
+	// keepAliveStop stops the running keepalive loop, if any.
+	keepAliveStop chan struct{}
+}
+
+// Dial connects to the libvirt server listening on "address" ("network" is
+// either "unix" or "tcp") and opens the hypervisor connection identified by
+// "uri". An empty "uri" lets the server choose the default hypervisor.
+func Dial(network string, address string, uri string, readOnly bool) (*Connection, error) {
+	c, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := NewConnection(c)
+	if err := conn.open(uri, readOnly); err != nil {
+		conn.shutdown(ErrClosed)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// NewConnection creates a Connection which exchanges messages over "c". The
+// hypervisor connection is not opened; Dial should be used instead, unless
+// the transport needs to be set up by the caller.
+func NewConnection(c net.Conn) *Connection {
+	conn := &Connection{
+		conn:     c,
+		pending:  make(map[uint32]chan reply),
+		done:     make(chan struct{}),
+		lastRecv: time.Now().UnixNano(),
+	}
+
+	go conn.readLoop()
+
+	return conn
+}
+
+// open opens the hypervisor connection identified by "uri".
+func (conn *Connection) open(uri string, readOnly bool) error {
+	var e encoder
+	if uri == "" {
+		e.writeOptString(nil)
+	} else {
+		e.writeOptString(&uri)
+	}
+
+	var flags uint32
+	if readOnly {
+		flags = 1 // VIR_CONNECT_RO
+	}
+	e.writeUint32(flags)
+
+	_, err := conn.call(procConnectOpen, e.bytes())
+
+	return err
+}
+
+// Close closes the hypervisor connection and the underlying transport. Unlike
+// the cgo package, there is no reference counting, so the returned count is
+// always zero on success.
+func (conn *Connection) Close() (int32, error) {
+	conn.mu.Lock()
+	conn.closing = true
+	conn.mu.Unlock()
+
+	_, err := conn.call(procConnectClose, nil)
+	conn.shutdown(ErrClosed)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// SetKeepAlive starts sending keepalive messages to the server every
+// "interval" the connection is idle. After "count" messages are sent without
+// any answer from the server, the connection is closed and every pending and
+// future call fails with ErrKeepAliveTimeout. A non-positive interval disables
+// keepalive messages. Calling it again replaces the previous settings. It
+// fails with ErrClosed if the connection is closed.
+func (conn *Connection) SetKeepAlive(interval time.Duration, count uint32) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.err != nil {
+		return conn.err
+	}
+
+	if conn.keepAliveStop != nil {
+		close(conn.keepAliveStop)
+		conn.keepAliveStop = nil
+	}
+
+	if interval <= 0 {
+		return nil
+	}
+
+	stop := make(chan struct{})
+	conn.keepAliveStop = stop
+	go conn.keepAliveLoop(interval, count, stop)
+
+	return nil
+}
+
+// keepAliveLoop sends PING messages while the connection is idle and closes it
+// when the server stops answering, until "stop" is closed.
+func (conn *Connection) keepAliveLoop(interval time.Duration, count uint32, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sent uint32
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&conn.lastRecv)))
+		if idle < interval {
+			sent = 0
+			continue
+		}
+
+		if sent >= count {
+			conn.shutdown(ErrKeepAliveTimeout)
+			return
+		}
+
+		if err := conn.sendKeepAlive(procKeepAlivePing); err != nil {
+			conn.shutdown(err)
+			return
+		}
+		sent++
+	}
+}
+
+// sendKeepAlive sends a message of the keepalive program.
+func (conn *Connection) sendKeepAlive(proc int32) error {
+	return conn.write(packet{
+		header: header{
+			Program:   keepAliveProgram,
+			Version:   keepAliveProtocolVersion,
+			Procedure: proc,
+			Type:      messageMessage,
+			Status:    statusOK,
+		},
+	})
+}
+
+// write sends "pkt" to the server.
+func (conn *Connection) write(pkt packet) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+
+	return writePacket(conn.conn, pkt)
+}
+
+// call invokes the procedure "proc" of the remote program with the encoded
+// arguments "args", and waits for its reply. The payload of a successful
+// reply is returned; errors reported by the server are returned as *Error.
+func (conn *Connection) call(proc int32, args []byte) ([]byte, error) {
+	ch := make(chan reply, 1)
+
+	conn.mu.Lock()
+	if conn.err != nil {
+		err := conn.err
+		conn.mu.Unlock()
+		return nil, err
+	}
+	conn.serial++
+	serial := conn.serial
+	conn.pending[serial] = ch
+	conn.mu.Unlock()
+
+	err := conn.write(packet{
+		header: header{
+			Program:   remoteProgram,
+			Version:   remoteProtocolVersion,
+			Procedure: proc,
+			Type:      messageCall,
+			Serial:    serial,
+			Status:    statusOK,
+		},
+		Payload: args,
+	})
+	if err != nil {
+		conn.mu.Lock()
+		delete(conn.pending, serial)
+		conn.mu.Unlock()
+		conn.shutdown(err)
+		return nil, err
+	}
+
+	r := <-ch
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.pkt.Status == statusError {
+		return nil, decodeError(r.pkt.Payload)
+	}
+
+	return r.pkt.Payload, nil
+}
+
+// readLoop reads every packet sent by the server and dispatches it, until the
+// connection fails or is closed.
+func (conn *Connection) readLoop() {
+	for {
+		pkt, err := readPacket(conn.conn)
+		if err != nil {
+			conn.shutdown(err)
+			return
+		}
+
+		atomic.StoreInt64(&conn.lastRecv, time.Now().UnixNano())
+
+		switch pkt.Program {
+		case keepAliveProgram:
+			if pkt.Procedure == procKeepAlivePing {
+				if err := conn.sendKeepAlive(procKeepAlivePong); err != nil {
+					conn.shutdown(err)
+					return
+				}
+			}
+		case remoteProgram:
+			if pkt.Type != messageReply {
+				// events and streams are not supported
+				continue
+			}
+
+			conn.mu.Lock()
+			ch, ok := conn.pending[pkt.Serial]
+			delete(conn.pending, pkt.Serial)
+			conn.mu.Unlock()
+
+			if ok {
+				ch <- reply{pkt: pkt}
+			}
+		}
+	}
+}
+
+// shutdown closes the transport and fails every pending and future call with
+// "err", wrapped with ErrClosed unless it's ErrClosed itself, so the cause of
+// the failure (e.g. a reset socket) is kept. After Close, the error is always
+// ErrClosed. Only the first error is kept.
+func (conn *Connection) shutdown(err error) {
+	conn.mu.Lock()
+	if conn.err != nil {
+		conn.mu.Unlock()
+		return
+	}
+
+	if conn.closing {
+		err = ErrClosed
+	} else if err != ErrClosed {
+		err = fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+	conn.err = err
+
+	pending := conn.pending
+	conn.pending = make(map[uint32]chan reply)
+	close(conn.done)
+	conn.mu.Unlock()
+
+	conn.conn.Close()
+
+	for _, ch := range pending {
+		ch <- reply{err: err}
+	}
+}
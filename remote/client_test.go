@@ -0,0 +1,513 @@
+package remote
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// exchange is a recorded RPC exchange: the call the client is expected to
+// send, and the reply sent back by the server. Payloads are hex encoded;
+// whitespace is ignored.
+type exchange struct {
+	proc   int32
+	args   string
+	status messageStatus
+	reply  string
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatalf("invalid hex data %q: %v", s, err)
+	}
+
+	return data
+}
+
+// replay returns a connection to a server which replays "exchanges", in
+// order, and fails the test if the client sends anything else.
+func replay(t *testing.T, exchanges []exchange) *Connection {
+	client, server := net.Pipe()
+
+	go func() {
+		defer server.Close()
+
+		for _, ex := range exchanges {
+			pkt, err := readPacket(server)
+			if err != nil {
+				t.Errorf("server: cannot read call: %v", err)
+				return
+			}
+
+			if pkt.Program != remoteProgram || pkt.Version != remoteProtocolVersion || pkt.Type != messageCall {
+				t.Errorf("server: unexpected packet header: %+v", pkt.header)
+				return
+			}
+
+			if pkt.Procedure != ex.proc {
+				t.Errorf("server: unexpected procedure; got=%v, want=%v", pkt.Procedure, ex.proc)
+				return
+			}
+
+			if want := hex.EncodeToString(decodeHex(t, ex.args)); hex.EncodeToString(pkt.Payload) != want {
+				t.Errorf("server: unexpected arguments for procedure %v; got=%x, want=%v", pkt.Procedure, pkt.Payload, want)
+				return
+			}
+
+			pkt.Type = messageReply
+			pkt.Status = ex.status
+			pkt.Payload = decodeHex(t, ex.reply)
+			if err := writePacket(server, pkt); err != nil {
+				t.Errorf("server: cannot write reply: %v", err)
+				return
+			}
+		}
+	}()
+
+	return NewConnection(client)
+}
+
+const (
+	// "test" domain, as sent by the test driver
+	testDomain = `00000004 74657374
+		6695eb01 f6a48304 79aa97f2 502e193f
+		00000001`
+
+	// "test" secret
+	testSecret = `aaf3c8d0 6c2b4a56 9b4d1e8c 7a3f5e21
+		00000005 00000008 6d792d76 6f6c756d`
+)
+
+var openExchange = exchange{
+	proc: procConnectOpen,
+	// "test:///default", flags = 0
+	args: `00000001 0000000f 74657374 3a2f2f2f 64656661 756c7400
+		00000000`,
+}
+
+var closeExchange = exchange{proc: procConnectClose}
+
+func TestDialOpenClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		for i := 0; i < 2; i++ {
+			// answer the open and close calls
+			pkt, err := readPacket(c)
+			if err != nil {
+				return
+			}
+
+			pkt.Type = messageReply
+			if err := writePacket(c, pkt); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := Dial("tcp", listener.Addr().String(), "test:///default", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret, err := conn.Close(); err != nil {
+		t.Error(err)
+	} else if ret != 0 {
+		t.Errorf("unexpected close return value; got=%v, want=0", ret)
+	}
+
+	if _, err := conn.Type(); err != ErrClosed {
+		t.Errorf("unexpected error after closing the connection; got=%v, want=%v", err, ErrClosed)
+	}
+}
+
+func TestConnectionInfo(t *testing.T) {
+	conn := replay(t, []exchange{
+		openExchange,
+		{proc: procConnectGetType, reply: "00000004 54657374"},
+		{proc: procConnectGetVersion, reply: "00000000 00000002"},
+		{proc: procConnectGetLibVersion, reply: "00000000 00989680"},
+		{proc: procConnectGetHostname, reply: "00000005 6c6f6361 6c000000"},
+		{proc: procConnectGetMaxVCPUs, args: "00000000", reply: "00000020"},
+		closeExchange,
+	})
+
+	if err := conn.open("test:///default", false); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if typ, err := conn.Type(); err != nil {
+		t.Error(err)
+	} else if typ != "Test" {
+		t.Errorf("unexpected type; got=%v, want=Test", typ)
+	}
+
+	if ver, err := conn.Version(); err != nil {
+		t.Error(err)
+	} else if ver != 2 {
+		t.Errorf("unexpected version; got=%v, want=2", ver)
+	}
+
+	if ver, err := conn.LibVersion(); err != nil {
+		t.Error(err)
+	} else if ver != 10000000 {
+		t.Errorf("unexpected library version; got=%v, want=10000000", ver)
+	}
+
+	if hostname, err := conn.Hostname(); err != nil {
+		t.Error(err)
+	} else if hostname != "local" {
+		t.Errorf("unexpected hostname; got=%v, want=local", hostname)
+	}
+
+	if vcpus, err := conn.MaxVCPUs(""); err != nil {
+		t.Error(err)
+	} else if vcpus != 32 {
+		t.Errorf("unexpected max vcpus; got=%v, want=32", vcpus)
+	}
+}
+
+func TestDomainLookupAndInfo(t *testing.T) {
+	conn := replay(t, []exchange{
+		{proc: procDomainLookupByName, args: "00000004 74657374", reply: testDomain},
+		{
+			proc: procDomainGetInfo,
+			args: testDomain,
+			reply: `00000001 00000000 00800000 00000000 00200000
+				00000002 00000000 3b9aca00`,
+		},
+		{proc: procDomainIsActive, args: testDomain, reply: "00000001"},
+		{proc: procDomainGetXMLDesc, args: testDomain + " 00000000", reply: "00000008 3c646f6d 61696e3e"},
+		{proc: procDomainSuspend, args: testDomain},
+		{
+			proc:  procDomainLookupByUUID,
+			args:  "6695eb01 f6a48304 79aa97f2 502e193f",
+			reply: testDomain,
+		},
+		{proc: procDomainDestroyFlags, args: testDomain + " 00000001"},
+		// state = VIR_DOMAIN_SHUTOFF, reason = VIR_DOMAIN_SHUTOFF_DESTROYED
+		{proc: procDomainGetState, args: testDomain + " 00000000", reply: "00000005 00000002"},
+		closeExchange,
+	})
+	defer conn.Close()
+
+	dom, err := conn.LookupDomainByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := dom.Name(); name != "test" {
+		t.Errorf("unexpected domain name; got=%v, want=test", name)
+	}
+
+	uuid, _ := dom.UUID()
+	if uuid != "6695eb01-f6a4-8304-79aa-97f2502e193f" {
+		t.Errorf("unexpected domain UUID; got=%v", uuid)
+	}
+
+	if id, _ := dom.ID(); id != 1 {
+		t.Errorf("unexpected domain ID; got=%v, want=1", id)
+	}
+
+	info, err := dom.info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domainInfo{state: DomStateRunning, maxMem: 8388608, memory: 2097152, nrVirtCPU: 2, cpuTime: 1000000000}
+	if info != want {
+		t.Errorf("unexpected domain info; got=%+v, want=%+v", info, want)
+	}
+
+	if active, err := dom.IsActive(); err != nil {
+		t.Error(err)
+	} else if !active {
+		t.Error("domain should be active")
+	}
+
+	if xml, err := dom.XML(DomXMLDefault); err != nil {
+		t.Error(err)
+	} else if xml != "<domain>" {
+		t.Errorf("unexpected domain XML; got=%v", xml)
+	}
+
+	if err := dom.Suspend(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := conn.LookupDomainByUUID(uuid); err != nil {
+		t.Error(err)
+	}
+
+	if err := dom.Destroy(DomDestroyGraceful); err != nil {
+		t.Error(err)
+	}
+
+	if state, reason, err := dom.State(); err != nil {
+		t.Error(err)
+	} else if state != DomStateShutoff || reason != 2 {
+		t.Errorf("unexpected domain state; got=%v/%v, want=%v/2", state, reason, DomStateShutoff)
+	}
+}
+
+func TestRemoteError(t *testing.T) {
+	conn := replay(t, []exchange{
+		{
+			proc:   procDomainLookupByName,
+			args:   "00000007 6d697373 696e6700",
+			status: statusError,
+			// code = VIR_ERR_NO_DOMAIN, domain = VIR_FROM_QEMU,
+			// message = "Domain not found", level = VIR_ERR_ERROR, str1 =
+			// "missing"
+			reply: `0000002a 0000000a
+				00000001 00000010 446f6d61 696e206e 6f742066 6f756e64
+				00000002
+				00000000
+				00000001 00000007 6d697373 696e6700
+				00000000
+				00000000
+				00000000 00000000
+				00000000`,
+		},
+		closeExchange,
+	})
+	defer conn.Close()
+
+	_, err := conn.LookupDomainByName("missing")
+	if err == nil {
+		t.Fatal("looking up a missing domain should fail")
+	}
+
+	rerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+
+	want := Error{Code: ErrNoDomain, Domain: ErrDomQEMU, Message: "Domain not found", Level: ErrLvlError, Str1: "missing"}
+	if *rerr != want {
+		t.Errorf("unexpected error; got=%+v, want=%+v", *rerr, want)
+	}
+
+	if !errors.Is(fmt.Errorf("lookup: %w", err), ErrNoDomain) {
+		t.Error("wrapped error should match its code")
+	}
+}
+
+func TestStoragePoolAndSecret(t *testing.T) {
+	pool := `00000007 64656661 756c7400
+		3a8c1e2f 5b6d4c7a 8e9f0a1b 2c3d4e5f`
+
+	conn := replay(t, []exchange{
+		{proc: procStoragePoolLookupByName, args: "00000007 64656661 756c7400", reply: pool},
+		{proc: procStoragePoolRefresh, args: pool + " 00000000"},
+		{
+			proc:  procStoragePoolGetInfo,
+			args:  pool,
+			reply: "00000002 00000000 00001000 00000000 00000400 00000000 00000c00",
+		},
+		{
+			proc:  procSecretLookupByUsage,
+			args:  "00000005 00000008 6d792d76 6f6c756d",
+			reply: testSecret,
+		},
+		{proc: procSecretSetValue, args: testSecret + " 00000003 61626300 00000000"},
+		{proc: procSecretGetValue, args: testSecret + " 00000000", reply: "00000003 61626300"},
+		closeExchange,
+	})
+	defer conn.Close()
+
+	p, err := conn.LookupStoragePoolByName("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uuid, _ := p.UUID(); uuid != "3a8c1e2f-5b6d-4c7a-8e9f-0a1b2c3d4e5f" {
+		t.Errorf("unexpected pool UUID; got=%v", uuid)
+	}
+
+	if err := p.Refresh(); err != nil {
+		t.Error(err)
+	}
+
+	if info, err := p.info(); err != nil {
+		t.Error(err)
+	} else if want := (storagePoolInfo{state: PoolStateRunning, capacity: 4096, allocation: 1024, available: 3072}); info != want {
+		t.Errorf("unexpected pool info; got=%+v, want=%+v", info, want)
+	}
+
+	sec, err := conn.LookupSecretByUsage(SecUsageTypeVTPM, "my-volum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sec.SetValue("abc"); err != nil {
+		t.Error(err)
+	}
+
+	if value, err := sec.Value(); err != nil {
+		t.Error(err)
+	} else if value != "abc" {
+		t.Errorf("unexpected secret value; got=%v, want=abc", value)
+	}
+}
+
+func TestSerialMatching(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConnection(client)
+	defer conn.shutdown(ErrClosed)
+
+	// the server reads both calls before answering them in reverse order,
+	// echoing back their arguments
+	go func() {
+		defer server.Close()
+
+		var calls []packet
+		for len(calls) < 2 {
+			pkt, err := readPacket(server)
+			if err != nil {
+				return
+			}
+			calls = append(calls, pkt)
+		}
+
+		for i := len(calls) - 1; i >= 0; i-- {
+			calls[i].Type = messageReply
+			if err := writePacket(server, calls[i]); err != nil {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			var e encoder
+			e.writeString(name)
+			got, err := conn.callString(procDomainGetOSType, e.bytes())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if got != name {
+				t.Errorf("reply was matched to the wrong call; got=%v, want=%v", got, name)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func TestKeepAlivePong(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConnection(client)
+	defer conn.shutdown(ErrClosed)
+	defer server.Close()
+
+	ping := packet{
+		header: header{
+			Program:   keepAliveProgram,
+			Version:   keepAliveProtocolVersion,
+			Procedure: procKeepAlivePing,
+			Type:      messageMessage,
+		},
+	}
+	if err := writePacket(server, ping); err != nil {
+		t.Fatal(err)
+	}
+
+	pong, err := readPacket(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pong.Program != keepAliveProgram || pong.Procedure != procKeepAlivePong || pong.Type != messageMessage {
+		t.Errorf("unexpected answer to keepalive ping: %+v", pong.header)
+	}
+}
+
+func TestKeepAliveTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConnection(client)
+	defer server.Close()
+
+	// the server reads everything and never answers
+	pings := make(chan int32, 16)
+	go func() {
+		for {
+			pkt, err := readPacket(server)
+			if err != nil {
+				close(pings)
+				return
+			}
+			if pkt.Program == keepAliveProgram {
+				pings <- pkt.Procedure
+			}
+		}
+	}()
+
+	// a non-positive interval disables keepalive instead of panicking
+	if err := conn.SetKeepAlive(0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.SetKeepAlive(10*time.Millisecond, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := conn.Type()
+	if !errors.Is(err, ErrKeepAliveTimeout) || !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error; got=%v, want=%v", err, ErrKeepAliveTimeout)
+	}
+
+	var n int
+	for proc := range pings {
+		if proc != procKeepAlivePing {
+			t.Errorf("unexpected keepalive procedure %v", proc)
+		}
+		n++
+	}
+
+	if n != 2 {
+		t.Errorf("unexpected number of keepalive pings; got=%v, want=2", n)
+	}
+
+	if err := conn.SetKeepAlive(time.Second, 2); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error on a closed connection; got=%v, want=%v", err, ErrClosed)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConnection(client)
+
+	// the server reads the call and drops the connection
+	go func() {
+		readPacket(server)
+		server.Close()
+	}()
+
+	_, err := conn.Type()
+	if !errors.Is(err, ErrClosed) || !errors.Is(err, io.EOF) {
+		t.Errorf("unexpected error after losing the connection; got=%v, want=%v wrapping %v", err, ErrClosed, io.EOF)
+	}
+}
@@ -0,0 +1,307 @@
+package remote
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// errInvalidUUID is returned when a UUID string can't be parsed.
+var errInvalidUUID = errors.New("remote: invalid UUID")
+
+// parseUUID converts the textual representation of a UUID to its binary form.
+func parseUUID(uuid string) ([]byte, error) {
+	var digits []byte
+	for i := 0; i < len(uuid); i++ {
+		if uuid[i] != '-' && uuid[i] != ' ' {
+			digits = append(digits, uuid[i])
+		}
+	}
+
+	data, err := hex.DecodeString(string(digits))
+	if err != nil || len(data) != uuidSize {
+		return nil, errInvalidUUID
+	}
+
+	return data, nil
+}
+
+// formatUUID converts a binary UUID to its textual representation.
+func formatUUID(uuid []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// callString invokes "proc" and decodes a reply containing a single string.
+func (conn *Connection) callString(proc int32, args []byte) (string, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return "", err
+	}
+
+	d := decoder{data: ret}
+	s := d.readString()
+
+	return s, d.err
+}
+
+// callUint64 invokes "proc" and decodes a reply containing a single unsigned
+// hyper.
+func (conn *Connection) callUint64(proc int32, args []byte) (uint64, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return 0, err
+	}
+
+	d := decoder{data: ret}
+	v := d.readUint64()
+
+	return v, d.err
+}
+
+// callInt32 invokes "proc" and decodes a reply containing a single int.
+func (conn *Connection) callInt32(proc int32, args []byte) (int32, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return 0, err
+	}
+
+	d := decoder{data: ret}
+	v := d.readInt32()
+
+	return v, d.err
+}
+
+// Version gets the version level of the Hypervisor running.
+func (conn *Connection) Version() (uint64, error) {
+	return conn.callUint64(procConnectGetVersion, nil)
+}
+
+// LibVersion provides the version of libvirt used by the daemon running on
+// the host.
+func (conn *Connection) LibVersion() (uint64, error) {
+	return conn.callUint64(procConnectGetLibVersion, nil)
+}
+
+// Capabilities provides capabilities of the hypervisor/driver.
+func (conn *Connection) Capabilities() (string, error) {
+	return conn.callString(procConnectGetCapabilities, nil)
+}
+
+// Hostname returns a system hostname on which the hypervisor is running
+// (based on the result of the gethostname system call, but possibly expanded
+// to a fully-qualified domain name via getaddrinfo).
+func (conn *Connection) Hostname() (string, error) {
+	return conn.callString(procConnectGetHostname, nil)
+}
+
+// Type gets the name of the Hypervisor driver used.
+func (conn *Connection) Type() (string, error) {
+	return conn.callString(procConnectGetType, nil)
+}
+
+// URI returns the URI (name) of the hypervisor connection.
+func (conn *Connection) URI() (string, error) {
+	return conn.callString(procConnectGetURI, nil)
+}
+
+// MaxVCPUs provides the maximum number of virtual CPUs supported for a guest
+// VM of a specific type. An empty "typ" means the default type.
+func (conn *Connection) MaxVCPUs(typ string) (int32, error) {
+	var e encoder
+	if typ == "" {
+		e.writeOptString(nil)
+	} else {
+		e.writeOptString(&typ)
+	}
+
+	return conn.callInt32(procConnectGetMaxVCPUs, e.bytes())
+}
+
+// callDomain invokes "proc" and decodes a reply containing a single domain.
+func (conn *Connection) callDomain(proc int32, args []byte) (Domain, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return Domain{}, err
+	}
+
+	d := decoder{data: ret}
+	dom := conn.decodeDomain(&d)
+	if d.err != nil {
+		return Domain{}, d.err
+	}
+
+	return dom, nil
+}
+
+// CreateDomain launches a new guest domain, based on an XML description
+// similar to the one returned by Domain.XML.
+func (conn *Connection) CreateDomain(xml string, flags DomainCreateFlag) (Domain, error) {
+	var e encoder
+	e.writeString(xml)
+	e.writeUint32(uint32(flags))
+
+	return conn.callDomain(procDomainCreateXML, e.bytes())
+}
+
+// DefineDomain defines a domain, but does not start it.
+func (conn *Connection) DefineDomain(xml string) (Domain, error) {
+	var e encoder
+	e.writeString(xml)
+
+	return conn.callDomain(procDomainDefineXML, e.bytes())
+}
+
+// LookupDomainByID tries to find a domain based on the hypervisor ID number.
+func (conn *Connection) LookupDomainByID(id uint32) (Domain, error) {
+	var e encoder
+	e.writeInt32(int32(id))
+
+	return conn.callDomain(procDomainLookupByID, e.bytes())
+}
+
+// LookupDomainByName tries to lookup a domain on the given hypervisor based on
+// its name.
+func (conn *Connection) LookupDomainByName(name string) (Domain, error) {
+	var e encoder
+	e.writeString(name)
+
+	return conn.callDomain(procDomainLookupByName, e.bytes())
+}
+
+// LookupDomainByUUID tries to lookup a domain on the given hypervisor based on
+// its UUID.
+func (conn *Connection) LookupDomainByUUID(uuid string) (Domain, error) {
+	data, err := parseUUID(uuid)
+	if err != nil {
+		return Domain{}, err
+	}
+
+	var e encoder
+	e.writeFixedOpaque(data)
+
+	return conn.callDomain(procDomainLookupByUUID, e.bytes())
+}
+
+// callStoragePool invokes "proc" and decodes a reply containing a single
+// storage pool.
+func (conn *Connection) callStoragePool(proc int32, args []byte) (StoragePool, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return StoragePool{}, err
+	}
+
+	d := decoder{data: ret}
+	pool := conn.decodeStoragePool(&d)
+	if d.err != nil {
+		return StoragePool{}, d.err
+	}
+
+	return pool, nil
+}
+
+// FindStoragePoolSources talks to a storage backend and attempts to auto-
+// discover the set of available storage pool sources. An empty "source" is
+// sent as NULL.
+func (conn *Connection) FindStoragePoolSources(typ string, source string) (string, error) {
+	var e encoder
+	e.writeString(typ)
+	if source == "" {
+		e.writeOptString(nil)
+	} else {
+		e.writeOptString(&source)
+	}
+	e.writeUint32(0)
+
+	return conn.callString(procConnectFindStoragePoolSources, e.bytes())
+}
+
+// DefineStoragePool defines an inactive persistent storage pool or modifies
+// an existing persistent one from the XML description.
+func (conn *Connection) DefineStoragePool(xml string) (StoragePool, error) {
+	var e encoder
+	e.writeString(xml)
+	e.writeUint32(0)
+
+	return conn.callStoragePool(procStoragePoolDefineXML, e.bytes())
+}
+
+// CreateStoragePool creates a new storage based on its XML description. The
+// pool is not persistent, so its definition will disappear when it is
+// destroyed, or if the host is restarted.
+func (conn *Connection) CreateStoragePool(xml string) (StoragePool, error) {
+	var e encoder
+	e.writeString(xml)
+	e.writeUint32(0)
+
+	return conn.callStoragePool(procStoragePoolCreateXML, e.bytes())
+}
+
+// LookupStoragePoolByName fetches a storage pool based on its unique name.
+func (conn *Connection) LookupStoragePoolByName(name string) (StoragePool, error) {
+	var e encoder
+	e.writeString(name)
+
+	return conn.callStoragePool(procStoragePoolLookupByName, e.bytes())
+}
+
+// LookupStoragePoolByUUID fetches a storage pool based on its globally unique
+// id.
+func (conn *Connection) LookupStoragePoolByUUID(uuid string) (StoragePool, error) {
+	data, err := parseUUID(uuid)
+	if err != nil {
+		return StoragePool{}, err
+	}
+
+	var e encoder
+	e.writeFixedOpaque(data)
+
+	return conn.callStoragePool(procStoragePoolLookupByUUID, e.bytes())
+}
+
+// callSecret invokes "proc" and decodes a reply containing a single secret.
+func (conn *Connection) callSecret(proc int32, args []byte) (Secret, error) {
+	ret, err := conn.call(proc, args)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	d := decoder{data: ret}
+	sec := conn.decodeSecret(&d)
+	if d.err != nil {
+		return Secret{}, d.err
+	}
+
+	return sec, nil
+}
+
+// DefineSecret fetches a secret based on its unique identifier, creating it
+// if it doesn't exist yet.
+func (conn *Connection) DefineSecret(xml string) (Secret, error) {
+	var e encoder
+	e.writeString(xml)
+	e.writeUint32(0)
+
+	return conn.callSecret(procSecretDefineXML, e.bytes())
+}
+
+// LookupSecretByUUID fetches a secret based on its unique identifier.
+func (conn *Connection) LookupSecretByUUID(uuid string) (Secret, error) {
+	data, err := parseUUID(uuid)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	var e encoder
+	e.writeFixedOpaque(data)
+
+	return conn.callSecret(procSecretLookupByUUID, e.bytes())
+}
+
+// LookupSecretByUsage fetches a secret based on the usage.
+func (conn *Connection) LookupSecretByUsage(usageType SecretUsageType, usageID string) (Secret, error) {
+	var e encoder
+	e.writeInt32(int32(usageType))
+	e.writeString(usageID)
+
+	return conn.callSecret(procSecretLookupByUsage, e.bytes())
+}
@@ -0,0 +1,345 @@
+package remote
+
+// Domain holds a libvirt domain. There are no exported fields.
+type Domain struct {
+	conn *Connection
+	name string
+	uuid []byte
+	id   int32
+}
+
+// DomainState represents the state of a domain. It has the same values as in
+// the cgo package.
+type DomainState uint32
+
+// Possible values for DomainState.
+const (
+	DomStateNone        DomainState = 0
+	DomStateRunning     DomainState = 1
+	DomStateBlocked     DomainState = 2
+	DomStatePaused      DomainState = 3
+	DomStateShutdown    DomainState = 4
+	DomStateShutoff     DomainState = 5
+	DomStateCrashed     DomainState = 6
+	DomStatePMSuspended DomainState = 7
+)
+
+// DomainXMLFlag defines how the XML content should be read from a domain.
+type DomainXMLFlag uint32
+
+// Possible values for DomainXMLFlag.
+const (
+	DomXMLDefault    DomainXMLFlag = 0
+	DomXMLSecure     DomainXMLFlag = 1
+	DomXMLInactive   DomainXMLFlag = 2
+	DomXMLUpdateCPU  DomainXMLFlag = 4
+	DomXMLMigratable DomainXMLFlag = 8
+)
+
+// DomainCreateFlag defines how a domain should be created.
+type DomainCreateFlag uint32
+
+// Possible values for DomainCreateFlag.
+const (
+	DomCreateDefault     DomainCreateFlag = 0
+	DomCreatePaused      DomainCreateFlag = 1
+	DomCreateAutodestroy DomainCreateFlag = 2
+	DomCreateBypassCache DomainCreateFlag = 4
+	DomCreateForceBoot   DomainCreateFlag = 8
+)
+
+// DomainDestroyFlag defines how a domain should be destroyed.
+type DomainDestroyFlag uint32
+
+// Possible values for DomainDestroyFlag.
+const (
+	DomDestroyDefault  DomainDestroyFlag = 0
+	DomDestroyGraceful DomainDestroyFlag = 1
+)
+
+// DomainUndefineFlag defines how a domain should be undefined.
+type DomainUndefineFlag uint32
+
+// Possible values for DomainUndefineFlag.
+const (
+	DomUndefineDefault           DomainUndefineFlag = 0
+	DomUndefineManagedSave       DomainUndefineFlag = 1
+	DomUndefineSnapshotsMetadata DomainUndefineFlag = 2
+	DomUndefineNVRAM             DomainUndefineFlag = 4
+)
+
+// DomainRebootFlag defines how a domain should be rebooted.
+type DomainRebootFlag uint32
+
+// Possible values for DomainRebootFlag.
+const (
+	DomRebootDefault      DomainRebootFlag = 0
+	DomRebootACPIPowerBtn DomainRebootFlag = 1
+	DomRebootGuestAgent   DomainRebootFlag = 2
+	DomRebootInitctl      DomainRebootFlag = 4
+	DomRebootSignal       DomainRebootFlag = 8
+	DomRebootParavirt     DomainRebootFlag = 16
+)
+
+// DomainShutdownFlag defines how a domain should be shut down.
+type DomainShutdownFlag uint32
+
+// Possible values for DomainShutdownFlag.
+const (
+	DomShutdownDefault      DomainShutdownFlag = 0
+	DomShutdownACPIPowerBtn DomainShutdownFlag = 1
+	DomShutdownGuestAgent   DomainShutdownFlag = 2
+	DomShutdownInitctl      DomainShutdownFlag = 4
+	DomShutdownSignal       DomainShutdownFlag = 8
+	DomShutdownParavirt     DomainShutdownFlag = 16
+)
+
+// decodeDomain decodes a remote_nonnull_domain structure.
+func (conn *Connection) decodeDomain(d *decoder) Domain {
+	return Domain{
+		conn: conn,
+		name: d.readString(),
+		uuid: d.readFixedOpaque(uuidSize),
+		id:   d.readInt32(),
+	}
+}
+
+// encode encodes the domain as a remote_nonnull_domain structure.
+func (dom Domain) encode(e *encoder) {
+	e.writeString(dom.name)
+	e.writeFixedOpaque(dom.uuid)
+	e.writeInt32(dom.id)
+}
+
+// args encodes the domain followed by "flags", which is the argument list of
+// most domain procedures.
+func (dom Domain) args(flags ...uint32) []byte {
+	var e encoder
+	dom.encode(&e)
+	for _, f := range flags {
+		e.writeUint32(f)
+	}
+
+	return e.bytes()
+}
+
+// callVoid invokes "proc" for the domain, ignoring the reply payload.
+func (dom Domain) callVoid(proc int32, flags ...uint32) error {
+	_, err := dom.conn.call(proc, dom.args(flags...))
+	return err
+}
+
+// callBool invokes "proc" for the domain and decodes an int reply as a bool.
+func (dom Domain) callBool(proc int32) (bool, error) {
+	v, err := dom.conn.callInt32(proc, dom.args())
+	return v == 1, err
+}
+
+// Free frees the domain object. It exists for compatibility with the cgo
+// package; there are no resources held by the client.
+func (dom Domain) Free() error {
+	return nil
+}
+
+// Name gets the public name for that domain.
+func (dom Domain) Name() (string, error) {
+	return dom.name, nil
+}
+
+// UUID gets the UUID for a domain as string.
+func (dom Domain) UUID() (string, error) {
+	return formatUUID(dom.uuid), nil
+}
+
+// ID gets the hypervisor ID number for the domain, as known when it was
+// looked up.
+func (dom Domain) ID() (uint32, error) {
+	return uint32(dom.id), nil
+}
+
+// Autostart provides a boolean value indicating whether the domain configured
+// to be automatically started when the host machine boots.
+func (dom Domain) Autostart() (bool, error) {
+	return dom.callBool(procDomainGetAutostart)
+}
+
+// SetAutostart configures the domain to be automatically started when the
+// host machine boots.
+func (dom Domain) SetAutostart(autostart bool) error {
+	var e encoder
+	dom.encode(&e)
+	e.writeBool(autostart)
+
+	_, err := dom.conn.call(procDomainSetAutostart, e.bytes())
+	return err
+}
+
+// IsActive determines if the domain is currently running.
+func (dom Domain) IsActive() (bool, error) {
+	return dom.callBool(procDomainIsActive)
+}
+
+// IsPersistent determines if the domain has a persistent configuration which
+// means it will still exist after shutting down.
+func (dom Domain) IsPersistent() (bool, error) {
+	return dom.callBool(procDomainIsPersistent)
+}
+
+// OSType gets the type of domain operation system.
+func (dom Domain) OSType() (string, error) {
+	return dom.conn.callString(procDomainGetOSType, dom.args())
+}
+
+// XML provides an XML description of the domain.
+func (dom Domain) XML(typ DomainXMLFlag) (string, error) {
+	return dom.conn.callString(procDomainGetXMLDesc, dom.args(uint32(typ)))
+}
+
+// MaxMemory retrieves the maximum amount of physical memory allocated to a
+// domain.
+func (dom Domain) MaxMemory() (uint64, error) {
+	return dom.conn.callUint64(procDomainGetMaxMemory, dom.args())
+}
+
+// Create launches a defined domain. If the call is successful the domain
+// moves from the defined to the running domains pools.
+func (dom Domain) Create(flags DomainCreateFlag) error {
+	if flags == DomCreateDefault {
+		return dom.callVoid(procDomainCreate)
+	}
+
+	return dom.callVoid(procDomainCreateWithFlags, uint32(flags))
+}
+
+// Destroy destroys the domain object. The running instance is shutdown if not
+// down already and all resources used by it are given back to the hypervisor.
+func (dom Domain) Destroy(flags DomainDestroyFlag) error {
+	if flags == DomDestroyDefault {
+		return dom.callVoid(procDomainDestroy)
+	}
+
+	return dom.callVoid(procDomainDestroyFlags, uint32(flags))
+}
+
+// Undefine undefines a domain. If the domain is running, it's converted to
+// transient domain, without stopping it. If the domain is inactive, the domain
+// configuration is removed.
+func (dom Domain) Undefine(flags DomainUndefineFlag) error {
+	if flags == DomUndefineDefault {
+		return dom.callVoid(procDomainUndefine)
+	}
+
+	return dom.callVoid(procDomainUndefineFlags, uint32(flags))
+}
+
+// Reboot reboots a domain, the domain object is still usable thereafter, but
+// the domain OS is being stopped for a restart.
+func (dom Domain) Reboot(flags DomainRebootFlag) error {
+	return dom.callVoid(procDomainReboot, uint32(flags))
+}
+
+// Reset resets a domain immediately without any guest OS shutdown.
+func (dom Domain) Reset() error {
+	return dom.callVoid(procDomainReset, 0)
+}
+
+// Shutdown shuts down a domain, the domain object is still usable thereafter,
+// but the domain OS is being stopped.
+func (dom Domain) Shutdown() error {
+	return dom.callVoid(procDomainShutdown)
+}
+
+// ShutdownFlags shuts down a domain, like Shutdown, using the methods selected
+// by "flags".
+func (dom Domain) ShutdownFlags(flags DomainShutdownFlag) error {
+	return dom.callVoid(procDomainShutdownFlags, uint32(flags))
+}
+
+// State returns the current state of the domain and the reason why it's in
+// that state. The reason has the same values as in the cgo package.
+func (dom Domain) State() (DomainState, int32, error) {
+	ret, err := dom.conn.call(procDomainGetState, dom.args(0))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	d := decoder{data: ret}
+	state := DomainState(d.readInt32())
+	reason := d.readInt32()
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+
+	return state, reason, nil
+}
+
+// Suspend suspends an active domain, the process is frozen without further
+// access to CPU resources and I/O but the memory used by the domain at the
+// hypervisor level will stay allocated.
+func (dom Domain) Suspend() error {
+	return dom.callVoid(procDomainSuspend)
+}
+
+// Resume resumes a suspended domain, the process is restarted from the state
+// where it was frozen by calling Suspend().
+func (dom Domain) Resume() error {
+	return dom.callVoid(procDomainResume)
+}
+
+// domainInfo is the reply of the DOMAIN_GET_INFO procedure.
+type domainInfo struct {
+	state     DomainState
+	maxMem    uint64
+	memory    uint64
+	nrVirtCPU uint16
+	cpuTime   uint64
+}
+
+// info reads the basic information about the domain.
+func (dom Domain) info() (domainInfo, error) {
+	ret, err := dom.conn.call(procDomainGetInfo, dom.args())
+	if err != nil {
+		return domainInfo{}, err
+	}
+
+	d := decoder{data: ret}
+	info := domainInfo{
+		state:     DomainState(d.readUint32()),
+		maxMem:    d.readUint64(),
+		memory:    d.readUint64(),
+		nrVirtCPU: uint16(d.readUint32()),
+		cpuTime:   d.readUint64(),
+	}
+
+	return info, d.err
+}
+
+// InfoState returns the running state of the domain.
+func (dom Domain) InfoState() (DomainState, error) {
+	info, err := dom.info()
+	return info.state, err
+}
+
+// InfoMaxMemory returns the maximum memory in KBytes allowed.
+func (dom Domain) InfoMaxMemory() (uint64, error) {
+	info, err := dom.info()
+	return info.maxMem, err
+}
+
+// InfoMemory returns the memory in KBytes used by the domain.
+func (dom Domain) InfoMemory() (uint64, error) {
+	info, err := dom.info()
+	return info.memory, err
+}
+
+// InfoVCPUs returns the number of virtual CPUs for the domain.
+func (dom Domain) InfoVCPUs() (uint16, error) {
+	info, err := dom.info()
+	return info.nrVirtCPU, err
+}
+
+// InfoCPUTime returns the CPU time used in nanoseconds.
+func (dom Domain) InfoCPUTime() (uint64, error) {
+	info, err := dom.info()
+	return info.cpuTime, err
+}
@@ -0,0 +1,236 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cd1/libvirt-golang/internal/virterr"
+)
+
+// ErrClosed is returned when using a connection which has already been closed,
+// or which was closed because of an error; in the latter case, the error is
+// wrapped with ErrClosed.
+var ErrClosed = errors.New("remote: connection is closed")
+
+// ErrKeepAliveTimeout is returned, wrapped with ErrClosed, when the server
+// stopped answering keepalive messages and the connection was closed by the
+// client.
+var ErrKeepAliveTimeout = errors.New("remote: keepalive timeout")
+
+// ErrorCode is the error code. The type, and its values, are shared with the
+// cgo package, so errors returned by this package match its codes too (e.g.
+// errors.Is(err, libvirt.ErrNoDomain)).
+type ErrorCode = virterr.Code
+
+// Possible values for ErrorCode.
+const (
+	ErrOK                      = virterr.ErrOK
+	ErrInternal                = virterr.ErrInternal
+	ErrNoMemory                = virterr.ErrNoMemory
+	ErrNoSupport               = virterr.ErrNoSupport
+	ErrUnknownHost             = virterr.ErrUnknownHost
+	ErrNoConnect               = virterr.ErrNoConnect
+	ErrInvalidConn             = virterr.ErrInvalidConn
+	ErrInvalidDomain           = virterr.ErrInvalidDomain
+	ErrInvalidArg              = virterr.ErrInvalidArg
+	ErrOperationFailed         = virterr.ErrOperationFailed
+	ErrGetFailed               = virterr.ErrGetFailed
+	ErrPostFailed              = virterr.ErrPostFailed
+	ErrHTTP                    = virterr.ErrHTTP
+	ErrSExprSerial             = virterr.ErrSExprSerial
+	ErrNoXen                   = virterr.ErrNoXen
+	ErrXenCall                 = virterr.ErrXenCall
+	ErrOSType                  = virterr.ErrOSType
+	ErrNoKernel                = virterr.ErrNoKernel
+	ErrNoRoot                  = virterr.ErrNoRoot
+	ErrNoSource                = virterr.ErrNoSource
+	ErrNoTarget                = virterr.ErrNoTarget
+	ErrNoName                  = virterr.ErrNoName
+	ErrNoOS                    = virterr.ErrNoOS
+	ErrNoDevice                = virterr.ErrNoDevice
+	ErrNoXenStore              = virterr.ErrNoXenStore
+	ErrDriverFull              = virterr.ErrDriverFull
+	ErrCallFailed              = virterr.ErrCallFailed
+	ErrXML                     = virterr.ErrXML
+	ErrDomExist                = virterr.ErrDomExist
+	ErrOperationDenied         = virterr.ErrOperationDenied
+	ErrOpenFailed              = virterr.ErrOpenFailed
+	ErrReadFailed              = virterr.ErrReadFailed
+	ErrParseFailed             = virterr.ErrParseFailed
+	ErrConfSyntax              = virterr.ErrConfSyntax
+	ErrWriteFailed             = virterr.ErrWriteFailed
+	ErrXMLDetail               = virterr.ErrXMLDetail
+	ErrInvalidNetwork          = virterr.ErrInvalidNetwork
+	ErrNetworkExist            = virterr.ErrNetworkExist
+	ErrSystem                  = virterr.ErrSystem
+	ErrRPC                     = virterr.ErrRPC
+	ErrGNUTLS                  = virterr.ErrGNUTLS
+	WarNoNetwork               = virterr.WarNoNetwork
+	ErrNoDomain                = virterr.ErrNoDomain
+	ErrNoNetwork               = virterr.ErrNoNetwork
+	ErrInvalidMAC              = virterr.ErrInvalidMAC
+	ErrAuthFailed              = virterr.ErrAuthFailed
+	ErrInvalidStoragePool      = virterr.ErrInvalidStoragePool
+	ErrInvalidStorageVol       = virterr.ErrInvalidStorageVol
+	WarNoStorage               = virterr.WarNoStorage
+	ErrNoStoragePool           = virterr.ErrNoStoragePool
+	ErrNoStorageVol            = virterr.ErrNoStorageVol
+	WarNoNode                  = virterr.WarNoNode
+	ErrInvalidNodeDevice       = virterr.ErrInvalidNodeDevice
+	ErrNoNodeDevice            = virterr.ErrNoNodeDevice
+	ErrNoSecurityModel         = virterr.ErrNoSecurityModel
+	ErrOperationInvalid        = virterr.ErrOperationInvalid
+	WarNoInterface             = virterr.WarNoInterface
+	ErrNoInterface             = virterr.ErrNoInterface
+	ErrInvalidInterface        = virterr.ErrInvalidInterface
+	ErrMultipleInterfaces      = virterr.ErrMultipleInterfaces
+	WarNoNwFilter              = virterr.WarNoNwFilter
+	ErrInvalidNwFilter         = virterr.ErrInvalidNwFilter
+	ErrNoNwFilter              = virterr.ErrNoNwFilter
+	ErrBuildFirewall           = virterr.ErrBuildFirewall
+	WarNoSecret                = virterr.WarNoSecret
+	ErrInvalidSecret           = virterr.ErrInvalidSecret
+	ErrNoSecret                = virterr.ErrNoSecret
+	ErrConfigUnsupported       = virterr.ErrConfigUnsupported
+	ErrOperationTimeout        = virterr.ErrOperationTimeout
+	ErrMigratePersistFailed    = virterr.ErrMigratePersistFailed
+	ErrHookScriptFailed        = virterr.ErrHookScriptFailed
+	ErrInvalidDomainSnapshot   = virterr.ErrInvalidDomainSnapshot
+	ErrNoDomainSnapshot        = virterr.ErrNoDomainSnapshot
+	ErrInvalidStream           = virterr.ErrInvalidStream
+	ErrArgumentUnsupported     = virterr.ErrArgumentUnsupported
+	ErrStorageProbeFailed      = virterr.ErrStorageProbeFailed
+	ErrStoragePoolBuilt        = virterr.ErrStoragePoolBuilt
+	ErrSnapshotRevertRisky     = virterr.ErrSnapshotRevertRisky
+	ErrOperationAborted        = virterr.ErrOperationAborted
+	ErrAuthCancelled           = virterr.ErrAuthCancelled
+	ErrNoDomainMetadata        = virterr.ErrNoDomainMetadata
+	ErrMigrateUnsafe           = virterr.ErrMigrateUnsafe
+	ErrOverflow                = virterr.ErrOverflow
+	ErrBlockCopyActive         = virterr.ErrBlockCopyActive
+	ErrOperationUnsupported    = virterr.ErrOperationUnsupported
+	ErrSSH                     = virterr.ErrSSH
+	ErrAgentUnresponsive       = virterr.ErrAgentUnresponsive
+	ErrResourceBusy            = virterr.ErrResourceBusy
+	ErrAccessDenied            = virterr.ErrAccessDenied
+	ErrDBusService             = virterr.ErrDBusService
+	ErrStorageVolExist         = virterr.ErrStorageVolExist
+	ErrCPUIncompatible         = virterr.ErrCPUIncompatible
+	ErrInvalidDomainCheckpoint = virterr.ErrInvalidDomainCheckpoint
+	ErrNoDomainCheckpoint      = virterr.ErrNoDomainCheckpoint
+)
+
+// ErrorDomain describes what part of the library raised the error. The type is
+// shared with the cgo package.
+type ErrorDomain = virterr.Domain
+
+// Possible values for ErrorDomain.
+const (
+	ErrDomNone             = virterr.ErrDomNone
+	ErrDomXen              = virterr.ErrDomXen
+	ErrDomXend             = virterr.ErrDomXend
+	ErrDomXenStore         = virterr.ErrDomXenStore
+	ErrDomSExpr            = virterr.ErrDomSExpr
+	ErrDomXML              = virterr.ErrDomXML
+	ErrDomDom              = virterr.ErrDomDom
+	ErrDomRPC              = virterr.ErrDomRPC
+	ErrDomProxy            = virterr.ErrDomProxy
+	ErrDomConf             = virterr.ErrDomConf
+	ErrDomQEMU             = virterr.ErrDomQEMU
+	ErrDomNet              = virterr.ErrDomNet
+	ErrDomTest             = virterr.ErrDomTest
+	ErrDomRemote           = virterr.ErrDomRemote
+	ErrDomOpenVZ           = virterr.ErrDomOpenVZ
+	ErrDomXenXM            = virterr.ErrDomXenXM
+	ErrDomStatsLinux       = virterr.ErrDomStatsLinux
+	ErrDomLXC              = virterr.ErrDomLXC
+	ErrDomStorage          = virterr.ErrDomStorage
+	ErrDomNetwork          = virterr.ErrDomNetwork
+	ErrDomDomain           = virterr.ErrDomDomain
+	ErrDomUML              = virterr.ErrDomUML
+	ErrDomNodeDev          = virterr.ErrDomNodeDev
+	ErrDomXenInotify       = virterr.ErrDomXenInotify
+	ErrDomSecurity         = virterr.ErrDomSecurity
+	ErrDomVBox             = virterr.ErrDomVBox
+	ErrDomInterface        = virterr.ErrDomInterface
+	ErrDomONE              = virterr.ErrDomONE
+	ErrDomESX              = virterr.ErrDomESX
+	ErrDomPHYP             = virterr.ErrDomPHYP
+	ErrDomSecret           = virterr.ErrDomSecret
+	ErrDomCPU              = virterr.ErrDomCPU
+	ErrDomXenAPI           = virterr.ErrDomXenAPI
+	ErrDomNwFilter         = virterr.ErrDomNwFilter
+	ErrDomHook             = virterr.ErrDomHook
+	ErrDomDomainSnapshot   = virterr.ErrDomDomainSnapshot
+	ErrDomAudit            = virterr.ErrDomAudit
+	ErrDomSysinfo          = virterr.ErrDomSysinfo
+	ErrDomStreams          = virterr.ErrDomStreams
+	ErrDomVMWare           = virterr.ErrDomVMWare
+	ErrDomEvent            = virterr.ErrDomEvent
+	ErrDomLibXL            = virterr.ErrDomLibXL
+	ErrDomLocking          = virterr.ErrDomLocking
+	ErrDomHyperv           = virterr.ErrDomHyperv
+	ErrDomCapabilities     = virterr.ErrDomCapabilities
+	ErrDomURI              = virterr.ErrDomURI
+	ErrDomAuth             = virterr.ErrDomAuth
+	ErrDomDBus             = virterr.ErrDomDBus
+	ErrDomParallels        = virterr.ErrDomParallels
+	ErrDomDevice           = virterr.ErrDomDevice
+	ErrDomSSH              = virterr.ErrDomSSH
+	ErrDomLockspace        = virterr.ErrDomLockspace
+	ErrDomInitctl          = virterr.ErrDomInitctl
+	ErrDomIdentity         = virterr.ErrDomIdentity
+	ErrDomCgroup           = virterr.ErrDomCgroup
+	ErrDomAccess           = virterr.ErrDomAccess
+	ErrDomSystemd          = virterr.ErrDomSystemd
+	ErrDomBhyve            = virterr.ErrDomBhyve
+	ErrDomCrypto           = virterr.ErrDomCrypto
+	ErrDomFirewall         = virterr.ErrDomFirewall
+	ErrDomDomainCheckpoint = virterr.ErrDomDomainCheckpoint
+)
+
+// ErrorLevel specifies how consequent is the error. The type is shared with the
+// cgo package.
+type ErrorLevel = virterr.Level
+
+// Possible values for ErrorLevel.
+const (
+	ErrLvlNone    = virterr.ErrLvlNone
+	ErrLvlWarning = virterr.ErrLvlWarning
+	ErrLvlError   = virterr.ErrLvlError
+)
+
+// Error is an error reported by the libvirt server. The type is shared with the
+// cgo package, so its error predicates (e.g. libvirt.IsNotFound) and errors.As
+// with a *libvirt.Error work with the errors returned by this package.
+type Error = virterr.Error
+
+// decodeError decodes a remote_error structure, sent by the server when a
+// call fails.
+func decodeError(payload []byte) error {
+	d := decoder{data: payload}
+
+	var err Error
+	err.Code = ErrorCode(d.readInt32())
+	err.Domain = ErrorDomain(d.readInt32())
+	err.Message = d.readOptString()
+	err.Level = ErrorLevel(d.readInt32())
+	if d.readBool() {
+		// the domain related to the error: not exposed
+		d.readString()
+		d.readFixedOpaque(uuidSize)
+		d.readInt32()
+	}
+	err.Str1 = d.readOptString()
+	err.Str2 = d.readOptString()
+	err.Str3 = d.readOptString()
+	err.Int1 = d.readInt32()
+	err.Int2 = d.readInt32()
+	// the network related to the error is ignored
+
+	if d.err != nil {
+		return fmt.Errorf("remote: cannot decode error: %v", d.err)
+	}
+
+	return &err
+}
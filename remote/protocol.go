@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Program numbers and versions, as defined by the libvirt remote protocol.
+const (
+	remoteProgram            = 0x20008086
+	remoteProtocolVersion    = 1
+	keepAliveProgram         = 0x6b656570
+	keepAliveProtocolVersion = 1
+)
+
+// Procedures of the keepalive program.
+const (
+	procKeepAlivePing = 1
+	procKeepAlivePong = 2
+)
+
+// Procedures of the remote program (see remote_protocol.x in libvirt).
+const (
+	procConnectOpen                   = 1
+	procConnectClose                  = 2
+	procConnectGetType                = 3
+	procConnectGetVersion             = 4
+	procConnectGetMaxVCPUs            = 5
+	procConnectGetCapabilities        = 7
+	procDomainCreate                  = 9
+	procDomainCreateXML               = 10
+	procDomainDefineXML               = 11
+	procDomainDestroy                 = 12
+	procDomainGetXMLDesc              = 14
+	procDomainGetAutostart            = 15
+	procDomainGetInfo                 = 16
+	procDomainGetMaxMemory            = 17
+	procDomainGetOSType               = 19
+	procDomainLookupByID              = 22
+	procDomainLookupByName            = 23
+	procDomainLookupByUUID            = 24
+	procDomainReboot                  = 27
+	procDomainResume                  = 28
+	procDomainSetAutostart            = 29
+	procDomainShutdown                = 33
+	procDomainSuspend                 = 34
+	procDomainUndefine                = 35
+	procConnectGetHostname            = 59
+	procConnectFindStoragePoolSources = 75
+	procStoragePoolCreateXML          = 76
+	procStoragePoolDefineXML          = 77
+	procStoragePoolCreate             = 78
+	procStoragePoolBuild              = 79
+	procStoragePoolDestroy            = 80
+	procStoragePoolDelete             = 81
+	procStoragePoolUndefine           = 82
+	procStoragePoolRefresh            = 83
+	procStoragePoolLookupByName       = 84
+	procStoragePoolLookupByUUID       = 85
+	procStoragePoolGetInfo            = 87
+	procStoragePoolGetXMLDesc         = 88
+	procStoragePoolGetAutostart       = 89
+	procStoragePoolSetAutostart       = 90
+	procConnectGetURI                 = 110
+	procSecretLookupByUUID            = 141
+	procSecretDefineXML               = 142
+	procSecretGetXMLDesc              = 143
+	procSecretSetValue                = 144
+	procSecretGetValue                = 145
+	procSecretUndefine                = 146
+	procSecretLookupByUsage           = 147
+	procDomainIsActive                = 150
+	procDomainIsPersistent            = 151
+	procStoragePoolIsActive           = 154
+	procStoragePoolIsPersistent       = 155
+	procConnectGetLibVersion          = 157
+	procDomainCreateWithFlags         = 196
+	procDomainGetState                = 212
+	procDomainUndefineFlags           = 231
+	procDomainDestroyFlags            = 234
+	procDomainReset                   = 245
+	procDomainShutdownFlags           = 258
+)
+
+// messageType is the type of a message exchanged with the server.
+type messageType uint32
+
+// Possible values for messageType.
+const (
+	messageCall    messageType = 0
+	messageReply   messageType = 1
+	messageMessage messageType = 2
+	messageStream  messageType = 3
+)
+
+// messageStatus is the status of a message exchanged with the server.
+type messageStatus uint32
+
+// Possible values for messageStatus.
+const (
+	statusOK       messageStatus = 0
+	statusError    messageStatus = 1
+	statusContinue messageStatus = 2
+)
+
+const (
+	// lengthSize is the size of the length which prefixes every packet.
+	lengthSize = 4
+
+	// headerSize is the size of the header of every packet.
+	headerSize = 24
+
+	// maxPacketSize is the maximum size of a packet accepted by the client
+	// (the same limit used by libvirt).
+	maxPacketSize = 32 * 1024 * 1024
+)
+
+// errPacketSize is returned when a packet has an invalid size.
+var errPacketSize = errors.New("remote: invalid packet size")
+
+// header is the header of every packet exchanged with the server.
+type header struct {
+	Program   uint32
+	Version   uint32
+	Procedure int32
+	Type      messageType
+	Serial    uint32
+	Status    messageStatus
+}
+
+// packet is a message exchanged with the server.
+type packet struct {
+	header
+	Payload []byte
+}
+
+// writePacket encodes "pkt" and writes it to "w" in a single call.
+func writePacket(w io.Writer, pkt packet) error {
+	size := lengthSize + headerSize + len(pkt.Payload)
+	if size > maxPacketSize {
+		return errPacketSize
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:], uint32(size))
+	binary.BigEndian.PutUint32(buf[4:], pkt.Program)
+	binary.BigEndian.PutUint32(buf[8:], pkt.Version)
+	binary.BigEndian.PutUint32(buf[12:], uint32(pkt.Procedure))
+	binary.BigEndian.PutUint32(buf[16:], uint32(pkt.Type))
+	binary.BigEndian.PutUint32(buf[20:], pkt.Serial)
+	binary.BigEndian.PutUint32(buf[24:], uint32(pkt.Status))
+	copy(buf[lengthSize+headerSize:], pkt.Payload)
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// readPacket reads the next packet from "r".
+func readPacket(r io.Reader) (packet, error) {
+	var lenBuf [lengthSize]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return packet{}, err
+	}
+
+	size := binary.BigEndian.Uint32(lenBuf[:])
+	if size < lengthSize+headerSize || size > maxPacketSize {
+		return packet{}, errPacketSize
+	}
+
+	buf := make([]byte, size-lengthSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return packet{}, err
+	}
+
+	pkt := packet{
+		header: header{
+			Program:   binary.BigEndian.Uint32(buf[0:]),
+			Version:   binary.BigEndian.Uint32(buf[4:]),
+			Procedure: int32(binary.BigEndian.Uint32(buf[8:])),
+			Type:      messageType(binary.BigEndian.Uint32(buf[12:])),
+			Serial:    binary.BigEndian.Uint32(buf[16:]),
+			Status:    messageStatus(binary.BigEndian.Uint32(buf[20:])),
+		},
+		Payload: buf[headerSize:],
+	}
+
+	return pkt, nil
+}
@@ -0,0 +1,109 @@
+package remote
+
+// Secret holds a libvirt secret. There are no exported fields.
+type Secret struct {
+	conn      *Connection
+	uuid      []byte
+	usageType SecretUsageType
+	usageID   string
+}
+
+// SecretUsageType defines a type of secret. It has the same values as in the
+// cgo package.
+type SecretUsageType uint32
+
+// Possible values for SecretUsageType.
+const (
+	SecUsageTypeNone   SecretUsageType = 0
+	SecUsageTypeVolume SecretUsageType = 1
+	SecUsageTypeCeph   SecretUsageType = 2
+	SecUsageTypeISCSI  SecretUsageType = 3
+	SecUsageTypeTLS    SecretUsageType = 4
+	SecUsageTypeVTPM   SecretUsageType = 5
+)
+
+// decodeSecret decodes a remote_nonnull_secret structure.
+func (conn *Connection) decodeSecret(d *decoder) Secret {
+	return Secret{
+		conn:      conn,
+		uuid:      d.readFixedOpaque(uuidSize),
+		usageType: SecretUsageType(d.readInt32()),
+		usageID:   d.readString(),
+	}
+}
+
+// encode encodes the secret as a remote_nonnull_secret structure.
+func (sec Secret) encode(e *encoder) {
+	e.writeFixedOpaque(sec.uuid)
+	e.writeInt32(int32(sec.usageType))
+	e.writeString(sec.usageID)
+}
+
+// Free frees the secret object. It exists for compatibility with the cgo
+// package; there are no resources held by the client.
+func (sec Secret) Free() error {
+	return nil
+}
+
+// UUID fetches the UUID of the secret.
+func (sec Secret) UUID() (string, error) {
+	return formatUUID(sec.uuid), nil
+}
+
+// UsageType gets the type of object which uses this secret.
+func (sec Secret) UsageType() (SecretUsageType, error) {
+	return sec.usageType, nil
+}
+
+// UsageID gets the unique identifier of the object with which this secret is
+// to be used.
+func (sec Secret) UsageID() (string, error) {
+	return sec.usageID, nil
+}
+
+// Undefine deletes the specified secret. This does not free the associated
+// secret object.
+func (sec Secret) Undefine() error {
+	var e encoder
+	sec.encode(&e)
+
+	_, err := sec.conn.call(procSecretUndefine, e.bytes())
+	return err
+}
+
+// XML fetches an XML document describing attributes of the secret.
+func (sec Secret) XML() (string, error) {
+	var e encoder
+	sec.encode(&e)
+	e.writeUint32(0)
+
+	return sec.conn.callString(procSecretGetXMLDesc, e.bytes())
+}
+
+// SetValue sets the value associated with a secret.
+func (sec Secret) SetValue(value string) error {
+	var e encoder
+	sec.encode(&e)
+	e.writeOpaque([]byte(value))
+	e.writeUint32(0)
+
+	_, err := sec.conn.call(procSecretSetValue, e.bytes())
+	return err
+}
+
+// Value fetches the value associated with a secret.
+func (sec Secret) Value() (string, error) {
+	var e encoder
+	sec.encode(&e)
+	e.writeUint32(0)
+
+	ret, err := sec.conn.call(procSecretGetValue, e.bytes())
+	if err != nil {
+		return "", err
+	}
+
+	d := decoder{data: ret}
+	value := d.readOpaque()
+
+	return string(value), d.err
+}
@@ -0,0 +1,220 @@
+package remote
+
+// StoragePool holds a libvirt storage pool. There are no exported fields.
+type StoragePool struct {
+	conn *Connection
+	name string
+	uuid []byte
+}
+
+// StoragePoolState represents the state of a storage pool. It has the same
+// values as in the cgo package.
+type StoragePoolState uint32
+
+// Possible values for StoragePoolState.
+const (
+	PoolStateInactive     StoragePoolState = 0
+	PoolStateBuilding     StoragePoolState = 1
+	PoolStateRunning      StoragePoolState = 2
+	PoolStateDegraded     StoragePoolState = 3
+	PoolStateInaccessible StoragePoolState = 4
+)
+
+// StoragePoolDeleteFlag defines how a storage pool should be deleted.
+type StoragePoolDeleteFlag uint32
+
+// Possible values for StoragePoolDeleteFlag.
+const (
+	PoolDeleteNormal StoragePoolDeleteFlag = 0
+	PoolDeleteZeroed StoragePoolDeleteFlag = 1
+)
+
+// StoragePoolBuildFlag defines how a storage pool should be built.
+type StoragePoolBuildFlag uint32
+
+// Possible values for StoragePoolBuildFlag.
+const (
+	PoolBuildNew         StoragePoolBuildFlag = 0
+	PoolBuildRepair      StoragePoolBuildFlag = 1
+	PoolBuildResize      StoragePoolBuildFlag = 2
+	PoolBuildNoOverwrite StoragePoolBuildFlag = 4
+	PoolBuildOverwrite   StoragePoolBuildFlag = 8
+)
+
+// StorageXMLFlag defines how the XML content should be read from a storage
+// resource.
+type StorageXMLFlag uint32
+
+// Possible values for StorageXMLFlag.
+const (
+	StorageXMLDefault  StorageXMLFlag = 0
+	StorageXMLInactive StorageXMLFlag = 1
+)
+
+// decodeStoragePool decodes a remote_nonnull_storage_pool structure.
+func (conn *Connection) decodeStoragePool(d *decoder) StoragePool {
+	return StoragePool{
+		conn: conn,
+		name: d.readString(),
+		uuid: d.readFixedOpaque(uuidSize),
+	}
+}
+
+// args encodes the storage pool followed by "flags", which is the argument
+// list of most storage pool procedures.
+func (pool StoragePool) args(flags ...uint32) []byte {
+	var e encoder
+	e.writeString(pool.name)
+	e.writeFixedOpaque(pool.uuid)
+	for _, f := range flags {
+		e.writeUint32(f)
+	}
+
+	return e.bytes()
+}
+
+// callVoid invokes "proc" for the storage pool, ignoring the reply payload.
+func (pool StoragePool) callVoid(proc int32, flags ...uint32) error {
+	_, err := pool.conn.call(proc, pool.args(flags...))
+	return err
+}
+
+// callBool invokes "proc" for the storage pool and decodes an int reply as a
+// bool.
+func (pool StoragePool) callBool(proc int32) (bool, error) {
+	v, err := pool.conn.callInt32(proc, pool.args())
+	return v == 1, err
+}
+
+// Free frees the storage pool object. It exists for compatibility with the cgo
+// package; there are no resources held by the client.
+func (pool StoragePool) Free() error {
+	return nil
+}
+
+// Name fetches the locally unique name of the storage pool.
+func (pool StoragePool) Name() (string, error) {
+	return pool.name, nil
+}
+
+// UUID fetches the globally unique ID of the storage pool as a string.
+func (pool StoragePool) UUID() (string, error) {
+	return formatUUID(pool.uuid), nil
+}
+
+// Undefine undefines an inactive storage pool.
+func (pool StoragePool) Undefine() error {
+	return pool.callVoid(procStoragePoolUndefine)
+}
+
+// Create starts an inactive storage pool.
+func (pool StoragePool) Create() error {
+	return pool.callVoid(procStoragePoolCreate, 0)
+}
+
+// Destroy destroys an active storage pool. This will deactivate the pool on
+// the host, but keep any persistent config associated with it.
+func (pool StoragePool) Destroy() error {
+	return pool.callVoid(procStoragePoolDestroy)
+}
+
+// Delete deletes the underlying pool resources. This is a non-recoverable
+// operation. The storage pool object itself is not free'd.
+func (pool StoragePool) Delete(flags StoragePoolDeleteFlag) error {
+	return pool.callVoid(procStoragePoolDelete, uint32(flags))
+}
+
+// Build builds the underlying storage pool.
+func (pool StoragePool) Build(flags StoragePoolBuildFlag) error {
+	return pool.callVoid(procStoragePoolBuild, uint32(flags))
+}
+
+// Refresh requests that the storage pool refreshes its list of volumes.
+func (pool StoragePool) Refresh() error {
+	return pool.callVoid(procStoragePoolRefresh, 0)
+}
+
+// IsActive determines if the storage pool is currently running.
+func (pool StoragePool) IsActive() (bool, error) {
+	return pool.callBool(procStoragePoolIsActive)
+}
+
+// IsPersistent determines if the storage pool has a persistent configuration
+// which means it will still exist after shutting down.
+func (pool StoragePool) IsPersistent() (bool, error) {
+	return pool.callBool(procStoragePoolIsPersistent)
+}
+
+// XML fetches an XML document describing all aspects of the storage pool.
+// This is suitable for later feeding back into the DefineStoragePool function
+// to recreate the storage pool.
+func (pool StoragePool) XML(flags StorageXMLFlag) (string, error) {
+	return pool.conn.callString(procStoragePoolGetXMLDesc, pool.args(uint32(flags)))
+}
+
+// Autostart fetches the value of the autostart flag, which determines whether
+// the pool is automatically started at boot time.
+func (pool StoragePool) Autostart() (bool, error) {
+	return pool.callBool(procStoragePoolGetAutostart)
+}
+
+// SetAutostart sets the autostart flag.
+func (pool StoragePool) SetAutostart(autostart bool) error {
+	var e encoder
+	e.writeString(pool.name)
+	e.writeFixedOpaque(pool.uuid)
+	e.writeBool(autostart)
+
+	_, err := pool.conn.call(procStoragePoolSetAutostart, e.bytes())
+	return err
+}
+
+// storagePoolInfo is the reply of the STORAGE_POOL_GET_INFO procedure.
+type storagePoolInfo struct {
+	state      StoragePoolState
+	capacity   uint64
+	allocation uint64
+	available  uint64
+}
+
+// info reads volatile information about the storage pool.
+func (pool StoragePool) info() (storagePoolInfo, error) {
+	ret, err := pool.conn.call(procStoragePoolGetInfo, pool.args())
+	if err != nil {
+		return storagePoolInfo{}, err
+	}
+
+	d := decoder{data: ret}
+	info := storagePoolInfo{
+		state:      StoragePoolState(d.readUint32()),
+		capacity:   d.readUint64(),
+		allocation: d.readUint64(),
+		available:  d.readUint64(),
+	}
+
+	return info, d.err
+}
+
+// InfoState returns the running state of the storage pool.
+func (pool StoragePool) InfoState() (StoragePoolState, error) {
+	info, err := pool.info()
+	return info.state, err
+}
+
+// InfoCapacity returns the logical size bytes of the storage pool.
+func (pool StoragePool) InfoCapacity() (uint64, error) {
+	info, err := pool.info()
+	return info.capacity, err
+}
+
+// InfoAllocation returns the current allocation bytes of the storage pool.
+func (pool StoragePool) InfoAllocation() (uint64, error) {
+	info, err := pool.info()
+	return info.allocation, err
+}
+
+// InfoAvailable returns the remaining free space bytes of the storage pool.
+func (pool StoragePool) InfoAvailable() (uint64, error) {
+	info, err := pool.info()
+	return info.available, err
+}
@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// errShortBuffer is returned when decoding data which ended prematurely.
+var errShortBuffer = errors.New("remote: XDR data is too short")
+
+// uuidSize is the size of a binary UUID, as used by the remote protocol.
+const uuidSize = 16
+
+// encoder writes values encoded with XDR (RFC 4506), which is the format used
+// by the libvirt remote protocol.
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// bytes returns the data encoded so far.
+func (e *encoder) bytes() []byte {
+	return e.buf.Bytes()
+}
+
+func (e *encoder) writeUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) writeInt32(v int32) {
+	e.writeUint32(uint32(v))
+}
+
+func (e *encoder) writeUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.writeUint32(1)
+	} else {
+		e.writeUint32(0)
+	}
+}
+
+// writePadding aligns the data written after "n" bytes to 4 bytes.
+func (e *encoder) writePadding(n int) {
+	if pad := (4 - n%4) % 4; pad > 0 {
+		e.buf.Write(make([]byte, pad))
+	}
+}
+
+// writeFixedOpaque writes data whose length is known by both sides.
+func (e *encoder) writeFixedOpaque(data []byte) {
+	e.buf.Write(data)
+	e.writePadding(len(data))
+}
+
+// writeOpaque writes variable-length data, prefixed by its length.
+func (e *encoder) writeOpaque(data []byte) {
+	e.writeUint32(uint32(len(data)))
+	e.writeFixedOpaque(data)
+}
+
+// writeString writes a non-null string (remote_nonnull_string).
+func (e *encoder) writeString(s string) {
+	e.writeOpaque([]byte(s))
+}
+
+// writeOptString writes an optional string (remote_string). A nil pointer is
+// encoded as NULL.
+func (e *encoder) writeOptString(s *string) {
+	e.writeBool(s != nil)
+	if s != nil {
+		e.writeString(*s)
+	}
+}
+
+// decoder reads values encoded with XDR. The first error is kept and every
+// following read returns zero values, so it only needs to be checked once, at
+// the end.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// next returns the next "n" bytes of data.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(d.data) < n {
+		d.err = errShortBuffer
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *decoder) readUint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) readInt32() int32 {
+	return int32(d.readUint32())
+}
+
+func (d *decoder) readUint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) readBool() bool {
+	return d.readUint32() != 0
+}
+
+// readFixedOpaque reads "n" bytes of data whose length is known by both sides.
+func (d *decoder) readFixedOpaque(n int) []byte {
+	b := d.next(n)
+	d.next((4 - n%4) % 4)
+
+	if d.err != nil {
+		return nil
+	}
+
+	data := make([]byte, n)
+	copy(data, b)
+
+	return data
+}
+
+// readOpaque reads variable-length data, prefixed by its length.
+func (d *decoder) readOpaque() []byte {
+	n := d.readUint32()
+	if d.err != nil {
+		return nil
+	}
+
+	if uint64(n) > uint64(len(d.data)) {
+		d.err = errShortBuffer
+		return nil
+	}
+
+	return d.readFixedOpaque(int(n))
+}
+
+// readString reads a non-null string (remote_nonnull_string).
+func (d *decoder) readString() string {
+	return string(d.readOpaque())
+}
+
+// readOptString reads an optional string (remote_string). NULL is decoded as
+// an empty string.
+func (d *decoder) readOptString() string {
+	if !d.readBool() {
+		return ""
+	}
+
+	return d.readString()
+}
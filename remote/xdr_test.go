@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestXDRRoundTrip(t *testing.T) {
+	name := "abcde"
+
+	var e encoder
+	e.writeUint32(7)
+	e.writeInt32(-1)
+	e.writeUint64(1 << 40)
+	e.writeBool(true)
+	e.writeString(name)
+	e.writeOptString(nil)
+	e.writeOptString(&name)
+	e.writeOpaque([]byte{1, 2, 3})
+
+	// strings and opaque data are padded to 4 bytes
+	if size := len(e.bytes()); size != 4+4+8+4+12+4+16+8 {
+		t.Fatalf("unexpected encoded size: %v", size)
+	}
+
+	d := decoder{data: e.bytes()}
+	if v := d.readUint32(); v != 7 {
+		t.Errorf("unexpected uint32; got=%v, want=7", v)
+	}
+	if v := d.readInt32(); v != -1 {
+		t.Errorf("unexpected int32; got=%v, want=-1", v)
+	}
+	if v := d.readUint64(); v != 1<<40 {
+		t.Errorf("unexpected uint64; got=%v, want=%v", v, uint64(1<<40))
+	}
+	if v := d.readBool(); !v {
+		t.Error("unexpected bool; got=false, want=true")
+	}
+	if v := d.readString(); v != name {
+		t.Errorf("unexpected string; got=%v, want=%v", v, name)
+	}
+	if v := d.readOptString(); v != "" {
+		t.Errorf("unexpected NULL string; got=%v", v)
+	}
+	if v := d.readOptString(); v != name {
+		t.Errorf("unexpected optional string; got=%v, want=%v", v, name)
+	}
+	if v := d.readOpaque(); !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("unexpected opaque data; got=%v", v)
+	}
+
+	if d.err != nil {
+		t.Error(d.err)
+	}
+	if len(d.data) != 0 {
+		t.Errorf("%v bytes left after decoding", len(d.data))
+	}
+}
+
+func TestXDRShortBuffer(t *testing.T) {
+	// a string claiming to be longer than the data
+	d := decoder{data: []byte{0, 0, 0, 8, 'a', 'b', 'c', 'd'}}
+	if s := d.readString(); s != "" {
+		t.Errorf("unexpected string; got=%q", s)
+	}
+
+	if d.err != errShortBuffer {
+		t.Errorf("unexpected error; got=%v, want=%v", d.err, errShortBuffer)
+	}
+
+	// following reads keep failing
+	if v := d.readUint32(); v != 0 || d.err != errShortBuffer {
+		t.Errorf("unexpected read after error; got=%v, %v", v, d.err)
+	}
+}
@@ -4,7 +4,9 @@ package libvirt
 // #include <libvirt/libvirt.h>
 import "C"
 import (
-	"log"
+	"errors"
+	"log/slog"
+	"runtime"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -30,27 +32,35 @@ const (
 	SecUsageTypeVolume SecretUsageType = C.VIR_SECRET_USAGE_TYPE_VOLUME
 	SecUsageTypeCeph   SecretUsageType = C.VIR_SECRET_USAGE_TYPE_CEPH
 	SecUsageTypeISCSI  SecretUsageType = C.VIR_SECRET_USAGE_TYPE_ISCSI
+	SecUsageTypeTLS    SecretUsageType = C.VIR_SECRET_USAGE_TYPE_TLS
+	SecUsageTypeVTPM   SecretUsageType = C.VIR_SECRET_USAGE_TYPE_VTPM
 )
 
 // Secret holds a libvirt secret. There are no exported fields.
 type Secret struct {
-	log       *log.Logger
+	log       *logger
 	virSecret C.virSecretPtr
+	handle    *handle
 }
 
 // Free releases the secret handle. The underlying secret continues to exist.
 func (sec Secret) Free() error {
-	sec.log.Println("freeing secret...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("freeing secret")
 	cRet := C.virSecretFree(sec.virSecret)
 	ret := int(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	sec.log.Println("secret freed")
+	sec.handle.release()
+	op.done("secret freed")
 
 	return nil
 }
@@ -58,61 +68,89 @@ func (sec Secret) Free() error {
 // Undefine deletes the specified secret. This does not free the associated
 // "Secret" object.
 func (sec Secret) Undefine() error {
-	sec.log.Println("undefining secret...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("undefining secret")
 	cRet := C.virSecretUndefine(sec.virSecret)
 	ret := int(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	sec.log.Println("secret undefined")
+	op.done("secret undefined")
 
 	return nil
 }
 
 // UUID fetches the UUID of the secret.
 func (sec Secret) UUID() (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
 	cUUID := (*C.char)(C.malloc(C.size_t(C.VIR_UUID_STRING_BUFLEN)))
 	defer C.free(unsafe.Pointer(cUUID))
 
-	sec.log.Println("reading secret UUID...")
+	op := sec.log.begin("reading secret UUID")
 	cRet := C.virSecretGetUUIDString(sec.virSecret, cUUID)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	uuid := C.GoString(cUUID)
-	sec.log.Printf("UUID: %v\n", uuid)
+	op.done("UUID read", "uuid", uuid)
 
 	return uuid, nil
 }
 
 // XML fetches an XML document describing attributes of the secret.
 func (sec Secret) XML() (string, error) {
-	sec.log.Println("reading secret XML...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("reading secret XML")
 	cXML := C.virSecretGetXMLDesc(sec.virSecret, 0)
 
 	if cXML == nil {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cXML))
 
 	xml := C.GoString(cXML)
 
-	sec.log.Printf("XML length: %v runes\n", utf8.RuneCountInString(xml))
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
 
 	return xml, nil
 }
 
+// Definition reads the XML description of the secret and parses it into a
+// SecretDef.
+func (sec Secret) Definition() (*SecretDef, error) {
+	doc, err := sec.XML()
+	if err != nil {
+		return nil, err
+	}
+
+	def := &SecretDef{}
+	if err := def.Unmarshal(doc); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
 // UsageID gets the unique identifier of the object with which this secret is to
 // be used. The format of the identifier is dependant on the usage type of the
 // secret. For a secret with a usage type of SecUsageTypeVolume the identifier
@@ -120,18 +158,22 @@ func (sec Secret) XML() (string, error) {
 // within the set of all secrets sharing the same usage type. ie, there shall
 // only ever be one secret for each volume path.
 func (sec Secret) UsageID() (string, error) {
-	sec.log.Println("reading secret usage ID...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("reading secret usage ID")
 	cUsageID := C.virSecretGetUsageID(sec.virSecret)
 
 	if cUsageID == nil {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	usageID := C.GoString(cUsageID)
 
-	sec.log.Printf("usage ID: %v\n", usageID)
+	op.done("usage ID read", "id", usageID)
 
 	return usageID, nil
 }
@@ -141,62 +183,210 @@ func (sec Secret) UsageID() (string, error) {
 // values may be added to this enumeration in the future, so callers should
 // expect to see usage types they do not explicitly know about.
 func (sec Secret) UsageType() (SecretUsageType, error) {
-	sec.log.Println("reading secret usage type...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("reading secret usage type")
 	cUsageType := C.virSecretGetUsageType(sec.virSecret)
 
 	if cUsageType == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	usageType := SecretUsageType(cUsageType)
 
-	sec.log.Printf("usage type: %v\n", usageType)
+	op.done("usage type read", "type", usageType)
 
 	return usageType, nil
 }
 
-// SetValue sets the value of a secret.
+// SecretValue holds the value of a secret, which may contain any bytes. It's
+// not formatted by the fmt package, log/slog nor encoding/json (or any other
+// encoder which uses encoding.TextMarshaler), so it doesn't end up in logs by
+// mistake; call Wipe once it's no longer needed.
+type SecretValue []byte
+
+// String hides the value of the secret.
+func (value SecretValue) String() string {
+	return "[secret value]"
+}
+
+// GoString hides the value of the secret.
+func (value SecretValue) GoString() string {
+	return value.String()
+}
+
+// LogValue hides the value of the secret from log/slog.
+func (value SecretValue) LogValue() slog.Value {
+	return slog.StringValue(value.String())
+}
+
+// MarshalText hides the value of the secret from encoders such as
+// encoding/json.
+func (value SecretValue) MarshalText() ([]byte, error) {
+	return []byte(value.String()), nil
+}
+
+// Wipe overwrites the value of the secret with zeros.
+func (value SecretValue) Wipe() {
+	for i := range value {
+		value[i] = 0
+	}
+}
+
+// wipeC overwrites "size" bytes of the C buffer "ptr" with zeros.
+func wipeC(ptr unsafe.Pointer, size C.size_t) {
+	SecretValue(unsafe.Slice((*byte)(ptr), int(size))).Wipe()
+}
+
+// SetValue sets the value of a secret. See "<Secret>.SetValueBytes".
 func (sec Secret) SetValue(value string) error {
+	return sec.SetValueBytes([]byte(value))
+}
+
+// SetValueBytes sets the value of a secret. The value may contain any bytes,
+// including NUL. The copy passed to libvirt is wiped once it's set; "value"
+// itself is kept as is.
+func (sec Secret) SetValueBytes(value []byte) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
 	cSize := C.size_t(len(value))
-	cValue := (*C.uchar)(unsafe.Pointer(C.CString(value)))
+	cValue := C.malloc(cSize + 1)
+	defer C.free(cValue)
+	defer wipeC(cValue, cSize)
+
+	copy(unsafe.Slice((*byte)(cValue), len(value)), value)
 
-	sec.log.Printf("setting secret value (%v)...\n", value)
-	cRet := C.virSecretSetValue(sec.virSecret, cValue, cSize, 0)
+	op := sec.log.begin("setting secret value", "bytes", len(value))
+	cRet := C.virSecretSetValue(sec.virSecret, (*C.uchar)(cValue), cSize, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	sec.log.Println("value set")
+	op.done("value set")
 
 	return nil
 }
 
-// Value fetches the value of a secret.
+// Value fetches the value of a secret. See "<Secret>.ValueBytes".
 func (sec Secret) Value() (string, error) {
+	value, err := sec.ValueBytes()
+	if err != nil {
+		return "", err
+	}
+	defer value.Wipe()
+
+	return string(value), nil
+}
+
+// ValueBytes fetches the value of a secret, which may contain any bytes. The
+// buffer returned by libvirt is wiped once it's copied.
+func (sec Secret) ValueBytes() (SecretValue, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
 	var cSize C.size_t
 
-	sec.log.Println("reading secret value...")
+	op := sec.log.begin("reading secret value")
 	cValue := C.virSecretGetValue(sec.virSecret, &cSize, 0)
 
 	if cValue == nil {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
-		return "", err
+		err := lastError()
+		op.failed(err)
+		return nil, err
 	}
 	defer C.free(unsafe.Pointer(cValue))
+	defer wipeC(unsafe.Pointer(cValue), cSize)
 
-	value := string(C.GoBytes(unsafe.Pointer(cValue), C.int(cSize)))
-	sec.log.Printf("value: %v\n", value)
+	value := make(SecretValue, int(cSize))
+	copy(value, unsafe.Slice((*byte)(unsafe.Pointer(cValue)), int(cSize)))
+	op.done("value read", "bytes", len(value))
 
 	return value, nil
 }
 
+// SecretRotation is a change of the value of a secret, made by
+// "<Secret>.Rotate", which can be rolled back until it's confirmed.
+type SecretRotation struct {
+	sec  SecretAPI
+	old  SecretValue
+	done bool
+}
+
+// ErrSecretRotationDone is returned when a SecretRotation which was already
+// confirmed or rolled back is rolled back.
+var ErrSecretRotationDone = errors.New("secret rotation already done")
+
+// Rotate replaces the value of the secret with "newValue", keeping the old
+// value so it can be restored with "<SecretRotation>.Rollback", e.g. if the
+// new value is rejected by the service which uses the secret. The old value is
+// wiped when the rotation is confirmed. The secret must have a value already,
+// and it can't be private, as the value of private secrets can't be read.
+func (sec Secret) Rotate(newValue []byte) (*SecretRotation, error) {
+	return RotateSecret(sec, newValue)
+}
+
+// RotateSecret replaces the value of "sec", as "<Secret>.Rotate".
+func RotateSecret(sec SecretAPI, newValue []byte) (*SecretRotation, error) {
+	old, err := sec.ValueBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sec.SetValueBytes(newValue); err != nil {
+		old.Wipe()
+		return nil, err
+	}
+
+	return &SecretRotation{sec: sec, old: old}, nil
+}
+
+// OldValue returns the value of the secret before the rotation, or nil once
+// the rotation is done. It's wiped when the rotation is done.
+func (rot *SecretRotation) OldValue() SecretValue {
+	return rot.old
+}
+
+// Confirm keeps the new value of the secret and wipes the old one. Confirming
+// a rotation which is done does nothing.
+func (rot *SecretRotation) Confirm() {
+	if rot.done {
+		return
+	}
+
+	rot.old.Wipe()
+	rot.old = nil
+	rot.done = true
+}
+
+// Rollback restores the old value of the secret and wipes it. If it can't be
+// restored, the rotation isn't done, so it can be retried.
+func (rot *SecretRotation) Rollback() error {
+	if rot.done {
+		return ErrSecretRotationDone
+	}
+
+	if err := rot.sec.SetValueBytes(rot.old); err != nil {
+		return err
+	}
+
+	rot.old.Wipe()
+	rot.old = nil
+	rot.done = true
+
+	return nil
+}
+
 // Ref increments the reference count on the secret. For each additional call to
 // this method, there shall be a corresponding call to "<Secret>.Free" to
 // release the reference count, once the caller no longer needs the reference to
@@ -206,17 +396,22 @@ func (sec Secret) Value() (string, error) {
 // all threads have finished using it. ie, each new thread using a secret would
 // increment the reference count.
 func (sec Secret) Ref() error {
-	sec.log.Println("incrementing secret's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(sec.handle)
+
+	op := sec.log.begin("incrementing secret's reference count")
 	cRet := C.virSecretRef(sec.virSecret)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		sec.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	sec.log.Println("reference count incremented")
+	sec.handle.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
@@ -0,0 +1,52 @@
+// Code generated by "enumgen secret.go SecretListFlag=SecList SecretUsageType=SecUsageType"; DO NOT EDIT.
+
+package libvirt
+
+// secretListFlagNames holds the text form of the values of SecretListFlag.
+var secretListFlagNames = []enumName[SecretListFlag]{
+	{SecListAll, "all"},
+	{SecListEphemeral, "ephemeral"},
+	{SecListNoEphemeral, "no_ephemeral"},
+	{SecListPrivate, "private"},
+	{SecListNoPrivate, "no_private"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v SecretListFlag) String() string {
+	return formatFlags(v, secretListFlagNames, "SecretListFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v SecretListFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, secretListFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *SecretListFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, secretListFlagNames, "SecretListFlag")
+}
+
+// secretUsageTypeNames holds the text form of the values of SecretUsageType.
+var secretUsageTypeNames = []enumName[SecretUsageType]{
+	{SecUsageTypeNone, "none"},
+	{SecUsageTypeVolume, "volume"},
+	{SecUsageTypeCeph, "ceph"},
+	{SecUsageTypeISCSI, "iscsi"},
+	{SecUsageTypeTLS, "tls"},
+	{SecUsageTypeVTPM, "vtpm"},
+}
+
+// String returns the text form of the value.
+func (v SecretUsageType) String() string {
+	return formatEnum(v, secretUsageTypeNames, "SecretUsageType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v SecretUsageType) MarshalText() ([]byte, error) {
+	return marshalEnum(v, secretUsageTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *SecretUsageType) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, secretUsageTypeNames, "SecretUsageType")
+}
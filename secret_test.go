@@ -1,6 +1,10 @@
 package libvirt
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"testing"
 )
 
@@ -63,6 +67,189 @@ func TestSecretValue(t *testing.T) {
 	}
 }
 
+func TestSecretValueBytes(t *testing.T) {
+	env := newTestEnvironment(t).withSecret()
+	defer env.cleanUp()
+
+	key := []byte{0x00, 0x01, 0xfe, 0x00, 0xff}
+
+	if err := env.sec.SetValueBytes(key); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := env.sec.ValueBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer value.Wipe()
+
+	if !bytes.Equal(value, key) {
+		t.Errorf("wrong secret value; got=%x, want=%x", []byte(value), key)
+	}
+}
+
+func TestSecretValueWipe(t *testing.T) {
+	value := SecretValue("s3cr3t")
+
+	for _, format := range []string{"%v", "%s", "%q", "%x", "%#v"} {
+		if s := fmt.Sprintf(format, value); bytes.Contains([]byte(s), []byte("s3cr3t")) || bytes.Contains([]byte(s), []byte("733363723374")) {
+			t.Errorf("secret value formatted with %v: %v", format, s)
+		}
+	}
+
+	var output bytes.Buffer
+	slog.New(slog.NewJSONHandler(&output, nil)).Info("secret read", "value", value, "values", []SecretValue{value})
+
+	encoded, err := json.Marshal(struct{ Value SecretValue }{value})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range [][]byte{output.Bytes(), encoded} {
+		// "s3cr3t" encoded in base64
+		if bytes.Contains(s, []byte("s3cr3t")) || bytes.Contains(s, []byte("czNjcjN0")) {
+			t.Errorf("secret value encoded: %s", s)
+		}
+	}
+
+	value.Wipe()
+
+	if !bytes.Equal(value, make([]byte, len(value))) {
+		t.Errorf("secret value not wiped: %x", []byte(value))
+	}
+}
+
+func TestSecretRotate(t *testing.T) {
+	env := newTestEnvironment(t).withSecret()
+	defer env.cleanUp()
+
+	if err := env.sec.SetValue(env.secData.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	rot, err := env.sec.Rotate([]byte("new value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rot.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := env.sec.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != env.secData.Value {
+		t.Errorf("wrong secret value after rollback; got=%v, want=%v", value, env.secData.Value)
+	}
+}
+
+func TestNewSecretXML(t *testing.T) {
+	doc, err := newSecretXML(SecUsageTypeVolume, "/var/lib/libvirt/images/a&b.img", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<secret ephemeral="no" private="yes">`,
+		`<usage type="volume">`,
+		`<volume>/var/lib/libvirt/images/a&amp;b.img</volume>`,
+	} {
+		if !bytes.Contains([]byte(doc), []byte(want)) {
+			t.Errorf("secret XML doesn't contain %q: %v", want, doc)
+		}
+	}
+
+	other, err := newSecretXML(SecUsageTypeNone, "ignored", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains([]byte(other), []byte("usage")) {
+		t.Errorf("unexpected secret XML without usage: %v", other)
+	}
+
+	if _, err := newSecretXML(SecretUsageType(99), "id", false, false); err == nil {
+		t.Error("an error was not returned when using an invalid usage type")
+	}
+}
+
+func TestSecretDefinition(t *testing.T) {
+	env := newTestEnvironment(t).withSecret()
+	defer env.cleanUp()
+
+	def, err := env.sec.Definition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.UUID != env.secData.UUID {
+		t.Errorf("wrong secret definition UUID; got=%v, want=%v", def.UUID, env.secData.UUID)
+	}
+
+	if def.Usage == nil {
+		t.Fatal("secret definition without usage")
+	}
+
+	if def.Usage.Type != env.secData.UsageType {
+		t.Errorf("wrong secret definition usage type; got=%v, want=%v", def.Usage.Type, env.secData.UsageType)
+	}
+
+	if id := def.Usage.ID(); id != env.secData.UsageName {
+		t.Errorf("wrong secret definition usage ID; got=%v, want=%v", id, env.secData.UsageName)
+	}
+}
+
+func TestSecretDefMarshal(t *testing.T) {
+	for _, usageType := range []SecretUsageType{SecUsageTypeVolume, SecUsageTypeCeph, SecUsageTypeISCSI, SecUsageTypeTLS, SecUsageTypeVTPM} {
+		usage, err := NewSecretUsage(usageType, "usage-id")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		def := SecretDef{
+			UUID:        "0a81f5b2-8403-7b23-c8d6-21ccc2f80d6f",
+			Description: "test <secret>",
+			Private:     true,
+			Usage:       usage,
+		}
+
+		doc, err := def.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := fmt.Sprintf(`<usage type="%v">`, usageType)
+		if !bytes.Contains([]byte(doc), []byte(want)) {
+			t.Errorf("secret XML doesn't contain %q: %v", want, doc)
+		}
+
+		var parsed SecretDef
+		if err := parsed.Unmarshal(doc); err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.UUID != def.UUID || parsed.Description != def.Description || parsed.Private != def.Private || parsed.Ephemeral != def.Ephemeral {
+			t.Errorf("wrong parsed secret definition; got=%+v, want=%+v", parsed, def)
+		}
+
+		if parsed.Usage == nil || *parsed.Usage != *usage {
+			t.Errorf("wrong parsed secret usage; got=%+v, want=%+v", parsed.Usage, usage)
+		}
+	}
+
+	if _, err := NewSecretUsage(SecUsageTypeNone, "id"); err == nil {
+		t.Error("an error was not returned when creating a usage of type none")
+	}
+
+	var def SecretDef
+	if err := def.Unmarshal(`<secret><usage type="unknown"><name>x</name></usage></secret>`); err == nil {
+		t.Error("an error was not returned when parsing an unknown usage type")
+	}
+}
+
 func TestSecretRef(t *testing.T) {
 	env := newTestEnvironment(t).withSecret()
 	defer env.cleanUp()
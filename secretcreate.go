@@ -0,0 +1,77 @@
+package libvirt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// newSecretXML returns the XML of a new secret with a random UUID.
+func newSecretXML(usage SecretUsageType, usageID string, private bool, ephemeral bool) (string, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	def := SecretDef{
+		UUID:      uuid,
+		Ephemeral: ephemeral,
+		Private:   private,
+	}
+
+	if usage != SecUsageTypeNone {
+		if def.Usage, err = NewSecretUsage(usage, usageID); err != nil {
+			return "", err
+		}
+	}
+
+	return def.Marshal()
+}
+
+// CreateSecret defines a new secret, with a random UUID, used by the object
+// "usageID" of type "usage" (which is ignored for SecUsageTypeNone), and sets
+// its value. If the value can't be set, the secret is undefined, so either
+// both steps succeed or none does; the errors of undefining and freeing it, if
+// any, are joined to the error of setting the value.
+func (conn Connection) CreateSecret(usage SecretUsageType, usageID string, value []byte, private bool, ephemeral bool) (Secret, error) {
+	sec, err := CreateSecret(NewConnectionAPI(conn), usage, usageID, value, private, ephemeral)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	return sec.(Secret), nil
+}
+
+// CreateSecret creates a secret on "conn", as "<Connection>.CreateSecret".
+func CreateSecret(conn ConnectionAPI, usage SecretUsageType, usageID string, value []byte, private bool, ephemeral bool) (SecretAPI, error) {
+	doc, err := newSecretXML(usage, usageID, private, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	sec, err := conn.DefineSecret(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sec.SetValueBytes(value); err != nil {
+		undefErr := sec.Undefine()
+		freeErr := sec.Free()
+		return nil, errors.Join(err, undefErr, freeErr)
+	}
+
+	return sec, nil
+}
@@ -0,0 +1,126 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// SecretDef is the definition of a secret, as described by the secret XML.
+type SecretDef struct {
+	UUID        string
+	Description string
+	// Ephemeral secrets are only kept in memory.
+	Ephemeral bool
+	// Private secrets can't have their values read through the public API.
+	Private bool
+	// Usage is nil if the secret isn't used by a specific object.
+	Usage *SecretUsage
+}
+
+// SecretUsage describes the object which uses a secret. Only the field which
+// matches Type is used to hold the usage ID; see ID.
+type SecretUsage struct {
+	Type SecretUsageType `xml:"type,attr"`
+	// Volume is the path of the volume, for SecUsageTypeVolume.
+	Volume string `xml:"volume,omitempty"`
+	// Name is the name of the usage, for SecUsageTypeCeph, SecUsageTypeTLS
+	// and SecUsageTypeVTPM.
+	Name string `xml:"name,omitempty"`
+	// Target is the iSCSI target, for SecUsageTypeISCSI.
+	Target string `xml:"target,omitempty"`
+}
+
+// NewSecretUsage returns the usage of type "typ" with the ID "id", stored in
+// the field which matches the type.
+func NewSecretUsage(typ SecretUsageType, id string) (*SecretUsage, error) {
+	usage := &SecretUsage{Type: typ}
+
+	switch typ {
+	case SecUsageTypeVolume:
+		usage.Volume = id
+	case SecUsageTypeCeph, SecUsageTypeTLS, SecUsageTypeVTPM:
+		usage.Name = id
+	case SecUsageTypeISCSI:
+		usage.Target = id
+	default:
+		return nil, fmt.Errorf("unsupported secret usage type: %v", typ)
+	}
+
+	return usage, nil
+}
+
+// ID returns the usage ID, as returned by "<Secret>.UsageID".
+func (usage SecretUsage) ID() string {
+	switch usage.Type {
+	case SecUsageTypeVolume:
+		return usage.Volume
+	case SecUsageTypeISCSI:
+		return usage.Target
+	default:
+		return usage.Name
+	}
+}
+
+// secretDefXML is the XML layout of SecretDef; libvirt writes the boolean
+// attributes as "yes" or "no".
+type secretDefXML struct {
+	XMLName     xml.Name     `xml:"secret"`
+	Ephemeral   string       `xml:"ephemeral,attr,omitempty"`
+	Private     string       `xml:"private,attr,omitempty"`
+	UUID        string       `xml:"uuid,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	Usage       *SecretUsage `xml:"usage"`
+}
+
+// yesNo returns the value of a boolean XML attribute.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// MarshalXML implements xml.Marshaler.
+func (def SecretDef) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(secretDefXML{
+		Ephemeral:   yesNo(def.Ephemeral),
+		Private:     yesNo(def.Private),
+		UUID:        def.UUID,
+		Description: def.Description,
+		Usage:       def.Usage,
+	})
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (def *SecretDef) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var doc secretDefXML
+	if err := d.DecodeElement(&doc, &start); err != nil {
+		return err
+	}
+
+	*def = SecretDef{
+		UUID:        doc.UUID,
+		Description: doc.Description,
+		Ephemeral:   doc.Ephemeral == "yes",
+		Private:     doc.Private == "yes",
+		Usage:       doc.Usage,
+	}
+
+	return nil
+}
+
+// Marshal returns the secret XML of the definition.
+func (def SecretDef) Marshal() (string, error) {
+	doc, err := xml.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(doc), nil
+}
+
+// Unmarshal parses the secret XML "doc" into the definition.
+func (def *SecretDef) Unmarshal(doc string) error {
+	return xml.Unmarshal([]byte(doc), def)
+}
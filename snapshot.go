@@ -4,8 +4,8 @@ package libvirt
 // #include <libvirt/libvirt.h>
 import "C"
 import (
-	"log"
 	"reflect"
+	"runtime"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -68,120 +68,245 @@ const (
 	SnapRevertForce   SnapshotRevertFlag = C.VIR_DOMAIN_SNAPSHOT_REVERT_FORCE
 )
 
+// SnapshotCurrentFlag defines how the current snapshot of a domain should be
+// read. No flags are supported yet.
+type SnapshotCurrentFlag uint32
+
+// Possible values for SnapshotCurrentFlag.
+const (
+	SnapCurrentDefault SnapshotCurrentFlag = 0
+)
+
 // Snapshot holds a libvirt domain snapshot. There are no exported fields.
 type Snapshot struct {
-	log         *log.Logger
+	log         *logger
 	virSnapshot C.virDomainSnapshotPtr
+	handle      *handle
 }
 
 // Free frees the domain snapshot object. The snapshot itself is not modified.
 // The data structure is freed and should not be used thereafter.
 func (snap Snapshot) Free() error {
-	snap.log.Println("freeing snapshot object...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("freeing snapshot object")
 	cRet := C.virDomainSnapshotFree(snap.virSnapshot)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	snap.log.Println("snapshot freed")
+	snap.handle.release()
+	op.done("snapshot freed")
 
 	return nil
 }
 
 // Delete deletes the snapshot.
 func (snap Snapshot) Delete(flags SnapshotDeleteFlag) error {
-	snap.log.Printf("deleting snapshot (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("deleting snapshot", "flags", flags)
 	cRet := C.virDomainSnapshotDelete(snap.virSnapshot, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	snap.log.Println("snapshot deleted")
+	op.done("snapshot deleted")
 
 	return nil
 }
 
 // Name gets the public name for that snapshot.
 func (snap Snapshot) Name() (string, error) {
-	snap.log.Println("reading snapshot name...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reading snapshot name")
 	cName := C.virDomainSnapshotGetName(snap.virSnapshot)
 
 	if cName == nil {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	name := C.GoString(cName)
-	snap.log.Printf("snapshot name: %v\n", name)
+	op.done("snapshot name read", "name", name)
 
 	return name, nil
 }
 
 // Parent gets the parent snapshot for "snap", if any.
 func (snap Snapshot) Parent() (Snapshot, error) {
-	snap.log.Println("reading snapshot parent...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reading snapshot parent")
 	cParent := C.virDomainSnapshotGetParent(snap.virSnapshot, 0)
 	if cParent == nil {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return Snapshot{}, err
 	}
 
 	parent := Snapshot{
-		log:         snap.log,
+		log:         snap.log.snapshot(cParent),
 		virSnapshot: cParent,
+		handle:      snap.handle.track(kindSnapshot, unsafe.Pointer(cParent)),
 	}
 
-	snap.log.Println("parent obtained")
+	op.done("parent obtained")
 
 	return parent, nil
 }
 
+// Domain gets the domain that the snapshot was created from. The returned
+// object holds a new reference to the domain, which must be freed with
+// "<Domain>.Free".
+func (snap Snapshot) Domain() (Domain, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reading snapshot domain")
+	cDom := C.virDomainSnapshotGetDomain(snap.virSnapshot)
+	if cDom == nil {
+		err := lastError()
+		op.failed(err)
+		return Domain{}, err
+	}
+
+	cRet := C.virDomainRef(cDom)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return Domain{}, err
+	}
+
+	dom := Domain{
+		log:       snap.log.domain(cDom),
+		virDomain: cDom,
+		handle:    snap.handle.track(kindDomain, unsafe.Pointer(cDom)),
+	}
+
+	op.done("domain obtained")
+
+	return dom, nil
+}
+
+// Connection gets the connection that the snapshot was created from. The
+// returned object holds a new reference to the connection, which must be
+// closed with "<Connection>.Close".
+func (snap Snapshot) Connection() (Connection, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reading snapshot connection")
+	cConn := C.virDomainSnapshotGetConnect(snap.virSnapshot)
+	if cConn == nil {
+		err := lastError()
+		op.failed(err)
+		return Connection{}, err
+	}
+
+	cRet := C.virConnectRef(cConn)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return Connection{}, err
+	}
+
+	conn := Connection{
+		log:        snap.log.connection(),
+		virConnect: cConn,
+		objects:    snap.handle.connection(),
+	}
+	conn.objects.ref()
+
+	op.done("connection obtained")
+
+	return conn, nil
+}
+
 // XML provides an XML description of the domain snapshot.
 func (snap Snapshot) XML(flags DomainXMLFlag) (string, error) {
-	snap.log.Printf("reading snapshot XML (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reading snapshot XML", "flags", flags)
 	cXML := C.virDomainSnapshotGetXMLDesc(snap.virSnapshot, C.uint(flags))
 	if cXML == nil {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cXML))
 
 	xml := C.GoString(cXML)
-	snap.log.Printf("XML length: %v runes\n", utf8.RuneCountInString(xml))
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
 
 	return xml, nil
 }
 
+// Definition reads the XML description of the snapshot and parses it into a
+// SnapshotDef.
+func (snap Snapshot) Definition(flags DomainXMLFlag) (*SnapshotDef, error) {
+	doc, err := snap.XML(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	def := &SnapshotDef{}
+	if err := def.Unmarshal(doc); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
 // HasMetadata determines if the given snapshot is associated with libvirt
 // metadata that would prevent the deletion of the domain.
 func (snap Snapshot) HasMetadata() (bool, error) {
-	snap.log.Println("checking whether snapshot has metadata...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("checking whether snapshot has metadata")
 	cRet := C.virDomainSnapshotHasMetadata(snap.virSnapshot, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	metadata := (ret == 1)
 
 	if metadata {
-		snap.log.Println("snapshot has metadata")
+		op.done("snapshot has metadata")
 	} else {
-		snap.log.Println("snapshot doesn't have metadata")
+		op.done("snapshot doesn't have metadata")
 	}
 
 	return metadata, nil
@@ -190,22 +315,26 @@ func (snap Snapshot) HasMetadata() (bool, error) {
 // IsCurrent determines if the given snapshot is the domain's current snapshot.
 // See also "<Domain>.HasCurrentSnapshot".
 func (snap Snapshot) IsCurrent() (bool, error) {
-	snap.log.Println("checking whether snapshot is current...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("checking whether snapshot is current")
 	cRet := C.virDomainSnapshotIsCurrent(snap.virSnapshot, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	current := (ret == 1)
 
 	if current {
-		snap.log.Println("snapshot is current")
+		op.done("snapshot is current")
 	} else {
-		snap.log.Println("snapshot isn't current")
+		op.done("snapshot isn't current")
 	}
 
 	return current, nil
@@ -215,17 +344,22 @@ func (snap Snapshot) IsCurrent() (bool, error) {
 // to this method, there shall be a corresponding call to "<Snapshot>.Free" to
 // release the reference count, once the caller no longer needs the reference to this object.
 func (snap Snapshot) Ref() error {
-	snap.log.Println("incrementing snapshot's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("incrementing snapshot's reference count")
 	cRet := C.virDomainSnapshotRef(snap.virSnapshot)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	snap.log.Println("reference count incremented")
+	snap.handle.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
@@ -244,16 +378,20 @@ func (snap Snapshot) Ref() error {
 // it is possible to select an impossible combination, in that case a hypervisor
 // may return either 0 or an error.
 func (snap Snapshot) ListChildren(flags SnapshotListFlag) ([]Snapshot, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
 	var cSnaps []C.virDomainSnapshotPtr
 	snapsSH := (*reflect.SliceHeader)(unsafe.Pointer(&cSnaps))
 
-	snap.log.Printf("reading snapshot children (flags = %v)...\n", flags)
+	op := snap.log.begin("reading snapshot children", "flags", flags)
 	cRet := C.virDomainSnapshotListAllChildren(snap.virSnapshot, (**C.virDomainSnapshotPtr)(unsafe.Pointer(&snapsSH.Data)), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(snapsSH.Data))
@@ -265,16 +403,41 @@ func (snap Snapshot) ListChildren(flags SnapshotListFlag) ([]Snapshot, error) {
 
 	for i := range snaps {
 		snaps[i] = Snapshot{
-			log:         snap.log,
+			log:         snap.log.snapshot(cSnaps[i]),
 			virSnapshot: cSnaps[i],
+			handle:      snap.handle.track(kindSnapshot, unsafe.Pointer(cSnaps[i])),
 		}
 	}
 
-	snap.log.Printf("snapshots count: %v\n", ret)
+	op.done("snapshots read", "count", ret)
 
 	return snaps, nil
 }
 
+// NumChildren provides the number of child snapshots for the given snapshot.
+// By default, only direct children are counted; SnapListDescendants in
+// "flags" counts all descendants. The other filters are the same as in
+// "<Snapshot>.ListChildren".
+func (snap Snapshot) NumChildren(flags SnapshotListFlag) (int32, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("counting snapshot children", "flags", flags)
+	cRet := C.virDomainSnapshotNumChildren(snap.virSnapshot, C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return 0, err
+	}
+
+	op.done("children read", "count", ret)
+
+	return ret, nil
+}
+
 // Revert reverts the domain to a given snapshot.
 // Normally, the domain will revert to the same state the domain was in while
 // the snapshot was taken (whether inactive, running, or paused), except that
@@ -304,17 +467,21 @@ func (snap Snapshot) ListChildren(flags SnapshotListFlag) ([]Snapshot, error) {
 // inactive snapshots with a "flags" request to start the domain after
 // the revert.
 func (snap Snapshot) Revert(flags SnapshotRevertFlag) error {
-	snap.log.Printf("reverting to snapshot (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(snap.handle)
+
+	op := snap.log.begin("reverting to snapshot", "flags", flags)
 	cRet := C.virDomainRevertToSnapshot(snap.virSnapshot, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		snap.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	snap.log.Println("domain reverted")
+	op.done("domain reverted")
 
 	return nil
 }
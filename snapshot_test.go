@@ -134,3 +134,72 @@ func BenchmarkSnapshotRevertTo(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestDomainSnapshotTree(t *testing.T) {
+	env := newTestEnvironment(t).withSnapshot()
+	defer env.cleanUp()
+
+	tree, err := env.dom.SnapshotTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := tree.Lookup(env.snapData.Name)
+	if node == nil {
+		t.Fatalf("snapshot %v not found in the tree", env.snapData.Name)
+	}
+
+	if tree.Current != node || node.Parent != nil || len(node.Children) != 0 {
+		t.Errorf("unexpected snapshot node; got=%+v", node)
+	}
+}
+
+func TestSnapshotDomainAndConnection(t *testing.T) {
+	env := newTestEnvironment(t).withSnapshot()
+	defer env.cleanUp()
+
+	current, err := env.dom.CurrentSnapshot(SnapCurrentDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer current.Free()
+
+	def, err := current.Definition(DomXMLDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Name != env.snapData.Name {
+		t.Errorf("unexpected current snapshot; got=%v, want=%v", def.Name, env.snapData.Name)
+	}
+
+	child, err := env.dom.CreateSnapshotDef(SnapshotDef{Name: newTestSnapshotData().Name}, SnapCreateDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer child.Free()
+	defer child.Delete(SnapDeleteDefault)
+
+	if n, err := env.snap.NumChildren(SnapListDescendants); err != nil || n != 1 {
+		t.Errorf("unexpected number of children; got=%v (%v), want=1", n, err)
+	}
+
+	dom, err := env.snap.Domain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dom.Free()
+
+	if name, _ := dom.Name(); name != env.domData.Name {
+		t.Errorf("unexpected snapshot domain; got=%v, want=%v", name, env.domData.Name)
+	}
+
+	conn, err := env.snap.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+}
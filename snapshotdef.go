@@ -0,0 +1,132 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// SnapshotState is the state of a domain when a snapshot was taken, as
+// written in the snapshot XML.
+type SnapshotState string
+
+// Possible values for SnapshotState.
+const (
+	SnapStateNone         SnapshotState = "nostate"
+	SnapStateRunning      SnapshotState = "running"
+	SnapStateBlocked      SnapshotState = "blocked"
+	SnapStatePaused       SnapshotState = "paused"
+	SnapStateShutdown     SnapshotState = "shutdown"
+	SnapStateShutoff      SnapshotState = "shutoff"
+	SnapStateCrashed      SnapshotState = "crashed"
+	SnapStatePMSuspended  SnapshotState = "pmsuspended"
+	SnapStateDiskSnapshot SnapshotState = "disk-snapshot"
+)
+
+// SnapshotLocation defines where the memory or a disk of a domain is saved
+// by a snapshot.
+type SnapshotLocation string
+
+// Possible values for SnapshotLocation.
+const (
+	SnapLocationDefault  SnapshotLocation = ""
+	SnapLocationNo       SnapshotLocation = "no"
+	SnapLocationInternal SnapshotLocation = "internal"
+	SnapLocationExternal SnapshotLocation = "external"
+	SnapLocationManual   SnapshotLocation = "manual"
+)
+
+// SnapshotDef is the definition of a domain snapshot, as described by the
+// snapshot XML. Only the name, the description and the memory and disk specs
+// are used when creating a snapshot; the other fields are set by libvirt.
+type SnapshotDef struct {
+	XMLName     xml.Name      `xml:"domainsnapshot"`
+	Name        string        `xml:"name,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	State       SnapshotState `xml:"state,omitempty"`
+	// CreationTime is the number of seconds since the Unix epoch; see
+	// Created.
+	CreationTime int64               `xml:"creationTime,omitempty"`
+	Parent       *SnapshotParent     `xml:"parent"`
+	Memory       *SnapshotMemorySpec `xml:"memory"`
+	Disks        []SnapshotDiskSpec  `xml:"disks>disk"`
+	// Domain is the configuration of the domain when the snapshot was taken.
+	Domain *SnapshotDomain `xml:"domain"`
+}
+
+// SnapshotParent identifies the parent of a snapshot.
+type SnapshotParent struct {
+	Name string `xml:"name"`
+}
+
+// SnapshotMemorySpec defines how the memory of a running domain is saved by
+// a snapshot.
+type SnapshotMemorySpec struct {
+	Snapshot SnapshotLocation `xml:"snapshot,attr,omitempty"`
+	// File is the path of the memory state, if Snapshot is
+	// SnapLocationExternal.
+	File string `xml:"file,attr,omitempty"`
+}
+
+// SnapshotDiskSpec defines how a disk of the domain is saved by a snapshot.
+type SnapshotDiskSpec struct {
+	// Name is the target device (e.g. "vda") or the source path of the disk.
+	Name     string           `xml:"name,attr"`
+	Snapshot SnapshotLocation `xml:"snapshot,attr,omitempty"`
+	// Type is the type of the external overlay, e.g. "file" or "block".
+	Type   string              `xml:"type,attr,omitempty"`
+	Source *SnapshotDiskSource `xml:"source"`
+	Driver *SnapshotDiskDriver `xml:"driver"`
+}
+
+// SnapshotDiskSource is the location of the external overlay of a disk.
+type SnapshotDiskSource struct {
+	File string `xml:"file,attr,omitempty"`
+	Dev  string `xml:"dev,attr,omitempty"`
+}
+
+// SnapshotDiskDriver is the format of the external overlay of a disk, e.g.
+// "qcow2".
+type SnapshotDiskDriver struct {
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// SnapshotDomain is the domain configuration saved in a snapshot. It's kept
+// as raw XML, so it can be passed back to libvirt without losing anything.
+type SnapshotDomain struct {
+	Attrs    []xml.Attr `xml:",any,attr"`
+	InnerXML string     `xml:",innerxml"`
+}
+
+// XML returns the domain configuration as a complete XML document, e.g. to be
+// used with "<Connection>.DefineDomain".
+func (dom SnapshotDomain) XML() (string, error) {
+	doc, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"domain"`
+		SnapshotDomain
+	}{SnapshotDomain: dom})
+	if err != nil {
+		return "", err
+	}
+
+	return string(doc), nil
+}
+
+// Created returns the creation time of the snapshot.
+func (def SnapshotDef) Created() time.Time {
+	return time.Unix(def.CreationTime, 0)
+}
+
+// Marshal returns the snapshot XML of the definition.
+func (def SnapshotDef) Marshal() (string, error) {
+	doc, err := xml.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(doc), nil
+}
+
+// Unmarshal parses the snapshot XML "doc" into the definition.
+func (def *SnapshotDef) Unmarshal(doc string) error {
+	return xml.Unmarshal([]byte(doc), def)
+}
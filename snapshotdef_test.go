@@ -0,0 +1,117 @@
+package libvirt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDefMarshal(t *testing.T) {
+	def := SnapshotDef{
+		Name:        "backup",
+		Description: "before <upgrade>",
+		Memory: &SnapshotMemorySpec{
+			Snapshot: SnapLocationExternal,
+			File:     "/var/lib/libvirt/qemu/backup.mem",
+		},
+		Disks: []SnapshotDiskSpec{
+			{
+				Name:     "vda",
+				Snapshot: SnapLocationExternal,
+				Source:   &SnapshotDiskSource{File: "/var/lib/libvirt/images/vda.backup"},
+				Driver:   &SnapshotDiskDriver{Type: "qcow2"},
+			},
+			{Name: "vdb", Snapshot: SnapLocationNo},
+		},
+	}
+
+	doc, err := def.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<domainsnapshot>",
+		"<description>before &lt;upgrade&gt;</description>",
+		`<memory snapshot="external" file="/var/lib/libvirt/qemu/backup.mem"></memory>`,
+		`<disk name="vdb" snapshot="no"></disk>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("snapshot XML doesn't contain %q:\n%v", want, doc)
+		}
+	}
+
+	for _, unwanted := range []string{"<state>", "<creationTime>", "<parent>", "<domain>"} {
+		if strings.Contains(doc, unwanted) {
+			t.Errorf("snapshot XML contains %q:\n%v", unwanted, doc)
+		}
+	}
+
+	var parsed SnapshotDef
+	if err := parsed.Unmarshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Name != def.Name || parsed.Description != def.Description {
+		t.Errorf("unexpected name or description; got=%q/%q, want=%q/%q", parsed.Name, parsed.Description, def.Name, def.Description)
+	}
+
+	if parsed.Memory == nil || *parsed.Memory != *def.Memory {
+		t.Errorf("unexpected memory spec; got=%+v, want=%+v", parsed.Memory, def.Memory)
+	}
+
+	if len(parsed.Disks) != 2 || parsed.Disks[0].Source == nil || parsed.Disks[0].Source.File != def.Disks[0].Source.File || parsed.Disks[1].Snapshot != SnapLocationNo {
+		t.Errorf("unexpected disk specs; got=%+v, want=%+v", parsed.Disks, def.Disks)
+	}
+}
+
+func TestSnapshotDefUnmarshal(t *testing.T) {
+	doc := `<domainsnapshot>
+  <name>child</name>
+  <state>running</state>
+  <parent>
+    <name>root</name>
+  </parent>
+  <creationTime>1700000000</creationTime>
+  <memory snapshot='internal'/>
+  <disks>
+    <disk name='vda' snapshot='internal'/>
+  </disks>
+  <domain type='kvm'>
+    <name>test</name>
+    <memory unit='KiB'>1024</memory>
+  </domain>
+</domainsnapshot>`
+
+	var def SnapshotDef
+	if err := def.Unmarshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if def.State != SnapStateRunning {
+		t.Errorf("unexpected state; got=%v, want=%v", def.State, SnapStateRunning)
+	}
+
+	if def.Parent == nil || def.Parent.Name != "root" {
+		t.Errorf("unexpected parent; got=%+v, want=root", def.Parent)
+	}
+
+	if created := def.Created(); !created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected creation time; got=%v", created)
+	}
+
+	if def.Domain == nil {
+		t.Fatal("the domain configuration was not parsed")
+	}
+
+	domXML, err := def.Domain.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`<domain type="kvm">`, "<name>test</name>", "<memory unit='KiB'>1024</memory>"} {
+		if !strings.Contains(domXML, want) {
+			t.Errorf("domain XML doesn't contain %q:\n%v", want, domXML)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package libvirt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SnapshotMergePolicy defines how "<Domain>.MergeExternalSnapshot" merges a
+// snapshot. The zero value merges at full speed and deletes the overlays.
+type SnapshotMergePolicy struct {
+	// Bandwidth limits each block commit, in bytes/s. 0 means unlimited.
+	Bandwidth uint64
+	// KeepOverlays keeps the overlay files once they're merged.
+	KeepOverlays bool
+}
+
+// SnapshotMergeResult describes what "<Domain>.MergeExternalSnapshot" did.
+type SnapshotMergeResult struct {
+	// Disks are the disks merged into their backing images, as named in the
+	// snapshot definition.
+	Disks []string
+	// RemovedOverlays are the overlay files deleted after being merged.
+	RemovedOverlays []string
+	// KeptOverlays are the overlay files merged but not deleted, either
+	// because of SnapshotMergePolicy.KeepOverlays or because they aren't
+	// storage volumes known by libvirt.
+	KeptOverlays []string
+}
+
+// SnapshotMergeError is returned by "<Domain>.MergeExternalSnapshot" when a
+// snapshot can't be merged. The block jobs started on the disks which weren't
+// pivoted yet are cancelled, so those disks keep using their overlays.
+type SnapshotMergeError struct {
+	// Disk is the disk which failed, or empty if the error isn't related to
+	// a single disk.
+	Disk string
+	// Pivoted are the disks already merged when the error happened. They
+	// can't be rolled back; if it's empty, the domain still uses all the
+	// overlays of the snapshot.
+	Pivoted []string
+	// Stuck are the disks whose block job couldn't be cancelled; they may
+	// still have a block job running.
+	Stuck []string
+	Err   error
+}
+
+// Error returns the description of the failure and of the state the domain
+// was left in.
+func (err *SnapshotMergeError) Error() string {
+	var b strings.Builder
+
+	b.WriteString("merging snapshot")
+	if err.Disk != "" {
+		fmt.Fprintf(&b, " disk %v", err.Disk)
+	}
+	fmt.Fprintf(&b, ": %v", err.Err)
+
+	if len(err.Pivoted) > 0 {
+		fmt.Fprintf(&b, " (already merged: %v)", strings.Join(err.Pivoted, ", "))
+	}
+	if len(err.Stuck) > 0 {
+		fmt.Fprintf(&b, " (block job not cancelled: %v)", strings.Join(err.Stuck, ", "))
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (err *SnapshotMergeError) Unwrap() error {
+	return err.Err
+}
+
+// ErrSnapshotNotMergeable is returned by "<Domain>.MergeExternalSnapshot" when
+// the snapshot doesn't have external disks, or when their overlays aren't the
+// active images of the domain: the snapshot must be the current one and it
+// can't have children.
+var ErrSnapshotNotMergeable = errors.New("snapshot can't be merged")
+
+// MergeExternalSnapshot merges the overlays created by an external (disk-only)
+// snapshot back into their backing images, while the domain is running, and
+// then deletes the snapshot. Each overlay disk is committed with an active
+// block commit, and all of them are pivoted once they're ready; then the
+// snapshot metadata is deleted with SnapDeleteMetadataOnly and the overlays
+// are deleted, unless the policy keeps them.
+// If a disk fails before the pivot, all the block jobs are cancelled and the
+// domain keeps using the overlays; the returned error is then a
+// *SnapshotMergeError. If only the deletion of an overlay fails, the merge
+// succeeded anyway: the complete result, which lists that overlay in
+// KeptOverlays, is returned together with the error of the first failed
+// deletion, which wraps the error from libvirt.
+func (dom Domain) MergeExternalSnapshot(ctx context.Context, snap Snapshot, policy SnapshotMergePolicy) (SnapshotMergeResult, error) {
+	return MergeExternalSnapshot(ctx, NewDomainAPI(dom), NewSnapshotAPI(snap), policy)
+}
+
+// MergeExternalSnapshot merges the snapshot "snap" of the domain "dom", as
+// "<Domain>.MergeExternalSnapshot".
+func MergeExternalSnapshot(ctx context.Context, dom DomainAPI, snap SnapshotAPI, policy SnapshotMergePolicy) (SnapshotMergeResult, error) {
+	var result SnapshotMergeResult
+
+	def, err := snap.Definition(DomXMLDefault)
+	if err != nil {
+		return result, err
+	}
+
+	var disks []SnapshotDiskSpec
+	for _, disk := range def.Disks {
+		if disk.Snapshot == SnapLocationExternal {
+			disks = append(disks, disk)
+		}
+	}
+
+	if len(disks) == 0 {
+		return result, ErrSnapshotNotMergeable
+	}
+
+	current, err := snap.IsCurrent()
+	if err != nil {
+		return result, err
+	}
+
+	children, err := snap.NumChildren(SnapListDescendants)
+	if err != nil {
+		return result, err
+	}
+
+	if !current || children > 0 {
+		return result, ErrSnapshotNotMergeable
+	}
+
+	// the connection is needed to delete the overlays, and it can't be read
+	// from the snapshot once it's deleted
+	var conn ConnectionAPI
+	if !policy.KeepOverlays {
+		if conn, err = snap.Connection(); err != nil {
+			return result, err
+		}
+		defer conn.Close()
+	}
+
+	flags := DomBlockCommitActive | DomBlockCommitShallow
+	if policy.Bandwidth > 0 {
+		flags |= DomBlockCommitBandwidthBytes
+	}
+
+	// running are the disks with a block job which wasn't pivoted yet
+	var running []string
+
+	fail := func(disk string, err error) (SnapshotMergeResult, error) {
+		mergeErr := &SnapshotMergeError{
+			Disk:    disk,
+			Pivoted: result.Disks,
+			Err:     err,
+		}
+
+		for _, name := range running {
+			if err := dom.BlockJobAbort(name, DomBlockJobAbortDefault); err != nil {
+				mergeErr.Stuck = append(mergeErr.Stuck, name)
+			}
+		}
+
+		result.Disks = nil
+		return result, mergeErr
+	}
+
+	for _, disk := range disks {
+		if err := dom.BlockCommit(disk.Name, "", "", policy.Bandwidth, flags); err != nil {
+			return fail(disk.Name, err)
+		}
+
+		running = append(running, disk.Name)
+	}
+
+	for _, disk := range disks {
+		err := waitUntil(ctx, nil, func() (bool, error) {
+			info, ok, err := dom.BlockJobInfo(disk.Name, DomBlockJobInfoDefault)
+			if err != nil {
+				return false, err
+			}
+
+			if !ok {
+				return false, errors.New("block job ended before being ready")
+			}
+
+			return info.Ready(), nil
+		})
+		if err != nil {
+			return fail(disk.Name, err)
+		}
+	}
+
+	for len(running) > 0 {
+		disk := running[0]
+
+		if err := dom.BlockJobAbort(disk, DomBlockJobAbortPivot); err != nil {
+			return fail(disk, err)
+		}
+
+		running = running[1:]
+		result.Disks = append(result.Disks, disk)
+	}
+
+	if err := snap.Delete(SnapDeleteMetadataOnly); err != nil {
+		return fail("", err)
+	}
+
+	var deleteErr error
+	for _, disk := range disks {
+		overlay := ""
+		if disk.Source != nil {
+			overlay = disk.Source.File
+			if overlay == "" {
+				overlay = disk.Source.Dev
+			}
+		}
+
+		if overlay == "" {
+			continue
+		}
+
+		if policy.KeepOverlays {
+			result.KeptOverlays = append(result.KeptOverlays, overlay)
+			continue
+		}
+
+		removed, err := deleteOverlay(conn, overlay)
+		if err != nil && deleteErr == nil {
+			deleteErr = fmt.Errorf("snapshot merged, but deleting overlay %v: %w", overlay, err)
+		}
+
+		if removed {
+			result.RemovedOverlays = append(result.RemovedOverlays, overlay)
+		} else {
+			result.KeptOverlays = append(result.KeptOverlays, overlay)
+		}
+	}
+
+	return result, deleteErr
+}
+
+// deleteOverlay deletes the storage volume at "path". It returns false if
+// there's no such volume.
+func deleteOverlay(conn ConnectionAPI, path string) (bool, error) {
+	vol, err := conn.LookupStorageVolumeByPath(path)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer vol.Free()
+
+	if err := vol.Delete(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
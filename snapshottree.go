@@ -0,0 +1,253 @@
+package libvirt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SnapshotNode is a snapshot in a SnapshotTree.
+type SnapshotNode struct {
+	Name         string
+	Description  string
+	CreationTime time.Time
+	State        SnapshotState
+	// Current tells whether this is the current snapshot of the domain.
+	Current bool
+	// Parent is nil for the root snapshots.
+	Parent *SnapshotNode
+	// Children are sorted by creation time.
+	Children []*SnapshotNode
+}
+
+// Ancestors returns the parent of the snapshot, the parent of the parent and
+// so on, up to the root snapshot.
+func (node *SnapshotNode) Ancestors() []*SnapshotNode {
+	var ancestors []*SnapshotNode
+
+	for n := node.Parent; n != nil; n = n.Parent {
+		ancestors = append(ancestors, n)
+	}
+
+	return ancestors
+}
+
+// Descendants returns all the snapshots created from the snapshot, in
+// depth-first order.
+func (node *SnapshotNode) Descendants() []*SnapshotNode {
+	var descendants []*SnapshotNode
+
+	for _, child := range node.Children {
+		child.walk(0, func(n *SnapshotNode, depth int) bool {
+			descendants = append(descendants, n)
+			return true
+		})
+	}
+
+	return descendants
+}
+
+// walk calls "fn" for the node and its descendants, in depth-first order, until
+// it returns false. It returns false if the walk was stopped.
+func (node *SnapshotNode) walk(depth int, fn func(node *SnapshotNode, depth int) bool) bool {
+	if !fn(node, depth) {
+		return false
+	}
+
+	for _, child := range node.Children {
+		if !child.walk(depth+1, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SnapshotTree is the hierarchy of the snapshots of a domain, read at once so
+// it can be traversed without calling libvirt.
+type SnapshotTree struct {
+	// Roots are the snapshots without a parent, sorted by creation time.
+	Roots []*SnapshotNode
+	// Current is nil if the domain has no current snapshot.
+	Current *SnapshotNode
+
+	nodes map[string]*SnapshotNode
+}
+
+// ErrSnapshotNotInTree is returned when a snapshot can't be found in a
+// SnapshotTree.
+var ErrSnapshotNotInTree = errors.New("snapshot not found in tree")
+
+// ErrSnapshotsNotConnected is returned by "<SnapshotTree>.Path" when the
+// snapshots are in different roots, so there's no path between them.
+var ErrSnapshotsNotConnected = errors.New("snapshots are not connected")
+
+// SnapshotTree reads all the snapshots of the domain and returns their
+// hierarchy. The snapshots are freed before it returns.
+func (dom Domain) SnapshotTree() (*SnapshotTree, error) {
+	return NewSnapshotTree(NewDomainAPI(dom))
+}
+
+// NewSnapshotTree reads all the snapshots of "dom" and returns their
+// hierarchy. The snapshots are freed before it returns.
+func NewSnapshotTree(dom DomainAPI) (*SnapshotTree, error) {
+	snaps, err := dom.ListSnapshots(SnapListAll)
+	if err != nil {
+		return nil, err
+	}
+	defer FreeAll(snaps)
+
+	var currentName string
+	if len(snaps) > 0 {
+		if currentName, err = currentSnapshotName(dom); err != nil {
+			return nil, err
+		}
+	}
+
+	tree := &SnapshotTree{
+		nodes: make(map[string]*SnapshotNode, len(snaps)),
+	}
+	parents := make(map[*SnapshotNode]string, len(snaps))
+
+	for _, snap := range snaps {
+		doc, err := snap.XML(DomXMLDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		var def SnapshotDef
+		if err := def.Unmarshal(doc); err != nil {
+			return nil, fmt.Errorf("parsing snapshot XML: %w", err)
+		}
+
+		current := def.Name == currentName
+
+		node := &SnapshotNode{
+			Name:         def.Name,
+			Description:  def.Description,
+			CreationTime: def.Created(),
+			State:        def.State,
+			Current:      current,
+		}
+
+		tree.nodes[node.Name] = node
+		if def.Parent != nil {
+			parents[node] = def.Parent.Name
+		}
+
+		if current {
+			tree.Current = node
+		}
+	}
+
+	for _, node := range tree.nodes {
+		if parent, ok := tree.nodes[parents[node]]; ok {
+			node.Parent = parent
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree.Roots = append(tree.Roots, node)
+		}
+	}
+
+	sortSnapshotNodes(tree.Roots)
+	for _, node := range tree.nodes {
+		sortSnapshotNodes(node.Children)
+	}
+
+	return tree, nil
+}
+
+// currentSnapshotName returns the name of the current snapshot of "dom", or
+// an empty string if there's none.
+func currentSnapshotName(dom DomainAPI) (string, error) {
+	snap, err := dom.CurrentSnapshot(SnapCurrentDefault)
+	if IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer snap.Free()
+
+	return snap.Name()
+}
+
+// sortSnapshotNodes sorts "nodes" by creation time and then by name, as
+// snapshots may be created within the same second.
+func sortSnapshotNodes(nodes []*SnapshotNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if !nodes[i].CreationTime.Equal(nodes[j].CreationTime) {
+			return nodes[i].CreationTime.Before(nodes[j].CreationTime)
+		}
+
+		return nodes[i].Name < nodes[j].Name
+	})
+}
+
+// Len returns the number of snapshots in the tree.
+func (tree *SnapshotTree) Len() int {
+	return len(tree.nodes)
+}
+
+// Lookup returns the snapshot named "name", or nil if it isn't in the tree.
+func (tree *SnapshotTree) Lookup(name string) *SnapshotNode {
+	return tree.nodes[name]
+}
+
+// Walk calls "fn" for each snapshot of the tree, in depth-first order, with
+// its depth (0 for the roots), until it returns false.
+func (tree *SnapshotTree) Walk(fn func(node *SnapshotNode, depth int) bool) {
+	for _, root := range tree.Roots {
+		if !root.walk(0, fn) {
+			return
+		}
+	}
+}
+
+// Path returns the snapshots on the way from the snapshot "from" to the
+// snapshot "to", both included: up to their closest common ancestor and then
+// down to "to". The snapshots in different roots aren't connected, so
+// ErrSnapshotsNotConnected is returned for them.
+func (tree *SnapshotTree) Path(from, to string) ([]*SnapshotNode, error) {
+	src, dst := tree.nodes[from], tree.nodes[to]
+	if src == nil || dst == nil {
+		return nil, ErrSnapshotNotInTree
+	}
+
+	// the index of each ancestor of "src" (including itself) in the path
+	up := map[*SnapshotNode]int{src: 0}
+	path := []*SnapshotNode{src}
+	for i, n := range src.Ancestors() {
+		up[n] = i + 1
+		path = append(path, n)
+	}
+
+	var down []*SnapshotNode
+	for n := dst; n != nil; n = n.Parent {
+		if i, ok := up[n]; ok {
+			path = path[:i+1]
+
+			for j := len(down) - 1; j >= 0; j-- {
+				path = append(path, down[j])
+			}
+
+			return path, nil
+		}
+
+		down = append(down, n)
+	}
+
+	return nil, ErrSnapshotsNotConnected
+}
+
+// PathFromCurrent returns the snapshots on the way from the current snapshot
+// to the snapshot "to", as returned by Path. ErrSnapshotNotInTree is returned
+// if there's no current snapshot.
+func (tree *SnapshotTree) PathFromCurrent(to string) ([]*SnapshotNode, error) {
+	if tree.Current == nil {
+		return nil, ErrSnapshotNotInTree
+	}
+
+	return tree.Path(tree.Current.Name, to)
+}
@@ -0,0 +1,125 @@
+package libvirt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cd1/libvirt-golang"
+	"github.com/cd1/libvirt-golang/libvirtfake"
+)
+
+// snapshotNodeNames returns the names of "nodes", joined by spaces.
+func snapshotNodeNames(nodes []*libvirt.SnapshotNode) string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+
+	return strings.Join(names, " ")
+}
+
+func TestSnapshotTree(t *testing.T) {
+	conn := libvirtfake.NewConnection()
+	defer conn.Close()
+
+	dom, err := conn.DefineDomain(testManagedDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root -> a -> a1
+	//      -> b (current)
+	for _, step := range []string{"root", "a", "a1", "-root", "b"} {
+		if strings.HasPrefix(step, "-") {
+			snap, err := dom.LookupSnapshotByName(step[1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := snap.Revert(libvirt.SnapRevertDefault); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		xml := "<domainsnapshot><name>" + step + "</name><description>snapshot " + step + "</description></domainsnapshot>"
+		if _, err := dom.CreateSnapshot(xml, libvirt.SnapCreateDefault); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree, err := dom.SnapshotTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tree.Len() != 4 || len(tree.Roots) != 1 || tree.Roots[0].Name != "root" {
+		t.Fatalf("unexpected tree; got %v snapshots with roots [%v]", tree.Len(), snapshotNodeNames(tree.Roots))
+	}
+
+	if tree.Current == nil || tree.Current.Name != "b" || !tree.Current.Current {
+		t.Errorf("unexpected current snapshot; got=%+v, want=b", tree.Current)
+	}
+
+	a := tree.Lookup("a")
+	if a == nil || a.Description != "snapshot a" || a.State != libvirt.SnapStateShutoff || a.CreationTime.IsZero() {
+		t.Errorf("unexpected snapshot node; got=%+v", a)
+	}
+
+	if tree.Lookup("missing") != nil {
+		t.Error("a missing snapshot should not be found")
+	}
+
+	if names := snapshotNodeNames(tree.Lookup("a1").Ancestors()); names != "a root" {
+		t.Errorf("unexpected ancestors; got=[%v], want=[a root]", names)
+	}
+
+	if names := snapshotNodeNames(tree.Roots[0].Descendants()); names != "a a1 b" {
+		t.Errorf("unexpected descendants; got=[%v], want=[a a1 b]", names)
+	}
+
+	var walked []string
+	tree.Walk(func(node *libvirt.SnapshotNode, depth int) bool {
+		walked = append(walked, strings.Repeat(">", depth)+node.Name)
+		return true
+	})
+
+	if got := strings.Join(walked, " "); got != "root >a >>a1 >b" {
+		t.Errorf("unexpected walk; got=[%v], want=[root >a >>a1 >b]", got)
+	}
+
+	path, err := tree.PathFromCurrent("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := snapshotNodeNames(path); names != "b root a a1" {
+		t.Errorf("unexpected path; got=[%v], want=[b root a a1]", names)
+	}
+
+	if path, err = tree.Path("a1", "a"); err != nil || snapshotNodeNames(path) != "a1 a" {
+		t.Errorf("unexpected path to an ancestor; got=[%v] (err = %v), want=[a1 a]", snapshotNodeNames(path), err)
+	}
+
+	if _, err = tree.Path("a", "missing"); err != libvirt.ErrSnapshotNotInTree {
+		t.Errorf("unexpected error for a missing snapshot; got=%v, want=%v", err, libvirt.ErrSnapshotNotInTree)
+	}
+
+	// deleting the root leaves "a" and "b" in different roots
+	root, err := dom.LookupSnapshotByName("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = root.Delete(libvirt.SnapDeleteMetadataOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	if tree, err = dom.SnapshotTree(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tree.Path("a1", "b"); err != libvirt.ErrSnapshotsNotConnected {
+		t.Errorf("unexpected error for snapshots in different roots; got=%v, want=%v", err, libvirt.ErrSnapshotsNotConnected)
+	}
+}
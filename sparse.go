@@ -0,0 +1,238 @@
+package libvirt
+
+// #define _GNU_SOURCE
+// #include <unistd.h>
+import "C"
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// StreamInDataFunc reports whether "offset" in a data source points to data
+// or to a hole, and how long that section is. It's used by SparseSendAll to
+// find the holes which are sent with "<Stream>.SendHole".
+type StreamInDataFunc func(offset int64) (inData bool, length int64, err error)
+
+// FileInData returns a StreamInDataFunc which finds the holes of the local file
+// "f" with SEEK_DATA/SEEK_HOLE. The whole file is treated as data when the
+// underlying filesystem doesn't support them. The offset of "f" is restored
+// after each lookup, so it's left untouched for the caller.
+func FileInData(f *os.File) StreamInDataFunc {
+	return func(offset int64) (bool, int64, error) {
+		return fileInData(f, offset)
+	}
+}
+
+// SparseSendAll sends the content of "r" to the stream, as the package
+// function SparseSendAll.
+func (str Stream) SparseSendAll(r io.ReaderAt, inData StreamInDataFunc, length int64) error {
+	return SparseSendAll(NewStreamAPI(str), r, inData, length)
+}
+
+// SparseSendAll sends the content of "r", from 0 to "length" (or until its
+// end, if "length" is zero), to the stream "str". The sections which "inData"
+// reports as holes are sent with "<Stream>.SendHole", so the stream must have
+// been set up as a sparse stream (e.g. with VolUploadSparseStream); if
+// "inData" is nil, everything is sent as data.
+// If "length" is non-zero and "r" ends before "length" bytes are sent, the
+// stream is aborted and io.ErrUnexpectedEOF is returned, as the peer expects
+// the full length.
+// The stream is aborted if an error happens; otherwise, it must still be
+// finished by the caller.
+func SparseSendAll(str StreamAPI, r io.ReaderAt, inData StreamInDataFunc, length int64) error {
+	bufPtr := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufPtr)
+	buf := *bufPtr
+
+	var pos int64
+
+	for length == 0 || pos < length {
+		data, sectionLen := true, int64(len(buf))
+		if inData != nil {
+			var err error
+			if data, sectionLen, err = inData(pos); err != nil {
+				str.Abort()
+				return err
+			}
+		}
+
+		if length > 0 && sectionLen > length-pos {
+			sectionLen = length - pos
+		}
+
+		if sectionLen == 0 {
+			break
+		}
+
+		if !data {
+			if err := str.SendHole(sectionLen); err != nil {
+				str.Abort()
+				return err
+			}
+
+			pos += sectionLen
+			continue
+		}
+
+		n, err := sendSection(str, r, buf, pos, sectionLen)
+		pos += n
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			str.Abort()
+			return err
+		}
+	}
+
+	if length > 0 && pos < length {
+		str.Abort()
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// sendSection writes "length" bytes read from "r" at "offset" to the stream
+// "str", using "buf" as the intermediate buffer. It returns the number of bytes
+// written and io.EOF if "r" ended before "length" bytes could be read.
+func sendSection(str StreamAPI, r io.ReaderAt, buf []byte, offset int64, length int64) (int64, error) {
+	var sent int64
+
+	for sent < length {
+		chunk := buf
+		if remaining := length - sent; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+
+		n, readErr := r.ReadAt(chunk, offset+sent)
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return sent, readErr
+		}
+
+		for written := 0; written < n; {
+			w, err := str.Write(chunk[written:n])
+			if err != nil {
+				return sent, err
+			}
+
+			written += w
+			sent += int64(w)
+		}
+
+		if readErr != nil {
+			return sent, io.EOF
+		}
+	}
+
+	return sent, nil
+}
+
+// SparseRecvAll receives the data of the stream into "w", as the package
+// function SparseRecvAll.
+func (str Stream) SparseRecvAll(w io.WriterAt) (int64, error) {
+	return SparseRecvAll(NewStreamAPI(str), w)
+}
+
+// SparseRecvAll receives all the data of the stream "str", which must have
+// been set up as a sparse stream (e.g. with VolDownloadSparseStream), into
+// "w", starting at 0. Holes are skipped in "w" instead of being written as
+// zero bytes, so "w" must start zero-filled (e.g. a new or truncated file), or
+// the holes keep its previous content. It returns the total length received,
+// holes included.
+// The stream is aborted if an error happens; otherwise, it must still be
+// finished by the caller.
+func SparseRecvAll(str StreamAPI, w io.WriterAt) (int64, error) {
+	bufPtr := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufPtr)
+	buf := *bufPtr
+
+	var pos int64
+
+	for {
+		n, err := str.RecvFlags(buf, StrRecvStopAtHole)
+		if err == io.EOF {
+			return pos, nil
+		}
+
+		if err == ErrStreamHole {
+			hole, err := str.RecvHole()
+			if err != nil {
+				str.Abort()
+				return pos, err
+			}
+
+			pos += hole
+			continue
+		}
+
+		if err != nil {
+			str.Abort()
+			return pos, err
+		}
+
+		if _, err = w.WriteAt(buf[:n], pos); err != nil {
+			str.Abort()
+			return pos, err
+		}
+
+		pos += int64(n)
+	}
+}
+
+// fileInData checks whether "offset" in the local file "f" points to data or
+// to a hole, and how long that section is. The whole file is treated as data
+// when the underlying filesystem doesn't support SEEK_DATA/SEEK_HOLE. The
+// offset of "f" is restored before returning.
+func fileInData(f *os.File, offset int64) (inData bool, length int64, err error) {
+	cur, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, 0, err
+	}
+
+	defer func() {
+		if _, seekErr := f.Seek(cur, io.SeekStart); seekErr != nil && err == nil {
+			inData, length, err = false, 0, seekErr
+		}
+	}()
+
+	data, err := f.Seek(offset, int(C.SEEK_DATA))
+	if err != nil {
+		if errors.Is(err, syscall.ENXIO) {
+			// there's no more data after "offset": we're in a trailing hole
+			end, err := f.Seek(0, io.SeekEnd)
+			if err != nil {
+				return false, 0, err
+			}
+
+			return false, end - offset, nil
+		}
+
+		if errors.Is(err, syscall.EINVAL) {
+			// SEEK_DATA is not supported: everything is data
+			end, err := f.Seek(0, io.SeekEnd)
+			if err != nil {
+				return false, 0, err
+			}
+
+			return true, end - offset, nil
+		}
+
+		return false, 0, err
+	}
+
+	if data > offset {
+		return false, data - offset, nil
+	}
+
+	hole, err := f.Seek(offset, int(C.SEEK_HOLE))
+	if err != nil {
+		return false, 0, err
+	}
+
+	return true, hole - offset, nil
+}
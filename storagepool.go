@@ -2,10 +2,12 @@ package libvirt
 
 // #include <stdlib.h>
 // #include <libvirt/libvirt.h>
+// #include "callbacks.h"
 import "C"
 import (
-	"log"
+	"context"
 	"reflect"
+	"runtime"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -89,58 +91,72 @@ const (
 
 // StoragePool holds a libvirt storage pool. There are no exported fields.
 type StoragePool struct {
-	log            *log.Logger
+	log            *logger
 	virStoragePool C.virStoragePoolPtr
+	handle         *handle
 }
 
 // Free frees a storage pool object, releasing all memory associated with it.
 // Does not change the state of the pool on the host.
 func (pool StoragePool) Free() error {
-	pool.log.Println("freeing storage pool object...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("freeing storage pool object")
 	cRet := C.virStoragePoolFree(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool freed")
+	pool.handle.release()
+	op.done("pool freed")
 
 	return nil
 }
 
 // Undefine undefines an inactive storage pool.
 func (pool StoragePool) Undefine() error {
-	pool.log.Println("undefining storage pool...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("undefining storage pool")
 	cRet := C.virStoragePoolUndefine(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool undefined")
+	op.done("pool undefined")
 
 	return nil
 }
 
 // Create starts an inactive storage pool.
 func (pool StoragePool) Create() error {
-	pool.log.Println("creating storage pool...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("creating storage pool")
 	cRet := C.virStoragePoolCreate(pool.virStoragePool, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool created")
+	op.done("pool created")
 
 	return nil
 }
@@ -150,17 +166,21 @@ func (pool StoragePool) Create() error {
 // persistent config it can later be restarted with "Create". This does not free
 // the associated StoragePool object.
 func (pool StoragePool) Destroy() error {
-	pool.log.Println("destroying storage pool...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("destroying storage pool")
 	cRet := C.virStoragePoolDestroy(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool destroyed")
+	op.done("pool destroyed")
 
 	return nil
 }
@@ -168,39 +188,47 @@ func (pool StoragePool) Destroy() error {
 // Delete deletes the underlying pool resources. This is a non-recoverable
 // operation. The StoragePool object itself is not free'd.
 func (pool StoragePool) Delete(flags StoragePoolDeleteFlag) error {
-	pool.log.Printf("deleting storage pool (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("deleting storage pool", "flags", flags)
 	cRet := C.virStoragePoolDelete(pool.virStoragePool, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool deleted")
+	op.done("pool deleted")
 
 	return nil
 }
 
 // IsActive determines if the storage pool is currently running.
 func (pool StoragePool) IsActive() (bool, error) {
-	pool.log.Println("checking whether storage pool is active...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("checking whether storage pool is active")
 	cRet := C.virStoragePoolIsActive(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	active := (ret == 1)
 
 	if active {
-		pool.log.Println("pool is active")
+		op.done("pool is active")
 	} else {
-		pool.log.Println("pool is not active")
+		op.done("pool is not active")
 	}
 
 	return active, nil
@@ -209,22 +237,26 @@ func (pool StoragePool) IsActive() (bool, error) {
 // IsPersistent determines if the storage pool has a persistent configuration
 // which means it will still exist after shutting down.
 func (pool StoragePool) IsPersistent() (bool, error) {
-	pool.log.Println("checking whether storage pool is persistent...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("checking whether storage pool is persistent")
 	cRet := C.virStoragePoolIsPersistent(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	persistent := (ret == 1)
 
 	if persistent {
-		pool.log.Println("pool is persistent")
+		op.done("pool is persistent")
 	} else {
-		pool.log.Println("pool is not persistent")
+		op.done("pool is not persistent")
 	}
 
 	return persistent, nil
@@ -232,38 +264,46 @@ func (pool StoragePool) IsPersistent() (bool, error) {
 
 // Name fetches the locally unique name of the storage pool.
 func (pool StoragePool) Name() (string, error) {
-	pool.log.Println("reading storage pool name...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("reading storage pool name")
 	cName := C.virStoragePoolGetName(pool.virStoragePool)
 
 	if cName == nil {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	name := C.GoString(cName)
-	pool.log.Printf("name: %v\n", name)
+	op.done("name read", "name", name)
 
 	return name, nil
 }
 
 // UUID fetches the globally unique ID of the storage pool as a string.
 func (pool StoragePool) UUID() (string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	cUUID := (*C.char)(C.malloc(C.size_t(C.VIR_UUID_STRING_BUFLEN)))
 	defer C.free(unsafe.Pointer(cUUID))
 
-	pool.log.Println("reading storage pool UUID...")
+	op := pool.log.begin("reading storage pool UUID")
 	cRet := C.virStoragePoolGetUUIDString(pool.virStoragePool, cUUID)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	uuid := C.GoString(cUUID)
-	pool.log.Printf("UUID: %v\n", uuid)
+	op.done("UUID read", "uuid", uuid)
 
 	return uuid, nil
 }
@@ -272,98 +312,197 @@ func (pool StoragePool) UUID() (string, error) {
 // is suitable for later feeding back into the
 // "<Connection>.CreateStoragePool" method.
 func (pool StoragePool) XML(flags StorageXMLFlag) (string, error) {
-	pool.log.Printf("reading storage pool XML (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("reading storage pool XML", "flags", flags)
 	cXML := C.virStoragePoolGetXMLDesc(pool.virStoragePool, C.uint(flags))
 
 	if cXML == nil {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cXML))
 
 	xml := C.GoString(cXML)
-	pool.log.Printf("XML length: %v runes\n", utf8.RuneCountInString(xml))
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
 
 	return xml, nil
 }
 
 // InfoState extracts the storage pool state.
 func (pool StoragePool) InfoState() (StoragePoolState, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cInfo C.virStoragePoolInfo
 
-	pool.log.Println("reading storage pool state...")
+	op := pool.log.begin("reading storage pool state")
 	cRet := C.virStoragePoolGetInfo(pool.virStoragePool, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	state := StoragePoolState(cInfo.state)
-	pool.log.Printf("state: %v\n", state)
+	op.done("state read", "state", state)
 
 	return state, nil
 }
 
+// WaitForState waits until the storage pool reaches one of the "desired"
+// states, or the context is done, and returns the last state read. Like
+// "<Domain>.WaitForState", the state is read again after each lifecycle event
+// and polled with an increasing interval.
+func (pool StoragePool) WaitForState(ctx context.Context, desired ...StoragePoolState) (StoragePoolState, error) {
+	wake, stop := pool.lifecycleEvents()
+	defer stop()
+
+	var state StoragePoolState
+
+	err := waitUntil(ctx, wake, func() (bool, error) {
+		var err error
+		if state, err = pool.InfoState(); err != nil {
+			return false, err
+		}
+
+		for _, d := range desired {
+			if state == d {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+
+	return state, err
+}
+
+// lifecycleEvents registers a lifecycle event callback for the storage pool,
+// and returns a channel which receives a message after the events and a
+// function which deregisters the callback. If the callback can't be
+// registered, the channel is nil.
+func (pool StoragePool) lifecycleEvents() (<-chan struct{}, func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	wake := make(chan struct{}, 1)
+	callbackID := registerCallback(lifecycleCallback(func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}))
+
+	cConn := C.virStoragePoolGetConnect(pool.virStoragePool)
+
+	op := pool.log.begin("registering lifecycle event callback")
+	cCallbackID := C.storagePoolEventLifecycleRegisterWrapper(cConn, pool.virStoragePool, C.long(callbackID))
+	ret := int32(cCallbackID)
+
+	if ret == -1 {
+		// not an error for the caller, which falls back to polling
+		unregisterCallback(callbackID)
+		op.done("lifecycle events not available", "error", lastError())
+		return nil, func() {}
+	}
+
+	op.done("lifecycle event callback registered", "callback_id", ret)
+
+	stop := func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer runtime.KeepAlive(pool.handle)
+
+		op := pool.log.begin("deregistering lifecycle event callback")
+		cRet := C.virConnectStoragePoolEventDeregisterAny(cConn, cCallbackID)
+
+		if int32(cRet) == -1 {
+			op.failed(lastError())
+			return
+		}
+
+		op.done("lifecycle event callback deregistered")
+	}
+
+	return wake, stop
+}
+
 // InfoCapacity extracts the storage pool logical size (bytes).
 func (pool StoragePool) InfoCapacity() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cInfo C.virStoragePoolInfo
 
-	pool.log.Println("reading storage pool capacity...")
+	op := pool.log.begin("reading storage pool capacity")
 	cRet := C.virStoragePoolGetInfo(pool.virStoragePool, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	capacity := uint64(cInfo.capacity)
-	pool.log.Printf("capacity: %v bytes\n", capacity)
+	op.done("capacity read", "bytes", capacity)
 
 	return capacity, nil
 }
 
 // InfoAllocation extracts the storage pool current allocation (bytes).
 func (pool StoragePool) InfoAllocation() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cInfo C.virStoragePoolInfo
 
-	pool.log.Println("reading storage pool allocation...")
+	op := pool.log.begin("reading storage pool allocation")
 	cRet := C.virStoragePoolGetInfo(pool.virStoragePool, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	allocation := uint64(cInfo.allocation)
-	pool.log.Printf("allocation: %v bytes\n", allocation)
+	op.done("allocation read", "bytes", allocation)
 
 	return allocation, nil
 }
 
 // InfoAvailable extracts the storage pool remaining free space (bytes)
 func (pool StoragePool) InfoAvailable() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cInfo C.virStoragePoolInfo
 
-	pool.log.Println("reading storage pool available space...")
+	op := pool.log.begin("reading storage pool available space")
 	cRet := C.virStoragePoolGetInfo(pool.virStoragePool, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	available := uint64(cInfo.available)
-	pool.log.Printf("available: %v bytes\n", available)
+	op.done("available space read", "bytes", available)
 
 	return available, nil
 }
@@ -371,24 +510,28 @@ func (pool StoragePool) InfoAvailable() (uint64, error) {
 // Autostart fetches the value of the autostart flag, which determines whether
 // the pool is automatically started at boot time.
 func (pool StoragePool) Autostart() (bool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cAutostart C.int
 
-	pool.log.Println("checking whether storage pool autostarts...")
+	op := pool.log.begin("checking whether storage pool autostarts")
 	cRet := C.virStoragePoolGetAutostart(pool.virStoragePool, &cAutostart)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return false, err
 	}
 
 	autostart := (int32(cAutostart) == 1)
 
 	if autostart {
-		pool.log.Println("pool autostarts")
+		op.done("pool autostarts")
 	} else {
-		pool.log.Println("pool does not autostart")
+		op.done("pool does not autostart")
 	}
 
 	return autostart, nil
@@ -396,12 +539,17 @@ func (pool StoragePool) Autostart() (bool, error) {
 
 // SetAutostart sets the autostart flag.
 func (pool StoragePool) SetAutostart(autostart bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var autostartInt int32
+	var op operation
 	if autostart {
-		pool.log.Println("enabling storage pool autostart...")
+		op = pool.log.begin("enabling storage pool autostart")
 		autostartInt = 1
 	} else {
-		pool.log.Println("disabling storage pool autostart...")
+		op = pool.log.begin("disabling storage pool autostart")
 		autostartInt = 0
 	}
 
@@ -409,15 +557,15 @@ func (pool StoragePool) SetAutostart(autostart bool) error {
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
 	if autostart {
-		pool.log.Printf("autostart enabled")
+		op.done("autostart enabled")
 	} else {
-		pool.log.Printf("autostart disabled")
+		op.done("autostart disabled")
 	}
 
 	return nil
@@ -425,17 +573,21 @@ func (pool StoragePool) SetAutostart(autostart bool) error {
 
 // Build builds the underlying storage pool.
 func (pool StoragePool) Build(flags StoragePoolBuildFlag) error {
-	pool.log.Printf("building storage pool (flags = %v)...\n", flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("building storage pool", "flags", flags)
 	cRet := C.virStoragePoolBuild(pool.virStoragePool, C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool built")
+	op.done("pool built")
 
 	return nil
 }
@@ -444,17 +596,21 @@ func (pool StoragePool) Build(flags StoragePoolBuildFlag) error {
 // communicating with a remote server, and/or initializing new devices at the
 // OS layer.
 func (pool StoragePool) Refresh() error {
-	pool.log.Println("refreshing storage pool...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("refreshing storage pool")
 	cRet := C.virStoragePoolRefresh(pool.virStoragePool, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	pool.log.Println("pool refreshed")
+	op.done("pool refreshed")
 
 	return nil
 }
@@ -468,32 +624,42 @@ func (pool StoragePool) Refresh() error {
 // all threads have finished using it. ie, each new thread using a pool would
 // increment the reference count.
 func (pool StoragePool) Ref() error {
-	pool.log.Println("incrementing storage pool's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
+	op := pool.log.begin("incrementing storage pool's reference count")
 	cRet := C.virStoragePoolRef(pool.virStoragePool)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
+	pool.handle.ref()
+
 	return nil
 }
 
 // ListStorageVolumes collects the list of storage volumes, and allocate an
 // array to store those objects.
 func (pool StoragePool) ListStorageVolumes() ([]StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	var cStorageVolumes []C.virStorageVolPtr
 	cStorageVolumesSH := (*reflect.SliceHeader)(unsafe.Pointer(&cStorageVolumes))
 
-	pool.log.Println("reading storage volumes...")
+	op := pool.log.begin("reading storage volumes")
 	cRet := C.virStoragePoolListAllVolumes(pool.virStoragePool, (**C.virStorageVolPtr)(unsafe.Pointer(&cStorageVolumesSH.Data)), 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return nil, err
 	}
 	defer C.free(unsafe.Pointer(cStorageVolumesSH.Data))
@@ -504,12 +670,13 @@ func (pool StoragePool) ListStorageVolumes() ([]StorageVolume, error) {
 	storageVolumes := make([]StorageVolume, ret)
 	for i, cVol := range cStorageVolumes {
 		storageVolumes[i] = StorageVolume{
-			log:           pool.log,
+			log:           pool.log.storageVolume(cVol),
 			virStorageVol: cVol,
+			handle:        pool.handle.track(kindStorageVolume, unsafe.Pointer(cVol)),
 		}
 	}
 
-	pool.log.Printf("volumes count: %v\n", ret)
+	op.done("volumes read", "count", ret)
 
 	return storageVolumes, nil
 }
@@ -522,23 +689,28 @@ func (pool StoragePool) ListStorageVolumes() ([]StorageVolume, error) {
 // "Free" should be used to free the resources after the storage volume object
 // is no longer needed.
 func (pool StoragePool) CreateStorageVolume(xml string, flags StorageVolumeCreateFlag) (StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	pool.log.Printf("creating storage volume (flags = %v)...\n", flags)
+	op := pool.log.begin("creating storage volume", "flags", flags)
 	cVol := C.virStorageVolCreateXML(pool.virStoragePool, cXML, C.uint(flags))
 
 	if cVol == nil {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StorageVolume{}, err
 	}
 
-	pool.log.Println("volume created")
+	op.done("volume created")
 
 	storageVolume := StorageVolume{
-		log:           pool.log,
+		log:           pool.log.storageVolume(cVol),
 		virStorageVol: cVol,
+		handle:        pool.handle.track(kindStorageVolume, unsafe.Pointer(cVol)),
 	}
 
 	return storageVolume, nil
@@ -553,23 +725,28 @@ func (pool StoragePool) CreateStorageVolume(xml string, flags StorageVolumeCreat
 // "Free" should be used to free the resources after the storage volume object
 // is no longer needed.
 func (pool StoragePool) CreateStorageVolumeFrom(xml string, cloneVol StorageVolume, flags StorageVolumeCreateFlag) (StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	cXML := C.CString(xml)
 	defer C.free(unsafe.Pointer(cXML))
 
-	pool.log.Printf("creating storage volume from another volume (flags = %v)...\n", flags)
+	op := pool.log.begin("creating storage volume from another volume", "flags", flags)
 	cVol := C.virStorageVolCreateXMLFrom(pool.virStoragePool, cXML, cloneVol.virStorageVol, C.uint(flags))
 
 	if cVol == nil {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StorageVolume{}, err
 	}
 
-	pool.log.Println("volume created")
+	op.done("volume created")
 
 	storageVolume := StorageVolume{
-		log:           pool.log,
+		log:           pool.log.storageVolume(cVol),
 		virStorageVol: cVol,
+		handle:        pool.handle.track(kindStorageVolume, unsafe.Pointer(cVol)),
 	}
 
 	return storageVolume, nil
@@ -580,23 +757,28 @@ func (pool StoragePool) CreateStorageVolumeFrom(xml string, cloneVol StorageVolu
 // "Free" should be used to free the resources after the storage volume object
 // is no longer needed.
 func (pool StoragePool) LookupStorageVolumeByName(name string) (StorageVolume, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(pool.handle)
+
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
 
-	pool.log.Printf("looking up storage volume by name = %v...\n", name)
+	op := pool.log.begin("looking up storage volume by name", "name", name)
 	cVol := C.virStorageVolLookupByName(pool.virStoragePool, cName)
 
 	if cVol == nil {
-		err := LastError()
-		pool.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StorageVolume{}, err
 	}
 
-	pool.log.Println("volume found")
+	op.done("volume found")
 
 	vol := StorageVolume{
-		log:           pool.log,
+		log:           pool.log.storageVolume(cVol),
 		virStorageVol: cVol,
+		handle:        pool.handle.track(kindStorageVolume, unsafe.Pointer(cVol)),
 	}
 
 	return vol, nil
@@ -0,0 +1,152 @@
+// Code generated by "enumgen -text PoolListNetFS=netfs,PoolListMPath=mpath storagepool.go StoragePoolListFlag=PoolList StoragePoolDeleteFlag=PoolDelete StorageXMLFlag=StorageXML StoragePoolState=PoolState StoragePoolBuildFlag=PoolBuild StorageVolumeCreateFlag=VolCreate"; DO NOT EDIT.
+
+package libvirt
+
+// storagePoolListFlagNames holds the text form of the values of StoragePoolListFlag.
+var storagePoolListFlagNames = []enumName[StoragePoolListFlag]{
+	{PoolListAll, "all"},
+	{PoolListInactive, "inactive"},
+	{PoolListActive, "active"},
+	{PoolListPersistent, "persistent"},
+	{PoolListTransient, "transient"},
+	{PoolListAutostart, "autostart"},
+	{PoolListNoAutostart, "no_autostart"},
+	{PoolListDir, "dir"},
+	{PoolListFS, "fs"},
+	{PoolListNetFS, "netfs"},
+	{PoolListLogical, "logical"},
+	{PoolListDisk, "disk"},
+	{PoolListISCSI, "iscsi"},
+	{PoolListSCSI, "scsi"},
+	{PoolListMPath, "mpath"},
+	{PoolListRBD, "rbd"},
+	{PoolListSheepdog, "sheepdog"},
+	{PoolListGluster, "gluster"},
+	{PoolListZFS, "zfs"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StoragePoolListFlag) String() string {
+	return formatFlags(v, storagePoolListFlagNames, "StoragePoolListFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StoragePoolListFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storagePoolListFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StoragePoolListFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storagePoolListFlagNames, "StoragePoolListFlag")
+}
+
+// storagePoolDeleteFlagNames holds the text form of the values of StoragePoolDeleteFlag.
+var storagePoolDeleteFlagNames = []enumName[StoragePoolDeleteFlag]{
+	{PoolDeleteNormal, "normal"},
+	{PoolDeleteZeroed, "zeroed"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StoragePoolDeleteFlag) String() string {
+	return formatFlags(v, storagePoolDeleteFlagNames, "StoragePoolDeleteFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StoragePoolDeleteFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storagePoolDeleteFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StoragePoolDeleteFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storagePoolDeleteFlagNames, "StoragePoolDeleteFlag")
+}
+
+// storageXMLFlagNames holds the text form of the values of StorageXMLFlag.
+var storageXMLFlagNames = []enumName[StorageXMLFlag]{
+	{StorageXMLDefault, "default"},
+	{StorageXMLInactive, "inactive"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StorageXMLFlag) String() string {
+	return formatFlags(v, storageXMLFlagNames, "StorageXMLFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageXMLFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storageXMLFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageXMLFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storageXMLFlagNames, "StorageXMLFlag")
+}
+
+// storagePoolStateNames holds the text form of the values of StoragePoolState.
+var storagePoolStateNames = []enumName[StoragePoolState]{
+	{PoolStateInactive, "inactive"},
+	{PoolStateBuilding, "building"},
+	{PoolStateRunning, "running"},
+	{PoolStateDegraded, "degraded"},
+	{PoolStateInaccessible, "inaccessible"},
+}
+
+// String returns the text form of the value.
+func (v StoragePoolState) String() string {
+	return formatEnum(v, storagePoolStateNames, "StoragePoolState")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StoragePoolState) MarshalText() ([]byte, error) {
+	return marshalEnum(v, storagePoolStateNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StoragePoolState) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, storagePoolStateNames, "StoragePoolState")
+}
+
+// storagePoolBuildFlagNames holds the text form of the values of StoragePoolBuildFlag.
+var storagePoolBuildFlagNames = []enumName[StoragePoolBuildFlag]{
+	{PoolBuildNew, "new"},
+	{PoolBuildRepair, "repair"},
+	{PoolBuildResize, "resize"},
+	{PoolBuildNoOverwrite, "no_overwrite"},
+	{PoolBuildOverwrite, "overwrite"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StoragePoolBuildFlag) String() string {
+	return formatFlags(v, storagePoolBuildFlagNames, "StoragePoolBuildFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StoragePoolBuildFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storagePoolBuildFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StoragePoolBuildFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storagePoolBuildFlagNames, "StoragePoolBuildFlag")
+}
+
+// storageVolumeCreateFlagNames holds the text form of the values of StorageVolumeCreateFlag.
+var storageVolumeCreateFlagNames = []enumName[StorageVolumeCreateFlag]{
+	{VolCreateDefault, "default"},
+	{VolCreatePreallocMetadata, "prealloc_metadata"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StorageVolumeCreateFlag) String() string {
+	return formatFlags(v, storageVolumeCreateFlagNames, "StorageVolumeCreateFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeCreateFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storageVolumeCreateFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeCreateFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storageVolumeCreateFlagNames, "StorageVolumeCreateFlag")
+}
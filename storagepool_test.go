@@ -2,7 +2,9 @@ package libvirt
 
 import (
 	"bytes"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/cd1/utils-golang"
 )
@@ -121,6 +123,32 @@ func TestStoragePoolBuild(t *testing.T) {
 	}
 }
 
+func TestStoragePoolWaitForState(t *testing.T) {
+	env := newTestEnvironment(t).withStoragePool()
+	defer env.cleanUp()
+
+	if err := env.pool.Create(); err != nil {
+		t.Fatal(err)
+	}
+	defer env.pool.Destroy()
+
+	state, err := env.pool.WaitForState(context.Background(), PoolStateRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != PoolStateRunning {
+		t.Errorf("unexpected storage pool state; got=%v, want=%v", state, PoolStateRunning)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err = env.pool.WaitForState(ctx, PoolStateInactive); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error when waiting for an unreached state; got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+}
+
 func TestStoragPoolRefresh(t *testing.T) {
 	env := newTestEnvironment(t).withStoragePool()
 	defer env.cleanUp()
@@ -4,7 +4,10 @@ package libvirt
 // #include <libvirt/libvirt.h>
 import "C"
 import (
-	"log"
+	"context"
+	"io"
+	"os"
+	"runtime"
 	"unicode/utf8"
 	"unsafe"
 )
@@ -49,43 +52,73 @@ const (
 	VolWipeAlgRandom     StorageVolumeWipeAlgorithm = C.VIR_STORAGE_VOL_WIPE_ALG_RANDOM
 )
 
+// StorageVolumeUploadFlag defines how data should be uploaded to a
+// storage volume.
+type StorageVolumeUploadFlag uint32
+
+// Possible values for StorageVolumeUploadFlag.
+const (
+	VolUploadDefault      StorageVolumeUploadFlag = 0
+	VolUploadSparseStream StorageVolumeUploadFlag = C.VIR_STORAGE_VOL_UPLOAD_SPARSE_STREAM
+)
+
+// StorageVolumeDownloadFlag defines how data should be downloaded from a
+// storage volume.
+type StorageVolumeDownloadFlag uint32
+
+// Possible values for StorageVolumeDownloadFlag.
+const (
+	VolDownloadDefault      StorageVolumeDownloadFlag = 0
+	VolDownloadSparseStream StorageVolumeDownloadFlag = C.VIR_STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+)
+
 // StorageVolume holds a libvirt storage volume. There are no exported fields.
 type StorageVolume struct {
-	log           *log.Logger
+	log           *logger
 	virStorageVol C.virStorageVolPtr
+	handle        *handle
 }
 
 // Free releases the storage volume handle. The underlying storage volume
 // continues to exist.
 func (vol StorageVolume) Free() error {
-	vol.log.Println("freeing storage volume object...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("freeing storage volume object")
 	cRet := C.virStorageVolFree(vol.virStorageVol)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("volume freed")
+	vol.handle.release()
+	op.done("volume freed")
 
 	return nil
 }
 
 // Delete deletes the storage volume from the pool.
 func (vol StorageVolume) Delete() error {
-	vol.log.Println("deleting storage volume...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("deleting storage volume")
 	cRet := C.virStorageVolDelete(vol.virStorageVol, 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("volume deleted")
+	op.done("volume deleted")
 
 	return nil
 }
@@ -93,17 +126,21 @@ func (vol StorageVolume) Delete() error {
 // Key fetches the storage volume key. This is globally unique, so the same
 // volume will have the same key no matter what host it is accessed from.
 func (vol StorageVolume) Key() (string, error) {
-	vol.log.Println("reading storage volume key...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("reading storage volume key")
 	cKey := C.virStorageVolGetKey(vol.virStorageVol)
 
 	if cKey == nil {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	key := C.GoString(cKey)
-	vol.log.Printf("key: %v\n", key)
+	op.done("key read", "key", key)
 
 	return key, nil
 }
@@ -111,17 +148,21 @@ func (vol StorageVolume) Key() (string, error) {
 // Name fetches the storage volume name. This is unique within the scope of
 // a pool.
 func (vol StorageVolume) Name() (string, error) {
-	vol.log.Println("reading storage volume name...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("reading storage volume name")
 	cName := C.virStorageVolGetName(vol.virStorageVol)
 
 	if cName == nil {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	name := C.GoString(cName)
-	vol.log.Printf("name: %v\n", name)
+	op.done("name read", "name", name)
 
 	return name, nil
 }
@@ -131,35 +172,43 @@ func (vol StorageVolume) Name() (string, error) {
 // startup. Consult pool documentation for information on getting the
 // persistent naming.
 func (vol StorageVolume) Path() (string, error) {
-	vol.log.Println("reading storage volume path...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("reading storage volume path")
 	cPath := C.virStorageVolGetPath(vol.virStorageVol)
 
 	if cPath == nil {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 	defer C.free(unsafe.Pointer(cPath))
 
 	path := C.GoString(cPath)
-	vol.log.Printf("path: %v\n", path)
+	op.done("path read", "path", path)
 
 	return path, nil
 }
 
 // XML fetches an XML document describing all aspects of the storage volume.
 func (vol StorageVolume) XML() (string, error) {
-	vol.log.Println("reading storage volume XML...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("reading storage volume XML")
 	cXML := C.virStorageVolGetXMLDesc(vol.virStorageVol, 0)
 
 	if cXML == nil {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return "", err
 	}
 
 	xml := C.GoString(cXML)
-	vol.log.Printf("XML length: %v runes\n", utf8.RuneCountInString(xml))
+	op.done("XML read", "runes", utf8.RuneCountInString(xml))
 
 	return xml, nil
 }
@@ -167,20 +216,24 @@ func (vol StorageVolume) XML() (string, error) {
 // InfoType fetches volatile information about the storage volume:
 // current type.
 func (vol StorageVolume) InfoType() (StorageVolumeType, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
 	var cInfo C.virStorageVolInfo
 
-	vol.log.Println("reading storage volume type...")
+	op := vol.log.begin("reading storage volume type")
 	cRet := C.virStorageVolGetInfo(vol.virStorageVol, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	typ := StorageVolumeType(cInfo._type)
-	vol.log.Printf("type: %v\n", typ)
+	op.done("type read", "type", typ)
 
 	return typ, nil
 }
@@ -188,20 +241,24 @@ func (vol StorageVolume) InfoType() (StorageVolumeType, error) {
 // InfoCapacity fetches volatile information about the storage volume:
 // current capacity.
 func (vol StorageVolume) InfoCapacity() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
 	var cInfo C.virStorageVolInfo
 
-	vol.log.Println("reading storage volume capacity...")
+	op := vol.log.begin("reading storage volume capacity")
 	cRet := C.virStorageVolGetInfo(vol.virStorageVol, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	capacity := uint64(cInfo.capacity)
-	vol.log.Printf("capacity: %v\n", capacity)
+	op.done("capacity read", "bytes", capacity)
 
 	return capacity, nil
 }
@@ -209,20 +266,24 @@ func (vol StorageVolume) InfoCapacity() (uint64, error) {
 // InfoAllocation fetches volatile information about the storage volume:
 // current allocation.
 func (vol StorageVolume) InfoAllocation() (uint64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
 	var cInfo C.virStorageVolInfo
 
-	vol.log.Println("reading storage volume allocation...")
+	op := vol.log.begin("reading storage volume allocation")
 	cRet := C.virStorageVolGetInfo(vol.virStorageVol, &cInfo)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
 	allocation := uint64(cInfo.allocation)
-	vol.log.Printf("allocation: %v\n", allocation)
+	op.done("allocation read", "bytes", allocation)
 
 	return allocation, nil
 }
@@ -249,34 +310,42 @@ func (vol StorageVolume) InfoAllocation() (uint64, error) {
 // "capacity" represents the absolute new size regardless of whether it is
 // larger or smaller than the current size.
 func (vol StorageVolume) Resize(capacity uint64, flags StorageVolumeResizeFlag) error {
-	vol.log.Printf("resizing storage volume to %v bytes (flags = %v)...\n", capacity, flags)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("resizing storage volume", "bytes", capacity, "flags", flags)
 	cRet := C.virStorageVolResize(vol.virStorageVol, C.ulonglong(capacity), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("volume resized")
+	op.done("volume resized")
 
 	return nil
 }
 
 // Wipe ensure data previously on a volume is not accessible to future reads.
 func (vol StorageVolume) Wipe(alg StorageVolumeWipeAlgorithm) error {
-	vol.log.Printf("wiping storage volume with algorithm %v...\n", alg)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("wiping storage volume", "algorithm", alg)
 	cRet := C.virStorageVolWipePattern(vol.virStorageVol, C.uint(alg), 0)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("volume wiped")
+	op.done("volume wiped")
 
 	return nil
 }
@@ -290,17 +359,22 @@ func (vol StorageVolume) Wipe(alg StorageVolumeWipeAlgorithm) error {
 // all threads have finished using it. ie, each new thread using a vol would
 // increment the reference count.
 func (vol StorageVolume) Ref() error {
-	vol.log.Println("incrementing storage volume's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("incrementing storage volume's reference count")
 	cRet := C.virStorageVolRef(vol.virStorageVol)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("reference count incremented")
+	vol.handle.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
@@ -309,20 +383,25 @@ func (vol StorageVolume) Ref() error {
 // "Free" should be used to free the resources after the storage pool object is
 // no longer needed.
 func (vol StorageVolume) StoragePool() (StoragePool, error) {
-	vol.log.Println("looking up storage pool by storage volume...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("looking up storage pool by storage volume")
 	cPool := C.virStoragePoolLookupByVolume(vol.virStorageVol)
 
 	if cPool == nil {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return StoragePool{}, err
 	}
 
-	vol.log.Println("pool found")
+	op.done("pool found")
 
 	pool := StoragePool{
-		log:            vol.log,
+		log:            vol.log.storagePool(cPool),
 		virStoragePool: cPool,
+		handle:         vol.handle.track(kindStoragePool, unsafe.Pointer(cPool)),
 	}
 
 	return pool, nil
@@ -343,17 +422,28 @@ func (vol StorageVolume) StoragePool() (StoragePool, error) {
 // characteristics from the source stream such as format type, capacity,
 // and allocation.
 func (vol StorageVolume) Upload(str Stream, offset uint64, length uint64) error {
-	vol.log.Printf("setting up to upload %v bytes of data to storage volume in offset %v...\n", length, offset)
-	cRet := C.virStorageVolUpload(vol.virStorageVol, str.virStream, C.ulonglong(offset), C.ulonglong(length), 0)
+	return vol.UploadFlags(str, offset, length, VolUploadDefault)
+}
+
+// UploadFlags uploads new content to the volume from a stream, as Upload.
+// If "flags" contains VolUploadSparseStream, holes in the data may be sent
+// with "<Stream>.SendHole" instead of writing zero bytes to the stream.
+func (vol StorageVolume) UploadFlags(str Stream, offset uint64, length uint64, flags StorageVolumeUploadFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("setting up upload to storage volume", "offset", offset, "bytes", length, "flags", flags)
+	cRet := C.virStorageVolUpload(vol.virStorageVol, str.virStream, C.ulonglong(offset), C.ulonglong(length), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	vol.log.Println("data set up")
+	op.done("data set up")
 
 	return nil
 }
@@ -366,17 +456,206 @@ func (vol StorageVolume) Upload(str Stream, offset uint64, length uint64) error
 // successfully transferred, and detect any errors. The results will be
 // unpredictable if another active stream is writing to the storage volume.
 func (vol StorageVolume) Download(str Stream, offset uint64, length uint64) error {
-	vol.log.Printf("setting up to download %v bytes of data from storage volume in offset %v...\n", length, offset)
-	cRet := C.virStorageVolDownload(vol.virStorageVol, str.virStream, C.ulonglong(offset), C.ulonglong(length), 0)
+	return vol.DownloadFlags(str, offset, length, VolDownloadDefault)
+}
+
+// DownloadFlags downloads the content of the volume as a stream, as Download.
+// If "flags" contains VolDownloadSparseStream, holes in the volume are not
+// transferred as zero bytes; they should be read with "<Stream>.RecvFlags" and
+// "<Stream>.RecvHole" instead.
+func (vol StorageVolume) DownloadFlags(str Stream, offset uint64, length uint64, flags StorageVolumeDownloadFlag) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("setting up download from storage volume", "offset", offset, "bytes", length, "flags", flags)
+	cRet := C.virStorageVolDownload(vol.virStorageVol, str.virStream, C.ulonglong(offset), C.ulonglong(length), C.uint(flags))
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		vol.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("data set up")
+
+	return nil
+}
+
+// newStream creates a blocking stream on the same connection as the
+// storage volume.
+func (vol StorageVolume) newStream() (Stream, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(vol.handle)
+
+	op := vol.log.begin("creating stream for storage volume")
+	cStream := C.virStreamNew(C.virStorageVolGetConnect(vol.virStorageVol), 0)
+
+	if cStream == nil {
+		err := lastError()
+		op.failed(err)
+		return Stream{}, err
+	}
+
+	op.done("stream created")
+
+	stream := Stream{
+		log:       vol.log.stream(),
+		virStream: cStream,
+		handle:    vol.handle.track(kindStream, unsafe.Pointer(cStream)),
+	}
+
+	return stream, nil
+}
+
+// DownloadTo downloads the content of the volume into "w", starting at
+// "offset" in the volume and at 0 in "w". If "length" is zero, then the
+// remaining contents of the volume after "offset" will be downloaded.
+// The data is transferred as a sparse stream: holes in the volume are not
+// transferred and are skipped in "w", so they are preserved when "w" is a
+// local file. If "w" can be truncated (like *os.File), its previous content is
+// discarded before the download, and it's resized to the downloaded length at
+// the end so a trailing hole is also preserved; otherwise, "w" must start
+// zero-filled, or the holes keep whatever it held before.
+func (vol StorageVolume) DownloadTo(w io.WriterAt, offset uint64, length uint64) error {
+	t, truncate := w.(interface {
+		Truncate(int64) error
+	})
+	if truncate {
+		if err := t.Truncate(0); err != nil {
+			return err
+		}
+	}
+
+	str, err := vol.newStream()
+	if err != nil {
+		return err
+	}
+	defer str.Free()
+
+	if err = vol.DownloadFlags(str, offset, length, VolDownloadSparseStream); err != nil {
 		return err
 	}
 
-	vol.log.Println("data set up")
+	pos, err := str.SparseRecvAll(w)
+	if err != nil {
+		return err
+	}
+
+	if err = str.Finish(); err != nil {
+		return err
+	}
+
+	if truncate {
+		return t.Truncate(pos)
+	}
 
 	return nil
 }
+
+// UploadFrom uploads the content of "r" to the volume, starting at 0 in "r"
+// and at "offset" in the volume. If "length" is non-zero, exactly "length"
+// bytes are uploaded, and io.ErrUnexpectedEOF is returned if "r" is shorter;
+// otherwise "r" is read until its end.
+// If "r" is a local file (*os.File), the data is transferred as a sparse
+// stream: holes in the file are detected with SEEK_DATA/SEEK_HOLE and sent as
+// holes instead of zero bytes.
+func (vol StorageVolume) UploadFrom(r io.ReaderAt, offset uint64, length uint64) error {
+	f, sparse := r.(*os.File)
+
+	end := int64(length)
+	if sparse && length == 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		end = info.Size()
+	}
+
+	str, err := vol.newStream()
+	if err != nil {
+		return err
+	}
+	defer str.Free()
+
+	flags := VolUploadDefault
+	if sparse {
+		flags = VolUploadSparseStream
+	}
+
+	if err = vol.UploadFlags(str, offset, uint64(end), flags); err != nil {
+		return err
+	}
+
+	var inData StreamInDataFunc
+	if sparse {
+		inData = FileInData(f)
+	}
+
+	if err = str.SparseSendAll(r, inData, end); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
+
+// UploadFromReader uploads the content of "r" to the volume, starting at
+// "offset". If "length" is non-zero, at most "length" bytes are read from "r";
+// otherwise "r" is read until its end.
+// The stream used in the transfer is created and released by this function:
+// it's finished when all data has been sent, or aborted if an error happens or
+// the context is cancelled, even while a chunk is being sent. In the latter
+// case, ctx.Err() is returned.
+// If "progress" is not nil, it's called after each chunk with the total
+// number of bytes sent so far.
+func (vol StorageVolume) UploadFromReader(ctx context.Context, r io.Reader, offset uint64, length uint64, progress TransferProgressFunc) error {
+	str, err := vol.newStream()
+	if err != nil {
+		return err
+	}
+	defer str.Free()
+
+	if err = vol.Upload(str, offset, length); err != nil {
+		return err
+	}
+
+	if length > 0 {
+		r = io.LimitReader(r, int64(length))
+	}
+
+	if err = SendAll(ctx, NewStreamAPI(str), r, progress); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
+
+// DownloadToWriter downloads the content of the volume, starting at "offset",
+// and writes it to "w". If "length" is zero, then the remaining contents of the
+// volume after "offset" will be downloaded.
+// The stream used in the transfer is created and released by this function:
+// it's finished when all data has been received, or aborted if an error
+// happens or the context is cancelled, even while a chunk is being received.
+// In the latter case, ctx.Err() is returned.
+// If "progress" is not nil, it's called after each chunk with the total
+// number of bytes received so far.
+func (vol StorageVolume) DownloadToWriter(ctx context.Context, w io.Writer, offset uint64, length uint64, progress TransferProgressFunc) error {
+	str, err := vol.newStream()
+	if err != nil {
+		return err
+	}
+	defer str.Free()
+
+	if err = vol.Download(str, offset, length); err != nil {
+		return err
+	}
+
+	if err = RecvAll(ctx, NewStreamAPI(str), w, progress); err != nil {
+		return err
+	}
+
+	return str.Finish()
+}
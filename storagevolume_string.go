@@ -0,0 +1,120 @@
+// Code generated by "enumgen -text VolWipeAlgDoD=dod storagevolume.go StorageVolumeType=VolType StorageVolumeResizeFlag=VolResize StorageVolumeWipeAlgorithm=VolWipeAlg StorageVolumeUploadFlag=VolUpload StorageVolumeDownloadFlag=VolDownload"; DO NOT EDIT.
+
+package libvirt
+
+// storageVolumeTypeNames holds the text form of the values of StorageVolumeType.
+var storageVolumeTypeNames = []enumName[StorageVolumeType]{
+	{VolTypeFile, "file"},
+	{VolTypeBlock, "block"},
+	{VolTypeDir, "dir"},
+	{VolTypeNetwork, "network"},
+	{VolTypeNetdir, "netdir"},
+}
+
+// String returns the text form of the value.
+func (v StorageVolumeType) String() string {
+	return formatEnum(v, storageVolumeTypeNames, "StorageVolumeType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeType) MarshalText() ([]byte, error) {
+	return marshalEnum(v, storageVolumeTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeType) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, storageVolumeTypeNames, "StorageVolumeType")
+}
+
+// storageVolumeResizeFlagNames holds the text form of the values of StorageVolumeResizeFlag.
+var storageVolumeResizeFlagNames = []enumName[StorageVolumeResizeFlag]{
+	{VolResizeDefault, "default"},
+	{VolResizeAllocate, "allocate"},
+	{VolResizeDelta, "delta"},
+	{VolResizeShrink, "shrink"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StorageVolumeResizeFlag) String() string {
+	return formatFlags(v, storageVolumeResizeFlagNames, "StorageVolumeResizeFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeResizeFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storageVolumeResizeFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeResizeFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storageVolumeResizeFlagNames, "StorageVolumeResizeFlag")
+}
+
+// storageVolumeWipeAlgorithmNames holds the text form of the values of StorageVolumeWipeAlgorithm.
+var storageVolumeWipeAlgorithmNames = []enumName[StorageVolumeWipeAlgorithm]{
+	{VolWipeAlgZero, "zero"},
+	{VolWipeAlgNNSA, "nnsa"},
+	{VolWipeAlgDoD, "dod"},
+	{VolWipeAlgBSI, "bsi"},
+	{VolWipeAlgGutmann, "gutmann"},
+	{VolWipeAlgSchneier, "schneier"},
+	{VolWipeAlgPfitzner7, "pfitzner7"},
+	{VolWipeAlgPfitzner33, "pfitzner33"},
+	{VolWipeAlgRandom, "random"},
+}
+
+// String returns the text form of the value.
+func (v StorageVolumeWipeAlgorithm) String() string {
+	return formatEnum(v, storageVolumeWipeAlgorithmNames, "StorageVolumeWipeAlgorithm")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeWipeAlgorithm) MarshalText() ([]byte, error) {
+	return marshalEnum(v, storageVolumeWipeAlgorithmNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeWipeAlgorithm) UnmarshalText(text []byte) error {
+	return unmarshalEnum(v, text, storageVolumeWipeAlgorithmNames, "StorageVolumeWipeAlgorithm")
+}
+
+// storageVolumeUploadFlagNames holds the text form of the values of StorageVolumeUploadFlag.
+var storageVolumeUploadFlagNames = []enumName[StorageVolumeUploadFlag]{
+	{VolUploadDefault, "default"},
+	{VolUploadSparseStream, "sparse_stream"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StorageVolumeUploadFlag) String() string {
+	return formatFlags(v, storageVolumeUploadFlagNames, "StorageVolumeUploadFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeUploadFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storageVolumeUploadFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeUploadFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storageVolumeUploadFlagNames, "StorageVolumeUploadFlag")
+}
+
+// storageVolumeDownloadFlagNames holds the text form of the values of StorageVolumeDownloadFlag.
+var storageVolumeDownloadFlagNames = []enumName[StorageVolumeDownloadFlag]{
+	{VolDownloadDefault, "default"},
+	{VolDownloadSparseStream, "sparse_stream"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StorageVolumeDownloadFlag) String() string {
+	return formatFlags(v, storageVolumeDownloadFlagNames, "StorageVolumeDownloadFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StorageVolumeDownloadFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, storageVolumeDownloadFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StorageVolumeDownloadFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, storageVolumeDownloadFlagNames, "StorageVolumeDownloadFlag")
+}
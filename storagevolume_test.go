@@ -2,7 +2,10 @@ package libvirt
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/cd1/utils-golang"
@@ -198,6 +201,111 @@ func TestStorageVolumeUploadDownload(t *testing.T) {
 	}
 }
 
+func TestStorageVolumeSparseUploadDownload(t *testing.T) {
+	env := newTestEnvironment(t).withStorageVolume()
+	defer env.cleanUp()
+
+	data := []byte(utils.RandomString())
+	holeSize := int64(streamChunkSize)
+
+	src, err := ioutil.TempFile("", "sparse-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+
+	// data, hole, data, trailing hole
+	if _, err = src.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = src.WriteAt(data, int64(len(data))+holeSize); err != nil {
+		t.Fatal(err)
+	}
+
+	size := 2*int64(len(data)) + 2*holeSize
+	if err = src.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = env.vol.Resize(uint64(size), VolResizeDefault); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = env.vol.UploadFrom(src, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempFile("", "sparse-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	// the previous content, longer than the volume, must be discarded
+	if _, err = dst.Write(bytes.Repeat([]byte{0xff}, int(size+holeSize))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = env.vol.DownloadTo(dst, 0, uint64(size)); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile(src.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected downloaded content; got %v bytes, want %v bytes", len(got), len(want))
+	}
+}
+
+func TestStorageVolumeUploadDownloadContext(t *testing.T) {
+	env := newTestEnvironment(t).withStorageVolume()
+	defer env.cleanUp()
+
+	data := utils.RandomString()
+	dataLen := uint64(len(data))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := env.vol.UploadFromReader(ctx, bytes.NewBufferString(data), 0, dataLen, nil); err != context.Canceled {
+		t.Errorf("unexpected error when uploading with a cancelled context; got=%v, want=%v", err, context.Canceled)
+	}
+
+	var uploaded uint64
+	progress := func(transferred uint64) {
+		uploaded = transferred
+	}
+
+	if err := env.vol.UploadFromReader(context.Background(), bytes.NewBufferString(data), 0, dataLen, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded != dataLen {
+		t.Errorf("unexpected upload progress; got=%v, want=%v", uploaded, dataLen)
+	}
+
+	var buf bytes.Buffer
+
+	if err := env.vol.DownloadToWriter(context.Background(), &buf, 0, dataLen, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if dl := buf.String(); dl != data {
+		t.Errorf("unexpected downloaded content; got=%v, want=%v", dl, data)
+	}
+}
+
 func BenchmarkStorageVolumeResize(b *testing.B) {
 	env := newTestEnvironment(b).withStorageVolume()
 	defer env.cleanUp()
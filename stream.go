@@ -2,10 +2,14 @@ package libvirt
 
 // #include <stdlib.h>
 // #include <libvirt/libvirt.h>
+// #include "callbacks.h"
 import "C"
 import (
+	"context"
+	"errors"
 	"io"
-	"log"
+	"runtime"
+	"sync"
 	"unsafe"
 )
 
@@ -18,10 +22,60 @@ const (
 	StrNonBlock StreamFlag = C.VIR_STREAM_NONBLOCK
 )
 
+// streamChunkSize is the size of the data chunks read from or written to a
+// stream by the high-level transfer functions.
+const streamChunkSize = 256 * 1024 // 256 KiB
+
+// TransferProgressFunc is called during a stream transfer with the total
+// number of bytes transferred so far.
+type TransferProgressFunc func(transferred uint64)
+
+// StreamRecvFlag defines how data should be received from a stream.
+type StreamRecvFlag uint32
+
+// Possible values for StreamRecvFlag.
+const (
+	StrRecvDefault    StreamRecvFlag = 0
+	StrRecvStopAtHole StreamRecvFlag = C.VIR_STREAM_RECV_STOP_AT_HOLE
+)
+
+// StreamEventType defines the events which can happen on a stream.
+type StreamEventType uint32
+
+// Possible values for StreamEventType.
+const (
+	StrEventReadable StreamEventType = C.VIR_STREAM_EVENT_READABLE
+	StrEventWritable StreamEventType = C.VIR_STREAM_EVENT_WRITABLE
+	StrEventError    StreamEventType = C.VIR_STREAM_EVENT_ERROR
+	StrEventHangup   StreamEventType = C.VIR_STREAM_EVENT_HANGUP
+)
+
+// StreamEventCallback is called when one of the events it was registered
+// for happens on the stream. "events" may contain more than one event.
+type StreamEventCallback func(str Stream, events StreamEventType)
+
+// streamCallback is the data registered for each stream event callback.
+type streamCallback struct {
+	log      *logger
+	callback StreamEventCallback
+}
+
+// ErrStreamWouldBlock is returned when reading from or writing to a
+// non-blocking stream (see StrNonBlock) would block. The operation should be
+// retried later, e.g. after the event registered with AddEventCallback
+// happens.
+var ErrStreamWouldBlock = errors.New("libvirt stream operation would block")
+
+// ErrStreamHole is returned by "<Stream>.RecvFlags" when StrRecvStopAtHole is
+// used and the stream has reached a hole. The hole size can then be read with
+// "<Stream>.RecvHole".
+var ErrStreamHole = errors.New("libvirt stream reached a hole")
+
 // Stream holds a libvirt stream. There are no exported fields.
 type Stream struct {
-	log       *log.Logger
+	log       *logger
 	virStream C.virStreamPtr
+	handle    *handle
 }
 
 // Free decrements the reference count on a stream, releasing the stream object
@@ -30,17 +84,22 @@ type Stream struct {
 // stream. If a stream needs to be disposed of prior to end of stream being
 // reached, then the Abort function should be called first.
 func (str Stream) Free() error {
-	str.log.Println("freeing stream object...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("freeing stream object")
 	cRet := C.virStreamFree(str.virStream)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	str.log.Println("stream freed")
+	str.handle.release()
+	op.done("stream freed")
 
 	return nil
 }
@@ -51,17 +110,21 @@ func (str Stream) Free() error {
 // input streams this can be used to inform the driver that it should stop
 // sending data.
 func (str Stream) Abort() error {
-	str.log.Println("aborting stream...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("aborting stream")
 	cRet := C.virStreamAbort(str.virStream)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	str.log.Println("stream aborted")
+	op.done("stream aborted")
 
 	return nil
 }
@@ -74,17 +137,21 @@ func (str Stream) Abort() error {
 // this returns a success code the application can be sure that all data has
 // been successfully processed.
 func (str Stream) Finish() error {
-	str.log.Println("finishing stream...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("finishing stream")
 	cRet := C.virStreamFinish(str.virStream)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	str.log.Println("stream finished")
+	op.done("stream finished")
 
 	return nil
 }
@@ -94,23 +161,30 @@ func (str Stream) Finish() error {
 // reference count, once the caller no longer needs the reference to this
 // object.
 func (str Stream) Ref() error {
-	str.log.Println("incrementing stream's reference count...")
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("incrementing stream's reference count")
 	cRet := C.virStreamRef(str.virStream)
 	ret := int32(cRet)
 
 	if ret == -1 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return err
 	}
 
-	str.log.Println("reference count incremented")
+	str.handle.ref()
+	op.done("reference count incremented")
 
 	return nil
 }
 
 // Write writes a series of bytes to the stream. This method may block the
-// calling application for an arbitrary amount of time. Once an application has
+// calling application for an arbitrary amount of time; if the stream is
+// non-blocking and no data can be sent right now, ErrStreamWouldBlock
+// is returned. Once an application has
 // finished sending data it should call Finish to wait for successful
 // confirmation from the driver, or detect any error.
 // This method may not be used if a stream source has been registered.
@@ -118,59 +192,427 @@ func (str Stream) Ref() error {
 // instead be delayed until a subsequent call.
 // This function is equivalent to the libvirt function "Send" but it has been
 // renamed to "Write" in order to implement the standard interface io.Writer.
+// The data is passed to libvirt directly, without being copied.
 func (str Stream) Write(data []byte) (int, error) {
-	cData := C.CString(string(data))
-	defer C.free(unsafe.Pointer(cData))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
 
 	l := len(data)
 
-	str.log.Printf("sending %v bytes to stream...\n", l)
-	cRet := C.virStreamSend(str.virStream, cData, C.size_t(l))
+	op := str.log.begin("sending data to stream", "bytes", l)
+	cRet := C.virStreamSend(str.virStream, bytesPointer(data), C.size_t(l))
 	ret := int32(cRet)
 
+	if ret == -2 {
+		op.done("sending data would block")
+		return 0, ErrStreamWouldBlock
+	}
+
 	if ret < 0 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	str.log.Printf("%v bytes sent\n", ret)
+	op.done("data sent", "bytes", ret)
 
 	return int(ret), nil
 }
 
+// WriteContext sends data to the stream, like Write, but aborts the stream (see
+// Abort) and returns ctx.Err() if the context is done before the data is sent.
+// The stream can't be used anymore after it's aborted.
+func (str Stream) WriteContext(ctx context.Context, data []byte) (int, error) {
+	var n int
+	err := callContext(ctx, func() error {
+		var err error
+		n, err = str.Write(data)
+		return err
+	}, str.Abort)
+
+	return n, err
+}
+
 // Read reads a series of bytes from the stream. This method may block the
-// calling application for an arbitrary amount of time.
+// calling application for an arbitrary amount of time; if the stream is
+// non-blocking and no data is available right now, ErrStreamWouldBlock
+// is returned.
 // Errors are not guaranteed to be reported synchronously with the call, but may
 // instead be delayed until a subsequent call.
 // This function is equivalent to the libvirt function "Recv" but it has been
 // renamed to "Read" in order to implement the standard interface io.Reader. And
 // due to that interface requirement, this function now returns (0, io.EOF)
 // instead of (0, nil) when there's nothing left to be read from the stream.
+// The data is received by libvirt directly into "data", without being copied.
 func (str Stream) Read(data []byte) (int, error) {
-	dataLen := len(data)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
 
-	cData := (*C.char)(C.malloc(C.size_t(dataLen)))
-	defer C.free(unsafe.Pointer(cData))
+	dataLen := len(data)
 
-	str.log.Printf("receiving %v bytes from stream...\n", dataLen)
-	cRet := C.virStreamRecv(str.virStream, (*C.char)(unsafe.Pointer(cData)), C.size_t(dataLen))
+	op := str.log.begin("receiving data from stream", "bytes", dataLen)
+	cRet := C.virStreamRecv(str.virStream, bytesPointer(data), C.size_t(dataLen))
 	ret := int32(cRet)
 
+	if ret == -2 {
+		op.done("receiving data would block")
+		return 0, ErrStreamWouldBlock
+	}
+
 	if ret < 0 {
-		err := LastError()
-		str.log.Printf("an error occurred: %v\n", err)
+		err := lastError()
+		op.failed(err)
 		return 0, err
 	}
 
-	str.log.Printf("%v bytes received\n", ret)
+	op.done("data received", "bytes", ret)
 
 	if ret == 0 && dataLen > 0 {
 		return 0, io.EOF
 	}
 
-	newData := C.GoStringN(cData, cRet)
-	copy(data, newData)
+	return int(ret), nil
+}
+
+// ReadContext receives data from the stream, like Read, but aborts the stream
+// (see Abort) and returns ctx.Err() if the context is done before any data is
+// received. The stream can't be used anymore after it's aborted.
+func (str Stream) ReadContext(ctx context.Context, data []byte) (int, error) {
+	var n int
+	err := callContext(ctx, func() error {
+		var err error
+		n, err = str.Read(data)
+		return err
+	}, str.Abort)
+
+	return n, err
+}
+
+// RecvFlags reads a series of bytes from the stream, just like Read, but
+// allows the caller to change how the data is received. If "flags" contains
+// StrRecvStopAtHole and the stream is positioned at a hole, this function
+// returns (0, ErrStreamHole) and the hole size should be read with RecvHole
+// before receiving more data. This only makes sense on streams set up for
+// sparse transfers (e.g. VolDownloadSparseStream).
+func (str Stream) RecvFlags(data []byte, flags StreamRecvFlag) (int, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	dataLen := len(data)
+
+	op := str.log.begin("receiving data from stream", "bytes", dataLen, "flags", flags)
+	cRet := C.virStreamRecvFlags(str.virStream, bytesPointer(data), C.size_t(dataLen), C.uint(flags))
+	ret := int32(cRet)
+
+	if ret == -2 {
+		op.done("receiving data would block")
+		return 0, ErrStreamWouldBlock
+	}
+
+	if ret == -3 {
+		op.done("hole reached")
+		return 0, ErrStreamHole
+	}
+
+	if ret < 0 {
+		err := lastError()
+		op.failed(err)
+		return 0, err
+	}
+
+	op.done("data received", "bytes", ret)
+
+	if ret == 0 && dataLen > 0 {
+		return 0, io.EOF
+	}
 
 	return int(ret), nil
 }
+
+// RecvHole reads the size of the hole the stream is currently positioned at.
+// This function should be called after RecvFlags returns ErrStreamHole.
+func (str Stream) RecvHole() (int64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	var cLength C.longlong
+
+	op := str.log.begin("receiving hole from stream")
+	cRet := C.virStreamRecvHole(str.virStream, &cLength, 0)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return 0, err
+	}
+
+	length := int64(cLength)
+	op.done("hole received", "bytes", length)
+
+	return length, nil
+}
+
+// SendHole sends a hole of "length" bytes to the stream. Instead of sending
+// that many zero bytes with Write, only the size of the hole is transferred
+// and the other side recreates it. This only makes sense on streams set up for
+// sparse transfers (e.g. VolUploadSparseStream).
+func (str Stream) SendHole(length int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("sending hole to stream", "bytes", length)
+	cRet := C.virStreamSendHole(str.virStream, C.longlong(length), 0)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("hole sent")
+
+	return nil
+}
+
+// AddEventCallback registers a callback to be notified when the stream becomes
+// readable or writable, or when an error or a hangup happens. Only one
+// callback can be registered for each stream. The callback is called from the
+// event loop, so an event implementation must have been registered (e.g. with
+// EventRegisterDefaultImpl) and must be running.
+// This is mostly useful for non-blocking streams (see StrNonBlock), which
+// should only be read from or written to when the appropriate event happens.
+func (str Stream) AddEventCallback(events StreamEventType, callback StreamEventCallback) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	callbackID := registerCallback(streamCallback{
+		log:      str.log,
+		callback: callback,
+	})
+
+	op := str.log.begin("adding stream event callback", "events", events)
+	cRet := C.streamEventAddCallbackWrapper(str.virStream, C.int(events), C.long(callbackID))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		unregisterCallback(callbackID)
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("event callback added")
+
+	return nil
+}
+
+// UpdateEventCallback changes the set of events monitored by the callback
+// previously registered with AddEventCallback.
+func (str Stream) UpdateEventCallback(events StreamEventType) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("updating stream event callback", "events", events)
+	cRet := C.virStreamEventUpdateCallback(str.virStream, C.int(events))
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("event callback updated")
+
+	return nil
+}
+
+// RemoveEventCallback removes the callback previously registered with
+// AddEventCallback. The callback won't be called anymore after this function
+// returns successfully.
+func (str Stream) RemoveEventCallback() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer runtime.KeepAlive(str.handle)
+
+	op := str.log.begin("removing stream event callback")
+	cRet := C.virStreamEventRemoveCallback(str.virStream)
+	ret := int32(cRet)
+
+	if ret == -1 {
+		err := lastError()
+		op.failed(err)
+		return err
+	}
+
+	op.done("event callback removed")
+
+	return nil
+}
+
+//export streamEventCallback
+func streamEventCallback(cStream C.virStreamPtr, cEvents C.int, callbackID C.long) {
+	data, ok := lookupCallback(int64(callbackID)).(streamCallback)
+	if !ok {
+		return
+	}
+
+	str := Stream{
+		log:       data.log,
+		virStream: cStream,
+	}
+
+	data.callback(str, StreamEventType(cEvents))
+}
+
+// bytesPointer returns a C pointer to the first byte of "data", or nil if it's
+// empty. Go memory can be passed to C this way because a byte slice doesn't
+// contain Go pointers and libvirt doesn't keep the pointer after the call
+// returns; the memory stays pinned while the C function runs.
+func bytesPointer(data []byte) *C.char {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return (*C.char)(unsafe.Pointer(&data[0]))
+}
+
+// streamBuffers holds the chunk buffers used by the high-level transfer
+// functions, so they're not reallocated on every transfer.
+var streamBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, streamChunkSize)
+		return &buf
+	},
+}
+
+// SendAll reads "r" until its end and sends the data to the stream "str" in
+// chunks, like virStreamSendAll. If "progress" is not nil, it's called after
+// each chunk with the total number of bytes sent so far.
+// The transfer runs until it ends or the context is done; in the latter case,
+// the stream is aborted, which also interrupts a send blocked on a stalled
+// peer, and ctx.Err() is returned. The stream is aborted as well if an error
+// happens; otherwise, it must still be finished by the caller.
+func SendAll(ctx context.Context, str StreamAPI, r io.Reader, progress TransferProgressFunc) error {
+	return transferContext(ctx, str, func() error {
+		return sendAll(ctx, str, r, progress)
+	})
+}
+
+// transferContext runs the transfer "call" on the stream "str" until it
+// returns or the context is done, like callContext. If the transfer fails, the
+// stream is aborted exactly once: either by callContext, to interrupt "call"
+// when the context is done, or afterwards.
+func transferContext(ctx context.Context, str StreamAPI, call func() error) error {
+	var aborted bool
+
+	err := callContext(ctx, call, func() error {
+		if err := str.Abort(); err != nil {
+			return err
+		}
+
+		aborted = true
+		return nil
+	})
+	if err != nil && !aborted {
+		str.Abort()
+	}
+
+	return err
+}
+
+// sendAll is the transfer loop of SendAll. The context is checked between
+// chunks, so the loop stops when the stream was aborted because of it.
+func sendAll(ctx context.Context, str StreamAPI, r io.Reader, progress TransferProgressFunc) error {
+	bufPtr := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufPtr)
+	buf := *bufPtr
+
+	var total uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+
+		for sent := 0; sent < n; {
+			w, err := str.Write(buf[sent:n])
+			if err != nil {
+				return err
+			}
+
+			sent += w
+			total += uint64(w)
+		}
+
+		if n > 0 && progress != nil {
+			progress(total)
+		}
+
+		if readErr != nil {
+			return nil
+		}
+	}
+}
+
+// RecvAll receives data from the stream "str" in chunks until its end and
+// writes it to "w", like virStreamRecvAll. If "progress" is not nil, it's
+// called after each chunk with the total number of bytes received so far.
+// The transfer runs until it ends or the context is done; in the latter case,
+// the stream is aborted, which also interrupts a receive blocked on a stalled
+// peer, and ctx.Err() is returned. The stream is aborted as well if an error
+// happens; otherwise, it must still be finished by the caller.
+func RecvAll(ctx context.Context, str StreamAPI, w io.Writer, progress TransferProgressFunc) error {
+	return transferContext(ctx, str, func() error {
+		return recvAll(ctx, str, w, progress)
+	})
+}
+
+// recvAll is the transfer loop of RecvAll. The context is checked between
+// chunks, so the loop stops when the stream was aborted because of it.
+func recvAll(ctx context.Context, str StreamAPI, w io.Writer, progress TransferProgressFunc) error {
+	bufPtr := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufPtr)
+	buf := *bufPtr
+
+	var total uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := str.Read(buf)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = w.Write(buf[:n]); err != nil {
+			return err
+		}
+
+		total += uint64(n)
+
+		if progress != nil {
+			progress(total)
+		}
+	}
+}
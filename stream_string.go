@@ -0,0 +1,68 @@
+// Code generated by "enumgen -flags StreamEventType stream.go StreamFlag=Str StreamRecvFlag=StrRecv StreamEventType=StrEvent"; DO NOT EDIT.
+
+package libvirt
+
+// streamFlagNames holds the text form of the values of StreamFlag.
+var streamFlagNames = []enumName[StreamFlag]{
+	{StrDefault, "default"},
+	{StrNonBlock, "non_block"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StreamFlag) String() string {
+	return formatFlags(v, streamFlagNames, "StreamFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StreamFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, streamFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StreamFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, streamFlagNames, "StreamFlag")
+}
+
+// streamRecvFlagNames holds the text form of the values of StreamRecvFlag.
+var streamRecvFlagNames = []enumName[StreamRecvFlag]{
+	{StrRecvDefault, "default"},
+	{StrRecvStopAtHole, "stop_at_hole"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StreamRecvFlag) String() string {
+	return formatFlags(v, streamRecvFlagNames, "StreamRecvFlag")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StreamRecvFlag) MarshalText() ([]byte, error) {
+	return marshalFlags(v, streamRecvFlagNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StreamRecvFlag) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, streamRecvFlagNames, "StreamRecvFlag")
+}
+
+// streamEventTypeNames holds the text form of the values of StreamEventType.
+var streamEventTypeNames = []enumName[StreamEventType]{
+	{StrEventReadable, "readable"},
+	{StrEventWritable, "writable"},
+	{StrEventError, "error"},
+	{StrEventHangup, "hangup"},
+}
+
+// String returns the text form of the set of flags, e.g. "a|b".
+func (v StreamEventType) String() string {
+	return formatFlags(v, streamEventTypeNames, "StreamEventType")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v StreamEventType) MarshalText() ([]byte, error) {
+	return marshalFlags(v, streamEventTypeNames)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *StreamEventType) UnmarshalText(text []byte) error {
+	return unmarshalFlags(v, text, streamEventTypeNames, "StreamEventType")
+}
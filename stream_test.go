@@ -1,7 +1,14 @@
 package libvirt
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
 	"testing"
+	"time"
+
+	"github.com/cd1/utils-golang"
 )
 
 func TestStreamAbort(t *testing.T) {
@@ -25,3 +32,132 @@ func TestStreamRef(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestStreamNonBlockEventCallback(t *testing.T) {
+	env := newTestEnvironment(t).withStorageVolume()
+	defer env.cleanUp()
+
+	data := utils.RandomString()
+
+	upload, err := env.conn.NewStream(StrDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upload.Free()
+
+	if err = env.vol.Upload(upload, 0, uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = io.Copy(upload, bytes.NewBufferString(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = upload.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	str, err := env.conn.NewStream(StrNonBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer str.Free()
+
+	if err = env.vol.Download(str, 0, uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+
+	err = str.AddEventCallback(StrEventReadable|StrEventError|StrEventHangup, func(s Stream, events StreamEventType) {
+		if events&(StrEventError|StrEventHangup) != 0 {
+			done <- s.Abort()
+			return
+		}
+
+		chunk := make([]byte, 1024)
+		for {
+			n, err := s.Read(chunk)
+			if err == ErrStreamWouldBlock {
+				return
+			}
+
+			if err == io.EOF {
+				s.RemoveEventCallback()
+				done <- s.Finish()
+				return
+			}
+
+			if err != nil {
+				s.RemoveEventCallback()
+				done <- err
+				return
+			}
+
+			buf.Write(chunk[:n])
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		str.RemoveEventCallback()
+		t.Fatal("timeout while waiting for the stream events")
+	}
+
+	if dl := buf.String(); dl != data {
+		t.Errorf("unexpected downloaded content; got=%v, want=%v", dl, data)
+	}
+}
+
+// benchmarkStreamDataSize is the amount of data transferred on each iteration
+// of the stream benchmarks.
+const benchmarkStreamDataSize = 64 * 1024 * 1024 // 64 MiB
+
+func BenchmarkStreamUpload(b *testing.B) {
+	env := newTestEnvironment(b).withStorageVolume()
+	defer env.cleanUp()
+
+	if err := env.vol.Resize(benchmarkStreamDataSize, VolResizeDefault); err != nil {
+		b.Fatal(err)
+	}
+
+	data := make([]byte, benchmarkStreamDataSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	b.SetBytes(benchmarkStreamDataSize)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := env.vol.UploadFromReader(context.Background(), bytes.NewReader(data), 0, benchmarkStreamDataSize, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+}
+
+func BenchmarkStreamDownload(b *testing.B) {
+	env := newTestEnvironment(b).withStorageVolume()
+	defer env.cleanUp()
+
+	if err := env.vol.Resize(benchmarkStreamDataSize, VolResizeDefault); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(benchmarkStreamDataSize)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := env.vol.DownloadToWriter(context.Background(), ioutil.Discard, 0, benchmarkStreamDataSize, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+}
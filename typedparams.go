@@ -0,0 +1,72 @@
+package libvirt
+
+// #include <stdlib.h>
+// #include <libvirt/libvirt.h>
+import "C"
+import (
+	"unsafe"
+)
+
+// typedParams holds a list of typed parameters returned by libvirt. It should
+// be released with free.
+type typedParams struct {
+	params  C.virTypedParameterPtr
+	nparams C.int
+}
+
+// free releases the memory used by the typed parameters.
+func (tp typedParams) free() {
+	C.virTypedParamsFree(tp.params, tp.nparams)
+}
+
+// getInt returns the value of the parameter "name" as an int32, and whether
+// it was found.
+func (tp typedParams) getInt(name string) (int32, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var cValue C.int
+	cRet := C.virTypedParamsGetInt(tp.params, tp.nparams, cName, &cValue)
+
+	return int32(cValue), int32(cRet) == 1
+}
+
+// getUint64 returns the value of the parameter "name" as an uint64, and whether
+// it was found.
+func (tp typedParams) getUint64(name string) (uint64, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var cValue C.ulonglong
+	cRet := C.virTypedParamsGetULLong(tp.params, tp.nparams, cName, &cValue)
+
+	return uint64(cValue), int32(cRet) == 1
+}
+
+// getBool returns the value of the parameter "name" as a bool, and whether
+// it was found.
+func (tp typedParams) getBool(name string) (bool, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var cValue C.int
+	cRet := C.virTypedParamsGetBoolean(tp.params, tp.nparams, cName, &cValue)
+
+	return cValue != 0, int32(cRet) == 1
+}
+
+// getString returns the value of the parameter "name" as a string, and whether
+// it was found.
+func (tp typedParams) getString(name string) (string, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var cValue *C.char
+	cRet := C.virTypedParamsGetString(tp.params, tp.nparams, cName, &cValue)
+
+	if int32(cRet) != 1 {
+		return "", false
+	}
+
+	return C.GoString(cValue), true
+}